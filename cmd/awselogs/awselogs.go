@@ -15,10 +15,10 @@
 package awselogs
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
-	"strings"
 
 	local "github.com/dremio/dremio-diagnostic-collector/cmd/local"
 	"github.com/dremio/dremio-diagnostic-collector/cmd/local/conf"
@@ -95,7 +95,7 @@ func Execute(efsLogDir string, outDir string, outFile string) error {
 	overrides[conf.KeyDremioGCLogsDir] = filepath.Join(efsLogDir, coordinatorNode)
 	overrides[conf.KeyDremioLogDir] = filepath.Join(efsLogDir, coordinatorNode)
 
-	if _, err := local.Execute([]string{}, overrides); err != nil {
+	if _, err := local.Execute(context.Background(), []string{}, overrides); err != nil {
 		return fmt.Errorf("unable to collect entry %v due to error %w", coordinatorNode, err)
 	}
 	for _, entry := range entries {
@@ -119,7 +119,7 @@ func Execute(efsLogDir string, outDir string, outFile string) error {
 		overrides[conf.KeyDremioGCLogsDir] = filepath.Join(efsLogDir, "executor", entry.Name())
 		overrides[conf.KeyDremioLogDir] = filepath.Join(efsLogDir, "executor", entry.Name())
 
-		if _, err := local.Execute([]string{}, overrides); err != nil {
+		if _, err := local.Execute(context.Background(), []string{}, overrides); err != nil {
 			return fmt.Errorf("unable to collect entry %v due to error %w", entry.Name(), err)
 		}
 	}
@@ -132,24 +132,31 @@ func Execute(efsLogDir string, outDir string, outFile string) error {
 		return fmt.Errorf("nothing captured or found in %v", outDir)
 	}
 	for _, e := range outDirEntries {
-		if strings.HasSuffix(e.Name(), ".tar.gz") {
+		if archive.IsArchive(e.Name()) {
 			tgzLoc := filepath.Join(outDir, e.Name())
+			volumes, err := archive.Volumes(tgzLoc)
+			if err != nil {
+				simplelog.Errorf("unable to find volumes of %v due to error %v", tgzLoc, err)
+				continue
+			}
 			if err := collection.ExtractTarGz(tgzLoc, outDir); err != nil {
 				simplelog.Errorf("unable to extract tarball %v due to error %v", tgzLoc, err)
 				continue
 			}
-			if err := os.Remove(tgzLoc); err != nil {
-				simplelog.Errorf("unable to remove tgz %v due to error: %v", tgzLoc, err)
-				continue
+			for _, v := range volumes {
+				if err := os.Remove(v); err != nil {
+					simplelog.Errorf("unable to remove tgz %v due to error: %v", v, err)
+				}
 			}
 		}
 	}
 	simplelog.Infof("archive folder '%v' into '%v'", outDir, outFile)
-	return archive.TarGzDir(outDir, outFile)
+	_, err = archive.ArchiveDir(outDir, outFile, archive.Options{Format: archive.FormatFromName(outFile)})
+	return err
 }
 
 func init() {
 	AWSELogsCmd.Flags().StringVar(&EFSLogDir, "efs-log-dir", "/var/dremio_efs/log/", "location to search for log folders in EFS")
 	AWSELogsCmd.Flags().StringVar(&OutDir, "tmp-out-dir", "/tmp/ddc-awse", "output location for files")
-	AWSELogsCmd.Flags().StringVar(&OutFile, "out-file", "diag.tgz", "output file")
+	AWSELogsCmd.Flags().StringVar(&OutFile, "out-file", "diag.tgz", "output file, written as tar.gz, tar.zst or zip depending on the extension")
 }
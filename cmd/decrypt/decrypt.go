@@ -0,0 +1,96 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// package decrypt provides the ddc decrypt command that reads archives written with --encrypt-to
+package decrypt
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/dremio/dremio-diagnostic-collector/pkg/encrypt"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/masking"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/simplelog"
+	"github.com/spf13/cobra"
+)
+
+var identityFile string
+var outputFile string
+
+var DecryptCmd = &cobra.Command{
+	Use:   "decrypt <file.age>...",
+	Short: "Decrypt archives and node tarballs written with --encrypt-to",
+	Long: `Decrypt archives and node tarballs written with --encrypt-to using an age identity or the ssh private key matching one of the recipients.
+Each file is written next to it without the .age suffix, for example diag.tgz.age becomes diag.tgz. Pass every volume of a split archive.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		simplelog.LogStartMessage()
+		defer simplelog.LogEndMessage()
+		files, err := Execute(args, identityFile, outputFile)
+		for _, f := range files {
+			fmt.Printf("decrypted %v\n", f)
+		}
+		if err != nil {
+			simplelog.Errorf("exiting %v", err)
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	},
+}
+
+// Execute decrypts every file and returns the files written, output is only allowed for a single file
+func Execute(files []string, identity, output string) ([]string, error) {
+	if identity == "" {
+		return nil, errors.New("--identity is required")
+	}
+	if output != "" && len(files) > 1 {
+		return nil, errors.New("--output can only be used when decrypting a single file")
+	}
+	identities, err := encrypt.LoadIdentities(identity, passphrase(identity))
+	if err != nil {
+		return nil, err
+	}
+	var written []string
+	for _, f := range files {
+		dest := output
+		if dest == "" {
+			dest = encrypt.DecryptedName(f)
+		}
+		if err := encrypt.Decrypt(f, dest, identities); err != nil {
+			return written, err
+		}
+		simplelog.Infof("decrypted %v to %v", f, dest)
+		written = append(written, dest)
+	}
+	return written, nil
+}
+
+func passphrase(identity string) func() ([]byte, error) {
+	return func() ([]byte, error) {
+		if pass := os.Getenv(encrypt.IdentityPassphraseEnv); pass != "" {
+			return []byte(pass), nil
+		}
+		pass, err := masking.PromptForSecret(fmt.Sprintf("Enter passphrase for %v", identity))
+		if err != nil {
+			return nil, err
+		}
+		return []byte(pass), nil
+	}
+}
+
+func init() {
+	DecryptCmd.Flags().StringVarP(&identityFile, "identity", "i", "", "age identity file (AGE-SECRET-KEY-...) or ssh private key, the passphrase of an encrypted ssh key is read from "+encrypt.IdentityPassphraseEnv+" or prompted for")
+	DecryptCmd.Flags().StringVarP(&outputFile, "output", "o", "", "where to write the decrypted file, only for a single file, defaults to the file name without .age")
+}
@@ -0,0 +1,559 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// package diff provides the ddc diff command that compares two diagnostic bundles of the same cluster
+package diff
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dremio/dremio-diagnostic-collector/cmd/inspect"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/simplelog"
+	"github.com/spf13/cobra"
+)
+
+var jsonOutput bool
+
+var DiffCmd = &cobra.Command{
+	Use:   "diff <before> <after>",
+	Short: "Compare two diagnostic bundles of the same cluster",
+	Long: `Compare two diagnostic bundles of the same cluster, for example a good and a bad collection, without extracting them.
+Reports added and removed nodes, Dremio version changes, changes to dremio.conf, dremio-env, logback.xml and logback-access.xml
+per node, JVM flag changes, WLM queue and rule changes and system table row count deltas as Markdown or json.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		simplelog.LogStartMessage()
+		defer simplelog.LogEndMessage()
+		result, err := Diff(args[0], args[1])
+		if err == nil {
+			if jsonOutput {
+				err = printJSON(os.Stdout, result)
+			} else {
+				err = Markdown(os.Stdout, result)
+			}
+		}
+		if err != nil {
+			simplelog.Errorf("exiting %v", err)
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	},
+}
+
+// configFiles are the files of configuration/<node> that are compared line by line
+var configFiles = map[string]bool{
+	"dremio.conf":        true,
+	"dremio-env":         true,
+	"logback.xml":        true,
+	"logback-access.xml": true,
+}
+
+// maxConfigBytes keeps a huge file from being loaded to compare it
+const maxConfigBytes = 1024 * 1024
+
+// Bundle is one side of the comparison
+type Bundle struct {
+	File         string    `json:"file"`
+	DDCVersion   string    `json:"ddcVersion,omitempty"`
+	StartTimeUTC time.Time `json:"startTimeUTC"`
+	ClusterIDs   []string  `json:"clusterIDs"`
+}
+
+// Change is a value that is different between the bundles, empty when it is missing on one side
+type Change struct {
+	Name   string `json:"name"`
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+// FileDiff holds the removed (-) and added (+) lines of a configuration file of a node
+type FileDiff struct {
+	Node  string   `json:"node"`
+	File  string   `json:"file"`
+	Lines []string `json:"lines"`
+}
+
+// FlagDiff holds the JVM flags of a node that were added, removed or given another value
+type FlagDiff struct {
+	Node    string   `json:"node"`
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+	Changed []Change `json:"changed,omitempty"`
+}
+
+// WLMChange is a queue or rule that was added, removed or changed
+type WLMChange struct {
+	File   string   `json:"file"`
+	Name   string   `json:"name"`
+	Change string   `json:"change"`
+	Fields []string `json:"fields,omitempty"`
+}
+
+// RowCount is the number of rows of a system table, nil when the table was not exported
+type RowCount struct {
+	Table  string `json:"table"`
+	Before *int64 `json:"before"`
+	After  *int64 `json:"after"`
+}
+
+// Delta is After - Before, 0 when the table is only in one bundle
+func (r RowCount) Delta() int64 {
+	if r.Before == nil || r.After == nil {
+		return 0
+	}
+	return *r.After - *r.Before
+}
+
+type Result struct {
+	Before       Bundle      `json:"before"`
+	After        Bundle      `json:"after"`
+	AddedNodes   []string    `json:"addedNodes,omitempty"`
+	RemovedNodes []string    `json:"removedNodes,omitempty"`
+	Versions     []Change    `json:"versionChanges,omitempty"`
+	Config       []FileDiff  `json:"configChanges,omitempty"`
+	JVMFlags     []FlagDiff  `json:"jvmFlagChanges,omitempty"`
+	WLM          []WLMChange `json:"wlmChanges,omitempty"`
+	RowCounts    []RowCount  `json:"systemTableRowCounts,omitempty"`
+}
+
+// Empty is true when nothing that is compared changed
+func (r Result) Empty() bool {
+	return len(r.AddedNodes)+len(r.RemovedNodes)+len(r.Versions)+len(r.Config)+len(r.JVMFlags)+len(r.WLM)+len(r.RowCounts) == 0
+}
+
+// contents are the files of a bundle that are compared
+type contents struct {
+	bundle   inspect.Bundle
+	config   map[string]map[string]string
+	jvmFlags map[string]string
+	wlm      map[string][]byte
+	rows     map[string]int64
+}
+
+// Diff reads each bundle once and compares them
+func Diff(before, after string) (Result, error) {
+	b, err := read(before)
+	if err != nil {
+		return Result{}, err
+	}
+	a, err := read(after)
+	if err != nil {
+		return Result{}, err
+	}
+	result := Result{Before: side(b.bundle), After: side(a.bundle)}
+
+	beforeNodes := make(map[string]inspect.Node)
+	for _, n := range b.bundle.Nodes {
+		beforeNodes[n.Name] = n
+	}
+	afterNodes := make(map[string]inspect.Node)
+	for _, n := range a.bundle.Nodes {
+		afterNodes[n.Name] = n
+		if _, ok := beforeNodes[n.Name]; !ok {
+			result.AddedNodes = append(result.AddedNodes, n.Name)
+		}
+	}
+	var common []string
+	for _, n := range b.bundle.Nodes {
+		if _, ok := afterNodes[n.Name]; !ok {
+			result.RemovedNodes = append(result.RemovedNodes, n.Name)
+			continue
+		}
+		common = append(common, n.Name)
+	}
+
+	for _, n := range common {
+		if v1, v2 := beforeNodes[n].DremioVersion, afterNodes[n].DremioVersion; v1 != v2 {
+			result.Versions = append(result.Versions, Change{Name: n, Before: v1, After: v2})
+		}
+		var files []string
+		for f := range union(b.config[n], a.config[n]) {
+			files = append(files, f)
+		}
+		sort.Strings(files)
+		for _, f := range files {
+			if lines := lineDiff(b.config[n][f], a.config[n][f]); len(lines) > 0 {
+				result.Config = append(result.Config, FileDiff{Node: n, File: f, Lines: lines})
+			}
+		}
+		if flags := flagDiff(n, b.jvmFlags[n], a.jvmFlags[n]); len(flags.Added)+len(flags.Removed)+len(flags.Changed) > 0 {
+			result.JVMFlags = append(result.JVMFlags, flags)
+		}
+	}
+
+	var wlmFiles []string
+	for f := range b.wlm {
+		wlmFiles = append(wlmFiles, f)
+	}
+	for f := range a.wlm {
+		if _, ok := b.wlm[f]; !ok {
+			wlmFiles = append(wlmFiles, f)
+		}
+	}
+	sort.Strings(wlmFiles)
+	for _, f := range wlmFiles {
+		changes, err := wlmDiff(f, b.wlm[f], a.wlm[f])
+		if err != nil {
+			simplelog.Warningf("unable to compare wlm %v: %v", f, err)
+			continue
+		}
+		result.WLM = append(result.WLM, changes...)
+	}
+
+	var tables []string
+	for t := range b.rows {
+		tables = append(tables, t)
+	}
+	for t := range a.rows {
+		if _, ok := b.rows[t]; !ok {
+			tables = append(tables, t)
+		}
+	}
+	sort.Strings(tables)
+	for _, t := range tables {
+		r := RowCount{Table: t}
+		if v, ok := b.rows[t]; ok {
+			r.Before = &v
+		}
+		if v, ok := a.rows[t]; ok {
+			r.After = &v
+		}
+		if r.Before == nil || r.After == nil || r.Delta() != 0 {
+			result.RowCounts = append(result.RowCounts, r)
+		}
+	}
+	return result, nil
+}
+
+func side(b inspect.Bundle) Bundle {
+	return Bundle{File: b.File, DDCVersion: b.DDCVersion, StartTimeUTC: b.StartTimeUTC, ClusterIDs: b.ClusterIDs}
+}
+
+func read(bundle string) (*contents, error) {
+	c := &contents{
+		config:   make(map[string]map[string]string),
+		jvmFlags: make(map[string]string),
+		wlm:      make(map[string][]byte),
+		rows:     make(map[string]int64),
+	}
+	b, err := inspect.Read(bundle, c.visit)
+	if err != nil {
+		return nil, err
+	}
+	c.bundle = b
+	return c, nil
+}
+
+// visit keeps the files that are compared, they are found by the last three parts of their path
+// which is <collector>/<node>/<file> in the layout documented on CopyStrategyHC
+func (c *contents) visit(name string, r io.Reader) error {
+	segments := strings.Split(name, "/")
+	if len(segments) < 3 {
+		return nil
+	}
+	dir, node, file := segments[len(segments)-3], segments[len(segments)-2], segments[len(segments)-1]
+	switch {
+	case dir == "configuration" && configFiles[file]:
+		b, err := io.ReadAll(io.LimitReader(r, maxConfigBytes))
+		if err != nil {
+			return err
+		}
+		if c.config[node] == nil {
+			c.config[node] = make(map[string]string)
+		}
+		c.config[node][file] = string(b)
+	case dir == "node-info" && file == "jvm_settings.txt":
+		b, err := io.ReadAll(io.LimitReader(r, maxConfigBytes))
+		if err != nil {
+			return err
+		}
+		c.jvmFlags[node] = string(b)
+	case dir == "wlm" && strings.HasSuffix(file, ".json"):
+		// every coordinator exports the same cluster wide wlm, the first one is used
+		if _, ok := c.wlm[file]; ok {
+			return nil
+		}
+		b, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		c.wlm[file] = b
+	case dir == "system-tables":
+		table, ok := systemTable(file)
+		if !ok {
+			return nil
+		}
+		var page struct {
+			RowCount int64 `json:"rowCount"`
+		}
+		if err := json.NewDecoder(r).Decode(&page); err != nil {
+			simplelog.Warningf("skipping unreadable %v: %v", name, err)
+			return nil
+		}
+		if current, ok := c.rows[table]; !ok || page.RowCount > current {
+			c.rows[table] = page.RowCount
+		}
+	}
+	return nil
+}
+
+// systemTable is the table of the first page of an export, sys.<table>_offset_0_limit_500.json,
+// every page repeats the row count of the whole result so the others are skipped
+func systemTable(file string) (string, bool) {
+	if !strings.HasPrefix(file, "sys.") || !strings.HasSuffix(file, ".json") {
+		return "", false
+	}
+	i := strings.Index(file, "_offset_0_")
+	if i < 0 {
+		return "", false
+	}
+	return strings.TrimPrefix(file[:i], "sys."), true
+}
+
+func union(a, b map[string]string) map[string]bool {
+	keys := make(map[string]bool)
+	for k := range a {
+		keys[k] = true
+	}
+	for k := range b {
+		keys[k] = true
+	}
+	return keys
+}
+
+// lineDiff returns the removed lines prefixed with - and the added lines prefixed with +, in the order
+// of a longest common subsequence so a changed line shows up as its removal followed by its addition
+func lineDiff(before, after string) []string {
+	if before == after {
+		return nil
+	}
+	a := splitLines(before)
+	b := splitLines(after)
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	var lines []string
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			lines = append(lines, "-"+a[i])
+			i++
+		default:
+			lines = append(lines, "+"+b[j])
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		lines = append(lines, "-"+a[i])
+	}
+	for ; j < len(b); j++ {
+		lines = append(lines, "+"+b[j])
+	}
+	return lines
+}
+
+func splitLines(s string) []string {
+	s = strings.TrimRight(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
+
+// flagDiff compares the jps -v output of a node, a flag that is set to another value such as -Xmx8g
+// and -Xmx16g or -XX:+UseG1GC and -XX:-UseG1GC is reported as changed
+func flagDiff(node, before, after string) FlagDiff {
+	d := FlagDiff{Node: node}
+	b := flags(before)
+	a := flags(after)
+	var keys []string
+	for k := range b {
+		keys = append(keys, k)
+	}
+	for k := range a {
+		if _, ok := b[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v1, inBefore := b[k]
+		v2, inAfter := a[k]
+		switch {
+		case !inBefore:
+			d.Added = append(d.Added, v2)
+		case !inAfter:
+			d.Removed = append(d.Removed, v1)
+		case v1 != v2:
+			d.Changed = append(d.Changed, Change{Name: k, Before: v1, After: v2})
+		}
+	}
+	return d
+}
+
+// flags maps each flag to its key, the main class and arguments that are not flags are skipped
+func flags(jps string) map[string]string {
+	m := make(map[string]string)
+	for _, f := range strings.Fields(jps) {
+		if strings.HasPrefix(f, "-") {
+			m[flagKey(f)] = f
+		}
+	}
+	return m
+}
+
+func flagKey(f string) string {
+	switch {
+	case strings.HasPrefix(f, "-XX:+"), strings.HasPrefix(f, "-XX:-"):
+		return "-XX:" + f[len("-XX:+"):]
+	case strings.HasPrefix(f, "-Xmx"), strings.HasPrefix(f, "-Xms"), strings.HasPrefix(f, "-Xss"), strings.HasPrefix(f, "-Xmn"):
+		return f[:len("-Xmx")]
+	}
+	if i := strings.Index(f, "="); i > 0 {
+		return f[:i]
+	}
+	return f
+}
+
+// wlmDiff compares the queues or rules of a wlm export by name
+func wlmDiff(file string, before, after []byte) ([]WLMChange, error) {
+	b, err := wlmItems(before)
+	if err != nil {
+		return nil, err
+	}
+	a, err := wlmItems(after)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for n := range b {
+		names = append(names, n)
+	}
+	for n := range a {
+		if _, ok := b[n]; !ok {
+			names = append(names, n)
+		}
+	}
+	sort.Strings(names)
+	var changes []WLMChange
+	for _, n := range names {
+		v1, inBefore := b[n]
+		v2, inAfter := a[n]
+		switch {
+		case !inBefore:
+			changes = append(changes, WLMChange{File: file, Name: n, Change: "added"})
+		case !inAfter:
+			changes = append(changes, WLMChange{File: file, Name: n, Change: "removed"})
+		default:
+			if fields := changedFields(v1, v2); len(fields) > 0 {
+				changes = append(changes, WLMChange{File: file, Name: n, Change: "changed", Fields: fields})
+			}
+		}
+	}
+	return changes, nil
+}
+
+// wlmItems finds the list in a wlm response, {"data": [...]} for queues and the first list for rules,
+// and keys each entry by its name or id
+func wlmItems(b []byte) (map[string]map[string]interface{}, error) {
+	items := make(map[string]map[string]interface{})
+	if len(b) == 0 {
+		return items, nil
+	}
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, err
+	}
+	list, ok := v.([]interface{})
+	if obj, isObj := v.(map[string]interface{}); isObj {
+		list, ok = obj["data"].([]interface{})
+		if !ok {
+			var keys []string
+			for k := range obj {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				if list, ok = obj[k].([]interface{}); ok {
+					break
+				}
+			}
+		}
+	}
+	if !ok {
+		return nil, fmt.Errorf("no list of queues or rules found")
+	}
+	for i, e := range list {
+		item, ok := e.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		key := fmt.Sprintf("#%v", i)
+		if name, ok := item["name"].(string); ok && name != "" {
+			key = name
+		} else if id, ok := item["id"].(string); ok && id != "" {
+			key = id
+		}
+		items[key] = item
+	}
+	return items, nil
+}
+
+func changedFields(before, after map[string]interface{}) []string {
+	keys := make(map[string]bool)
+	for k := range before {
+		keys[k] = true
+	}
+	for k := range after {
+		keys[k] = true
+	}
+	var fields []string
+	for k := range keys {
+		// json.Marshal sorts map keys so equal values marshal the same
+		b1, _ := json.Marshal(before[k])
+		b2, _ := json.Marshal(after[k])
+		if string(b1) != string(b2) {
+			fields = append(fields, k)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+func init() {
+	DiffCmd.Flags().BoolVar(&jsonOutput, "json", false, "print the differences as json instead of Markdown")
+}
@@ -0,0 +1,161 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// package diff provides the ddc diff command that compares two diagnostic bundles of the same cluster
+package diff
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dremio/dremio-diagnostic-collector/pkg/archive"
+)
+
+const baseDir = "20221110-141414-DDC"
+
+func writeBundle(t *testing.T, files map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		name = filepath.Join(root, baseDir, name)
+		if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dest := filepath.Join(t.TempDir(), "diag.tgz")
+	if _, err := archive.ArchiveDir(root, dest, archive.Options{Format: archive.TarGz}); err != nil {
+		t.Fatal(err)
+	}
+	return dest
+}
+
+func TestDiff(t *testing.T) {
+	before := writeBundle(t, map[string]string{
+		"cluster-stats/master-0/cluster-stats.json":                    `{"dremioVersion": "24.0.0", "clusterID": "abc", "nodeName": "master-0"}`,
+		"cluster-stats/executor-0/cluster-stats.json":                  `{"dremioVersion": "24.0.0", "clusterID": "abc", "nodeName": "executor-0"}`,
+		"configuration/master-0/dremio.conf":                           "paths.local: /data\nservices.executor.enabled: false\n",
+		"configuration/master-0/logback.xml":                           "<configuration/>\n",
+		"node-info/master-0/jvm_settings.txt":                          "DremioDaemon -Xmx8g -XX:+UseG1GC -Ddremio.log.path=/var/log -XX:MaxDirectMemorySize=8g",
+		"wlm/master-0/queues.json":                                     `{"data": [{"name": "Low Cost", "cpuTier": "LOW"}, {"name": "High Cost", "cpuTier": "HIGH"}]}`,
+		"wlm/master-0/rules.json":                                      `{"rules": [{"name": "UI", "acceptName": "Low Cost"}]}`,
+		"system-tables/master-0/sys.nodes_offset_0_limit_500.json":     `{"rowCount": 2, "rows": []}`,
+		"system-tables/master-0/sys.options_offset_0_limit_500.json":   `{"rowCount": 700, "rows": []}`,
+		"system-tables/master-0/sys.options_offset_500_limit_500.json": `{"rowCount": 700, "rows": []}`,
+	})
+	after := writeBundle(t, map[string]string{
+		"cluster-stats/master-0/cluster-stats.json":                               `{"dremioVersion": "24.1.0", "clusterID": "abc", "nodeName": "master-0"}`,
+		"cluster-stats/executor-1/cluster-stats.json":                             `{"dremioVersion": "24.1.0", "clusterID": "abc", "nodeName": "executor-1"}`,
+		"configuration/master-0/dremio.conf":                                      "paths.local: /mnt/data\nservices.executor.enabled: false\n",
+		"configuration/master-0/logback.xml":                                      "<configuration/>\n",
+		"node-info/master-0/jvm_settings.txt":                                     "DremioDaemon -Xmx16g -XX:-UseG1GC -Ddremio.log.path=/var/log -XX:+HeapDumpOnOutOfMemoryError",
+		"wlm/master-0/queues.json":                                                `{"data": [{"name": "Low Cost", "cpuTier": "MEDIUM"}, {"name": "ETL", "cpuTier": "HIGH"}]}`,
+		"wlm/master-0/rules.json":                                                 `{"rules": [{"name": "UI", "acceptName": "Low Cost"}]}`,
+		"system-tables/master-0/sys.nodes_offset_0_limit_500.json":                `{"rowCount": 2, "rows": []}`,
+		"system-tables/master-0/sys.options_offset_0_limit_500.json":              `{"rowCount": 712, "rows": []}`,
+		"system-tables/master-0/sys.project.history.jobs_offset_0_limit_500.json": `{"rowCount": 40, "rows": []}`,
+	})
+	r, err := Diff(before, after)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(r.AddedNodes, []string{"executor-1"}) || !reflect.DeepEqual(r.RemovedNodes, []string{"executor-0"}) {
+		t.Errorf("unexpected node changes added %v removed %v", r.AddedNodes, r.RemovedNodes)
+	}
+	if !reflect.DeepEqual(r.Versions, []Change{{Name: "master-0", Before: "24.0.0", After: "24.1.0"}}) {
+		t.Errorf("unexpected version changes %v", r.Versions)
+	}
+	expectedConfig := []FileDiff{{Node: "master-0", File: "dremio.conf", Lines: []string{"-paths.local: /data", "+paths.local: /mnt/data"}}}
+	if !reflect.DeepEqual(r.Config, expectedConfig) {
+		t.Errorf("expected config changes %v but was %v", expectedConfig, r.Config)
+	}
+	expectedFlags := []FlagDiff{{
+		Node:    "master-0",
+		Added:   []string{"-XX:+HeapDumpOnOutOfMemoryError"},
+		Removed: []string{"-XX:MaxDirectMemorySize=8g"},
+		Changed: []Change{{Name: "-XX:UseG1GC", Before: "-XX:+UseG1GC", After: "-XX:-UseG1GC"}, {Name: "-Xmx", Before: "-Xmx8g", After: "-Xmx16g"}},
+	}}
+	if !reflect.DeepEqual(r.JVMFlags, expectedFlags) {
+		t.Errorf("expected flag changes %#v but was %#v", expectedFlags, r.JVMFlags)
+	}
+	expectedWLM := []WLMChange{
+		{File: "queues.json", Name: "ETL", Change: "added"},
+		{File: "queues.json", Name: "High Cost", Change: "removed"},
+		{File: "queues.json", Name: "Low Cost", Change: "changed", Fields: []string{"cpuTier"}},
+	}
+	if !reflect.DeepEqual(r.WLM, expectedWLM) {
+		t.Errorf("expected wlm changes %v but was %v", expectedWLM, r.WLM)
+	}
+	var tables []string
+	for _, c := range r.RowCounts {
+		tables = append(tables, c.Table)
+	}
+	if !reflect.DeepEqual(tables, []string{"options", "project.history.jobs"}) || r.RowCounts[0].Delta() != 12 {
+		t.Errorf("unexpected row counts %v", tables)
+	}
+
+	var out bytes.Buffer
+	if err := Markdown(&out, r); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"- added `executor-1`\n- removed `executor-0`",
+		"| master-0 | 24.0.0 | 24.1.0 |",
+		"### master-0 dremio.conf\n\n```diff\n-paths.local: /data\n+paths.local: /mnt/data\n```",
+		"- changed `-Xmx8g` to `-Xmx16g`",
+		"| queues.json | Low Cost | changed | cpuTier |",
+		"| options | 700 | 712 | +12 |",
+		"| project.history.jobs | - | 40 | - |",
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("expected the report to contain\n%v\nbut was\n%v", expected, out.String())
+		}
+	}
+}
+
+func TestDiffSameBundle(t *testing.T) {
+	bundle := writeBundle(t, map[string]string{
+		"configuration/master-0/dremio.conf": "paths.local: /data\n",
+	})
+	r, err := Diff(bundle, bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.Empty() {
+		t.Errorf("expected no differences but was %#v", r)
+	}
+	var out bytes.Buffer
+	if err := Markdown(&out, r); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "No differences found.") {
+		t.Errorf("unexpected report %v", out.String())
+	}
+}
+
+func TestLineDiff(t *testing.T) {
+	lines := lineDiff("a\nb\nc\n", "a\nc\nd\n")
+	if !reflect.DeepEqual(lines, []string{"-b", "+d"}) {
+		t.Errorf("unexpected diff %v", lines)
+	}
+	if lines := lineDiff("", "a\n"); !reflect.DeepEqual(lines, []string{"+a"}) {
+		t.Errorf("unexpected diff %v", lines)
+	}
+}
@@ -0,0 +1,132 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+func printJSON(w io.Writer, r Result) error {
+	b, err := json.MarshalIndent(r, "", "\t")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(b))
+	return err
+}
+
+// Markdown writes the result as a Markdown report with a section per kind of change, sections
+// without changes are left out
+func Markdown(w io.Writer, r Result) error {
+	var b strings.Builder
+	b.WriteString("# ddc diff\n\n")
+	b.WriteString("| | before | after |\n|---|---|---|\n")
+	fmt.Fprintf(&b, "| bundle | %v | %v |\n", cellText(r.Before.File), cellText(r.After.File))
+	fmt.Fprintf(&b, "| collected | %v | %v |\n", collected(r.Before.StartTimeUTC), collected(r.After.StartTimeUTC))
+	fmt.Fprintf(&b, "| cluster id | %v | %v |\n", cellText(strings.Join(r.Before.ClusterIDs, ", ")), cellText(strings.Join(r.After.ClusterIDs, ", ")))
+	fmt.Fprintf(&b, "| ddc version | %v | %v |\n", cellText(r.Before.DDCVersion), cellText(r.After.DDCVersion))
+
+	if r.Empty() {
+		b.WriteString("\nNo differences found.\n")
+		_, err := io.WriteString(w, b.String())
+		return err
+	}
+
+	if len(r.AddedNodes)+len(r.RemovedNodes) > 0 {
+		b.WriteString("\n## Nodes\n\n")
+		for _, n := range r.AddedNodes {
+			fmt.Fprintf(&b, "- added `%v`\n", n)
+		}
+		for _, n := range r.RemovedNodes {
+			fmt.Fprintf(&b, "- removed `%v`\n", n)
+		}
+	}
+
+	if len(r.Versions) > 0 {
+		b.WriteString("\n## Dremio versions\n\n| node | before | after |\n|---|---|---|\n")
+		for _, v := range r.Versions {
+			fmt.Fprintf(&b, "| %v | %v | %v |\n", v.Name, cellText(v.Before), cellText(v.After))
+		}
+	}
+
+	if len(r.Config) > 0 {
+		b.WriteString("\n## Configuration\n")
+		for _, f := range r.Config {
+			fmt.Fprintf(&b, "\n### %v %v\n\n```diff\n%v\n```\n", f.Node, f.File, strings.Join(f.Lines, "\n"))
+		}
+	}
+
+	if len(r.JVMFlags) > 0 {
+		b.WriteString("\n## JVM flags\n")
+		for _, f := range r.JVMFlags {
+			fmt.Fprintf(&b, "\n### %v\n\n", f.Node)
+			for _, a := range f.Added {
+				fmt.Fprintf(&b, "- added `%v`\n", a)
+			}
+			for _, rm := range f.Removed {
+				fmt.Fprintf(&b, "- removed `%v`\n", rm)
+			}
+			for _, c := range f.Changed {
+				fmt.Fprintf(&b, "- changed `%v` to `%v`\n", c.Before, c.After)
+			}
+		}
+	}
+
+	if len(r.WLM) > 0 {
+		b.WriteString("\n## WLM\n\n| file | name | change | fields |\n|---|---|---|---|\n")
+		for _, c := range r.WLM {
+			fmt.Fprintf(&b, "| %v | %v | %v | %v |\n", c.File, cellText(c.Name), c.Change, cellText(strings.Join(c.Fields, ", ")))
+		}
+	}
+
+	if len(r.RowCounts) > 0 {
+		b.WriteString("\n## System table row counts\n\n| table | before | after | delta |\n|---|---|---|---|\n")
+		for _, c := range r.RowCounts {
+			delta := "-"
+			if c.Before != nil && c.After != nil {
+				delta = fmt.Sprintf("%+d", c.Delta())
+			}
+			fmt.Fprintf(&b, "| %v | %v | %v | %v |\n", c.Table, count(c.Before), count(c.After), delta)
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// cellText keeps a value from breaking the table it is in
+func cellText(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return strings.ReplaceAll(s, "|", "\\|")
+}
+
+func collected(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Format(time.RFC3339)
+}
+
+func count(c *int64) string {
+	if c == nil {
+		return "-"
+	}
+	return fmt.Sprint(*c)
+}
@@ -0,0 +1,483 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// package inspect provides the ddc inspect command that summarizes a bundle without extracting it
+package inspect
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dremio/dremio-diagnostic-collector/cmd/root/collection"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/archive"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/clusterstats"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/encrypt"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/manifest"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/simplelog"
+	"github.com/spf13/cobra"
+)
+
+var jsonOutput bool
+
+var InspectCmd = &cobra.Command{
+	Use:   "inspect <bundle>",
+	Short: "Summarize a diagnostic bundle without extracting it",
+	Long: `Summarize a diagnostic bundle without extracting it: the Dremio version and cluster ID of every node,
+the collection time window, what each collector gathered on each node and which collections are missing or were skipped.
+The bundle is an archive written by ddc, any volume of a split archive, or the directory it was extracted to.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		simplelog.LogStartMessage()
+		defer simplelog.LogEndMessage()
+		b, err := Inspect(args[0])
+		if err == nil {
+			err = Print(os.Stdout, b, jsonOutput)
+		}
+		if err != nil {
+			simplelog.Errorf("exiting %v", err)
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	},
+}
+
+// nodeDirs are written by every node under <collector>/<node>, a missing one means the collector failed on that node
+var nodeDirs = map[string][]string{
+	"logs":          {"server-logs", "gc-logs", "meta-refresh-log", "reflection-log", "acceleration-log", "access-log", "audit-log"},
+	"configuration": {"dremio-configuration"},
+	"node-info":     {"os-config", "disk-usage", "jvm-flags"},
+	"jfr":           {"jfr"},
+	"thread-dumps":  {"jstack"},
+	"ttop":          {"ttop"},
+}
+
+// clusterDirs are only written by the coordinators, they are missing when no node has them
+var clusterDirs = map[string][]string{
+	"queries":       {"queries-json"},
+	"job-profiles":  {"job-profiles"},
+	"kvstore":       {"kvstore-report"},
+	"system-tables": {"system-tables-export"},
+	"wlm":           {"wlm"},
+	"heap-dumps":    {"heap-dump"},
+}
+
+// Collector is what one collector wrote
+type Collector struct {
+	Name  string `json:"name"`
+	Files int    `json:"files"`
+	Bytes int64  `json:"bytes"`
+}
+
+type Node struct {
+	Name          string `json:"name"`
+	DremioVersion string `json:"dremioVersion,omitempty"`
+	ClusterID     string `json:"clusterID,omitempty"`
+	// Encrypted is set when the node tarball was encrypted on the node and cannot be looked into
+	Encrypted  bool        `json:"encrypted,omitempty"`
+	Collectors []Collector `json:"collectors"`
+	// Missing are the enabled collectors that wrote nothing for this node
+	Missing []string `json:"missing,omitempty"`
+}
+
+// Bundle is the summary of a diagnostic bundle
+type Bundle struct {
+	File                string      `json:"file"`
+	DDCVersion          string      `json:"ddcVersion,omitempty"`
+	StartTimeUTC        time.Time   `json:"startTimeUTC"`
+	EndTimeUTC          time.Time   `json:"endTimeUTC"`
+	ClusterIDs          []string    `json:"clusterIDs"`
+	Nodes               []Node      `json:"nodes"`
+	Cluster             []Collector `json:"cluster,omitempty"`
+	CollectionsEnabled  []string    `json:"collectionsEnabled"`
+	CollectionsDisabled []string    `json:"collectionsDisabled"`
+	// MissingCollections are enabled coordinator collections that no node wrote
+	MissingCollections []string `json:"missingCollections,omitempty"`
+	// NodesAttempted and NodesCollected come from summary.json, the difference is the nodes that failed
+	NodesAttempted int      `json:"nodesAttempted"`
+	NodesCollected int      `json:"nodesCollected"`
+	CancelledNodes []string `json:"cancelledNodes,omitempty"`
+	HasSummary     bool     `json:"hasSummary"`
+	HasManifest    bool     `json:"hasManifest"`
+	TotalFiles     int      `json:"totalFiles"`
+	TotalBytes     int64    `json:"totalBytes"`
+}
+
+type file struct {
+	name string
+	size int64
+}
+
+// Inspect reads the bundle once, only summary.json and the cluster-stats.json of each node are parsed
+func Inspect(bundle string) (Bundle, error) {
+	return Read(bundle, nil)
+}
+
+// Read is Inspect that also hands every other file of the bundle to visit, name is slash separated and
+// relative to the root of the bundle
+func Read(bundle string, visit func(name string, r io.Reader) error) (Bundle, error) {
+	b := Bundle{File: bundle, ClusterIDs: []string{}, Nodes: []Node{}}
+	if encrypt.IsEncrypted(bundle) {
+		return b, fmt.Errorf("%v is encrypted, run ddc decrypt on it first", bundle)
+	}
+	var files []file
+	var summary collection.SummaryInfo
+	var stats []clusterstats.ClusterStats
+	err := archive.Walk(bundle, func(e archive.Entry, r io.Reader) error {
+		if r == nil {
+			return nil
+		}
+		name := strings.TrimPrefix(path.Clean("/"+e.Name), "/")
+		files = append(files, file{name: name, size: e.Size})
+		switch {
+		case name == "summary.json":
+			if err := json.NewDecoder(r).Decode(&summary); err != nil {
+				return fmt.Errorf("unable to read summary.json: %w", err)
+			}
+			b.HasSummary = true
+		case name == manifest.FileName:
+			b.HasManifest = true
+		case path.Base(name) == "cluster-stats.json":
+			var s clusterstats.ClusterStats
+			if err := json.NewDecoder(r).Decode(&s); err != nil {
+				simplelog.Warningf("skipping unreadable %v: %v", name, err)
+				return nil
+			}
+			stats = append(stats, s)
+		case visit != nil:
+			return visit(name, r)
+		}
+		return nil
+	})
+	if err != nil {
+		return b, fmt.Errorf("unable to read %v: %w", bundle, err)
+	}
+	b.DDCVersion = strings.TrimSpace(summary.DDCVersion)
+	b.StartTimeUTC = summary.StartTimeUTC
+	b.EndTimeUTC = summary.EndTimeUTC
+	b.CollectionsEnabled = summary.CollectionsEnabled
+	b.CollectionsDisabled = summary.CollectionsDisabled
+	sort.Strings(b.CollectionsEnabled)
+	sort.Strings(b.CollectionsDisabled)
+	b.NodesAttempted = summary.ClusterInfo.TotalNodesAttempted
+	b.NodesCollected = len(summary.CollectedFiles)
+	b.CancelledNodes = summary.CancelledHosts
+
+	contentDir := contentDir(files)
+	nodes := make(map[string]*Node)
+	for _, f := range files {
+		if n, encrypted := nodeOf(f.name, contentDir); n != "" {
+			if _, ok := nodes[n]; !ok {
+				nodes[n] = &Node{Name: n}
+			}
+			nodes[n].Encrypted = nodes[n].Encrypted || encrypted
+		}
+	}
+	for _, s := range stats {
+		if s.NodeName == "" {
+			continue
+		}
+		if _, ok := nodes[s.NodeName]; !ok {
+			nodes[s.NodeName] = &Node{Name: s.NodeName}
+		}
+		nodes[s.NodeName].DremioVersion = s.DremioVersion
+		nodes[s.NodeName].ClusterID = s.ClusterID
+		if s.ClusterID != "" && !contains(b.ClusterIDs, s.ClusterID) {
+			b.ClusterIDs = append(b.ClusterIDs, s.ClusterID)
+		}
+	}
+	sort.Strings(b.ClusterIDs)
+	var names []string
+	for n := range nodes {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	perNode := make(map[string]map[string]*Collector)
+	cluster := make(map[string]*Collector)
+	for _, f := range files {
+		if f.name == "summary.json" || f.name == manifest.FileName {
+			continue
+		}
+		b.TotalFiles++
+		b.TotalBytes += f.size
+		node, collector := manifest.Classify(f.name, contentDir, names)
+		switch {
+		case collector == "" && encrypt.IsEncrypted(f.name):
+			collector = "encrypted-tarball"
+		case collector == "":
+			collector = "other"
+		}
+		target := cluster
+		if node != "" {
+			if perNode[node] == nil {
+				perNode[node] = make(map[string]*Collector)
+			}
+			target = perNode[node]
+		}
+		c, ok := target[collector]
+		if !ok {
+			c = &Collector{Name: collector}
+			target[collector] = c
+		}
+		c.Files++
+		c.Bytes += f.size
+	}
+
+	enabled := make(map[string]bool)
+	for _, c := range b.CollectionsEnabled {
+		enabled[c] = true
+	}
+	for _, n := range names {
+		node := nodes[n]
+		node.Collectors = sortedCollectors(perNode[n])
+		if node.Encrypted {
+			b.Nodes = append(b.Nodes, *node)
+			continue
+		}
+		for dir, collections := range nodeDirs {
+			if anyEnabled(enabled, collections) && perNode[n][dir] == nil {
+				node.Missing = append(node.Missing, dir)
+			}
+		}
+		sort.Strings(node.Missing)
+		b.Nodes = append(b.Nodes, *node)
+	}
+	b.Cluster = sortedCollectors(cluster)
+	for dir, collections := range clusterDirs {
+		if !anyEnabled(enabled, collections) || cluster[dir] != nil {
+			continue
+		}
+		found := false
+		for _, n := range names {
+			if perNode[n][dir] != nil || nodes[n].Encrypted {
+				found = true
+				break
+			}
+		}
+		if !found {
+			b.MissingCollections = append(b.MissingCollections, dir)
+		}
+	}
+	sort.Strings(b.MissingCollections)
+	return b, nil
+}
+
+// contentDir is the directory the collectors wrote to, the <date>-DDC directory of an archive written by ddc
+func contentDir(files []file) string {
+	dirs := make(map[string]bool)
+	for _, f := range files {
+		if i := strings.Index(f.name, "/"); i > 0 {
+			dirs[f.name[:i]] = true
+		}
+	}
+	if len(dirs) != 1 {
+		return ""
+	}
+	for d := range dirs {
+		// an extracted node tarball has no such directory, its collectors are at the top
+		if _, ok := nodeDirs[d]; ok {
+			return ""
+		}
+		if _, ok := clusterDirs[d]; ok || d == "cluster-stats" {
+			return ""
+		}
+		return d
+	}
+	return ""
+}
+
+// nodeOf finds the node a file was written for from the layout documented on CopyStrategyHC
+func nodeOf(name, contentDir string) (node string, encrypted bool) {
+	if contentDir != "" {
+		if !strings.HasPrefix(name, contentDir+"/") {
+			return "", false
+		}
+		name = strings.TrimPrefix(name, contentDir+"/")
+	}
+	segments := strings.Split(name, "/")
+	switch {
+	case len(segments) == 1 && strings.HasSuffix(name, ".tar.gz"+encrypt.Suffix):
+		return nodeName(name), true
+	case len(segments) > 3 && segments[0] == "jfr" && segments[1] == "thread-dumps":
+		return segments[2], false
+	case len(segments) > 2 && segments[0] != "jfr" && segments[0] != "heap-dumps" && segments[0] != "kubernetes":
+		return segments[1], false
+	}
+	return "", false
+}
+
+// nodeName is the host a node tarball was named after
+func nodeName(tarball string) string {
+	return strings.TrimSuffix(strings.TrimSuffix(path.Base(tarball), encrypt.Suffix), ".tar.gz")
+}
+
+func sortedCollectors(m map[string]*Collector) []Collector {
+	collectors := []Collector{}
+	for _, c := range m {
+		collectors = append(collectors, *c)
+	}
+	sort.Slice(collectors, func(i, j int) bool { return collectors[i].Name < collectors[j].Name })
+	return collectors
+}
+
+func anyEnabled(enabled map[string]bool, collections []string) bool {
+	for _, c := range collections {
+		if enabled[c] {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(values []string, v string) bool {
+	for _, s := range values {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+// Print writes the bundle as a table or as indented json
+func Print(w io.Writer, b Bundle, asJSON bool) error {
+	if asJSON {
+		out, err := json.MarshalIndent(b, "", "\t")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(out))
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "bundle:\t%v\n", b.File)
+	if b.HasSummary {
+		fmt.Fprintf(tw, "ddc version:\t%v\n", b.DDCVersion)
+		fmt.Fprintf(tw, "collected:\t%v to %v (%v)\n", b.StartTimeUTC.Format(time.RFC3339), b.EndTimeUTC.Format(time.RFC3339), b.EndTimeUTC.Sub(b.StartTimeUTC))
+		fmt.Fprintf(tw, "nodes:\t%v of %v collected\n", b.NodesCollected, b.NodesAttempted)
+	} else {
+		fmt.Fprintf(tw, "summary:\tnone, summary.json is not in the bundle\n")
+	}
+	fmt.Fprintf(tw, "cluster id:\t%v\n", orNone(b.ClusterIDs))
+	fmt.Fprintf(tw, "files:\t%v (%v)\n", b.TotalFiles, HumanBytes(b.TotalBytes))
+	fmt.Fprintf(tw, "manifest:\t%v\n", yesNo(b.HasManifest))
+	fmt.Fprintf(tw, "skipped:\t%v\n", orNone(b.CollectionsDisabled))
+	fmt.Fprintf(tw, "missing:\t%v\n", orNone(b.MissingCollections))
+	if len(b.CancelledNodes) > 0 {
+		fmt.Fprintf(tw, "cancelled nodes:\t%v\n", strings.Join(b.CancelledNodes, ", "))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(w); err != nil {
+		return err
+	}
+	return printNodes(w, b)
+}
+
+// printNodes renders a row per node and a column per collector, MISSING marks an enabled collector
+// that wrote nothing for the node and - one that does not run there
+func printNodes(w io.Writer, b Bundle) error {
+	columns := make(map[string]bool)
+	for _, n := range b.Nodes {
+		if n.Encrypted {
+			continue
+		}
+		for _, c := range n.Collectors {
+			columns[c.Name] = true
+		}
+		for _, m := range n.Missing {
+			columns[m] = true
+		}
+	}
+	var names []string
+	for c := range columns {
+		names = append(names, c)
+	}
+	sort.Strings(names)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "node\tdremio version\t%v\n", strings.Join(names, "\t"))
+	for _, n := range b.Nodes {
+		var row []string
+		for _, col := range names {
+			row = append(row, cell(n, col))
+		}
+		version := n.DremioVersion
+		if version == "" {
+			version = "-"
+		}
+		fmt.Fprintf(tw, "%v\t%v\t%v\n", n.Name, version, strings.Join(row, "\t"))
+	}
+	if len(b.Cluster) > 0 {
+		var cluster []string
+		for _, c := range b.Cluster {
+			cluster = append(cluster, fmt.Sprintf("%v %v", c.Name, HumanBytes(c.Bytes)))
+		}
+		fmt.Fprintf(tw, "(cluster)\t-\t%v\n", strings.Join(cluster, ", "))
+	}
+	return tw.Flush()
+}
+
+func cell(n Node, col string) string {
+	if n.Encrypted {
+		return "ENCRYPTED"
+	}
+	for _, c := range n.Collectors {
+		if c.Name == col {
+			return HumanBytes(c.Bytes)
+		}
+	}
+	if contains(n.Missing, col) {
+		return "MISSING"
+	}
+	return "-"
+}
+
+// HumanBytes formats a size with a binary unit like 1.5MB
+func HumanBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%vB", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+func orNone(values []string) string {
+	if len(values) == 0 {
+		return "none"
+	}
+	return strings.Join(values, ", ")
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+func init() {
+	InspectCmd.Flags().BoolVar(&jsonOutput, "json", false, "print the summary as json")
+}
@@ -0,0 +1,140 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// package inspect provides the ddc inspect command that summarizes a bundle without extracting it
+package inspect
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dremio/dremio-diagnostic-collector/pkg/archive"
+)
+
+const baseDir = "20221110-141414-DDC"
+
+func writeBundle(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	files := map[string]string{
+		"summary.json": `{"ddcVersion": "ddc v0.9.0-abc\n", "startTimeUTC": "2022-11-10T14:14:14Z", "endTimeUTC": "2022-11-10T14:19:14Z",
+			"clusterInfo": {"totalNodesAttempted": 3}, "collectedFiles": [{"path": "/tmp/a/master-0.tar.gz", "size": 10}, {"path": "/tmp/a/executor-0.tar.gz", "size": 10}],
+			"collectionsEnabled": ["server-logs", "jfr", "jstack", "job-profiles", "dremio-configuration"], "collectionsDisabled": ["heap-dump"]}`,
+		baseDir + "/cluster-stats/master-0/cluster-stats.json":   `{"dremioVersion": "24.1.0", "clusterID": "abc", "nodeName": "master-0"}`,
+		baseDir + "/cluster-stats/executor-0/cluster-stats.json": `{"dremioVersion": "24.1.0", "clusterID": "abc", "nodeName": "executor-0"}`,
+		baseDir + "/logs/master-0/server.log":                    "log",
+		baseDir + "/logs/executor-0/server.log":                  "executor log",
+		baseDir + "/configuration/master-0/dremio.conf":          "conf",
+		baseDir + "/configuration/executor-0/dremio.conf":        "conf",
+		baseDir + "/jfr/master-0.jfr":                            "recording",
+		baseDir + "/jfr/thread-dumps/master-0/1.txt":             "jstack",
+		baseDir + "/kubernetes/pods.json":                        "[]",
+		baseDir + "/executor-1.tar.gz.age":                       "encrypted",
+	}
+	for name, content := range files {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(root, name)), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestInspect(t *testing.T) {
+	dest := filepath.Join(t.TempDir(), "diag.tar.zst")
+	if _, err := archive.ArchiveDir(writeBundle(t), dest, archive.Options{Format: archive.TarZst}); err != nil {
+		t.Fatal(err)
+	}
+	b, err := Inspect(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.DDCVersion != "ddc v0.9.0-abc" || b.NodesAttempted != 3 || b.NodesCollected != 2 {
+		t.Errorf("unexpected summary %#v", b)
+	}
+	if !reflect.DeepEqual(b.ClusterIDs, []string{"abc"}) {
+		t.Errorf("expected cluster id abc but was %v", b.ClusterIDs)
+	}
+	var names []string
+	for _, n := range b.Nodes {
+		names = append(names, n.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"executor-0", "executor-1", "master-0"}) {
+		t.Fatalf("unexpected nodes %v", names)
+	}
+	executor, encrypted, master := b.Nodes[0], b.Nodes[1], b.Nodes[2]
+	if !reflect.DeepEqual(executor.Missing, []string{"jfr", "thread-dumps"}) {
+		t.Errorf("expected jfr and thread dumps to be missing on executor-0 but was %v", executor.Missing)
+	}
+	if len(master.Missing) != 0 || master.DremioVersion != "24.1.0" {
+		t.Errorf("unexpected master %#v", master)
+	}
+	if !encrypted.Encrypted || len(encrypted.Missing) != 0 {
+		t.Errorf("expected executor-1 to be encrypted %#v", encrypted)
+	}
+	// job-profiles may be in the encrypted tarball so it is not reported missing
+	if len(b.MissingCollections) != 0 {
+		t.Errorf("unexpected missing collections %v", b.MissingCollections)
+	}
+	if len(b.Cluster) != 1 || b.Cluster[0].Name != "kubernetes" {
+		t.Errorf("expected only kubernetes at cluster level but was %v", b.Cluster)
+	}
+
+	var out bytes.Buffer
+	if err := Print(&out, b, false); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"collected:    2022-11-10T14:14:14Z to 2022-11-10T14:19:14Z (5m0s)",
+		"nodes:        2 of 3 collected",
+		"skipped:      heap-dump",
+		"node        dremio version  cluster-stats  configuration  jfr        logs       thread-dumps",
+		"executor-0  24.1.0          73B            4B             MISSING    12B        MISSING",
+		"master-0    24.1.0          71B            4B             9B         3B         6B",
+		"executor-1  -               ENCRYPTED",
+		"(cluster)   -               kubernetes 2B",
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("expected output to contain\n%v\nbut was\n%v", expected, out.String())
+		}
+	}
+}
+
+func TestInspectReportsMissingCoordinatorCollections(t *testing.T) {
+	root := writeBundle(t)
+	if err := os.Remove(filepath.Join(root, baseDir, "executor-1.tar.gz.age")); err != nil {
+		t.Fatal(err)
+	}
+	b, err := Inspect(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(b.MissingCollections, []string{"job-profiles"}) {
+		t.Errorf("expected job-profiles to be missing but was %v", b.MissingCollections)
+	}
+}
+
+func TestHumanBytes(t *testing.T) {
+	for n, expected := range map[int64]string{0: "0B", 1023: "1023B", 1024: "1.0KB", 1536: "1.5KB", 5 * 1024 * 1024 * 1024: "5.0GB"} {
+		if actual := HumanBytes(n); actual != expected {
+			t.Errorf("expected %v for %v but was %v", expected, n, actual)
+		}
+	}
+}
@@ -117,6 +117,11 @@ type CollectConf struct {
 	collectWLM                  bool
 	nodeName                    string
 	restHTTPTimeout             int
+	collectorTimeoutSeconds     int
+	jvmCaptureStartUTC          time.Time
+	collectionMode              string
+	encryptTo                   []string
+	requireEncryption           bool
 
 	// variables
 	systemtables            []string
@@ -195,7 +200,9 @@ func ReadConf(overrides map[string]string, ddcYamlLoc string) (*CollectConf, err
 		hostName = fmt.Sprintf("unknown-%v", uuid.New())
 	}
 
-	SetViperDefaults(confData, hostName, defaultCaptureSeconds, getOutputDir(time.Now()))
+	if err := SetViperDefaults(confData, hostName, defaultCaptureSeconds, getOutputDir(time.Now())); err != nil {
+		return &CollectConf{}, fmt.Errorf("config failed: %w", err)
+	}
 
 	c := &CollectConf{}
 	c.systemtables = SystemTableList()
@@ -241,6 +248,17 @@ func ReadConf(overrides map[string]string, ddcYamlLoc string) (*CollectConf, err
 	c.numberThreads = GetInt(confData, KeyNumberThreads)
 	// log collect
 	c.tarballOutDir = GetString(confData, KeyTarballOutDir)
+	for _, r := range strings.Split(GetString(confData, KeyEncryptTo), ",") {
+		if r = strings.TrimSpace(r); r != "" {
+			c.encryptTo = append(c.encryptTo, r)
+		}
+	}
+	c.requireEncryption = GetBool(confData, KeyRequireEncryption)
+	c.collectionMode = GetString(confData, KeyCollectionMode)
+	simplelog.Infof("collection mode %v", c.collectionMode)
+	if c.requireEncryption && len(c.encryptTo) == 0 {
+		return &CollectConf{}, fmt.Errorf("%v is set so the tarball must be encrypted but %v is empty", KeyRequireEncryption, KeyEncryptTo)
+	}
 	c.outputDir = GetString(confData, KeyTmpOutputDir)
 	c.dremioLogsNumDays = GetInt(confData, KeyDremioLogsNumDays)
 	c.dremioQueriesJSONNumDays = GetInt(confData, KeyDremioQueriesJSONNumDays)
@@ -413,6 +431,13 @@ func ReadConf(overrides map[string]string, ddcYamlLoc string) (*CollectConf, err
 	c.collectKVStoreReport = GetBool(confData, KeyCollectKVStoreReport) && !disableRESTAPI
 	c.restHTTPTimeout = GetInt(confData, KeyRestHTTPTimeout)
 	restclient.InitClient(c.allowInsecureSSL, c.restHTTPTimeout)
+	c.collectorTimeoutSeconds = GetInt(confData, KeyCollectorTimeoutSeconds)
+	if start := GetString(confData, KeyJVMCaptureStartUTC); start != "" {
+		c.jvmCaptureStartUTC, err = time.Parse(time.RFC3339, start)
+		if err != nil {
+			return &CollectConf{}, fmt.Errorf("%v must be a RFC3339 time such as 2006-01-02T15:04:05Z: %w", KeyJVMCaptureStartUTC, err)
+		}
+	}
 
 	numberJobProfilesToCollect, jobProfilesNumHighQueryCost, jobProfilesNumSlowExec, jobProfilesNumRecentErrors, jobProfilesNumSlowPlanning := CalculateJobProfileSettingsWithViperConfig(c)
 	c.numberJobProfilesToCollect = numberJobProfilesToCollect
@@ -683,6 +708,10 @@ func (c *CollectConf) ClusterStatsOutDir() string {
 	return filepath.Join(c.outputDir, "cluster-stats", c.nodeName)
 }
 
+func (c *CollectConf) TaskResultsOutDir() string {
+	return filepath.Join(c.outputDir, "task-results", c.nodeName)
+}
+
 func (c *CollectConf) WLMOutDir() string { return filepath.Join(c.outputDir, "wlm", c.nodeName) }
 
 // works on all nodes but includes node name in file name
@@ -815,6 +844,30 @@ func (c *CollectConf) RestHTTPTimeout() int {
 	return c.restHTTPTimeout
 }
 
+// CollectorTimeoutSeconds is how long a collector may run past the time it is expected to take, 0 means no timeout
+func (c *CollectConf) CollectorTimeoutSeconds() int {
+	return c.collectorTimeoutSeconds
+}
+
+// JVMCaptureStartUTC is when the ttop, JFR and jstack captures start so they line up with the other nodes, zero starts them right away
+func (c *CollectConf) JVMCaptureStartUTC() time.Time {
+	return c.jvmCaptureStartUTC
+}
+
+// CollectionMode is the preset that filled in the keys ddc.yaml and the flags did not set
+func (c *CollectConf) CollectionMode() string {
+	return c.collectionMode
+}
+
+// EncryptTo are the recipients, or files listing them, that the tarball is encrypted to
+func (c *CollectConf) EncryptTo() []string {
+	return c.encryptTo
+}
+
+func (c *CollectConf) RequireEncryption() bool {
+	return c.requireEncryption
+}
+
 func (c *CollectConf) DremioRocksDBDir() string {
 	return c.dremioRocksDBDir
 }
@@ -70,4 +70,10 @@ const (
 	KeyJobProfilesNumRecentErrors  = "job-profiles-num-recent-errors"
 	KeyJobProfilesNumSlowPlanning  = "job-profiles-num-slow-planning"
 	KeyRestHTTPTimeout             = "rest-http-timeout"
+	KeyCollectorTimeoutSeconds     = "collector-timeout-seconds"
+	KeyJVMCaptureStartUTC          = "jvm-capture-start-utc"
+	KeyCollectionMode              = "collection-mode"
+	KeyCollectionModes             = "collection-modes"
+	KeyEncryptTo                   = "encrypt-to"
+	KeyRequireEncryption           = "require-encryption"
 )
@@ -21,8 +21,12 @@ func setDefault(confData map[string]interface{}, key string, value interface{})
 	}
 }
 
-// SetViperDefaults wires up default values for viper when the ddc.yaml or the cli flags do not set the value
-func SetViperDefaults(confData map[string]interface{}, hostName string, defaultCaptureSeconds int, outputDir string) {
+// SetViperDefaults wires up default values for viper when the ddc.yaml or the cli flags do not set the value,
+// the keys of the collection-mode come first and the defaults fill in the rest
+func SetViperDefaults(confData map[string]interface{}, hostName string, defaultCaptureSeconds int, outputDir string) error {
+	if err := applyCollectionMode(confData); err != nil {
+		return err
+	}
 	// set default config
 	setDefault(confData, KeyVerbose, "vv")
 	setDefault(confData, KeyDisableRESTAPI, false)
@@ -73,4 +77,9 @@ func SetViperDefaults(confData map[string]interface{}, hostName string, defaultC
 	setDefault(confData, KeyDremioCloudProjectID, "")
 	setDefault(confData, KeyAllowInsecureSSL, true)
 	setDefault(confData, KeyRestHTTPTimeout, 30)
+	setDefault(confData, KeyCollectorTimeoutSeconds, 1800)
+	setDefault(confData, KeyJVMCaptureStartUTC, "")
+	setDefault(confData, KeyEncryptTo, "")
+	setDefault(confData, KeyRequireEncryption, false)
+	return nil
 }
@@ -22,19 +22,21 @@ import (
 	"github.com/dremio/dremio-diagnostic-collector/cmd/local/conf"
 )
 
-func setupTestSetViperDefaults() (map[string]interface{}, string, int, string) {
+func setupTestSetViperDefaults(t *testing.T) (map[string]interface{}, string, int, string) {
 	hostName := "test-host"
 	defaultCaptureSeconds := 30
 	outputDir := "/tmp"
 	confData := make(map[string]interface{})
 	// Run the function.
-	conf.SetViperDefaults(confData, hostName, defaultCaptureSeconds, outputDir)
+	if err := conf.SetViperDefaults(confData, hostName, defaultCaptureSeconds, outputDir); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
 
 	return confData, hostName, defaultCaptureSeconds, outputDir
 }
 
 func TestSetViperDefaults(t *testing.T) {
-	confData, hostName, defaultCaptureSeconds, outputDir := setupTestSetViperDefaults()
+	confData, hostName, defaultCaptureSeconds, outputDir := setupTestSetViperDefaults(t)
 
 	checks := []struct {
 		key      string
@@ -84,6 +86,10 @@ func TestSetViperDefaults(t *testing.T) {
 		{conf.KeyNodeName, hostName},
 		{conf.KeyAcceptCollectionConsent, true},
 		{conf.KeyAllowInsecureSSL, true},
+		{conf.KeyEncryptTo, ""},
+		{conf.KeyJVMCaptureStartUTC, ""},
+		{conf.KeyCollectionMode, conf.CollectionModeStandard},
+		{conf.KeyRequireEncryption, false},
 	}
 
 	for _, check := range checks {
@@ -0,0 +1,135 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package conf
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// built in collection modes
+const (
+	// CollectionModeLight collects the configuration and logs only
+	CollectionModeLight = "light"
+	// CollectionModeStandard is the defaults
+	CollectionModeStandard = "standard"
+	// CollectionModePerformance runs long jstack, JFR and ttop captures and collects more job profiles
+	CollectionModePerformance = "performance"
+	// CollectionModeHealthcheck adds the access, audit and acceleration logs to the standard collection
+	CollectionModeHealthcheck = "healthcheck"
+)
+
+var collectionModes = map[string]map[string]interface{}{
+	CollectionModeLight: {
+		KeyCollectDiskUsage:          false,
+		KeyCollectJFR:                false,
+		KeyCollectJStack:             false,
+		KeyCollectTtop:               false,
+		KeyCaptureHeapDump:           false,
+		KeyCollectSystemTablesExport: false,
+		KeyCollectWLM:                false,
+		KeyCollectKVStoreReport:      false,
+		KeyNumberJobProfiles:         0,
+	},
+	CollectionModeStandard: {},
+	CollectionModePerformance: {
+		KeyCollectJFR:              true,
+		KeyCollectJStack:           true,
+		KeyCollectTtop:             true,
+		KeyDremioJStackTimeSeconds: 300,
+		KeyDremioJFRTimeSeconds:    300,
+		KeyDremioTtopTimeSeconds:   300,
+		KeyNumberJobProfiles:       50000,
+	},
+	CollectionModeHealthcheck: {
+		KeyCollectAccelerationLog: true,
+		KeyCollectAccessLog:       true,
+		KeyCollectAuditLog:        true,
+		KeyCaptureHeapDump:        false,
+	},
+}
+
+// CollectionModes are the built in collection modes and the ones defined under collection-modes in ddc.yaml, sorted
+func CollectionModes(confData map[string]interface{}) []string {
+	var names []string
+	for name := range collectionModes {
+		names = append(names, name)
+	}
+	if userModes, ok := confData[KeyCollectionModes].(map[string]interface{}); ok {
+		for name := range userModes {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// applyCollectionMode sets the keys of the collection-mode that are not already set, so keys in ddc.yaml or
+// passed as flags still take precedence
+func applyCollectionMode(confData map[string]interface{}) error {
+	setDefault(confData, KeyCollectionMode, CollectionModeStandard)
+	name := GetString(confData, KeyCollectionMode)
+	preset, err := collectionMode(confData, name)
+	if err != nil {
+		return err
+	}
+	for k, v := range preset {
+		setDefault(confData, k, v)
+	}
+	return nil
+}
+
+// CollectionModeSets is true when the collection-mode of confData sets key, whether or not ddc.yaml overrides it
+func CollectionModeSets(confData map[string]interface{}, key string) bool {
+	preset, err := collectionMode(confData, GetString(confData, KeyCollectionMode))
+	if err != nil {
+		return false
+	}
+	_, ok := preset[key]
+	return ok
+}
+
+// collectionMode is a built in mode or one from collection-modes in ddc.yaml
+func collectionMode(confData map[string]interface{}, name string) (map[string]interface{}, error) {
+	modes := make(map[string]interface{})
+	if userModes, ok := confData[KeyCollectionModes]; ok {
+		if modes, ok = userModes.(map[string]interface{}); !ok {
+			return nil, fmt.Errorf("%v must map mode names to ddc.yaml keys but was %T", KeyCollectionModes, userModes)
+		}
+	}
+	for userMode := range modes {
+		if _, builtIn := collectionModes[userMode]; builtIn {
+			return nil, fmt.Errorf("%v '%v' is built in, give it another name", KeyCollectionModes, userMode)
+		}
+	}
+	if preset, ok := collectionModes[name]; ok {
+		return preset, nil
+	}
+	mode, ok := modes[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown %v '%v', use one of %v", KeyCollectionMode, name, strings.Join(CollectionModes(confData), ", "))
+	}
+	preset, ok := mode.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%v '%v' must map ddc.yaml keys to values but was %T", KeyCollectionModes, name, mode)
+	}
+	for k := range preset {
+		if k == KeyCollectionMode || k == KeyCollectionModes {
+			return nil, fmt.Errorf("%v '%v' cannot set %v", KeyCollectionModes, name, k)
+		}
+	}
+	return preset, nil
+}
@@ -0,0 +1,129 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package conf_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dremio/dremio-diagnostic-collector/cmd/local/conf"
+)
+
+func TestCollectionModeFillsInUnsetKeys(t *testing.T) {
+	confData := map[string]interface{}{
+		conf.KeyCollectionMode: conf.CollectionModeLight,
+		conf.KeyCollectJStack:  true,
+	}
+	if err := conf.SetViperDefaults(confData, "test-host", 60, "/tmp"); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	checks := []struct {
+		key      string
+		expected interface{}
+	}{
+		{conf.KeyCollectJFR, false},
+		{conf.KeyCollectTtop, false},
+		{conf.KeyNumberJobProfiles, 0},
+		// set explicitly so the mode does not change it
+		{conf.KeyCollectJStack, true},
+		// not part of the mode so it keeps its default
+		{conf.KeyCollectServerLogs, true},
+	}
+	for _, check := range checks {
+		if actual := confData[check.key]; actual != check.expected {
+			t.Errorf("expected %v to be %v but was %v", check.key, check.expected, actual)
+		}
+	}
+}
+
+func TestCollectionModeSets(t *testing.T) {
+	confData := map[string]interface{}{conf.KeyCollectionMode: conf.CollectionModePerformance}
+	if !conf.CollectionModeSets(confData, conf.KeyNumberJobProfiles) {
+		t.Errorf("expected %v to set %v", conf.CollectionModePerformance, conf.KeyNumberJobProfiles)
+	}
+	confData[conf.KeyCollectionMode] = conf.CollectionModeStandard
+	if conf.CollectionModeSets(confData, conf.KeyNumberJobProfiles) {
+		t.Errorf("expected %v to leave %v at its default", conf.CollectionModeStandard, conf.KeyNumberJobProfiles)
+	}
+	confData[conf.KeyCollectionMode] = "unknown"
+	if conf.CollectionModeSets(confData, conf.KeyNumberJobProfiles) {
+		t.Error("expected an unknown mode to set nothing")
+	}
+}
+
+func TestCollectionModeFromDDCYaml(t *testing.T) {
+	yamlLoc := filepath.Join(t.TempDir(), "ddc.yaml")
+	yamlText := `
+collection-mode: nightly
+collection-modes:
+  nightly:
+    collect-jfr: false
+    dremio-logs-num-days: 1
+`
+	if err := os.WriteFile(yamlLoc, []byte(yamlText), 0600); err != nil {
+		t.Fatal(err)
+	}
+	confData, err := conf.ParseConfig(yamlLoc, make(map[string]string))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err := conf.SetViperDefaults(confData, "test-host", 60, "/tmp"); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if actual := conf.GetBool(confData, conf.KeyCollectJFR); actual {
+		t.Error("expected the nightly mode to turn off jfr")
+	}
+	if actual := conf.GetInt(confData, conf.KeyDremioLogsNumDays); actual != 1 {
+		t.Errorf("expected 1 day of logs but was %v", actual)
+	}
+	expected := []string{"healthcheck", "light", "nightly", "performance", "standard"}
+	if actual := conf.CollectionModes(confData); strings.Join(actual, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected modes %v but was %v", expected, actual)
+	}
+}
+
+func TestCollectionModeErrors(t *testing.T) {
+	for name, tc := range map[string]struct {
+		confData map[string]interface{}
+		expected string
+	}{
+		"unknown": {
+			confData: map[string]interface{}{conf.KeyCollectionMode: "missing"},
+			expected: "unknown collection-mode 'missing', use one of healthcheck, light, performance, standard",
+		},
+		"shadows a built in mode": {
+			confData: map[string]interface{}{
+				conf.KeyCollectionModes: map[string]interface{}{"light": map[string]interface{}{conf.KeyCollectJFR: true}},
+			},
+			expected: "collection-modes 'light' is built in, give it another name",
+		},
+		"sets the mode": {
+			confData: map[string]interface{}{
+				conf.KeyCollectionMode:  "loop",
+				conf.KeyCollectionModes: map[string]interface{}{"loop": map[string]interface{}{conf.KeyCollectionMode: "light"}},
+			},
+			expected: "collection-modes 'loop' cannot set collection-mode",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			err := conf.SetViperDefaults(tc.confData, "test-host", 60, "/tmp")
+			if err == nil || err.Error() != tc.expected {
+				t.Errorf("expected error '%v' but was '%v'", tc.expected, err)
+			}
+		})
+	}
+}
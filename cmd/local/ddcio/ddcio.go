@@ -16,6 +16,7 @@
 package ddcio
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
@@ -23,6 +24,7 @@ import (
 	"path"
 	"path/filepath"
 	"runtime"
+	"time"
 
 	"github.com/dremio/dremio-diagnostic-collector/pkg/simplelog"
 )
@@ -147,6 +149,11 @@ func GetFilesInDir(dir string) ([]os.DirEntry, error) {
 
 // Shell executes a shell command with shell expansion and appends its output to the provided io.Writer.
 func Shell(writer io.Writer, commandLine string) error {
+	return ShellContext(context.Background(), writer, commandLine)
+}
+
+// ShellContext is Shell but the command is killed once the context is done
+func ShellContext(ctx context.Context, writer io.Writer, commandLine string) error {
 	//this is a hack before we can do a longer term improvement of separating local-collect
 	// and the ddc command into different clis
 	shell := "bash"
@@ -155,9 +162,11 @@ func Shell(writer io.Writer, commandLine string) error {
 		shell = "cmd.exe"
 		fileArg = "/C"
 	}
-	cmd := exec.Command(shell, fileArg, commandLine)
+	cmd := exec.CommandContext(ctx, shell, fileArg, commandLine)
 	cmd.Stdout = writer
 	cmd.Stderr = writer
+	// children of the shell can keep the output open after the shell is killed
+	cmd.WaitDelay = 5 * time.Second
 
 	err := cmd.Run()
 	if err != nil {
@@ -0,0 +1,78 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jvmcollect
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dremio/dremio-diagnostic-collector/pkg/simplelog"
+)
+
+// MaxCaptureStartWait is the furthest in the future a capture start is honored, a start further away
+// usually means the clock of the node is off
+const MaxCaptureStartWait = time.Hour
+
+// capture names, they match the collector names of local-collect
+const (
+	CaptureTtop   = "ttop"
+	CaptureJFR    = "jfr"
+	CaptureJStack = "jstack"
+)
+
+var (
+	captureStartsMu sync.Mutex
+	captureStarts   = make(map[string]time.Time)
+)
+
+// WaitForCaptureStart blocks until start so the capture lines up with the other nodes, a zero start or one
+// that has already passed returns right away. The time the capture really started is kept for CaptureStarts
+func WaitForCaptureStart(ctx context.Context, capture string, start time.Time, now func() time.Time) error {
+	if !start.IsZero() {
+		wait := start.Sub(now())
+		switch {
+		case wait > MaxCaptureStartWait:
+			return fmt.Errorf("%v is to start at %v which is more than %v away, check the clock of the node", capture, start.UTC().Format(time.RFC3339), MaxCaptureStartWait)
+		case wait > 0:
+			simplelog.Infof("waiting %v to start %v at %v", wait.Round(time.Millisecond), capture, start.UTC().Format(time.RFC3339))
+			timer := time.NewTimer(wait)
+			defer timer.Stop()
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		default:
+			simplelog.Warningf("%v is starting %v after %v, it will not line up with the other nodes", capture, (-wait).Round(time.Millisecond), start.UTC().Format(time.RFC3339))
+		}
+	}
+	captureStartsMu.Lock()
+	defer captureStartsMu.Unlock()
+	captureStarts[capture] = now().UTC()
+	return nil
+}
+
+// CaptureStarts is when each capture passed WaitForCaptureStart
+func CaptureStarts() map[string]time.Time {
+	captureStartsMu.Lock()
+	defer captureStartsMu.Unlock()
+	starts := make(map[string]time.Time, len(captureStarts))
+	for k, v := range captureStarts {
+		starts[k] = v
+	}
+	return starts
+}
@@ -0,0 +1,70 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jvmcollect_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dremio/dremio-diagnostic-collector/cmd/local/jvmcollect"
+)
+
+func TestWaitForCaptureStartWaitsForTheStart(t *testing.T) {
+	start := time.Now().Add(300 * time.Millisecond)
+	if err := jvmcollect.WaitForCaptureStart(context.Background(), "wait-test", start, time.Now); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	started, ok := jvmcollect.CaptureStarts()["wait-test"]
+	if !ok {
+		t.Fatal("expected the start to be recorded")
+	}
+	if started.Before(start) {
+		t.Errorf("expected the capture to start at %v or later but it started at %v", start, started)
+	}
+}
+
+func TestWaitForCaptureStartDoesNotWaitForAPastStart(t *testing.T) {
+	begin := time.Now()
+	if err := jvmcollect.WaitForCaptureStart(context.Background(), "late-test", begin.Add(-time.Minute), time.Now); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if waited := time.Since(begin); waited > time.Second {
+		t.Errorf("expected no wait but waited %v", waited)
+	}
+	if _, ok := jvmcollect.CaptureStarts()["late-test"]; !ok {
+		t.Error("expected the start to be recorded")
+	}
+}
+
+func TestWaitForCaptureStartRejectsAFarStart(t *testing.T) {
+	err := jvmcollect.WaitForCaptureStart(context.Background(), "far-test", time.Now().Add(2*jvmcollect.MaxCaptureStartWait), time.Now)
+	if err == nil {
+		t.Fatal("expected an error for a start more than an hour away")
+	}
+	if _, ok := jvmcollect.CaptureStarts()["far-test"]; ok {
+		t.Error("expected no start to be recorded")
+	}
+}
+
+func TestWaitForCaptureStartIsCancelled(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := jvmcollect.WaitForCaptureStart(ctx, "cancel-test", time.Now().Add(time.Minute), time.Now)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the context error but was %v", err)
+	}
+}
@@ -27,12 +27,21 @@ import (
 	"github.com/dremio/dremio-diagnostic-collector/pkg/simplelog"
 )
 
+// HeapDumpCommand dumps the heap of the pid to hprofFile
+func HeapDumpCommand(hprofFile string, pid int) string {
+	return fmt.Sprintf("jmap -dump:format=b,file=%v %v", hprofFile, pid)
+}
+
+// HeapDumpFile is where the heap dump is written before it is gzipped
+func HeapDumpFile(c *conf.CollectConf) string {
+	return filepath.Join(c.OutputDir(), fmt.Sprintf("%v.hprof", c.NodeName()))
+}
+
 func RunCollectHeapDump(c *conf.CollectConf) error {
 	simplelog.Debug("Capturing Java Heap Dump")
 	dremioPID := c.DremioPID()
-	baseName := fmt.Sprintf("%v.hprof", c.NodeName())
-
-	hprofFile := filepath.Join(c.OutputDir(), baseName)
+	hprofFile := HeapDumpFile(c)
+	baseName := filepath.Base(hprofFile)
 	hprofGzFile := fmt.Sprintf("%v.gz", hprofFile)
 	if err := os.Remove(path.Clean(hprofGzFile)); err != nil {
 		simplelog.Warningf("unable to remove hprof.gz file with error %v", err)
@@ -41,7 +50,7 @@ func RunCollectHeapDump(c *conf.CollectConf) error {
 		simplelog.Warningf("unable to remove hprof file with error %v", err)
 	}
 	var w bytes.Buffer
-	if err := ddcio.Shell(&w, fmt.Sprintf("jmap -dump:format=b,file=%v %v", hprofFile, dremioPID)); err != nil {
+	if err := ddcio.Shell(&w, HeapDumpCommand(hprofFile, dremioPID)); err != nil {
 		return fmt.Errorf("unable to capture heap dump %v", err)
 	}
 	simplelog.Debugf("heap dump output %v", w.String())
@@ -17,6 +17,7 @@ package jvmcollect
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"strings"
 	"time"
@@ -26,10 +27,32 @@ import (
 	"github.com/dremio/dremio-diagnostic-collector/pkg/simplelog"
 )
 
-func RunCollectJFR(c *conf.CollectConf) error {
+// JFRUnlockCommand unlocks JFR on the older JVMs that still need it
+func JFRUnlockCommand(pid int) string {
+	return fmt.Sprintf("jcmd %v VM.unlock_commercial_features", pid)
+}
+
+// JFRStartCommand starts the DREMIO_JFR recording writing to the jfr output dir of the node
+func JFRStartCommand(c *conf.CollectConf) string {
+	return fmt.Sprintf("jcmd %v JFR.start name=\"DREMIO_JFR\" settings=profile maxage=%vs  filename=%v/%v.jfr dumponexit=true", c.DremioPID(), c.DremioJFRTimeSeconds(), c.JFROutDir(), c.NodeName())
+}
+
+// JFRDumpCommand writes the DREMIO_JFR recording to its file
+func JFRDumpCommand(pid int) string {
+	return fmt.Sprintf("jcmd %v JFR.dump name=\"DREMIO_JFR\"", pid)
+}
+
+// JFRStopCommand stops the DREMIO_JFR recording
+func JFRStopCommand(pid int) string {
+	return fmt.Sprintf("jcmd %v JFR.stop name=\"DREMIO_JFR\"", pid)
+}
+
+// RunCollectJFR records for the configured time, when the context is cancelled first the recording is stopped
+// without a dump so it does not keep running on the node
+func RunCollectJFR(ctx context.Context, c *conf.CollectConf) error {
 	var w bytes.Buffer
 	w = bytes.Buffer{}
-	if err := ddcio.Shell(&w, fmt.Sprintf("jcmd %v VM.unlock_commercial_features", c.DremioPID())); err != nil {
+	if err := ddcio.Shell(&w, JFRUnlockCommand(c.DremioPID())); err != nil {
 		simplelog.Warningf("Error trying to unlock commercial features %v. Note: newer versions of OpenJDK do not support the call VM.unlock_commercial_features. This is usually safe to ignore", err)
 	}
 
@@ -37,29 +60,43 @@ func RunCollectJFR(c *conf.CollectConf) error {
 
 	w = bytes.Buffer{}
 	// this is effectively a no op unless there is an existing recording running
-	if err := ddcio.Shell(&w, fmt.Sprintf("jcmd %v JFR.stop name=\"DREMIO_JFR\"", c.DremioPID())); err != nil {
+	if err := ddcio.Shell(&w, JFRStopCommand(c.DremioPID())); err != nil {
 		simplelog.Debugf("attempting to stop existing JFR failed, but this is usually expected: '%v' -- output: '%v'", err, w.String())
 	}
 	if strings.Contains(w.String(), "Stopped recording \"DREMIO_JFR\"") {
 		simplelog.Warningf("stopped a JFR recording named \"DREMIO_JFR\"")
 	}
 
+	if err := WaitForCaptureStart(ctx, CaptureJFR, c.JVMCaptureStartUTC(), time.Now); err != nil {
+		return err
+	}
 	w = bytes.Buffer{}
-	if err := ddcio.Shell(&w, fmt.Sprintf("jcmd %v JFR.start name=\"DREMIO_JFR\" settings=profile maxage=%vs  filename=%v/%v.jfr dumponexit=true", c.DremioPID(), c.DremioJFRTimeSeconds(), c.JFROutDir(), c.NodeName())); err != nil {
+	if err := ddcio.Shell(&w, JFRStartCommand(c)); err != nil {
 		return fmt.Errorf("unable to run JFR due to error %v", err)
 	}
 	simplelog.Debugf("node: %v - jfr start output - %v", c.NodeName(), w.String())
 	secondsWaiting := c.DremioJFRTimeSeconds()
-	time.Sleep(time.Duration(secondsWaiting) * time.Second)
+	timer := time.NewTimer(time.Duration(secondsWaiting) * time.Second)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+		simplelog.Warningf("collection cancelled, stopping JFR recording on %v", c.NodeName())
+		w = bytes.Buffer{}
+		if err := ddcio.Shell(&w, JFRStopCommand(c.DremioPID())); err != nil {
+			return fmt.Errorf("unable to stop JFR after cancellation due to error %v", err)
+		}
+		return ctx.Err()
+	}
 	// do not "optimize". the recording first needs to be stopped for all processes before collecting the data.
 	simplelog.Debugf("... stopping JFR %v", c.NodeName())
 	w = bytes.Buffer{}
-	if err := ddcio.Shell(&w, fmt.Sprintf("jcmd %v JFR.dump name=\"DREMIO_JFR\"", c.DremioPID())); err != nil {
+	if err := ddcio.Shell(&w, JFRDumpCommand(c.DremioPID())); err != nil {
 		return fmt.Errorf("unable to dump JFR due to error %v", err)
 	}
 	simplelog.Debugf("node: %v - jfr dump output %v", c.NodeName(), w.String())
 	w = bytes.Buffer{}
-	if err := ddcio.Shell(&w, fmt.Sprintf("jcmd %v JFR.stop name=\"DREMIO_JFR\"", c.DremioPID())); err != nil {
+	if err := ddcio.Shell(&w, JFRStopCommand(c.DremioPID())); err != nil {
 		return fmt.Errorf("unable to dump JFR due to error %v", err)
 	}
 	simplelog.Debugf("node: %v - jfr stop output %v", c.NodeName(), w.String())
@@ -15,6 +15,7 @@
 package jvmcollect_test
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
@@ -93,7 +94,7 @@ dremio-jfr-time-seconds: 2
 	if err != nil {
 		t.Fatal(err)
 	}
-	err = jvmcollect.RunCollectJFR(c)
+	err = jvmcollect.RunCollectJFR(context.Background(), c)
 	if err != nil {
 		t.Fatalf("expected no error but got %v", err)
 	}
@@ -191,7 +192,7 @@ dremio-jfr-time-seconds: 2
 		t.Fatal(err)
 	}
 
-	err = jvmcollect.RunCollectJFR(c)
+	err = jvmcollect.RunCollectJFR(context.Background(), c)
 	if err != nil {
 		t.Fatal(err)
 	}
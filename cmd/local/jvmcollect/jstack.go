@@ -17,6 +17,7 @@ package jvmcollect
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -27,20 +28,28 @@ import (
 	"github.com/dremio/dremio-diagnostic-collector/pkg/simplelog"
 )
 
-func RunCollectJStacks(c *conf.CollectConf) error {
-	return RunCollectJStacksWithTimeService(c, func() time.Time {
+// JStackCommand prints the threads of the pid with their locks
+func JStackCommand(pid int) string {
+	return fmt.Sprintf("jcmd %v Thread.print -l", pid)
+}
+
+func RunCollectJStacks(ctx context.Context, c *conf.CollectConf) error {
+	return RunCollectJStacksWithTimeService(ctx, c, func() time.Time {
 		return time.Now()
 	})
 }
 
-func RunCollectJStacksWithTimeService(c *conf.CollectConf, timer func() time.Time) error {
+func RunCollectJStacksWithTimeService(ctx context.Context, c *conf.CollectConf, timer func() time.Time) error {
 	simplelog.Debug("Collecting GC logs ...")
 	threadDumpFreq := c.DremioJStackFreqSeconds()
 	iterations := c.DremioJStackTimeSeconds() / threadDumpFreq
+	if err := WaitForCaptureStart(ctx, CaptureJStack, c.JVMCaptureStartUTC(), timer); err != nil {
+		return err
+	}
 	simplelog.Debugf("Running Java thread dumps every %v second(s) for a total of %v iterations ...", threadDumpFreq, iterations)
 	for i := 0; i < iterations; i++ {
 		var w bytes.Buffer
-		if err := ddcio.Shell(&w, fmt.Sprintf("jcmd %v Thread.print -l", c.DremioPID())); err != nil {
+		if err := ddcio.Shell(&w, JStackCommand(c.DremioPID())); err != nil {
 			simplelog.Warningf("unable to capture jstack of pid %v due to error %v", c.DremioPID(), err)
 		}
 		date := timer().Format("2006-01-02_15_04_05")
@@ -50,7 +59,12 @@ func RunCollectJStacksWithTimeService(c *conf.CollectConf, timer func() time.Tim
 		}
 		simplelog.Debugf("Saved %v", threadDumpFileName)
 		simplelog.Debugf("Waiting %v second(s) ...", threadDumpFreq)
-		time.Sleep(time.Duration(threadDumpFreq) * time.Second)
+		select {
+		case <-time.After(time.Duration(threadDumpFreq) * time.Second):
+		case <-ctx.Done():
+			simplelog.Warningf("collection cancelled, stopping thread dumps after %v of %v", i+1, iterations)
+			return ctx.Err()
+		}
 	}
 	return nil
 }
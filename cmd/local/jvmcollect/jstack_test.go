@@ -15,6 +15,7 @@
 package jvmcollect_test
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
@@ -83,7 +84,7 @@ dremio-jstack-freq-seconds: 1
 	now := time.Now()
 	counter := 0
 	var times []time.Time
-	err = jvmcollect.RunCollectJStacksWithTimeService(c, func() time.Time {
+	err = jvmcollect.RunCollectJStacksWithTimeService(context.Background(), c, func() time.Time {
 		counter++
 		current := now.Add(time.Duration(counter) * time.Second)
 		times = append(times, current)
@@ -16,6 +16,7 @@ package jvmcollect
 
 import (
 	"bufio"
+	"context"
 	"embed"
 	"errors"
 	"fmt"
@@ -50,6 +51,13 @@ type Ttop struct {
 type TtopArgs struct {
 	Interval int
 	PID      int
+	// Start is when sampling begins, zero starts right away
+	Start time.Time
+}
+
+// TtopCommand is the java command running sjk ttop against the pid every interval seconds
+func TtopCommand(sjk string, interval, pid int) []string {
+	return []string{"java", "-jar", sjk, "ttop", "-ri", fmt.Sprintf("%vs", interval), "-n", "100", "-p", fmt.Sprintf("%v", pid)}
 }
 
 func (t *Ttop) StartTtop(args TtopArgs) error {
@@ -79,7 +87,8 @@ func (t *Ttop) StartTtop(args TtopArgs) error {
 		return err
 	}
 
-	t.cmd = exec.Command("java", "-jar", sjk, "ttop", "-ri", fmt.Sprintf("%vs", interval), "-n", "100", "-p", fmt.Sprintf("%v", pid))
+	ttop := TtopCommand(sjk, interval, pid)
+	t.cmd = exec.Command(ttop[0], ttop[1:]...)
 
 	stdout, err := t.cmd.StdoutPipe()
 	if err != nil {
@@ -145,26 +154,35 @@ func (d *DateTimeTicker) WaitSeconds(interval int) {
 	time.Sleep(time.Duration(interval) * time.Second)
 }
 
-func RunTtopCollect(c *conf.CollectConf) error {
+func RunTtopCollect(ctx context.Context, c *conf.CollectConf) error {
 	simplelog.Debug("Starting ttop collection")
 	ttopArgs := TtopArgs{
 		Interval: c.DremioTtopFreqSeconds(),
 		PID:      c.DremioPID(),
+		Start:    c.JVMCaptureStartUTC(),
 	}
-	return OnLoop(ttopArgs, c.DremioTtopTimeSeconds(), c.TtopOutDir(), &Ttop{}, &DateTimeTicker{})
+	return OnLoop(ctx, ttopArgs, c.DremioTtopTimeSeconds(), c.TtopOutDir(), &Ttop{}, &DateTimeTicker{})
 }
 
-func OnLoop(ttopArgs TtopArgs, duration int, outDir string, ttopService TtopService, timeTicker TimeTicker) error {
+// OnLoop runs ttop for the duration once ttopArgs.Start is reached, when the context is cancelled ttop is killed at the next interval and nothing is written
+func OnLoop(ctx context.Context, ttopArgs TtopArgs, duration int, outDir string, ttopService TtopService, timeTicker TimeTicker) error {
+	if err := WaitForCaptureStart(ctx, CaptureTtop, ttopArgs.Start, time.Now); err != nil {
+		return err
+	}
 	err := ttopService.StartTtop(ttopArgs)
 	if err != nil {
 		return fmt.Errorf("unable to start ttop: %w", err)
 	}
 	interval := ttopArgs.Interval
 	times := duration / interval
-	for i := 0; i < times; i++ {
+	for i := 0; i < times && ctx.Err() == nil; i++ {
 		timeTicker.WaitSeconds(interval)
 	}
 	txt, err := ttopService.KillTtop()
+	if ctx.Err() != nil {
+		simplelog.Warning("collection cancelled, stopped ttop")
+		return ctx.Err()
+	}
 	if err != nil {
 		return fmt.Errorf("unable to get text from ttop: %w", err)
 	}
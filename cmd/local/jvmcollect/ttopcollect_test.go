@@ -15,6 +15,8 @@
 package jvmcollect_test
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
@@ -78,7 +80,7 @@ func TestTtopCollects(t *testing.T) {
 		PID:      pid,
 		Interval: interval,
 	}
-	if err := jvmcollect.OnLoop(ttopArgs, duration, outDir, ttopService, timeTicker); err != nil {
+	if err := jvmcollect.OnLoop(context.Background(), ttopArgs, duration, outDir, ttopService, timeTicker); err != nil {
 		t.Fatalf("unable to collect %v", err)
 	}
 
@@ -113,6 +115,44 @@ func TestTtopCollects(t *testing.T) {
 	}
 }
 
+// cancelTicker cancels the collection on the first wait
+type cancelTicker struct {
+	cancel context.CancelFunc
+	waited int
+}
+
+func (c *cancelTicker) WaitSeconds(_ int) {
+	c.waited++
+	c.cancel()
+}
+
+func TestTtopStopsWhenCancelled(t *testing.T) {
+	outDir := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	timeTicker := &cancelTicker{cancel: cancel}
+	ttopService := &MockTtopService{
+		text: "ttop file text",
+	}
+	ttopArgs := jvmcollect.TtopArgs{
+		PID:      1900,
+		Interval: 1,
+	}
+	err := jvmcollect.OnLoop(ctx, ttopArgs, 10, outDir, ttopService, timeTicker)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected %v but was %v", context.Canceled, err)
+	}
+	if timeTicker.waited != 1 {
+		t.Errorf("expected to call Wait once before stopping but it was %v", timeTicker.waited)
+	}
+	if !ttopService.killed {
+		t.Error("expected ttop to have been killed was not")
+	}
+	if _, err := os.Stat(filepath.Join(outDir, "ttop.txt")); err == nil {
+		t.Error("expected no ttop.txt to be written after cancellation")
+	}
+}
+
 func TestTtopExec(t *testing.T) {
 	ttop := &jvmcollect.Ttop{}
 	jarLoc := filepath.Join("testdata", "demo.jar")
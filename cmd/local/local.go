@@ -18,14 +18,17 @@ package cmd
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/fs"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"regexp"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/spf13/cobra"
@@ -40,7 +43,11 @@ import (
 	"github.com/dremio/dremio-diagnostic-collector/cmd/local/nodeinfocollect"
 	"github.com/dremio/dremio-diagnostic-collector/pkg/archive"
 	"github.com/dremio/dremio-diagnostic-collector/pkg/clusterstats"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/collectplan"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/consoleprint"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/encrypt"
 	"github.com/dremio/dremio-diagnostic-collector/pkg/simplelog"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/taskresults"
 
 	"github.com/dremio/dremio-diagnostic-collector/cmd/local/ddcio"
 	"github.com/dremio/dremio-diagnostic-collector/cmd/local/threading"
@@ -49,6 +56,8 @@ import (
 )
 
 var ddcYamlLoc string
+var dryRun bool
+var progressMode string
 
 func createAllDirs(c *conf.CollectConf) error {
 	var perms fs.FileMode = 0750
@@ -88,6 +97,9 @@ func createAllDirs(c *conf.CollectConf) error {
 	if err := os.MkdirAll(c.ClusterStatsOutDir(), perms); err != nil {
 		return fmt.Errorf("unable to create cluster-stats directory due to error %v", err)
 	}
+	if err := os.MkdirAll(c.TaskResultsOutDir(), perms); err != nil {
+		return fmt.Errorf("unable to create task-results directory due to error %v", err)
+	}
 	if err := os.MkdirAll(c.SystemTablesOutDir(), perms); err != nil {
 		return fmt.Errorf("unable to create system-tables directory due to error %v", err)
 	}
@@ -100,165 +112,310 @@ func createAllDirs(c *conf.CollectConf) error {
 	return nil
 }
 
-func collect(c *conf.CollectConf) error {
-	if err := createAllDirs(c); err != nil {
-		return fmt.Errorf("unable to create directories due to error %w", err)
+// scheduledCollector is a collector that runs in the thread pool, the name matches its entry in the dry run plan.
+// The JVM captures have a high priority so they are not held up by the log copying, which has a low one.
+type scheduledCollector struct {
+	name     string
+	priority int
+	run      func(ctx context.Context) error
+}
+
+// scheduleCollectors returns the collectors enabled by the configuration in the order they are added
+// to the thread pool along with the names of the ones that are skipped
+func scheduleCollectors(c *conf.CollectConf) (scheduled []scheduledCollector, skipped []string) {
+	add := func(name string, priority int, run func(ctx context.Context) error) {
+		scheduled = append(scheduled, scheduledCollector{name: name, priority: priority, run: run})
 	}
-	t, err := threading.NewThreadPool(c.NumberThreads(), 1)
-	if err != nil {
-		return fmt.Errorf("unable to spawn thread pool: %w", err)
+	wrapJob := func(j func() error) func(ctx context.Context) error {
+		return func(context.Context) error { return j() }
+	}
+	wrapConfigJob := func(j func(c *conf.CollectConf) error) func(ctx context.Context) error {
+		return func(context.Context) error { return j(c) }
 	}
-	wrapConfigJob := func(j func(c *conf.CollectConf) error) func() error {
-		return func() error { return j(c) }
+	// for the long running jobs that have to stop the jvm tooling when the collection is cancelled or times out
+	wrapContextJob := func(j func(ctx context.Context, c *conf.CollectConf) error) func(ctx context.Context) error {
+		return func(ctx context.Context) error { return j(ctx, c) }
 	}
 	if !c.IsDremioCloud() {
 		if !c.CollectDiskUsage() {
 			simplelog.Info("Skipping disk usage collection")
+			skipped = append(skipped, "disk-usage")
 		} else {
-			t.AddJob(wrapConfigJob(nodeinfocollect.RunCollectDiskUsage))
+			add("disk-usage", threading.PriorityNormal, wrapConfigJob(nodeinfocollect.RunCollectDiskUsage))
 		}
 
 		if !c.CollectDremioConfiguration() {
 			simplelog.Info("Skipping Dremio config collection")
+			skipped = append(skipped, "dremio-configuration")
 		} else {
-			t.AddJob(wrapConfigJob(configcollect.RunCollectDremioConfig))
+			add("dremio-configuration", threading.PriorityNormal, wrapConfigJob(configcollect.RunCollectDremioConfig))
 		}
 
 		if !c.CollectOSConfig() {
 			simplelog.Info("Skipping OS config collection")
+			skipped = append(skipped, "os-config")
 		} else {
-			t.AddJob(wrapConfigJob(runCollectOSConfig))
+			add("os-config", threading.PriorityNormal, wrapConfigJob(runCollectOSConfig))
 		}
 
 		// log collection
 
-		logCollector := logcollect.NewLogCollector(
-			c.DremioLogDir(),
-			c.LogsOutDir(),
-			c.GcLogsDir(),
-			c.DremioGCFilePattern(),
-			c.QueriesOutDir(),
-			c.DremioQueriesJSONNumDays(),
-			c.DremioLogsNumDays(),
-		)
+		logCollector := newLogCollector(c)
 
 		if !c.CollectQueriesJSON() && c.NumberJobProfilesToCollect() == 0 {
 			simplelog.Debug("Skipping queries.json collection")
+			skipped = append(skipped, "queries-json")
 		} else {
 			if !c.CollectQueriesJSON() {
 				simplelog.Warning("NOT Skipping collection of Queries JSON, because --number-job-profiles is greater than 0 and job profile download requires queries.json ...")
 			}
-			t.AddJob(logCollector.RunCollectQueriesJSON)
+			add("queries-json", threading.PriorityLow, wrapJob(logCollector.RunCollectQueriesJSON))
 		}
 
 		if !c.CollectServerLogs() {
 			simplelog.Debug("Skipping server log collection")
+			skipped = append(skipped, "server-logs")
 		} else {
-			t.AddJob(logCollector.RunCollectDremioServerLog)
+			add("server-logs", threading.PriorityLow, wrapJob(logCollector.RunCollectDremioServerLog))
 		}
 
 		if !c.CollectGCLogs() {
 			simplelog.Debug("Skipping gc log collection")
+			skipped = append(skipped, "gc-logs")
 		} else {
-			t.AddJob(logCollector.RunCollectGcLogs)
+			add("gc-logs", threading.PriorityLow, wrapJob(logCollector.RunCollectGcLogs))
 		}
 
 		if !c.CollectMetaRefreshLogs() {
 			simplelog.Debug("Skipping metadata refresh log collection")
+			skipped = append(skipped, "metadata-refresh-logs")
 		} else {
-			t.AddJob(logCollector.RunCollectMetadataRefreshLogs)
+			add("metadata-refresh-logs", threading.PriorityLow, wrapJob(logCollector.RunCollectMetadataRefreshLogs))
 		}
 
 		if !c.CollectReflectionLogs() {
 			simplelog.Debug("Skipping reflection log collection")
+			skipped = append(skipped, "reflection-logs")
 		} else {
-			t.AddJob(logCollector.RunCollectReflectionLogs)
+			add("reflection-logs", threading.PriorityLow, wrapJob(logCollector.RunCollectReflectionLogs))
 		}
 
 		if !c.CollectAccelerationLogs() {
 			simplelog.Debug("Skipping acceleration log collection")
+			skipped = append(skipped, "acceleration-logs")
 		} else {
-			t.AddJob(logCollector.RunCollectAccelerationLogs)
+			add("acceleration-logs", threading.PriorityLow, wrapJob(logCollector.RunCollectAccelerationLogs))
 		}
 
 		if !c.CollectAccessLogs() {
 			simplelog.Debug("Skipping access log collection")
+			skipped = append(skipped, "access-logs")
 		} else {
-			t.AddJob(logCollector.RunCollectDremioAccessLogs)
+			add("access-logs", threading.PriorityLow, wrapJob(logCollector.RunCollectDremioAccessLogs))
 		}
 
 		if !c.CollectAuditLogs() {
 			simplelog.Debug("Skipping audit log collection")
+			skipped = append(skipped, "audit-logs")
 		} else {
-			t.AddJob(logCollector.RunCollectDremioAuditLogs)
+			add("audit-logs", threading.PriorityLow, wrapJob(logCollector.RunCollectDremioAuditLogs))
 		}
 
 		if !c.CollectJVMFlags() {
 			simplelog.Debug("Skipping JVM Flags collection")
+			skipped = append(skipped, "jvm-flags")
 		} else {
-			t.AddJob(wrapConfigJob(jvmcollect.RunCollectJVMFlags))
+			add("jvm-flags", threading.PriorityNormal, wrapConfigJob(jvmcollect.RunCollectJVMFlags))
 		}
 		// rest call collections
 
 		if !c.CollectKVStoreReport() {
 			simplelog.Debug("Skipping KV store report collection")
+			skipped = append(skipped, "kv-store-report")
 		} else {
-			t.AddJob(wrapConfigJob(apicollect.RunCollectKvReport))
+			add("kv-store-report", threading.PriorityNormal, wrapConfigJob(apicollect.RunCollectKvReport))
 		}
 
 		if !c.CollectTtop() {
 			simplelog.Debugf("Skipping ttop collection")
+			skipped = append(skipped, "ttop")
 		} else {
-			t.AddJob(wrapConfigJob(jvmcollect.RunTtopCollect))
+			add("ttop", threading.PriorityHigh, wrapContextJob(jvmcollect.RunTtopCollect))
 		}
 		if !c.CollectJFR() {
 			simplelog.Debugf("Skipping Java Flight Recorder collection")
+			skipped = append(skipped, "jfr")
 		} else {
-			t.AddJob(wrapConfigJob(jvmcollect.RunCollectJFR))
+			add("jfr", threading.PriorityHigh, wrapContextJob(jvmcollect.RunCollectJFR))
 		}
 
 		if !c.CollectJStack() {
 			simplelog.Debugf("Skipping Java thread dumps collection")
+			skipped = append(skipped, "jstack")
 		} else {
-			t.AddJob(wrapConfigJob(jvmcollect.RunCollectJStacks))
+			add("jstack", threading.PriorityHigh, wrapContextJob(jvmcollect.RunCollectJStacks))
 		}
 
 		if !c.CaptureHeapDump() {
 			simplelog.Debugf("Skipping Java heap dump collection")
+			skipped = append(skipped, "heap-dump")
 		} else {
-			t.AddJob(wrapConfigJob(jvmcollect.RunCollectHeapDump))
+			add("heap-dump", threading.PriorityHigh, wrapConfigJob(jvmcollect.RunCollectHeapDump))
 		}
 	}
 
 	if !c.CollectWLM() {
 		simplelog.Debug("Skipping Workload Manager report collection")
+		skipped = append(skipped, "wlm")
 	} else {
-		t.AddJob(wrapConfigJob(apicollect.RunCollectWLM))
+		add("wlm", threading.PriorityNormal, wrapConfigJob(apicollect.RunCollectWLM))
 	}
 
 	if !c.CollectSystemTablesExport() {
 		simplelog.Debug("Skipping system tables collection")
+		skipped = append(skipped, "system-tables")
 	} else {
-		t.AddJob(wrapConfigJob(apicollect.RunCollectDremioSystemTables))
+		add("system-tables", threading.PriorityNormal, wrapConfigJob(apicollect.RunCollectDremioSystemTables))
 	}
+	return scheduled, skipped
+}
+
+func newLogCollector(c *conf.CollectConf) *logcollect.Collector {
+	return logcollect.NewLogCollector(
+		c.DremioLogDir(),
+		c.LogsOutDir(),
+		c.GcLogsDir(),
+		c.DremioGCFilePattern(),
+		c.QueriesOutDir(),
+		c.DremioQueriesJSONNumDays(),
+		c.DremioLogsNumDays(),
+	)
+}
 
-	if err := t.ProcessAndWait(); err != nil {
+// abandonedCollectorsWait is how long the archive waits for collectors left running after their timeout
+const abandonedCollectorsWait = 30 * time.Second
+
+// collect runs the collectors and returns the output dirs to leave out of the tarball, those of the
+// collectors that were still writing them after their timeout
+func collect(ctx context.Context, c *conf.CollectConf) ([]string, error) {
+	if err := createAllDirs(c); err != nil {
+		return nil, fmt.Errorf("unable to create directories due to error %w", err)
+	}
+	scheduled, skipped := scheduleCollectors(c)
+	t, err := newCollectorPool(c, scheduled)
+	if err != nil {
+		return nil, fmt.Errorf("unable to spawn thread pool: %w", err)
+	}
+	results := newTaskRecorder(c)
+	t.OnJobFinished(results.record)
+	for _, name := range skipped {
+		results.skip(name)
+	}
+
+	if err := t.ProcessAndWaitContext(ctx); err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("collection cancelled: %w", err)
+		}
 		simplelog.Errorf("thread pool has an error: %v", err)
 	}
 
-	//we wait on the thread pool to empty out as this is also multithreaded and takes the longest
+	//we wait on the thread pool to empty out as the job profiles read the queries.json collected by it
 	if c.NumberJobProfilesToCollect() == 0 {
 		simplelog.Debugf("Skipping job profiles collection")
+		results.skip("job-profiles")
 	} else {
-		if err := apicollect.RunCollectJobProfiles(c); err != nil {
-			simplelog.Errorf("during job profile collection there was an error: %v", err)
+		t.Add(threading.Job{Name: "job-profiles", Timeout: collectorTimeout(c, planJobProfiles), Run: func(context.Context) error {
+			return apicollect.RunCollectJobProfiles(c)
+		}})
+	}
+	t.Add(threading.Job{Name: "cluster-stats", Timeout: collectorTimeout(c, planClusterStats), Run: func(context.Context) error {
+		return runCollectClusterStats(c)
+	}})
+	if err := t.ProcessAndWaitContext(ctx); err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("collection cancelled: %w", err)
+		}
+		simplelog.Errorf("during job profile or cluster stats collection there was an error: %v", err)
+	}
+	var exclude []string
+	if running := t.WaitForAbandoned(abandonedCollectorsWait); len(running) > 0 {
+		outDirs := collectorOutDirs(c)
+		for _, name := range running {
+			if dir, ok := outDirs[name]; ok {
+				simplelog.Warningf("%v is still running after its timeout, %v is left out of the tarball as it may be incomplete", name, dir)
+				exclude = append(exclude, dir)
+			} else {
+				simplelog.Warningf("%v is still running after its timeout, the files it wrote may be incomplete", name)
+			}
 		}
 	}
+	if err := results.write(); err != nil {
+		simplelog.Errorf("unable to write %v: %v", taskresults.FileName, err)
+	}
+	return exclude, nil
+}
 
-	if err := runCollectClusterStats(c); err != nil {
-		simplelog.Errorf("during unable to collect cluster stats like cluster ID: %v", err)
+// collectorOutDirs are the output dirs written by a single collector
+func collectorOutDirs(c *conf.CollectConf) map[string]string {
+	return map[string]string{
+		"ttop":            c.TtopOutDir(),
+		"jfr":             c.JFROutDir(),
+		"jstack":          c.ThreadDumpsOutDir(),
+		"heap-dump":       c.HeapDumpsOutDir(),
+		"kv-store-report": c.KVstoreOutDir(),
+		"wlm":             c.WLMOutDir(),
+		"system-tables":   c.SystemTablesOutDir(),
+		"job-profiles":    c.JobProfilesOutDir(),
+		"cluster-stats":   c.ClusterStatsOutDir(),
 	}
-	return nil
+}
+
+// isSynchronizedCapture is true for the captures that wait for the common start of the nodes
+func isSynchronizedCapture(name string) bool {
+	switch name {
+	case jvmcollect.CaptureTtop, jvmcollect.CaptureJFR, jvmcollect.CaptureJStack:
+		return true
+	}
+	return false
+}
+
+// newCollectorPool adds the scheduled collectors to a thread pool of number-threads plus one thread for each
+// of the ttop, JFR and jstack captures. They wait for the common start of the nodes while holding their
+// thread, without their own threads they would take the number-threads, start one after another and hold
+// up the log copying until the start.
+func newCollectorPool(c *conf.CollectConf, scheduled []scheduledCollector) (*threading.ThreadPool, error) {
+	threads := c.NumberThreads()
+	for _, s := range scheduled {
+		if isSynchronizedCapture(s.name) {
+			threads++
+		}
+	}
+	t, err := threading.NewThreadPool(threads, 1)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range scheduled {
+		timeout := collectorTimeout(c, planners[s.name])
+		if isSynchronizedCapture(s.name) {
+			if wait := time.Until(c.JVMCaptureStartUTC()); timeout > 0 && wait > 0 {
+				timeout += wait
+			}
+		}
+		t.Add(threading.Job{Name: s.name, Priority: s.priority, Timeout: timeout, Run: s.run})
+	}
+	return t, nil
+}
+
+// collectorTimeout is how long the collector may run, the time its plan expects plus collector-timeout-seconds
+func collectorTimeout(c *conf.CollectConf, planner func(c *conf.CollectConf) collectplan.CollectorPlan) time.Duration {
+	if c.CollectorTimeoutSeconds() <= 0 {
+		return 0
+	}
+	seconds := c.CollectorTimeoutSeconds()
+	if planner != nil {
+		seconds += planner(c).DurationSeconds
+	}
+	return time.Duration(seconds) * time.Second
 }
 
 func findClusterID(c *conf.CollectConf) (string, error) {
@@ -415,6 +572,18 @@ func runCollectClusterStats(c *conf.CollectConf) error {
 	return os.WriteFile(filepath.Join(c.ClusterStatsOutDir(), "cluster-stats.json"), b, 0600)
 }
 
+// osConfigCommands are run in order by runCollectOSConfig, each output follows a "___\n>>> <command>" header in os_info.txt
+var osConfigCommands = []string{
+	"cat /etc/*-release",
+	"uname -r",
+	"cat /etc/issue",
+	"cat /proc/sys/kernel/hostname",
+	"cat /proc/meminfo",
+	"lscpu",
+	"mount",
+	"lsblk",
+}
+
 func runCollectOSConfig(c *conf.CollectConf) error {
 	simplelog.Debug("Collecting OS Information")
 	osInfoFile := filepath.Join(c.NodeInfoOutDir(), "os_info.txt")
@@ -431,74 +600,14 @@ func runCollectOSConfig(c *conf.CollectConf) error {
 		}
 	}()
 
-	simplelog.Debug("/etc/*-release")
-
-	_, err = w.Write([]byte("___\n>>> cat /etc/*-release\n"))
-	if err != nil {
-		simplelog.Warningf("unable to write release file header for os_info.txt due to error %v", err)
-	}
-
-	err = ddcio.Shell(w, "cat /etc/*-release")
-	if err != nil {
-		simplelog.Warningf("unable to write release files for os_info.txt due to error %v", err)
-	}
-
-	_, err = w.Write([]byte("___\n>>> uname -r\n"))
-	if err != nil {
-		simplelog.Warningf("unable to write uname header for os_info.txt due to error %v", err)
-	}
-
-	err = ddcio.Shell(w, "uname -r")
-	if err != nil {
-		simplelog.Warningf("unable to write uname -r for os_info.txt due to error %v", err)
-	}
-	_, err = w.Write([]byte("___\n>>> cat /etc/issue\n"))
-	if err != nil {
-		simplelog.Warningf("unable to write cat /etc/issue header for os_info.txt due to error %v", err)
-	}
-	err = ddcio.Shell(w, "cat /etc/issue")
-	if err != nil {
-		simplelog.Warningf("unable to write /etc/issue for os_info.txt due to error %v", err)
-	}
-	_, err = w.Write([]byte("___\n>>> cat /proc/sys/kernel/hostname\n"))
-	if err != nil {
-		simplelog.Warningf("unable to write hostname for os_info.txt due to error %v", err)
-	}
-	err = ddcio.Shell(w, "cat /proc/sys/kernel/hostname")
-	if err != nil {
-		simplelog.Warningf("unable to write hostname for os_info.txt due to error %v", err)
-	}
-	_, err = w.Write([]byte("___\n>>> cat /proc/meminfo\n"))
-	if err != nil {
-		simplelog.Warningf("unable to write /proc/meminfo header for os_info.txt due to error %v", err)
-	}
-	err = ddcio.Shell(w, "cat /proc/meminfo")
-	if err != nil {
-		simplelog.Warningf("unable to write /proc/meminfo for os_info.txt due to error %v", err)
-	}
-	_, err = w.Write([]byte("___\n>>> lscpu\n"))
-	if err != nil {
-		simplelog.Warningf("unable to write lscpu header for os_info.txt due to error %v", err)
-	}
-	err = ddcio.Shell(w, "lscpu")
-	if err != nil {
-		simplelog.Warningf("unable to write lscpu for os_info.txt due to error %v", err)
-	}
-	_, err = w.Write([]byte("___\n>>> mount\n"))
-	if err != nil {
-		simplelog.Warningf("unable to write mount header for os_info.txt due to error %v", err)
-	}
-	err = ddcio.Shell(w, "mount")
-	if err != nil {
-		simplelog.Warningf("unable to write mount for os_info.txt due to error %v", err)
-	}
-	_, err = w.Write([]byte("___\n>>> lsblk\n"))
-	if err != nil {
-		simplelog.Warningf("unable to write lsblk header for os_info.txt due to error %v", err)
-	}
-	err = ddcio.Shell(w, "lsblk")
-	if err != nil {
-		simplelog.Warningf("unable to write lsblk for os_info.txt due to error %v", err)
+	for _, command := range osConfigCommands {
+		simplelog.Debug(command)
+		if _, err := w.Write([]byte("___\n>>> " + command + "\n")); err != nil {
+			simplelog.Warningf("unable to write %v header for os_info.txt due to error %v", command, err)
+		}
+		if err := ddcio.Shell(w, command); err != nil {
+			simplelog.Warningf("unable to write %v for os_info.txt due to error %v", command, err)
+		}
 	}
 
 	simplelog.Debugf("... Collecting OS Information from %v COMPLETED", c.NodeName())
@@ -532,7 +641,14 @@ var LocalCollectCmd = &cobra.Command{
 			}
 			overrides[flag.Name] = flag.Value.String()
 		})
-		msg, err := Execute(args, overrides)
+		if err := consoleprint.SetProgress(progressMode); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		// ddc stops local-collect with SIGTERM when the collection is cancelled or times out
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		msg, err := Execute(ctx, args, overrides)
 		if err != nil {
 			fmt.Println(errors.Unwrap(err).Error())
 			os.Exit(1)
@@ -541,7 +657,7 @@ var LocalCollectCmd = &cobra.Command{
 	},
 }
 
-func Execute(args []string, overrides map[string]string) (string, error) {
+func Execute(ctx context.Context, args []string, overrides map[string]string) (string, error) {
 	simplelog.Infof("ddc local-collect version: %v", versions.GetCLIVersion())
 	simplelog.Infof("args: %v", strings.Join(args, " "))
 	fmt.Println(strings.TrimSpace(versions.GetCLIVersion()))
@@ -553,6 +669,18 @@ func Execute(args []string, overrides map[string]string) (string, error) {
 	}
 
 	fmt.Println("looking for logs in: " + c.DremioLogDir())
+	if dryRun {
+		// nothing is collected so there is nothing to consent to yet, the plan is printed last so ddc can find it
+		plan, err := buildPlan(c)
+		if err != nil {
+			return "", fmt.Errorf("unable to build plan: %w", err)
+		}
+		b, err := json.MarshalIndent(plan, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("unable to marshal plan: %w", err)
+		}
+		return string(b), nil
+	}
 	if !c.AcceptCollectionConsent() {
 		fmt.Println(consent.OutputConsent(c))
 		return "", errors.New("no consent given")
@@ -560,7 +688,8 @@ func Execute(args []string, overrides map[string]string) (string, error) {
 
 	// Run application
 	simplelog.Info("Starting collection...")
-	if err := collect(c); err != nil {
+	exclude, err := collect(ctx, c)
+	if err != nil {
 		return "", fmt.Errorf("unable to collect: %w", err)
 	}
 
@@ -572,9 +701,23 @@ func Execute(args []string, overrides map[string]string) (string, error) {
 	}
 	tarballName := filepath.Join(c.TarballOutDir(), c.NodeName()+".tar.gz")
 	simplelog.Debugf("collection complete. Archiving %v to %v...", c.OutputDir(), tarballName)
-	if err := archive.TarGzDir(c.OutputDir(), tarballName); err != nil {
+	if _, err := archive.ArchiveDir(c.OutputDir(), tarballName, archive.Options{Format: archive.TarGz, Exclude: exclude}); err != nil {
 		return "", fmt.Errorf("unable to compress archive from folder '%v exiting due to error %w", c.OutputDir(), err)
 	}
+	if ctx.Err() != nil {
+		// ddc gave up on this node while archiving so the tarball will never be picked up
+		if err := os.Remove(tarballName); err != nil {
+			simplelog.Warningf("unable to remove tarball %v after cancellation due to error %v", tarballName, err)
+		}
+		return "", fmt.Errorf("collection cancelled: %w", ctx.Err())
+	}
+	if len(c.EncryptTo()) > 0 {
+		encrypted, err := encrypt.ReplaceFile(tarballName, c.EncryptTo())
+		if err != nil {
+			return "", err
+		}
+		tarballName = encrypted
+	}
 	simplelog.Infof("Archive %v complete", tarballName)
 	endTime := time.Now().Unix()
 	fi, err := os.Stat(tarballName)
@@ -609,6 +752,11 @@ func init() {
 	LocalCollectCmd.Flags().Bool("capture-heap-dump", false, "Run the Heap Dump collector")
 	LocalCollectCmd.Flags().Bool("allow-insecure-ssl", false, "When true allow insecure ssl certs when doing API calls")
 	LocalCollectCmd.Flags().Bool("disable-rest-api", false, "disable all REST API calls, this will disable job profile, WLM, and KVM reports")
+	LocalCollectCmd.Flags().String("encrypt-to", "", "comma separated age (age1...) or ssh public keys, or files listing them one per line, the tarball is encrypted to them and written as <node>.tar.gz.age")
+	LocalCollectCmd.Flags().String("collection-mode", "", fmt.Sprintf("preset of collectors and capture times: %v, or one defined under collection-modes in ddc.yaml, keys set in ddc.yaml still take precedence, defaults to the collection-mode of ddc.yaml or %v", strings.Join(conf.CollectionModes(nil), ", "), conf.CollectionModeStandard))
+	LocalCollectCmd.Flags().String("jvm-capture-start-utc", "", "RFC3339 UTC time at which the ttop, JFR and jstack captures start, ddc sets it to the same time on every node so the capture windows line up")
+	LocalCollectCmd.Flags().StringVar(&progressMode, "progress", consoleprint.ProgressAuto, "how task progress is shown: 'tui' prints a . or x per finished task, 'plain' prints a line per task start and finish, 'json' prints them as json lines and 'auto' is tui when stdout is a terminal and plain otherwise")
+	LocalCollectCmd.Flags().BoolVar(&dryRun, "dry-run", false, "print a json plan of the resolved configuration and every collector that would run, with durations and estimated sizes, without collecting anything")
 
 	execLoc, err := os.Executable()
 	if err != nil {
@@ -16,16 +16,20 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"reflect"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/dremio/dremio-diagnostic-collector/cmd/local/conf"
+	"github.com/dremio/dremio-diagnostic-collector/cmd/local/jvmcollect"
 )
 
 func writeConfWithYamlText(tmpOutputDir, yamlTextMinusTmpOutputDir string) string {
@@ -171,7 +175,7 @@ is-dremio-cloud: false
 	if err != nil {
 		t.Fatalf("reading config %v", err)
 	}
-	if err := collect(c); err != nil {
+	if _, err := collect(context.Background(), c); err != nil {
 		t.Fatal(err)
 	}
 	if err := cmd.Process.Kill(); err != nil {
@@ -263,7 +267,7 @@ is-dremio-cloud: false
 	if err != nil {
 		t.Fatalf("reading config %v", err)
 	}
-	if err := collect(c); err != nil {
+	if _, err := collect(context.Background(), c); err != nil {
 		t.Fatal(err)
 	}
 	if err := cmd.Process.Kill(); err != nil {
@@ -343,3 +347,70 @@ func TestParseClassPathVersion(t *testing.T) {
 		t.Errorf("expected %v but was '%v'", expected, version)
 	}
 }
+
+func TestJVMCapturesStartTogetherWithDefaultThreads(t *testing.T) {
+	start := time.Now().UTC().Add(2 * time.Second).Truncate(time.Second)
+	tmpDirForConf := filepath.Join(t.TempDir(), "ddc")
+	yaml := fmt.Sprintf(`
+dremio-pid-detection: false
+dremio-pid: %v
+jvm-capture-start-utc: "%v"
+`, os.Getpid(), start.Format(time.RFC3339))
+	yamlLocation := writeConfWithYamlText(tmpDirForConf, yaml)
+	c, err := conf.ReadConf(make(map[string]string), yamlLocation)
+	if err != nil {
+		t.Fatalf("reading config %v", err)
+	}
+	if c.NumberThreads() != 2 {
+		t.Fatalf("expected the default of 2 threads but was %v", c.NumberThreads())
+	}
+	scheduled, _ := scheduleCollectors(c)
+	var captures []string
+	var mu sync.Mutex
+	var othersDone []time.Time
+	for i, s := range scheduled {
+		name := s.name
+		if isSynchronizedCapture(name) {
+			captures = append(captures, name)
+			scheduled[i].run = func(ctx context.Context) error {
+				if err := jvmcollect.WaitForCaptureStart(ctx, name, start, time.Now); err != nil {
+					return err
+				}
+				// the capture itself takes a while, a capture waiting for a thread would start this late
+				time.Sleep(500 * time.Millisecond)
+				return nil
+			}
+			continue
+		}
+		scheduled[i].run = func(context.Context) error {
+			time.Sleep(10 * time.Millisecond)
+			mu.Lock()
+			defer mu.Unlock()
+			othersDone = append(othersDone, time.Now())
+			return nil
+		}
+	}
+	if !reflect.DeepEqual(captures, []string{jvmcollect.CaptureTtop, jvmcollect.CaptureJFR, jvmcollect.CaptureJStack}) {
+		t.Fatalf("expected ttop, jfr and jstack to be on by default but was %v", captures)
+	}
+	pool, err := newCollectorPool(c, scheduled)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pool.ProcessAndWait(); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	starts := jvmcollect.CaptureStarts()
+	for _, name := range captures {
+		if skew := starts[name].Sub(start); skew < 0 || skew > 200*time.Millisecond {
+			t.Errorf("expected %v to start at %v but it started at %v", name, start, starts[name])
+		}
+	}
+	// the other collectors do not wait behind the captures
+	for _, done := range othersDone {
+		if done.After(start) {
+			t.Errorf("expected the other collectors to finish before the captures start at %v but one finished at %v", start, done)
+			break
+		}
+	}
+}
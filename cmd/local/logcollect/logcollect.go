@@ -248,3 +248,53 @@ func (l *Collector) exportArchivedLogs(srcLogDir string, unzippedFile string, lo
 	}
 	return nil
 }
+
+// FindArchivedLogs returns the files exportArchivedLogs would copy, the current log followed by the archives of the last archiveDays
+func FindArchivedLogs(srcLogDir string, unzippedFile string, logPrefix string, archiveDays int) []string {
+	var found []string
+	src := path.Join(srcLogDir, unzippedFile)
+	if _, err := os.Stat(src); err == nil {
+		found = append(found, src)
+	}
+	files, err := os.ReadDir(filepath.Join(srcLogDir, "archive"))
+	if err != nil {
+		return found
+	}
+	today := time.Now()
+	for i := 0; i <= archiveDays; i++ {
+		processingDate := today.AddDate(0, 0, -i).Format("2006-01-02")
+		for _, f := range files {
+			if strings.HasPrefix(f.Name(), fmt.Sprintf("%v.%v", logPrefix, processingDate)) {
+				found = append(found, filepath.Join(srcLogDir, "archive", f.Name()))
+			}
+		}
+	}
+	return found
+}
+
+// FindGcLogs returns the gc logs RunCollectGcLogs would copy
+func (l *Collector) FindGcLogs() []string {
+	var found []string
+	if l.gcLogsDir == "" {
+		return found
+	}
+	files, err := os.ReadDir(path.Clean(l.gcLogsDir))
+	if err != nil {
+		return found
+	}
+	logAgeLimit := time.Now().AddDate(0, 0, -l.dremioLogsNumDays)
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		if matched, err := filepath.Match(l.dremioGCFilePattern, file.Name()); err != nil || !matched {
+			continue
+		}
+		info, err := file.Info()
+		if err != nil || info.ModTime().Before(logAgeLimit) {
+			continue
+		}
+		found = append(found, filepath.Join(l.gcLogsDir, file.Name()))
+	}
+	return found
+}
@@ -0,0 +1,348 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// cmd package contains all the command line flag and initialization logic for commands
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/dremio/dremio-diagnostic-collector/cmd/local/conf"
+	"github.com/dremio/dremio-diagnostic-collector/cmd/local/jvmcollect"
+	"github.com/dremio/dremio-diagnostic-collector/cmd/local/logcollect"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/collectplan"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/versions"
+)
+
+// rough sizes for output we cannot measure before it is captured, they are only used for the dry run estimate
+const (
+	commandOutputBytes     = 16 * 1024
+	osConfigBytes          = 64 * 1024
+	ttopBytesPerSample     = 16 * 1024
+	jfrBytesPerSecond      = 32 * 1024
+	threadDumpBytes        = 512 * 1024
+	restResponseBytes      = 64 * 1024
+	systemTableRowBytes    = 512
+	jobProfileBytes        = 64 * 1024
+	jobProfilesPerSecond   = 25
+	defaultHeapDumpBytes   = 4 * 1024 * 1024 * 1024
+	dremioConfigFileBytes  = 8 * 1024
+	clusterStatsOutputSize = 1024
+)
+
+// jvmCaptureSeconds maps the keys turning on the jstack, JFR and ttop captures to the keys of their durations
+var jvmCaptureSeconds = map[string]string{
+	conf.KeyCollectJStack: conf.KeyDremioJStackTimeSeconds,
+	conf.KeyCollectJFR:    conf.KeyDremioJFRTimeSeconds,
+	conf.KeyCollectTtop:   conf.KeyDremioTtopTimeSeconds,
+}
+
+// JVMCapturesEnabled is true when the configuration turns on any of the jstack, JFR and ttop captures
+func JVMCapturesEnabled(confData map[string]interface{}) bool {
+	for enabled := range jvmCaptureSeconds {
+		if conf.GetBool(confData, enabled) {
+			return true
+		}
+	}
+	return false
+}
+
+// ExpectedSeconds is roughly how long local-collect runs with the configuration, without the wait for the
+// common start of the nodes: the longest of the jstack, JFR and ttop captures, which run at the same time,
+// then the job profiles, which are only collected with a PAT
+func ExpectedSeconds(confData map[string]interface{}, patSet bool) int {
+	var captures int
+	for enabled, seconds := range jvmCaptureSeconds {
+		if conf.GetBool(confData, enabled) && conf.GetInt(confData, seconds) > captures {
+			captures = conf.GetInt(confData, seconds)
+		}
+	}
+	if !patSet {
+		return captures
+	}
+	return captures + conf.GetInt(confData, conf.KeyNumberJobProfiles)/jobProfilesPerSecond
+}
+
+// planners describe each collector scheduleCollectors can add to the thread pool
+var planners = map[string]func(c *conf.CollectConf) collectplan.CollectorPlan{
+	"disk-usage":            planDiskUsage,
+	"dremio-configuration":  planDremioConfiguration,
+	"os-config":             planOSConfig,
+	"queries-json":          planArchivedLog("queries.json", "queries", func(c *conf.CollectConf) int { return c.DremioQueriesJSONNumDays() }),
+	"server-logs":           planServerLogs,
+	"gc-logs":               planGCLogs,
+	"metadata-refresh-logs": planArchivedLog("metadata_refresh.log", "metadata_refresh", logsNumDays),
+	"reflection-logs":       planArchivedLog("reflection.log", "reflection", logsNumDays),
+	"acceleration-logs":     planArchivedLog("acceleration.log", "acceleration", logsNumDays),
+	"access-logs":           planArchivedLog("access.log", "access", logsNumDays),
+	"audit-logs":            planArchivedLog("audit.json", "audit", logsNumDays),
+	"jvm-flags":             planJVMFlags,
+	"kv-store-report":       planKVStoreReport,
+	"ttop":                  planTtop,
+	"jfr":                   planJFR,
+	"jstack":                planJStack,
+	"heap-dump":             planHeapDump,
+	"wlm":                   planWLM,
+	"system-tables":         planSystemTables,
+}
+
+// buildPlan resolves what collect would do with the configuration without running any collector
+func buildPlan(c *conf.CollectConf) (collectplan.NodePlan, error) {
+	plan := collectplan.NodePlan{
+		NodeName:           c.NodeName(),
+		DDCVersion:         strings.TrimSpace(versions.GetCLIVersion()),
+		CollectionMode:     c.CollectionMode(),
+		DremioPID:          c.DremioPID(),
+		DremioPIDDetection: c.DremioPIDDetection(),
+		DremioLogDir:       c.DremioLogDir(),
+		DremioConfDir:      c.DremioConfDir(),
+		DremioGCLogsDir:    c.GcLogsDir(),
+		DremioRocksDBDir:   c.DremioRocksDBDir(),
+		OutputDir:          c.OutputDir(),
+		Tarball:            filepath.Join(c.TarballOutDir(), c.NodeName()+".tar.gz"),
+		NumberThreads:      c.NumberThreads(),
+		Collectors:         []collectplan.CollectorPlan{},
+	}
+	scheduled, skipped := scheduleCollectors(c)
+	plan.Skipped = append([]string{}, skipped...)
+	var durations []int
+	for _, s := range scheduled {
+		planner, ok := planners[s.name]
+		if !ok {
+			return plan, fmt.Errorf("no dry run plan for collector %v", s.name)
+		}
+		p := planner(c)
+		p.Name = s.name
+		plan.Collectors = append(plan.Collectors, p)
+		durations = append(durations, p.DurationSeconds)
+	}
+	plan.EstimatedDurationSeconds = collectplan.EstimateDuration(durations, c.NumberThreads())
+
+	// these run one after another once the thread pool is done
+	if c.NumberJobProfilesToCollect() == 0 {
+		plan.Skipped = append(plan.Skipped, "job-profiles")
+	} else {
+		p := planJobProfiles(c)
+		plan.Collectors = append(plan.Collectors, p)
+		plan.EstimatedDurationSeconds += p.DurationSeconds
+	}
+	plan.Collectors = append(plan.Collectors, planClusterStats(c))
+
+	for _, p := range plan.Collectors {
+		plan.EstimatedBytes += p.EstimatedBytes
+	}
+	return plan, nil
+}
+
+func logsNumDays(c *conf.CollectConf) int {
+	return c.DremioLogsNumDays()
+}
+
+// sizeOf adds up the size of the files, files we cannot stat are left out
+func sizeOf(files []string) int64 {
+	var total int64
+	for _, f := range files {
+		if info, err := os.Stat(f); err == nil {
+			total += info.Size()
+		}
+	}
+	return total
+}
+
+func planDiskUsage(c *conf.CollectConf) collectplan.CollectorPlan {
+	p := collectplan.CollectorPlan{
+		Commands:       []string{"df -h"},
+		EstimatedBytes: commandOutputBytes,
+	}
+	// mirrors the kubernetes only check in RunCollectDiskUsage
+	if strings.Contains(c.NodeName(), "dremio-master") {
+		p.Commands = append(p.Commands, "du -sh /opt/dremio/data/db/*")
+		p.EstimatedBytes += commandOutputBytes
+	}
+	return p
+}
+
+func planDremioConfiguration(c *conf.CollectConf) collectplan.CollectorPlan {
+	var reads []string
+	for _, f := range []string{"dremio.conf", "dremio-env", "logback.xml", "logback-access.xml"} {
+		reads = append(reads, filepath.Join(c.DremioConfDir(), f))
+	}
+	size := sizeOf(reads)
+	if size == 0 {
+		size = dremioConfigFileBytes
+	}
+	return collectplan.CollectorPlan{Reads: reads, EstimatedBytes: size}
+}
+
+func planOSConfig(_ *conf.CollectConf) collectplan.CollectorPlan {
+	return collectplan.CollectorPlan{
+		Commands:       append([]string(nil), osConfigCommands...),
+		EstimatedBytes: osConfigBytes,
+	}
+}
+
+func planArchivedLog(unzippedFile, logPrefix string, days func(c *conf.CollectConf) int) func(c *conf.CollectConf) collectplan.CollectorPlan {
+	return func(c *conf.CollectConf) collectplan.CollectorPlan {
+		reads := logcollect.FindArchivedLogs(c.DremioLogDir(), unzippedFile, logPrefix, days(c))
+		return collectplan.CollectorPlan{Reads: reads, EstimatedBytes: sizeOf(reads)}
+	}
+}
+
+func planServerLogs(c *conf.CollectConf) collectplan.CollectorPlan {
+	p := planArchivedLog("server.log", "server", logsNumDays)(c)
+	serverOut := filepath.Join(c.DremioLogDir(), "server.out")
+	if _, err := os.Stat(serverOut); err == nil {
+		p.Reads = append(p.Reads, serverOut)
+		p.EstimatedBytes += sizeOf([]string{serverOut})
+	}
+	return p
+}
+
+func planGCLogs(c *conf.CollectConf) collectplan.CollectorPlan {
+	reads := newLogCollector(c).FindGcLogs()
+	return collectplan.CollectorPlan{Reads: reads, EstimatedBytes: sizeOf(reads)}
+}
+
+func planJVMFlags(_ *conf.CollectConf) collectplan.CollectorPlan {
+	return collectplan.CollectorPlan{Commands: []string{"jps -v"}, EstimatedBytes: commandOutputBytes}
+}
+
+func planKVStoreReport(c *conf.CollectConf) collectplan.CollectorPlan {
+	return collectplan.CollectorPlan{
+		Requests:       []string{"GET " + c.DremioEndpoint() + "/apiv2/kvstore/report"},
+		EstimatedBytes: restResponseBytes,
+	}
+}
+
+func planTtop(c *conf.CollectConf) collectplan.CollectorPlan {
+	samples := 0
+	if c.DremioTtopFreqSeconds() > 0 {
+		samples = c.DremioTtopTimeSeconds() / c.DremioTtopFreqSeconds()
+	}
+	return collectplan.CollectorPlan{
+		Commands:        []string{strings.Join(jvmcollect.TtopCommand("sjk.jar", c.DremioTtopFreqSeconds(), c.DremioPID()), " ")},
+		DurationSeconds: c.DremioTtopTimeSeconds(),
+		EstimatedBytes:  int64(samples) * ttopBytesPerSample,
+	}
+}
+
+func planJFR(c *conf.CollectConf) collectplan.CollectorPlan {
+	return collectplan.CollectorPlan{
+		Commands: []string{
+			jvmcollect.JFRUnlockCommand(c.DremioPID()),
+			jvmcollect.JFRStartCommand(c),
+			jvmcollect.JFRDumpCommand(c.DremioPID()),
+			jvmcollect.JFRStopCommand(c.DremioPID()),
+		},
+		DurationSeconds: c.DremioJFRTimeSeconds(),
+		EstimatedBytes:  int64(c.DremioJFRTimeSeconds()) * jfrBytesPerSecond,
+	}
+}
+
+func planJStack(c *conf.CollectConf) collectplan.CollectorPlan {
+	dumps := 0
+	if c.DremioJStackFreqSeconds() > 0 {
+		dumps = c.DremioJStackTimeSeconds() / c.DremioJStackFreqSeconds()
+	}
+	return collectplan.CollectorPlan{
+		Commands:        []string{fmt.Sprintf("%v (%v times, every %v seconds)", jvmcollect.JStackCommand(c.DremioPID()), dumps, c.DremioJStackFreqSeconds())},
+		DurationSeconds: c.DremioJStackTimeSeconds(),
+		EstimatedBytes:  int64(dumps) * threadDumpBytes,
+	}
+}
+
+func planHeapDump(c *conf.CollectConf) collectplan.CollectorPlan {
+	// the heap dump is about the size of the resident memory of the jvm
+	size, err := residentBytes(c.DremioPID())
+	if err != nil {
+		size = defaultHeapDumpBytes
+	}
+	return collectplan.CollectorPlan{
+		Commands:       []string{jvmcollect.HeapDumpCommand(jvmcollect.HeapDumpFile(c), c.DremioPID())},
+		EstimatedBytes: size,
+	}
+}
+
+// residentBytes reads VmRSS of the process from /proc
+func residentBytes(pid int) (int64, error) {
+	f, err := os.Open(filepath.Clean(fmt.Sprintf("/proc/%v/status", pid)))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 3 && fields[0] == "VmRSS:" {
+			kb, err := strconv.ParseInt(fields[1], 10, 64)
+			if err != nil {
+				return 0, fmt.Errorf("unable to parse VmRSS for pid %v: %w", pid, err)
+			}
+			return kb * 1024, nil
+		}
+	}
+	return 0, fmt.Errorf("no VmRSS found for pid %v", pid)
+}
+
+func planWLM(c *conf.CollectConf) collectplan.CollectorPlan {
+	return collectplan.CollectorPlan{
+		Requests: []string{
+			"GET " + c.DremioEndpoint() + "/api/v3/wlm/queue",
+			"GET " + c.DremioEndpoint() + "/api/v3/wlm/rule",
+		},
+		EstimatedBytes: 2 * restResponseBytes,
+	}
+}
+
+func planSystemTables(c *conf.CollectConf) collectplan.CollectorPlan {
+	systables := c.Systemtables()
+	sqlurl := c.DremioEndpoint() + "/api/v3/sql"
+	if c.IsDremioCloud() {
+		systables = c.SystemtablesDremioCloud()
+		sqlurl = c.DremioEndpoint() + "/v0/projects/" + c.DremioCloudProjectID() + "/sql"
+	}
+	var requests []string
+	for _, systable := range systables {
+		requests = append(requests, fmt.Sprintf("POST %v SELECT * FROM sys.%v", sqlurl, systable))
+	}
+	return collectplan.CollectorPlan{
+		Requests:       requests,
+		EstimatedBytes: int64(len(systables)) * int64(c.SystemTablesRowLimit()) * systemTableRowBytes,
+	}
+}
+
+func planJobProfiles(c *conf.CollectConf) collectplan.CollectorPlan {
+	n := c.NumberJobProfilesToCollect()
+	return collectplan.CollectorPlan{
+		Name:            "job-profiles",
+		Reads:           []string{filepath.Join(c.QueriesOutDir(), "queries.json*")},
+		Requests:        []string{fmt.Sprintf("GET %v/apiv2/support/<job id>/download (up to %v times)", c.DremioEndpoint(), n)},
+		DurationSeconds: n / jobProfilesPerSecond,
+		EstimatedBytes:  int64(n) * jobProfileBytes,
+	}
+}
+
+func planClusterStats(c *conf.CollectConf) collectplan.CollectorPlan {
+	return collectplan.CollectorPlan{
+		Name:           "cluster-stats",
+		Commands:       []string{fmt.Sprintf("jcmd %v VM.system_properties", c.DremioPID())},
+		Reads:          []string{c.DremioRocksDBDir()},
+		EstimatedBytes: clusterStatsOutputSize,
+	}
+}
@@ -0,0 +1,193 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// cmd package contains all the command line flag and initialization logic for commands
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dremio/dremio-diagnostic-collector/cmd/local/conf"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/collectplan"
+)
+
+func TestBuildPlan(t *testing.T) {
+	tmpDirForConf := filepath.Join(t.TempDir(), "ddc")
+	yaml := `
+dremio-pid-detection: false
+number-threads: 1
+collect-ttop: true
+dremio-ttop-time-seconds: 30
+dremio-ttop-freq-seconds: 10
+collect-access-log: false
+collect-gc-logs: false
+`
+	yamlLocation := writeConfWithYamlText(tmpDirForConf, yaml)
+	c, err := conf.ReadConf(make(map[string]string), yamlLocation)
+	if err != nil {
+		t.Fatalf("reading config %v", err)
+	}
+	plan, err := buildPlan(c)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	collectors := make(map[string]collectplan.CollectorPlan)
+	for _, p := range plan.Collectors {
+		collectors[p.Name] = p
+	}
+
+	serverLog := filepath.Join("testdata", "fs", "opt", "dremio", "logs", "server.log")
+	info, err := os.Stat(serverLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverLogs, ok := collectors["server-logs"]
+	if !ok {
+		t.Fatalf("expected server-logs in the plan %#v", plan.Collectors)
+	}
+	if len(serverLogs.Reads) != 1 || serverLogs.Reads[0] != serverLog {
+		t.Errorf("expected server-logs to read %v but was %v", serverLog, serverLogs.Reads)
+	}
+	if serverLogs.EstimatedBytes != info.Size() {
+		t.Errorf("expected server-logs estimate of %v but was %v", info.Size(), serverLogs.EstimatedBytes)
+	}
+
+	ttop, ok := collectors["ttop"]
+	if !ok {
+		t.Fatalf("expected ttop in the plan %#v", plan.Collectors)
+	}
+	if ttop.DurationSeconds != 30 || ttop.EstimatedBytes != 3*ttopBytesPerSample {
+		t.Errorf("unexpected ttop plan %#v", ttop)
+	}
+	// the plan shows the command the ttop collector runs
+	expectedTtop := fmt.Sprintf("java -jar sjk.jar ttop -ri 10s -n 100 -p %v", c.DremioPID())
+	if len(ttop.Commands) != 1 || ttop.Commands[0] != expectedTtop {
+		t.Errorf("expected ttop command %q but was %v", expectedTtop, ttop.Commands)
+	}
+	if plan.EstimatedDurationSeconds != 30 {
+		t.Errorf("expected an estimated duration of 30 seconds but was %v", plan.EstimatedDurationSeconds)
+	}
+
+	// without a pid the jvm captures are turned off by the configuration
+	for _, name := range []string{"jfr", "jstack", "heap-dump", "access-logs", "gc-logs", "job-profiles"} {
+		if _, ok := collectors[name]; ok {
+			t.Errorf("expected %v to be skipped", name)
+		}
+	}
+	var total int64
+	for _, p := range plan.Collectors {
+		total += p.EstimatedBytes
+	}
+	if plan.EstimatedBytes != total {
+		t.Errorf("expected estimated bytes %v to add up to %v", plan.EstimatedBytes, total)
+	}
+
+	// nothing is collected
+	if _, err := os.Stat(c.LogsOutDir()); !os.IsNotExist(err) {
+		t.Errorf("expected logs dir %v to not exist but stat returned %v", c.LogsOutDir(), err)
+	}
+}
+
+func TestExpectedSeconds(t *testing.T) {
+	confData := map[string]interface{}{conf.KeyCollectionMode: conf.CollectionModePerformance}
+	if err := conf.SetViperDefaults(confData, "test-host", 60, "/tmp"); err != nil {
+		t.Fatal(err)
+	}
+	// the captures run at the same time so only the longest counts
+	if seconds := ExpectedSeconds(confData, false); seconds != 300 {
+		t.Errorf("expected 300 seconds without a PAT but was %v", seconds)
+	}
+	if seconds := ExpectedSeconds(confData, true); seconds != 300+50000/jobProfilesPerSecond {
+		t.Errorf("expected the job profiles to be added with a PAT but was %v", seconds)
+	}
+}
+
+func TestPlanOSConfigShowsTheCollectedCommands(t *testing.T) {
+	commands := planOSConfig(nil).Commands
+	if !reflect.DeepEqual(commands, osConfigCommands) {
+		t.Errorf("expected the os-config plan to show %v but was %v", osConfigCommands, commands)
+	}
+}
+
+func TestJVMCapturesEnabled(t *testing.T) {
+	confData := map[string]interface{}{conf.KeyCollectionMode: conf.CollectionModeLight}
+	if err := conf.SetViperDefaults(confData, "test-host", 60, "/tmp"); err != nil {
+		t.Fatal(err)
+	}
+	confData[conf.KeyCollectJStack] = false
+	confData[conf.KeyCollectJFR] = false
+	confData[conf.KeyCollectTtop] = false
+	if JVMCapturesEnabled(confData) {
+		t.Error("expected no jvm capture to be enabled")
+	}
+	confData[conf.KeyCollectTtop] = true
+	if !JVMCapturesEnabled(confData) {
+		t.Error("expected ttop to enable the jvm captures")
+	}
+}
+
+func TestEveryScheduledCollectorHasAPlan(t *testing.T) {
+	tmpDirForConf := filepath.Join(t.TempDir(), "ddc")
+	yaml := `
+dremio-pid-detection: false
+collect-acceleration-log: true
+collect-access-log: true
+collect-audit-log: true
+dremio-pat-token: "my-pat"
+dremio-endpoint: "http://localhost:9047"
+`
+	yamlLocation := writeConfWithYamlText(tmpDirForConf, yaml)
+	c, err := conf.ReadConf(make(map[string]string), yamlLocation)
+	if err != nil {
+		t.Fatalf("reading config %v", err)
+	}
+	names := make(map[string]bool)
+	scheduled, skipped := scheduleCollectors(c)
+	for _, s := range scheduled {
+		names[s.name] = true
+	}
+	for _, s := range skipped {
+		names[s] = true
+	}
+	for name := range planners {
+		if !names[name] {
+			t.Errorf("planner %v does not match any collector", name)
+		}
+	}
+}
+
+func TestCollectorTimeoutAddsThePlannedDuration(t *testing.T) {
+	tmpDirForConf := filepath.Join(t.TempDir(), "ddc")
+	yaml := `
+dremio-pid-detection: false
+dremio-jstack-time-seconds: 120
+collector-timeout-seconds: 300
+`
+	yamlLocation := writeConfWithYamlText(tmpDirForConf, yaml)
+	c, err := conf.ReadConf(make(map[string]string), yamlLocation)
+	if err != nil {
+		t.Fatalf("reading config %v", err)
+	}
+	if timeout := collectorTimeout(c, planners["jstack"]); timeout != 420*time.Second {
+		t.Errorf("expected jstack to time out after 420s but was %v", timeout)
+	}
+	if timeout := collectorTimeout(c, planners["os-config"]); timeout != 300*time.Second {
+		t.Errorf("expected os-config to time out after 300s but was %v", timeout)
+	}
+}
@@ -0,0 +1,161 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/dremio/dremio-diagnostic-collector/cmd/local/conf"
+	"github.com/dremio/dremio-diagnostic-collector/cmd/local/jvmcollect"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/simplelog"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/taskresults"
+)
+
+// taskOutputs are the files each collector writes to, as globs, so the bytes it wrote can be counted
+// once every collector is done, collectors that share a directory are told apart by the file names
+var taskOutputs = map[string]func(c *conf.CollectConf) []string{
+	"disk-usage":            outputsIn(func(c *conf.CollectConf) string { return c.NodeInfoOutDir() }, "diskusage.txt", "rocksdb_disk_allocation.txt"),
+	"dremio-configuration":  outputsIn(func(c *conf.CollectConf) string { return c.ConfigurationOutDir() }, "*"),
+	"os-config":             outputsIn(func(c *conf.CollectConf) string { return c.NodeInfoOutDir() }, "os_info.txt"),
+	"queries-json":          outputsIn(func(c *conf.CollectConf) string { return c.QueriesOutDir() }, "queries*"),
+	"server-logs":           outputsIn(func(c *conf.CollectConf) string { return c.LogsOutDir() }, "server.*"),
+	"metadata-refresh-logs": outputsIn(func(c *conf.CollectConf) string { return c.LogsOutDir() }, "metadata_refresh*"),
+	"reflection-logs":       outputsIn(func(c *conf.CollectConf) string { return c.LogsOutDir() }, "reflection*"),
+	"acceleration-logs":     outputsIn(func(c *conf.CollectConf) string { return c.LogsOutDir() }, "acceleration*"),
+	"access-logs":           outputsIn(func(c *conf.CollectConf) string { return c.LogsOutDir() }, "access*"),
+	"audit-logs":            outputsIn(func(c *conf.CollectConf) string { return c.LogsOutDir() }, "audit*"),
+	"gc-logs": func(c *conf.CollectConf) []string {
+		return []string{filepath.Join(c.LogsOutDir(), c.DremioGCFilePattern())}
+	},
+	"jvm-flags":       outputsIn(func(c *conf.CollectConf) string { return c.NodeInfoOutDir() }, "jvm_settings.txt"),
+	"kv-store-report": outputsIn(func(c *conf.CollectConf) string { return c.KVstoreOutDir() }, "*"),
+	"ttop":            outputsIn(func(c *conf.CollectConf) string { return c.TtopOutDir() }, "*"),
+	"jfr":             outputsIn(func(c *conf.CollectConf) string { return c.JFROutDir() }, "*.jfr"),
+	"jstack":          outputsIn(func(c *conf.CollectConf) string { return c.ThreadDumpsOutDir() }, "*"),
+	"heap-dump":       outputsIn(func(c *conf.CollectConf) string { return c.HeapDumpsOutDir() }, "*"),
+	"wlm":             outputsIn(func(c *conf.CollectConf) string { return c.WLMOutDir() }, "*"),
+	"system-tables":   outputsIn(func(c *conf.CollectConf) string { return c.SystemTablesOutDir() }, "*"),
+	"job-profiles":    outputsIn(func(c *conf.CollectConf) string { return c.JobProfilesOutDir() }, "*"),
+	"cluster-stats":   outputsIn(func(c *conf.CollectConf) string { return c.ClusterStatsOutDir() }, "*"),
+}
+
+func outputsIn(dir func(c *conf.CollectConf) string, patterns ...string) func(c *conf.CollectConf) []string {
+	return func(c *conf.CollectConf) []string {
+		var globs []string
+		for _, p := range patterns {
+			globs = append(globs, filepath.Join(dir(c), p))
+		}
+		return globs
+	}
+}
+
+// taskRecorder keeps the result of every collector of the node as they finish
+type taskRecorder struct {
+	c       *conf.CollectConf
+	mu      sync.Mutex
+	results []taskresults.TaskResult
+}
+
+func newTaskRecorder(c *conf.CollectConf) *taskRecorder {
+	return &taskRecorder{c: c}
+}
+
+// record is called by the thread pool when a collector is done, a collector that timed out has the timeout as error
+func (r *taskRecorder) record(name string, start time.Time, err error) {
+	startUTC := start.UTC()
+	result := taskresults.TaskResult{
+		Name:            name,
+		Status:          taskresults.StatusOK,
+		StartTimeUTC:    &startUTC,
+		DurationSeconds: time.Since(start).Seconds(),
+	}
+	if err != nil {
+		result.Status = taskresults.StatusFailed
+		result.Error = err.Error()
+	}
+	r.add(result)
+}
+
+func (r *taskRecorder) skip(name string) {
+	r.add(taskresults.TaskResult{Name: name, Status: taskresults.StatusSkipped})
+}
+
+func (r *taskRecorder) add(result taskresults.TaskResult) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.results = append(r.results, result)
+}
+
+// write counts the bytes of every collector that ran, adds when the jvm captures started and writes the results to the task-results directory of the node
+func (r *taskRecorder) write() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	captureStarts := jvmcollect.CaptureStarts()
+	for i, result := range r.results {
+		if start, ok := captureStarts[result.Name]; ok {
+			r.results[i].CaptureStartUTC = &start
+		}
+		outputs, ok := taskOutputs[result.Name]
+		if !ok || result.Status == taskresults.StatusSkipped {
+			continue
+		}
+		r.results[i].Bytes = bytesMatching(outputs(r.c))
+	}
+	nodeResults := taskresults.NodeResults{NodeName: r.c.NodeName(), Tasks: r.results}
+	if requested := r.c.JVMCaptureStartUTC(); !requested.IsZero() {
+		requested = requested.UTC()
+		nodeResults.CaptureStartRequestedUTC = &requested
+	}
+	b, err := json.MarshalIndent(nodeResults, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to marshal task results: %w", err)
+	}
+	return os.WriteFile(filepath.Join(r.c.TaskResultsOutDir(), taskresults.FileName), b, 0600)
+}
+
+// bytesMatching adds up the size of the files matching the globs, including everything under matching directories
+func bytesMatching(patterns []string) int64 {
+	var total int64
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			simplelog.Warningf("unable to match %v: %v", pattern, err)
+			continue
+		}
+		for _, m := range matches {
+			err := filepath.WalkDir(m, func(_ string, d fs.DirEntry, err error) error {
+				if err != nil || d.IsDir() {
+					return err
+				}
+				info, err := d.Info()
+				if err != nil {
+					return err
+				}
+				total += info.Size()
+				return nil
+			})
+			if err != nil {
+				simplelog.Warningf("unable to size %v: %v", m, err)
+			}
+		}
+	}
+	return total
+}
@@ -0,0 +1,105 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dremio/dremio-diagnostic-collector/cmd/local/conf"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/taskresults"
+)
+
+func TestTaskRecorderWritesResults(t *testing.T) {
+	tmpDirForConf := filepath.Join(t.TempDir(), "ddc")
+	yamlLocation := writeConfWithYamlText(tmpDirForConf, "dremio-pid-detection: false\n")
+	c, err := conf.ReadConf(make(map[string]string), yamlLocation)
+	if err != nil {
+		t.Fatalf("reading config %v", err)
+	}
+	if err := createAllDirs(c); err != nil {
+		t.Fatal(err)
+	}
+	r := newTaskRecorder(c)
+	if err := os.WriteFile(filepath.Join(c.LogsOutDir(), "server.log.gz"), []byte("12345"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	r.record("server-logs", time.Now(), nil)
+	// another collector writing to the same directory is not counted for server-logs
+	if err := os.WriteFile(filepath.Join(c.LogsOutDir(), "access.log.gz"), []byte("123"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	r.record("wlm", time.Now(), errors.New("401 unauthorized"))
+	r.skip("jfr")
+	if err := r.write(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(filepath.Join(c.TaskResultsOutDir(), taskresults.FileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var results taskresults.NodeResults
+	if err := json.Unmarshal(b, &results); err != nil {
+		t.Fatal(err)
+	}
+	if results.NodeName != c.NodeName() || len(results.Tasks) != 3 {
+		t.Fatalf("unexpected results %#v", results)
+	}
+	byName := make(map[string]taskresults.TaskResult)
+	for _, task := range results.Tasks {
+		byName[task.Name] = task
+	}
+	if task := byName["server-logs"]; task.Status != taskresults.StatusOK || task.Bytes != 5 || task.StartTimeUTC == nil {
+		t.Errorf("unexpected server-logs result %#v", task)
+	}
+	if task := byName["wlm"]; task.Status != taskresults.StatusFailed || task.Error != "401 unauthorized" {
+		t.Errorf("unexpected wlm result %#v", task)
+	}
+	if task := byName["jfr"]; task.Status != taskresults.StatusSkipped || task.StartTimeUTC != nil {
+		t.Errorf("unexpected jfr result %#v", task)
+	}
+}
+
+func TestEveryCollectorHasOutputs(t *testing.T) {
+	tmpDirForConf := filepath.Join(t.TempDir(), "ddc")
+	yaml := `
+dremio-pid-detection: false
+collect-acceleration-log: true
+collect-access-log: true
+collect-audit-log: true
+dremio-pat-token: "my-pat"
+dremio-endpoint: "http://localhost:9047"
+`
+	yamlLocation := writeConfWithYamlText(tmpDirForConf, yaml)
+	c, err := conf.ReadConf(make(map[string]string), yamlLocation)
+	if err != nil {
+		t.Fatalf("reading config %v", err)
+	}
+	scheduled, skipped := scheduleCollectors(c)
+	names := append([]string{"job-profiles", "cluster-stats"}, skipped...)
+	for _, s := range scheduled {
+		names = append(names, s.name)
+	}
+	for _, name := range names {
+		if _, ok := taskOutputs[name]; !ok {
+			t.Errorf("collector %v has no outputs to count the bytes of", name)
+		}
+	}
+}
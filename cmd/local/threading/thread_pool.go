@@ -16,101 +16,283 @@
 package threading
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"sort"
 	"sync"
+	"time"
 
+	"github.com/dremio/dremio-diagnostic-collector/pkg/consoleprint"
 	"github.com/dremio/dremio-diagnostic-collector/pkg/simplelog"
 )
 
+// job priorities, higher priorities start first
+const (
+	// PriorityHigh is for time sensitive work like JVM captures that should not wait behind bulk copying
+	PriorityHigh = 10
+	// PriorityNormal is the priority of jobs added with AddJob and AddNamedJob
+	PriorityNormal = 0
+	// PriorityLow is for bulk work like copying logs
+	PriorityLow = -10
+)
+
+// abandonAfter is how long a job that timed out has to return before the pool moves on without it
+const abandonAfter = 10 * time.Second
+
+// Job is a unit of work for the thread pool
+type Job struct {
+	// Name is what the job is reported under in the progress output and in errors, jobs without
+	// a name are left out of the progress output
+	Name string
+	// Priority orders the jobs, jobs of the same priority start in the order they were added
+	Priority int
+	// Timeout cancels the context of the job once it has run this long, 0 uses the timeout of the pool
+	Timeout time.Duration
+	Run     func(ctx context.Context) error
+}
+
 type ThreadPool struct {
-	wg               sync.WaitGroup
 	numberThreads    int
-	jobs             chan func() error
+	jobs             []Job
 	pendingJobs      int
 	totalJobs        int
+	skippedJobs      int
 	loggingFrequency int
+	jobTimeout       time.Duration
+	finished         func(name string, start time.Time, err error)
+	errs             []error
+	abandoned        map[int]string
+	abandonedJobs    int
+	abandonedWG      sync.WaitGroup
 	mut              sync.Mutex
 }
 
 func NewThreadPool(numberThreads int, loggingFrequency int) (*ThreadPool, error) {
-	if numberThreads == 0 {
-		return &ThreadPool{}, errors.New("invalid number of threads at 0")
-	}
-
-	//by default support 4 million jobs
-	jobs := make(chan func() error, 4000000)
-	return &ThreadPool{
-		numberThreads:    numberThreads,
-		jobs:             jobs,
-		loggingFrequency: loggingFrequency,
-	}, nil
+	return NewThreadPoolWithJobQueue(numberThreads, 0, loggingFrequency)
 }
 
+// NewThreadPoolWithJobQueue is NewThreadPool with room for jobQueueSize jobs reserved up front
 func NewThreadPoolWithJobQueue(numberThreads, jobQueueSize int, loggingFrequency int) (*ThreadPool, error) {
 	if numberThreads == 0 {
 		return &ThreadPool{}, errors.New("invalid number of threads at 0")
 	}
-	jobs := make(chan func() error, jobQueueSize)
-
 	return &ThreadPool{
 		numberThreads:    numberThreads,
-		jobs:             jobs,
+		jobs:             make([]Job, 0, jobQueueSize),
 		loggingFrequency: loggingFrequency,
 	}, nil
 }
 
-// AddJob adds a job to the thread pool. It increases the wait group counter and sends the job to the jobs channel.
+// SetJobTimeout sets the timeout of the jobs that do not have their own, 0 turns it off
+func (t *ThreadPool) SetJobTimeout(timeout time.Duration) {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+	t.jobTimeout = timeout
+}
+
+// OnJobFinished calls finished after every job that ran, err is the timeout when it timed out
+func (t *ThreadPool) OnJobFinished(finished func(name string, start time.Time, err error)) {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+	t.finished = finished
+}
+
+// AddJob adds a job to the thread pool that is not shown in the progress output, like the many small
+// jobs of a pool nested in another job.
 func (t *ThreadPool) AddJob(job func() error) {
+	t.Add(Job{Priority: PriorityNormal, Run: func(context.Context) error { return job() }})
+}
+
+// AddNamedJob adds a job to the thread pool that is reported under name when it starts and finishes.
+func (t *ThreadPool) AddNamedJob(name string, job func() error) {
+	t.Add(Job{Name: name, Priority: PriorityNormal, Run: func(context.Context) error { return job() }})
+}
+
+// Add adds a job to the thread pool, it is started by the next ProcessAndWait.
+func (t *ThreadPool) Add(job Job) {
 	t.mut.Lock()
+	defer t.mut.Unlock()
 	t.pendingJobs++
 	t.totalJobs++
-	t.mut.Unlock()
-	t.wg.Add(1)
-	t.jobs <- job
+	t.jobs = append(t.jobs, job)
 }
 
-// worker listens for jobs on the jobs channel and executes them. Each job runs on its own goroutine.
-func (t *ThreadPool) worker() {
-	for job := range t.jobs {
-		err := job()
-		if err != nil {
-			fmt.Print("x")
-			simplelog.Errorf("Failed to execute job: %v", err)
+// worker runs the jobs of the queue one after another. Once the context is cancelled the remaining jobs are drained without being run.
+func (t *ThreadPool) worker(ctx context.Context, queue <-chan Job) {
+	for job := range queue {
+		if ctx.Err() != nil {
+			t.mut.Lock()
+			t.pendingJobs--
+			t.skippedJobs++
+			t.mut.Unlock()
+			continue
+		}
+		name := job.Name
+		if name != "" {
+			consoleprint.TaskStarted(name)
 		} else {
-			fmt.Print(".")
+			name = "job"
+		}
+		start := time.Now()
+		err := t.run(ctx, job)
+		if err != nil {
+			simplelog.Errorf("Failed to execute job %v: %v", name, err)
+		}
+		if job.Name != "" {
+			consoleprint.TaskFinished(name, time.Since(start), err)
+		}
+		t.mut.Lock()
+		finished := t.finished
+		t.mut.Unlock()
+		if finished != nil {
+			finished(name, start, err)
 		}
 		t.mut.Lock()
+		if err != nil {
+			t.errs = append(t.errs, fmt.Errorf("%v: %w", name, err))
+		}
 		t.pendingJobs--
 		jobsCompleted := t.totalJobs - t.pendingJobs
 		if jobsCompleted%t.loggingFrequency == 0 {
 			simplelog.Infof("%v/%v tasks completed", jobsCompleted, t.totalJobs)
 		}
 		t.mut.Unlock()
-		t.wg.Done()
 	}
 }
 
+// run runs the job with its timeout. A job that does not return once its context is cancelled by
+// the timeout is left running after abandonAfter so it cannot stall the pool, it keeps its goroutine
+// until it returns and may still be writing its output. WaitForAbandoned tells which ones are left.
+func (t *ThreadPool) run(ctx context.Context, job Job) error {
+	timeout := job.Timeout
+	if timeout == 0 {
+		t.mut.Lock()
+		timeout = t.jobTimeout
+		t.mut.Unlock()
+	}
+	if timeout <= 0 {
+		return job.Run(ctx)
+	}
+	jobCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- job.Run(jobCtx)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-jobCtx.Done():
+	}
+	if ctx.Err() != nil {
+		// cancelled rather than timed out, running jobs stop on their own and are waited for
+		return <-done
+	}
+	select {
+	case <-done:
+	case <-time.After(abandonAfter):
+		simplelog.Warningf("job %v did not stop %v after its timeout, it is left running", job.Name, abandonAfter)
+		t.abandon(job.Name, done)
+	}
+	return fmt.Errorf("timed out after %v", timeout)
+}
+
+// abandon keeps track of a job left running until done returns
+func (t *ThreadPool) abandon(name string, done <-chan error) {
+	t.mut.Lock()
+	if t.abandoned == nil {
+		t.abandoned = make(map[int]string)
+	}
+	id := t.abandonedJobs
+	t.abandonedJobs++
+	t.abandoned[id] = name
+	t.abandonedWG.Add(1)
+	t.mut.Unlock()
+	go func() {
+		defer t.abandonedWG.Done()
+		<-done
+		t.mut.Lock()
+		defer t.mut.Unlock()
+		delete(t.abandoned, id)
+	}()
+}
+
+// WaitForAbandoned waits up to wait for the jobs left running after their timeout to return and
+// gives the names of the ones still running, their output may be incomplete
+func (t *ThreadPool) WaitForAbandoned(wait time.Duration) []string {
+	returned := make(chan struct{})
+	go func() {
+		t.abandonedWG.Wait()
+		close(returned)
+	}()
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-returned:
+		return nil
+	case <-timer.C:
+	}
+	t.mut.Lock()
+	defer t.mut.Unlock()
+	var names []string
+	for _, name := range t.abandoned {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 // ProcessAndWait blocks until all jobs have finished. If no jobs were added, it returns an error.
 func (t *ThreadPool) ProcessAndWait() error {
+	return t.ProcessAndWaitContext(context.Background())
+}
+
+// ProcessAndWaitContext blocks until all jobs have finished or the context is cancelled. The jobs start by
+// priority and the errors of every job that failed are returned joined together. After cancellation the
+// jobs that have not started are skipped and the context error is returned along with them, running jobs
+// get the cancelled context to stop early. The pool can be used again once it returns.
+func (t *ThreadPool) ProcessAndWaitContext(ctx context.Context) error {
 	t.mut.Lock()
 	if t.pendingJobs == 0 {
 		t.mut.Unlock()
 		return fmt.Errorf("thread pool wait called with no pending jobs this is unexpected")
 	}
+	jobs := t.jobs
+	t.jobs = nil
 	t.mut.Unlock()
-	//start processing jobs
+
+	sort.SliceStable(jobs, func(i, j int) bool { return jobs[i].Priority > jobs[j].Priority })
+	queue := make(chan Job, len(jobs))
+	for _, job := range jobs {
+		queue <- job
+	}
+	close(queue)
+	var wg sync.WaitGroup
 	for i := 0; i < t.numberThreads; i++ {
-		go t.worker()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			t.worker(ctx, queue)
+		}()
 	}
-	//then wait for them
-	t.wg.Wait()
-	close(t.jobs)
+	wg.Wait()
+
 	t.mut.Lock()
-	simplelog.Infof("%v/%v tasks completed", t.totalJobs, t.totalJobs)
+	defer t.mut.Unlock()
+	if t.skippedJobs > 0 {
+		simplelog.Warningf("%v/%v tasks completed, %v skipped due to cancellation", t.totalJobs-t.skippedJobs, t.totalJobs, t.skippedJobs)
+	} else {
+		simplelog.Infof("%v/%v tasks completed", t.totalJobs, t.totalJobs)
+	}
+	errs := t.errs
+	if ctx.Err() != nil {
+		errs = append([]error{ctx.Err()}, errs...)
+	}
 	t.totalJobs = 0
-	t.mut.Unlock()
-	return nil
+	t.skippedJobs = 0
+	t.errs = nil
+	return errors.Join(errs...)
 }
 
 // PendingJobs returns the number of jobs that are pending.
@@ -15,7 +15,11 @@
 package threading_test
 
 import (
+	"context"
+	"errors"
 	"log"
+	"reflect"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -152,3 +156,141 @@ func TestConcurrentThreadsCappedAtThreadPool(t *testing.T) {
 		t.Errorf("expected %v but was %v", 2, maxConcurrencyObserved)
 	}
 }
+
+func TestThreadPool_WhenCancelled(t *testing.T) {
+	tp, err := threading.NewThreadPool(1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	var mut sync.Mutex
+	executed := 0
+	// the first job cancels so none of the queued jobs should run
+	tp.AddJob(func() error {
+		mut.Lock()
+		defer mut.Unlock()
+		executed++
+		cancel()
+		return nil
+	})
+	for i := 0; i < 10; i++ {
+		tp.AddJob(func() error {
+			mut.Lock()
+			defer mut.Unlock()
+			executed++
+			return nil
+		})
+	}
+	err = tp.ProcessAndWaitContext(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected %v but was %v", context.Canceled, err)
+	}
+	if executed != 1 {
+		t.Errorf("expected 1 job executed but had %v", executed)
+	}
+	if tp.PendingJobs() != 0 {
+		t.Errorf("expected no pending jobs but had %v", tp.PendingJobs())
+	}
+}
+
+func TestThreadPool_ReturnsAllErrors(t *testing.T) {
+	tp, err := threading.NewThreadPool(2, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errJFR := errors.New("jcmd not found")
+	errWLM := errors.New("401 unauthorized")
+	tp.AddNamedJob("jfr", func() error { return errJFR })
+	tp.AddNamedJob("server-logs", func() error { return nil })
+	tp.AddNamedJob("wlm", func() error { return errWLM })
+	err = tp.ProcessAndWait()
+	if !errors.Is(err, errJFR) || !errors.Is(err, errWLM) {
+		t.Errorf("expected both errors but was %v", err)
+	}
+	// the errors are not kept for the next run
+	tp.AddJob(func() error { return nil })
+	if err := tp.ProcessAndWait(); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestThreadPool_StartsByPriority(t *testing.T) {
+	tp, err := threading.NewThreadPool(1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var started []string
+	add := func(name string, priority int) {
+		tp.Add(threading.Job{Name: name, Priority: priority, Run: func(context.Context) error {
+			started = append(started, name)
+			return nil
+		}})
+	}
+	add("server-logs", threading.PriorityLow)
+	add("wlm", threading.PriorityNormal)
+	add("jfr", threading.PriorityHigh)
+	add("gc-logs", threading.PriorityLow)
+	add("jstack", threading.PriorityHigh)
+	if err := tp.ProcessAndWait(); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"jfr", "jstack", "wlm", "server-logs", "gc-logs"}
+	if !reflect.DeepEqual(started, expected) {
+		t.Errorf("expected %v but was %v", expected, started)
+	}
+}
+
+func TestThreadPool_TimesOutHungJobs(t *testing.T) {
+	tp, err := threading.NewThreadPool(1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tp.SetJobTimeout(time.Hour)
+	tp.Add(threading.Job{Name: "jstack", Timeout: 50 * time.Millisecond, Run: func(ctx context.Context) error {
+		// a hung jcmd that is stopped by the context
+		<-ctx.Done()
+		return ctx.Err()
+	}})
+	var executed bool
+	tp.AddNamedJob("server-logs", func() error {
+		executed = true
+		return nil
+	})
+	start := time.Now()
+	err = tp.ProcessAndWait()
+	if err == nil || !strings.Contains(err.Error(), "jstack: timed out after 50ms") {
+		t.Errorf("expected the jstack job to time out but was %v", err)
+	}
+	if !executed {
+		t.Error("expected the job after the hung one to run")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected the pool to move on after the timeout but took %v", elapsed)
+	}
+}
+
+func TestThreadPool_WaitForAbandoned(t *testing.T) {
+	tp, err := threading.NewThreadPool(1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if running := tp.WaitForAbandoned(time.Second); running != nil {
+		t.Errorf("expected no abandoned jobs but was %v", running)
+	}
+	release := make(chan struct{})
+	tp.Add(threading.Job{Name: "server-logs", Timeout: 50 * time.Millisecond, Run: func(context.Context) error {
+		// a copy that does not look at the context
+		<-release
+		return nil
+	}})
+	if err := tp.ProcessAndWait(); err == nil {
+		t.Error("expected the job to time out")
+	}
+	if running := tp.WaitForAbandoned(50 * time.Millisecond); !reflect.DeepEqual(running, []string{"server-logs"}) {
+		t.Errorf("expected server-logs to still be running but was %v", running)
+	}
+	close(release)
+	if running := tp.WaitForAbandoned(5 * time.Second); running != nil {
+		t.Errorf("expected server-logs to have returned but was %v", running)
+	}
+}
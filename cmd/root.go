@@ -16,27 +16,43 @@
 package cmd
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/dremio/dremio-diagnostic-collector/cmd/awselogs"
+	"github.com/dremio/dremio-diagnostic-collector/cmd/decrypt"
+	"github.com/dremio/dremio-diagnostic-collector/cmd/diff"
+	"github.com/dremio/dremio-diagnostic-collector/cmd/inspect"
 	local "github.com/dremio/dremio-diagnostic-collector/cmd/local"
 	"github.com/dremio/dremio-diagnostic-collector/cmd/local/conf"
 	"github.com/dremio/dremio-diagnostic-collector/cmd/root/collection"
+	"github.com/dremio/dremio-diagnostic-collector/cmd/root/docker"
 	"github.com/dremio/dremio-diagnostic-collector/cmd/root/helpers"
 	"github.com/dremio/dremio-diagnostic-collector/cmd/root/kubernetes"
 	"github.com/dremio/dremio-diagnostic-collector/cmd/root/ssh"
+	"github.com/dremio/dremio-diagnostic-collector/cmd/schedule"
+	uploadcmd "github.com/dremio/dremio-diagnostic-collector/cmd/upload"
+	"github.com/dremio/dremio-diagnostic-collector/cmd/verify"
 	version "github.com/dremio/dremio-diagnostic-collector/cmd/version"
+	"github.com/dremio/dremio-diagnostic-collector/cmd/watch"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/archive"
 	"github.com/dremio/dremio-diagnostic-collector/pkg/consoleprint"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/encrypt"
 	"github.com/dremio/dremio-diagnostic-collector/pkg/masking"
 	"github.com/dremio/dremio-diagnostic-collector/pkg/simplelog"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/upload"
 	"github.com/dremio/dremio-diagnostic-collector/pkg/versions"
+	"github.com/manifoldco/promptui"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
+	"golang.org/x/term"
 )
 
 // var scaleoutCoordinatorContainer string
@@ -44,16 +60,43 @@ var coordinatorContainer string
 var executorsContainer string
 var coordinatorStr string
 var executorsStr string
+var hostsInventory string
+var sshJumpHosts string
+var sshJumpKeys string
 var sshKeyLoc string
 var sshUser string
+var sshTransport string
+var sshKnownHosts string
+var sshInsecureIgnoreHostKey bool
 var promptForDremioPAT bool
 var transferDir string
 var ddcYamlLoc string
 
 var outputLoc string
+var outputFormat string
+var outputMaxVolumeMB int64
+var resume bool
+var discardCheckpoint bool
+var dryRun bool
+var skipPreflight bool
+var preflightOnFailure string
+var preflightMinFreeMB int64
+var progressMode string
+var maxConcurrentHosts int
+var hostTimeout time.Duration
+var keepDDCInstalled bool
+var captureStartDelay time.Duration
+var collectionMode string
+var uploadArgs upload.Args
+var encryptTo []string
+var encryptNodeTarballs bool
 
 var kubectlPath string
+var k8sTransport string
+var kubeConfig string
 var isK8s bool
+var isDocker bool
+var containerRuntime string
 var sudoUser string
 var namespace string
 
@@ -84,6 +127,13 @@ for kubernetes deployments:
 	ddc --k8s --namespace mynamespace --coordinator app=dremio-coordinator --executors app=dremio-executor 
 	# to collect job profiles, system tables, kv reports and wlm 
 	ddc --k8s -n mynamespace -c app=dremio-coordinator -e app=dremio-executor --dremio-pat-prompt
+
+for docker or podman containers:
+
+	# docker compose services
+	ddc --docker --coordinator service:dremio-coordinator --executors service:dremio-executor
+	# podman containers by name
+	ddc --docker --container-runtime podman --coordinator dremio-coordinator --executors dremio-executor-1,dremio-executor-2
 `,
 	Run: func(c *cobra.Command, args []string) {
 
@@ -114,7 +164,7 @@ func startTicker() (stop func()) {
 	}
 }
 
-func RemoteCollect(collectionArgs collection.Args, sshArgs ssh.Args, kubeArgs kubernetes.KubeArgs, k8sEnabled bool) error {
+func RemoteCollect(ctx context.Context, collectionArgs collection.Args, sshArgs ssh.Args, kubeArgs kubernetes.KubeArgs, dockerArgs docker.Args, k8sEnabled bool) error {
 	consoleprint.UpdateRuntime(
 		versions.GetCLIVersion(),
 		simplelog.GetLogLoc(),
@@ -126,7 +176,7 @@ func RemoteCollect(collectionArgs collection.Args, sshArgs ssh.Args, kubeArgs ku
 		0,
 		0,
 	)
-	err := validateParameters(collectionArgs, sshArgs, k8sEnabled)
+	err := validateParameters(collectionArgs, sshArgs, kubeArgs, dockerArgs, k8sEnabled)
 	if err != nil {
 		fmt.Println("COMMAND HELP TEXT:")
 		fmt.Println("")
@@ -136,8 +186,23 @@ func RemoteCollect(collectionArgs collection.Args, sshArgs ssh.Args, kubeArgs ku
 		}
 		return fmt.Errorf("invalid command flag detected: %w", err)
 	}
-	// This is where the SSH or K8s collection is determined. We create an instance of the interface based on this
-	// which then determines whether the commands are routed to the SSH or K8s commands
+	sshEnabled := !k8sEnabled && !dockerArgs.Enabled
+	if sshEnabled {
+		sshArgs.JumpHosts, err = ssh.ParseJumpHosts(sshArgs.JumpHostsStr, sshArgs.JumpKeysStr)
+		if err != nil {
+			return fmt.Errorf("invalid --ssh-jump-host: %w", err)
+		}
+		if len(sshArgs.JumpHosts) > 0 {
+			simplelog.Infof("connecting through %v jump host(s): %v", len(sshArgs.JumpHosts), sshArgs.JumpHostsStr)
+		}
+	}
+	if sshEnabled && sshArgs.InventoryFile != "" {
+		if err := applyInventory(&collectionArgs, &sshArgs); err != nil {
+			return err
+		}
+	}
+	// This is where the SSH, K8s or container collection is determined. We create an instance of the interface based on this
+	// which then determines whether the commands are routed to the SSH, K8s or docker commands
 	cs, err := helpers.NewHCCopyStrategy(collectionArgs.DDCfs, &helpers.RealTimeService{})
 	if err != nil {
 		return fmt.Errorf("error when creating copy strategy: %v", err)
@@ -145,8 +210,21 @@ func RemoteCollect(collectionArgs collection.Args, sshArgs ssh.Args, kubeArgs ku
 	var clusterCollect = func([]string) {}
 	var collectorStrategy collection.Collector
 	if k8sEnabled {
-		simplelog.Info("using Kubernetes kubectl based collection")
-		collectorStrategy = kubernetes.NewKubectlK8sActions(kubeArgs)
+		var k8sCollector interface {
+			collection.Collector
+			collection.K8sClusterCollector
+		}
+		if kubeArgs.Transport == kubernetes.TransportAPI {
+			simplelog.Info("using Kubernetes API based collection")
+			k8sCollector, err = kubernetes.NewKubeAPIActions(kubeArgs)
+			if err != nil {
+				return fmt.Errorf("unable to setup kubernetes client: %w", err)
+			}
+		} else {
+			simplelog.Info("using Kubernetes kubectl based collection")
+			k8sCollector = kubernetes.NewKubectlK8sActions(kubeArgs)
+		}
+		collectorStrategy = k8sCollector
 		consoleprint.UpdateRuntime(
 			versions.GetCLIVersion(),
 			simplelog.GetLogLoc(),
@@ -159,26 +237,48 @@ func RemoteCollect(collectionArgs collection.Args, sshArgs ssh.Args, kubeArgs ku
 			0,
 		)
 		clusterCollect = func(pods []string) {
-			err = collection.ClusterK8sExecute(kubeArgs.Namespace, cs, collectionArgs.DDCfs, collectorStrategy, kubeArgs.KubectlPath)
+			err = collection.ClusterK8sExecute(cs, collectionArgs.DDCfs, k8sCollector)
 			if err != nil {
 				simplelog.Errorf("when getting Kubernetes info, the following error was returned: %v", err)
 			}
-			err = collection.GetClusterLogs(kubeArgs.Namespace, cs, collectionArgs.DDCfs, kubeArgs.KubectlPath, pods)
+			err = collection.GetClusterLogs(cs, collectionArgs.DDCfs, k8sCollector, pods)
 			if err != nil {
 				simplelog.Errorf("when getting container logs, the following error was returned: %v", err)
 			}
-			err = collection.GetClusterNodes(kubeArgs.Namespace, cs, collectionArgs.DDCfs, kubeArgs.KubectlPath)
+			err = collection.GetClusterNodes(cs, collectionArgs.DDCfs, k8sCollector)
 			if err != nil {
 				simplelog.Errorf("when getting cluster nodes, the following error was returned: %v", err)
 			}
 		}
+	} else if dockerArgs.Enabled {
+		dockerCollector := docker.NewDockerActions(dockerArgs)
+		simplelog.Infof("using %v based collection", dockerCollector.Name())
+		collectorStrategy = dockerCollector
+		clusterCollect = func(containers []string) {
+			err = collection.ContainerClusterExecute(cs, collectionArgs.DDCfs, dockerCollector, containers)
+			if err != nil {
+				simplelog.Errorf("when getting container info, the following error was returned: %v", err)
+			}
+		}
+	} else if sshArgs.Transport == ssh.TransportNative {
+		simplelog.Info("using native SSH based collection")
+		nativeSSH, err := ssh.NewNativeSSHActions(sshArgs)
+		if err != nil {
+			return fmt.Errorf("unable to setup ssh: %w", err)
+		}
+		defer func() {
+			if err := nativeSSH.Close(); err != nil {
+				simplelog.Warningf("unable to close ssh connections: %v", err)
+			}
+		}()
+		collectorStrategy = nativeSSH
 	} else {
 		simplelog.Info("using SSH based collection")
 		collectorStrategy = ssh.NewCmdSSHActions(sshArgs)
 	}
 
 	// Launch the collection
-	err = collection.Execute(collectorStrategy,
+	err = collection.Execute(ctx, collectorStrategy,
 		cs,
 		collectionArgs,
 		clusterCollect,
@@ -189,9 +289,31 @@ func RemoteCollect(collectionArgs collection.Args, sshArgs ssh.Args, kubeArgs ku
 	return nil
 }
 
-func ValidateAndReadYaml(ddcYaml string) (map[string]interface{}, error) {
-	empyyOverrides := make(map[string]string)
-	confData, err := conf.ParseConfig(ddcYaml, empyyOverrides)
+// applyInventory loads the --hosts-inventory file and uses it for the hosts to collect from and their settings
+func applyInventory(collectionArgs *collection.Args, sshArgs *ssh.Args) error {
+	inventory, err := ssh.LoadInventory(sshArgs.InventoryFile)
+	if err != nil {
+		return err
+	}
+	if err := inventory.Validate(*sshArgs); err != nil {
+		return fmt.Errorf("invalid hosts inventory %v: %w", sshArgs.InventoryFile, err)
+	}
+	coordinators := inventory.Coordinators()
+	if len(coordinators) == 0 {
+		return fmt.Errorf("hosts inventory %v has no host with role '%v'", sshArgs.InventoryFile, ssh.RoleCoordinator)
+	}
+	simplelog.Infof("hosts inventory %v lists %v coordinator(s) and %v executor(s)", sshArgs.InventoryFile, len(coordinators), len(inventory.Executors()))
+	sshArgs.Inventory = inventory
+	collectionArgs.CoordinatorStr = strings.Join(coordinators, ",")
+	collectionArgs.ExecutorsStr = strings.Join(inventory.Executors(), ",")
+	collectionArgs.HostSudoUsers = inventory.SudoUsers()
+	collectionArgs.HostLabels = inventory.Labels()
+	return nil
+}
+
+// ValidateAndReadYaml parses ddc.yaml with the overrides applied over it and fills in the defaults
+func ValidateAndReadYaml(ddcYaml string, overrides map[string]string) (map[string]interface{}, error) {
+	confData, err := conf.ParseConfig(ddcYaml, overrides)
 	if err != nil {
 		return make(map[string]interface{}), err
 	}
@@ -206,10 +328,34 @@ func ValidateAndReadYaml(ddcYaml string) (map[string]interface{}, error) {
 	}
 
 	// set defaults so we get an accurate reading of if these will be enabled or not
-	conf.SetViperDefaults(confData, "", 0, "")
+	if err := conf.SetViperDefaults(confData, "", 0, ""); err != nil {
+		return make(map[string]interface{}), err
+	}
 	return confData, nil
 }
 
+// interruptContext is cancelled on the first Ctrl-C or SIGTERM so the hosts can be cleaned up, after that the
+// default handling is back and a second Ctrl-C exits right away
+func interruptContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case sig := <-sigs:
+			signal.Stop(sigs)
+			simplelog.Warningf("received %v, stopping the collection and cleaning up the hosts", sig)
+			consoleprint.UpdateResult("CANCELLING - cleaning up the hosts, press Ctrl-C again to exit right away")
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, func() {
+		signal.Stop(sigs)
+		cancel()
+	}
+}
+
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute(args []string) error {
@@ -225,8 +371,16 @@ func Execute(args []string) error {
 	foundCmd, _, err := RootCmd.Find(args[1:])
 	// default cmd if no cmd is given
 	if err == nil && foundCmd.Use == RootCmd.Use && foundCmd.Flags().Parse(args[1:]) != pflag.ErrHelp {
-		stop := startTicker()
-		defer stop()
+		if err := consoleprint.SetProgress(progressMode); err != nil {
+			return err
+		}
+		// the status screen is only redrawn on a terminal, plain and json progress print events as they happen
+		stop := func() {}
+		if consoleprint.Interactive() {
+			stop = startTicker()
+		}
+		// stop is replaced when the ticker is restarted after a prompt
+		defer func() { stop() }()
 		if sshKeyLoc == "" {
 			sshDefault, err := sshDefault()
 			if err != nil {
@@ -245,7 +399,11 @@ func Execute(args []string) error {
 		patSet := dremioPAT != ""
 		simplelog.Info(versions.GetCLIVersion())
 		simplelog.Infof("cli command: %v", strings.Join(args, " "))
-		confData, err := ValidateAndReadYaml(ddcYamlLoc)
+		overrides := make(map[string]string)
+		if collectionMode != "" {
+			overrides[conf.KeyCollectionMode] = collectionMode
+		}
+		confData, err := ValidateAndReadYaml(ddcYamlLoc, overrides)
 		if err != nil {
 			return fmt.Errorf("CRITICAL ERROR: unable to parse %v: %v", ddcYamlLoc, err)
 		}
@@ -278,31 +436,101 @@ func Execute(args []string) error {
 				}
 			}
 		}
+		if !patSet && conf.GetInt(confData, conf.KeyNumberJobProfiles) > 0 && conf.CollectionModeSets(confData, conf.KeyNumberJobProfiles) {
+			simplelog.Warningf("collection mode %v collects up to %v job profiles but no PAT was given so none will be collected, pass --dremio-pat-prompt to collect them",
+				conf.GetString(confData, conf.KeyCollectionMode), conf.GetInt(confData, conf.KeyNumberJobProfiles))
+		}
+		if captureStartDelay > 0 && !local.JVMCapturesEnabled(confData) {
+			simplelog.Infof("--capture-start-delay %v is ignored since no jstack, JFR or ttop capture is enabled", captureStartDelay)
+			captureStartDelay = 0
+		}
+		expected := captureStartDelay + time.Duration(local.ExpectedSeconds(confData, patSet))*time.Second
+		if minimum := minimumHostTimeout(expected); hostTimeout > 0 && hostTimeout < minimum {
+			simplelog.Warningf("--host-timeout %v is shorter than the %v the hosts are expected to take with collection mode %v, hosts may be stopped part way, use at least --host-timeout %v",
+				hostTimeout, expected, conf.GetString(confData, conf.KeyCollectionMode), minimum)
+		}
+		recipients, nodeEncryption, err := encryptionSettings(confData, encryptTo, encryptNodeTarballs)
+		if err != nil {
+			return fmt.Errorf("invalid command flag detected: %w", err)
+		}
+		var uploadTarget upload.Target
+		if uploadArgs.URL != "" {
+			if dryRun {
+				simplelog.Warningf("--upload-to %v is ignored for a dry run", uploadArgs.URL)
+			} else {
+				uploadArgs.SSHConfig = ssh.ClientConfigFor(sshKeyLoc, sshKnownHosts, sshInsecureIgnoreHostKey)
+				uploadTarget, err = upload.NewTarget(uploadArgs)
+				if err != nil {
+					return fmt.Errorf("invalid command flag detected: %w", err)
+				}
+			}
+		}
 		collectionArgs := collection.Args{
-			CoordinatorStr: coordinatorStr,
-			ExecutorsStr:   executorsStr,
-			OutputLoc:      filepath.Clean(outputLoc),
-			SudoUser:       sudoUser,
-			DDCfs:          helpers.NewRealFileSystem(),
-			DremioPAT:      dremioPAT,
-			TransferDir:    transferDir,
-			DDCYamlLoc:     ddcYamlLoc,
-			Enabled:        enabled,
-			Disabled:       disabled,
-			PATSet:         patSet,
+			CoordinatorStr:        coordinatorStr,
+			ExecutorsStr:          executorsStr,
+			OutputLoc:             filepath.Clean(outputLoc),
+			ArchiveFormat:         archive.Format(outputFormat),
+			MaxVolumeBytes:        outputMaxVolumeMB * 1024 * 1024,
+			SudoUser:              sudoUser,
+			DDCfs:                 helpers.NewRealFileSystem(),
+			DremioPAT:             dremioPAT,
+			TransferDir:           transferDir,
+			DDCYamlLoc:            ddcYamlLoc,
+			Enabled:               enabled,
+			Disabled:              disabled,
+			PATSet:                patSet,
+			Resume:                resume,
+			DiscardCheckpoint:     discardCheckpoint,
+			DryRun:                dryRun,
+			SkipPreflight:         skipPreflight,
+			PreflightOnFailure:    collection.ResolvePreflightOnFailure(preflightOnFailure, term.IsTerminal(int(os.Stdin.Fd()))),
+			PreflightDirs:         preflightDirs(confData),
+			PreflightMinFreeBytes: preflightMinFreeMB * 1024 * 1024,
+			ConfirmPreflight: func(failedHosts []string) (bool, error) {
+				// the status screen is redrawn every few seconds which would wipe out the prompt
+				if consoleprint.Interactive() {
+					stop()
+					defer func() { stop = startTicker() }()
+				}
+				return confirmPreflight(failedHosts)
+			},
+			MaxConcurrentHosts:  maxConcurrentHosts,
+			HostTimeout:         hostTimeout,
+			KeepDDCInstalled:    keepDDCInstalled,
+			CaptureStartDelay:   captureStartDelay,
+			CollectionMode:      conf.GetString(confData, conf.KeyCollectionMode),
+			UploadTarget:        uploadTarget,
+			EncryptTo:           recipients,
+			EncryptNodeTarballs: nodeEncryption,
 		}
 		sshArgs := ssh.Args{
-			SSHKeyLoc: sshKeyLoc,
-			SSHUser:   sshUser,
+			SSHKeyLoc:             sshKeyLoc,
+			SSHUser:               sshUser,
+			Transport:             sshTransport,
+			KnownHostsFile:        sshKnownHosts,
+			InsecureIgnoreHostKey: sshInsecureIgnoreHostKey,
+			InventoryFile:         hostsInventory,
+			JumpHostsStr:          sshJumpHosts,
+			JumpKeysStr:           sshJumpKeys,
 		}
 		kubeArgs := kubernetes.KubeArgs{
 			Namespace:            namespace,
 			CoordinatorContainer: coordinatorContainer,
 			ExecutorsContainer:   executorsContainer,
 			KubectlPath:          kubectlPath,
+			Transport:            k8sTransport,
+			KubeConfig:           kubeConfig,
 		}
-		if err := RemoteCollect(collectionArgs, sshArgs, kubeArgs, isK8s); err != nil {
+		dockerArgs := docker.Args{
+			Enabled: isDocker,
+			Runtime: containerRuntime,
+		}
+		ctx, cancel := interruptContext()
+		defer cancel()
+		if err := RemoteCollect(ctx, collectionArgs, sshArgs, kubeArgs, dockerArgs, isK8s); err != nil {
 			consoleprint.UpdateResult(err.Error())
+		} else if dryRun {
+			consoleprint.UpdateResult(fmt.Sprintf("dry run plan written to %v at %v", collection.PlanFile(collectionArgs.OutputLoc), time.Now().Format(time.RFC1123)))
 		} else {
 			consoleprint.UpdateResult(fmt.Sprintf("complete at %v", time.Now().Format(time.RFC1123)))
 		}
@@ -316,6 +544,62 @@ func Execute(args []string) error {
 	return nil
 }
 
+// preflightDirs are the dremio directories from ddc.yaml that local-collect reads from
+func preflightDirs(confData map[string]interface{}) []string {
+	var dirs []string
+	for _, key := range []string{conf.KeyDremioLogDir, conf.KeyDremioConfDir, conf.KeyDremioGCLogsDir} {
+		if dir, ok := confData[key].(string); ok && dir != "" {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// encryptionSettings combines --encrypt-to with the encrypt-to and require-encryption keys of ddc.yaml.
+// ddc.yaml is copied to the nodes so when it asks for encryption the node tarballs are always encrypted
+func encryptionSettings(confData map[string]interface{}, flagRecipients []string, nodeTarballs bool) ([]string, bool, error) {
+	values := append([]string{}, flagRecipients...)
+	yamlRecipients := conf.GetString(confData, conf.KeyEncryptTo)
+	values = append(values, strings.Split(yamlRecipients, ",")...)
+	recipients, err := encrypt.LoadRecipients(values)
+	if err != nil {
+		return nil, false, fmt.Errorf("invalid --encrypt-to: %w", err)
+	}
+	required := conf.GetBool(confData, conf.KeyRequireEncryption)
+	if required && len(recipients) == 0 {
+		return nil, false, fmt.Errorf("%v is set in ddc.yaml so the collection must be encrypted, pass --encrypt-to with an age or ssh public key", conf.KeyRequireEncryption)
+	}
+	if nodeTarballs && len(recipients) == 0 {
+		return nil, false, errors.New("--encrypt-node-tarballs needs --encrypt-to")
+	}
+	return recipients, nodeTarballs || required || strings.TrimSpace(yamlRecipients) != "", nil
+}
+
+// minimumHostTimeout is the shortest --host-timeout suggested for hosts expected to take expected,
+// the margin covers the transfers and slow hosts
+func minimumHostTimeout(expected time.Duration) time.Duration {
+	return (expected + expected/2 + 10*time.Minute).Round(time.Minute)
+}
+
+// confirmPreflight shows the preflight matrix and asks whether to collect anyway
+func confirmPreflight(failedHosts []string) (bool, error) {
+	if fi, err := os.Stdin.Stat(); err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+		return false, errors.New("unable to ask whether to continue since stdin is not a terminal, set --preflight-on-failure to auto, abort or continue")
+	}
+	fmt.Printf("\npreflight checks failed on hosts %v\n\n%v\n", strings.Join(failedHosts, ", "), consoleprint.PreflightMatrix())
+	prompt := promptui.Prompt{
+		Label:     "Continue the collection anyway",
+		IsConfirm: true,
+	}
+	if _, err := prompt.Run(); err != nil {
+		if errors.Is(err, promptui.ErrAbort) {
+			return false, nil
+		}
+		return false, fmt.Errorf("prompt failed %w", err)
+	}
+	return true, nil
+}
+
 type unableToGetHomeDir struct {
 	Err error
 }
@@ -340,16 +624,43 @@ func init() {
 	RootCmd.Flags().StringVar(&coordinatorContainer, "coordinator-container", "dremio-master-coordinator,dremio-coordinator", "for use with -k8s flag: sets the container name to use to retrieve logs in the coordinators")
 	RootCmd.Flags().StringVar(&executorsContainer, "executors-container", "dremio-executor", "for use with -k8s flag: sets the container name to use to retrieve logs in the executors")
 	RootCmd.Flags().StringVarP(&coordinatorStr, "coordinator", "c", "", "coordinator to connect to for collection. With ssh set a list of ip addresses separated by commas. In K8s use a label that matches to the pod(s).")
-	RootCmd.Flags().StringVarP(&executorsStr, "executors", "e", "", "either a common separated list or a ip range of executors nodes to connect to. With ssh set a list of ip addresses separated by commas. In K8s use a label that matches to the pod(s).")
+	RootCmd.Flags().StringVarP(&executorsStr, "executors", "e", "", "either a common separated list or a ip range of executors nodes to connect to. With ssh set a list of ip addresses separated by commas, ranges such as 10.0.0.20-30 and CIDR blocks such as 10.0.0.16/28 are expanded. In K8s use a label that matches to the pod(s).")
+	RootCmd.Flags().StringVar(&hostsInventory, "hosts-inventory", "", "YAML or JSON file listing the ssh hosts with their role and optionally user, key, port, sudo-user and label, replaces --coordinator and --executors")
 	RootCmd.Flags().StringVarP(&sshKeyLoc, "ssh-key", "s", "", "location of ssh key to use to login")
 	RootCmd.Flags().StringVarP(&sshUser, "ssh-user", "u", "", "user to use during ssh operations to login")
+	RootCmd.Flags().StringVar(&sshJumpHosts, "ssh-jump-host", "", "comma separated jump hosts to reach the nodes through, in the order they are connected to, each as [user@]host[:port]. Hops without a user use --ssh-user")
+	RootCmd.Flags().StringVar(&sshJumpKeys, "ssh-jump-key", "", "ssh key for the jump hosts, either one key for every hop or a comma separated key per hop, defaults to --ssh-key")
+	RootCmd.Flags().StringVar(&sshTransport, "ssh-transport", ssh.TransportCLI, "'cli' uses the ssh and scp binaries, 'native' uses a built in ssh client with sftp, known_hosts verification and ssh-agent support")
+	RootCmd.Flags().StringVar(&sshKnownHosts, "ssh-known-hosts", "", "known_hosts file used to verify the host keys of the hosts with --ssh-transport native and of the jump hosts with either transport, defaults to ~/.ssh/known_hosts")
+	RootCmd.Flags().BoolVar(&sshInsecureIgnoreHostKey, "ssh-insecure-ignore-host-key", false, "skip host key verification of the hosts with --ssh-transport native and of the jump hosts with either transport, not recommended")
 	RootCmd.Flags().StringVarP(&namespace, "namespace", "n", "default", "namespace to use for kubernetes pods")
 	RootCmd.Flags().StringVarP(&kubectlPath, "kubectl-path", "p", "kubectl", "where to find kubectl")
+	RootCmd.Flags().StringVar(&k8sTransport, "k8s-transport", kubernetes.TransportKubectl, "for use with -k8s flag: 'kubectl' uses the kubectl binary, 'api' talks to the Kubernetes API server directly and does not need kubectl installed")
+	RootCmd.Flags().StringVar(&kubeConfig, "kubeconfig", "", "for use with --k8s-transport api: kubeconfig file to use, defaults to $KUBECONFIG, ~/.kube/config and then the in cluster service account")
 	RootCmd.Flags().BoolVarP(&isK8s, "k8s", "k", false, "use kubernetes to retrieve the diagnostics instead of ssh, instead of hosts pass in labels to the --coordinator and --executors flags")
+	RootCmd.Flags().BoolVar(&isDocker, "docker", false, "use docker or podman to retrieve the diagnostics from containers instead of ssh, pass container names, name:<pattern>, label:<key>=<value> or service:<compose service> to the --coordinator and --executors flags")
+	RootCmd.Flags().StringVar(&containerRuntime, "container-runtime", docker.RuntimeDocker, "for use with --docker flag: 'docker' or 'podman'")
 	RootCmd.Flags().BoolVarP(&promptForDremioPAT, "dremio-pat-prompt", "t", false, "Prompt for Dremio Personal Access Token (PAT)")
 	RootCmd.Flags().StringVarP(&sudoUser, "sudo-user", "b", "", "if any diagnostics commands need a sudo user (i.e. for jcmd)")
 	RootCmd.Flags().StringVar(&transferDir, "transfer-dir", "/tmp/ddc", "directory to use for communication between the local-collect command and this one")
 	RootCmd.Flags().StringVar(&outputLoc, "output-file", "diag.tgz", "name of tgz file to save the diagnostic collection to")
+	RootCmd.Flags().StringVar(&outputFormat, "output-format", "", "format of --output-file: 'tar.gz', 'tar.zst' or 'zip', by default it is picked from the --output-file extension and is tar.gz for unknown extensions")
+	RootCmd.Flags().Int64Var(&outputMaxVolumeMB, "output-max-volume-mb", 0, "split --output-file into numbered volumes (diag.tgz.001, diag.tgz.002...) of at most this many MB, 0 writes a single file")
+	RootCmd.Flags().IntVar(&maxConcurrentHosts, "max-concurrent-hosts", 0, "maximum number of hosts to capture at the same time, 0 captures every host at once")
+	RootCmd.Flags().DurationVar(&hostTimeout, "host-timeout", 0, "maximum time a single host capture may take before it is marked as failed and ddc is stopped on it, 0 (the default) lets every host run to completion. Leave room for the job profiles, the JVM captures and --capture-start-delay when setting it")
+	RootCmd.Flags().StringVar(&collectionMode, "collection-mode", "", fmt.Sprintf("preset of collectors and capture times: %v, or one defined under collection-modes in ddc.yaml, keys set in ddc.yaml still take precedence, defaults to the collection-mode of ddc.yaml or %v", strings.Join(conf.CollectionModes(nil), ", "), conf.CollectionModeStandard))
+	RootCmd.Flags().DurationVar(&captureStartDelay, "capture-start-delay", 0, "start the ttop, JFR and jstack captures of every host at the same time, this long after the hosts are launched so ddc can be copied to them first. 0 (the default) lets every host start them as soon as it can. Leave room for slow uploads and set --max-concurrent-hosts to 0 so no host is queued")
+	RootCmd.Flags().BoolVar(&keepDDCInstalled, "keep-ddc-installed", false, "leave the ddc binary in --transfer-dir after the collection so later runs do not have to upload it again")
+	RootCmd.Flags().BoolVar(&dryRun, "dry-run", false, "find the hosts and run local-collect --dry-run on each of them, the resolved configuration and every collector that would run with durations and estimated sizes are written to a plan json next to --output-file, nothing is collected")
+	RootCmd.Flags().BoolVar(&skipPreflight, "skip-preflight", false, "skip the checks for free space in --transfer-dir, jcmd, jps and java, read access to the dremio directories and sudo that run on every host before collecting")
+	RootCmd.Flags().StringVar(&preflightOnFailure, "preflight-on-failure", collection.PreflightAuto, "what to do when a preflight check fails: 'prompt' asks whether to continue, 'abort' stops before anything is collected, 'continue' collects anyway and 'auto' is prompt when stdin is a terminal and continue otherwise, so cron, CI and ddc schedule runs still collect")
+	RootCmd.Flags().StringVar(&progressMode, "progress", consoleprint.ProgressAuto, "how progress is shown: 'tui' redraws a status screen, 'plain' prints a line per event, 'json' prints an event per line as json and 'auto' is tui when stdout is a terminal and plain otherwise")
+	RootCmd.Flags().Int64Var(&preflightMinFreeMB, "preflight-min-free-mb", 1024, "free space in MB the preflight check needs in --transfer-dir on every host")
+	upload.AddFlags(RootCmd.Flags(), &uploadArgs)
+	RootCmd.Flags().StringArrayVar(&encryptTo, "encrypt-to", nil, "encrypt the archive to an age (age1...) or ssh public key, or to every key listed in a file, can be repeated. The archive is written as <output-file>.age and is read with ddc decrypt")
+	RootCmd.Flags().BoolVar(&encryptNodeTarballs, "encrypt-node-tarballs", false, "also encrypt every node tarball on the node before it is copied back so nothing unencrypted is left in --transfer-dir or on jump hosts. The archive then holds the encrypted node tarballs")
+	RootCmd.Flags().BoolVar(&resume, "resume", false, "resume a collection that failed on some hosts using the checkpoint next to --output-file, only the failed or missing hosts are collected again")
+	RootCmd.Flags().BoolVar(&discardCheckpoint, "discard-checkpoint", false, "delete the checkpoint of an earlier collection next to --output-file and its node tarballs, then start a new collection")
 	execLoc, err := os.Executable()
 	if err != nil {
 		fmt.Printf("unable to find ddc, critical error %v", err)
@@ -362,9 +673,66 @@ func init() {
 	RootCmd.AddCommand(local.LocalCollectCmd)
 	RootCmd.AddCommand(version.VersionCmd)
 	RootCmd.AddCommand(awselogs.AWSELogsCmd)
+	RootCmd.AddCommand(uploadcmd.UploadCmd)
+	RootCmd.AddCommand(decrypt.DecryptCmd)
+	RootCmd.AddCommand(verify.VerifyCmd)
+	RootCmd.AddCommand(inspect.InspectCmd)
+	RootCmd.AddCommand(diff.DiffCmd)
+	RootCmd.AddCommand(schedule.ScheduleCmd)
+	RootCmd.AddCommand(watch.WatchCmd)
 }
 
-func validateParameters(args collection.Args, sshArgs ssh.Args, isK8s bool) error {
+func validateParameters(args collection.Args, sshArgs ssh.Args, kubeArgs kubernetes.KubeArgs, dockerArgs docker.Args, isK8s bool) error {
+	switch args.PreflightOnFailure {
+	case "", collection.PreflightAuto, collection.PreflightPrompt, collection.PreflightAbort, collection.PreflightContinue:
+	default:
+		return fmt.Errorf("--preflight-on-failure must be %v, %v, %v or %v but was '%v'", collection.PreflightAuto, collection.PreflightPrompt, collection.PreflightAbort, collection.PreflightContinue, args.PreflightOnFailure)
+	}
+	if args.PreflightMinFreeBytes < 0 {
+		return fmt.Errorf("--preflight-min-free-mb must be 0 or more but was %v", args.PreflightMinFreeBytes/(1024*1024))
+	}
+	if args.ArchiveFormat != "" {
+		if _, err := archive.ParseFormat(string(args.ArchiveFormat)); err != nil {
+			return fmt.Errorf("invalid --output-format: %w", err)
+		}
+	}
+	if args.MaxVolumeBytes < 0 {
+		return fmt.Errorf("--output-max-volume-mb must be 0 or more but was %v", args.MaxVolumeBytes/(1024*1024))
+	}
+	if args.DryRun && args.Resume {
+		return errors.New("--dry-run cannot be used with --resume")
+	}
+	if args.Resume && args.DiscardCheckpoint {
+		return errors.New("--resume cannot be used with --discard-checkpoint")
+	}
+	if args.MaxConcurrentHosts < 0 {
+		return fmt.Errorf("--max-concurrent-hosts must be 0 or more but was %v", args.MaxConcurrentHosts)
+	}
+	if args.HostTimeout < 0 {
+		return fmt.Errorf("--host-timeout must be 0 or more but was %v", args.HostTimeout)
+	}
+	if args.CaptureStartDelay < 0 {
+		return fmt.Errorf("--capture-start-delay must be 0 or more but was %v", args.CaptureStartDelay)
+	}
+	if isK8s && (sshArgs.JumpHostsStr != "" || sshArgs.JumpKeysStr != "") {
+		return errors.New("--ssh-jump-host and --ssh-jump-key are only for ssh collections")
+	}
+	if dockerArgs.Enabled {
+		return validateDockerParameters(args, sshArgs, dockerArgs, isK8s)
+	}
+	if sshArgs.InventoryFile != "" {
+		if isK8s {
+			return errors.New("--hosts-inventory is only for ssh collections, use --coordinator and --executors labels with --k8s")
+		}
+		if args.CoordinatorStr != "" || args.ExecutorsStr != "" {
+			return errors.New("--hosts-inventory lists the coordinators and executors, do not pass --coordinator or --executors with it")
+		}
+		// the user, key and transport are checked per host once the inventory is loaded
+		if sshArgs.Transport != "" && sshArgs.Transport != ssh.TransportCLI && sshArgs.Transport != ssh.TransportNative {
+			return fmt.Errorf("invalid --ssh-transport '%v', valid values are '%v' and '%v'", sshArgs.Transport, ssh.TransportCLI, ssh.TransportNative)
+		}
+		return nil
+	}
 	if args.CoordinatorStr == "" {
 		if isK8s {
 			return errors.New("the coordinator string was empty you must pass a label that will match your coordinators --coordinator or -c arguments. Example: -c \"mylabel=coordinator\"")
@@ -379,6 +747,27 @@ func validateParameters(args collection.Args, sshArgs ssh.Args, isK8s bool) erro
 		if sshArgs.SSHUser == "" {
 			return errors.New("the ssh user was empty, pass --ssh-user or -u with the user name you want to use to get past this error. Example --ssh-user ubuntu")
 		}
+		if sshArgs.Transport != "" && sshArgs.Transport != ssh.TransportCLI && sshArgs.Transport != ssh.TransportNative {
+			return fmt.Errorf("invalid --ssh-transport '%v', valid values are '%v' and '%v'", sshArgs.Transport, ssh.TransportCLI, ssh.TransportNative)
+		}
+	} else if kubeArgs.Transport != "" && kubeArgs.Transport != kubernetes.TransportKubectl && kubeArgs.Transport != kubernetes.TransportAPI {
+		return fmt.Errorf("invalid --k8s-transport '%v', valid values are '%v' and '%v'", kubeArgs.Transport, kubernetes.TransportKubectl, kubernetes.TransportAPI)
+	}
+	return nil
+}
+
+func validateDockerParameters(args collection.Args, sshArgs ssh.Args, dockerArgs docker.Args, isK8s bool) error {
+	if isK8s {
+		return errors.New("--docker and --k8s cannot be used together")
+	}
+	if dockerArgs.Runtime != "" && dockerArgs.Runtime != docker.RuntimeDocker && dockerArgs.Runtime != docker.RuntimePodman {
+		return fmt.Errorf("invalid --container-runtime '%v', valid values are '%v' and '%v'", dockerArgs.Runtime, docker.RuntimeDocker, docker.RuntimePodman)
+	}
+	if sshArgs.InventoryFile != "" || sshArgs.JumpHostsStr != "" || sshArgs.JumpKeysStr != "" {
+		return errors.New("--hosts-inventory, --ssh-jump-host and --ssh-jump-key are only for ssh collections")
+	}
+	if args.CoordinatorStr == "" {
+		return errors.New("the coordinator string was empty you must pass the container names, a label or a compose service that will match your coordinators to --coordinator or -c arguments. Example: -c service:dremio-coordinator")
 	}
 	return nil
 }
@@ -16,12 +16,16 @@
 package collection
 
 import (
+	"context"
 	"fmt"
 	"path"
 	"path/filepath"
 	"strings"
+	"time"
 
+	"github.com/dremio/dremio-diagnostic-collector/cmd/root/ddcbinary"
 	"github.com/dremio/dremio-diagnostic-collector/pkg/consoleprint"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/encrypt"
 	"github.com/dremio/dremio-diagnostic-collector/pkg/simplelog"
 	"github.com/dremio/dremio-diagnostic-collector/pkg/strutils"
 )
@@ -35,8 +39,9 @@ func (fe FindErr) Error() string {
 }
 
 // Capture collects diagnostics, conf files and log files from the target hosts. Failures are permissive and
-// are first logged and then returned at the end with the reason for the failure.
-func Capture(conf HostCaptureConfiguration, localDDCPath, localDDCYamlPath, outputLoc string, skipRESTCollect bool) (int64, string, error) {
+// are first logged and then returned at the end with the reason for the failure. Once the context is cancelled
+// no further step is started, the remote cleanup is left to captureWithTimeout.
+func Capture(ctx context.Context, conf HostCaptureConfiguration, localDDCPath, localDDCYamlPath, outputLoc string, skipRESTCollect bool) (int64, string, error) {
 	host := conf.Host
 	consoleprint.UpdateNodeState(host, "STARTING")
 	ddcTmpDir := conf.TransferDir
@@ -46,21 +51,46 @@ func Capture(conf HostCaptureConfiguration, localDDCPath, localDDCYamlPath, outp
 	pathToDDCYAML := path.Join(ddcTmpDir, "ddc.yaml")
 	dremioPAT := conf.DremioPAT
 	versionMatch := false
-	// //check if the version is up to date
-	// if out, err := ComposeExecute(conf, []string{pathToDDC, "version"}); err != nil {
-	// 	simplelog.Warningf("host %v unable to find ddc version due to error '%v' with output '%v'", host, err, out)
-	// } else {
-	// 	simplelog.Infof("host %v has ddc version '%v' already installed", host, out)
-	// 	versionMatch = out == versions.GetDDCRuntimeVersion()
-	// }
+	//check if the copy already in the transfer dir is the one we would upload, the file is hashed by the host
+	//and not by that ddc so a stale or changed copy cannot report the hash we expect
+	if conf.DDCSha256 != "" {
+		consoleprint.UpdateNodeState(host, "CHECKING DDC VERSION")
+		if out, err := ComposeExecute(false, conf, []string{"sha256sum", pathToDDC}); err != nil {
+			simplelog.Infof("host %v has no ddc at %v that can be hashed so it will be copied: '%v'", host, pathToDDC, err)
+		} else {
+			remoteSha := ddcbinary.ParseSHA256SumOutput(out)
+			versionMatch = remoteSha == conf.DDCSha256
+			simplelog.Infof("host %v has a ddc with sha256 '%v' already installed, matches: %v", host, remoteSha, versionMatch)
+		}
+	}
+	if !conf.KeepDDCInstalled {
+		defer func() {
+			// clear out when done
+			if out, err := ComposeExecute(false, conf, []string{"rm", pathToDDC}); err != nil {
+				simplelog.Warningf("on host %v unable to remove ddc due to error '%v' with output '%v'", host, err, out)
+			}
+		}()
+	}
+	defer func() {
+		// clear out when done
+		if out, err := ComposeExecute(false, conf, []string{"rm", pathToDDC + ".log"}); err != nil {
+			simplelog.Warningf("on host %v unable to remove ddc.log due to error '%v' with output '%v'", host, err, out)
+		}
+	}()
 	//if versions don't match go ahead and install a copy in the ddc tmp directory
-	if !versionMatch {
+	if versionMatch {
+		consoleprint.UpdateNodeState(host, "DDC ALREADY INSTALLED")
+		simplelog.Infof("host %v already has a matching ddc at %v, skipping the copy", host, pathToDDC)
+	} else {
 		consoleprint.UpdateNodeState(host, "CREATING REMOTE DIR")
 		//remotely make TransferDir
 		if out, err := ComposeExecute(false, conf, []string{"mkdir", "-p", ddcTmpDir}); err != nil {
 			consoleprint.UpdateNodeState(host, fmt.Sprintf("FAILED - TRANSFER SETUP - (%v) %v", err, out))
 			return 0, "", fmt.Errorf("host %v unable to make dir %v due to error '%v' with output '%v'", host, ddcTmpDir, err, out)
 		}
+		if err := ctx.Err(); err != nil {
+			return 0, "", err
+		}
 		consoleprint.UpdateNodeState(host, "COPY DDC TO HOST")
 		//copy file to TransferDir assume there is
 		if out, err := ComposeCopyTo(conf, localDDCPath, pathToDDC); err != nil {
@@ -69,18 +99,6 @@ func Capture(conf HostCaptureConfiguration, localDDCPath, localDDCYamlPath, outp
 			//this is a critical error so it is safe to exit
 		}
 		simplelog.Infof("successfully copied ddc to host %v at %v", host, pathToDDC)
-		defer func() {
-			// clear out when done
-			if out, err := ComposeExecute(false, conf, []string{"rm", pathToDDC}); err != nil {
-				simplelog.Warningf("on host %v unable to remove ddc due to error '%v' with output '%v'", host, err, out)
-			}
-		}()
-		defer func() {
-			// clear out when done
-			if out, err := ComposeExecute(false, conf, []string{"rm", pathToDDC + ".log"}); err != nil {
-				simplelog.Warningf("on host %v unable to remove ddc.log due to error '%v' with output '%v'", host, err, out)
-			}
-		}()
 		consoleprint.UpdateNodeState(host, "SETTING DDC PERMISSIONS")
 		//make  exec TransferDir
 		if out, err := ComposeExecute(false, conf, []string{"chmod", "+x", pathToDDC}); err != nil {
@@ -88,6 +106,9 @@ func Capture(conf HostCaptureConfiguration, localDDCPath, localDDCYamlPath, outp
 			return 0, "", fmt.Errorf("host %v unable to make ddc exec %v and cannot proceed with capture due to error '%v' with output '%v'", host, pathToDDC, err, out)
 		}
 	}
+	if err := ctx.Err(); err != nil {
+		return 0, "", err
+	}
 	consoleprint.UpdateNodeState(host, "COPY DDC.YAML")
 	//always update the configuration
 	if out, err := ComposeCopyTo(conf, localDDCYamlPath, pathToDDCYAML); err != nil {
@@ -103,10 +124,40 @@ func Capture(conf HostCaptureConfiguration, localDDCPath, localDDCYamlPath, outp
 		}
 	}()
 
+	// we cannot use filepath.join here as it will break everything during the transfer
+	pathToRecipients := path.Join(ddcTmpDir, "ddc-recipients.txt")
+	if conf.RecipientsFile != "" {
+		consoleprint.UpdateNodeState(host, "COPY RECIPIENTS")
+		if out, err := ComposeCopyTo(conf, conf.RecipientsFile, pathToRecipients); err != nil {
+			consoleprint.UpdateNodeState(host, fmt.Sprintf("FAILED - RECIPIENTS COPY - (%v) %v", err, out))
+			return 0, "", fmt.Errorf("unable to copy the encryption recipients '%v' to remote path due to error: '%v' with output '%v'", conf.RecipientsFile, err, out)
+		}
+		defer func() {
+			if out, err := ComposeExecute(false, conf, []string{"rm", pathToRecipients}); err != nil {
+				simplelog.Warningf("on host %v unable to remove the encryption recipients due to error '%v' with output '%v'", host, err, out)
+			}
+		}()
+	}
+
+	if err := ctx.Err(); err != nil {
+		return 0, "", err
+	}
 	consoleprint.UpdateNodeState(host, "COLLECTING")
 	//execute local-collect with a tarball-out-dir flag it must match our transfer-dir flag
 	var mask bool // to mask PAT token in logs
 	localCollectArgs := []string{pathToDDC, "local-collect", "--tarball-out-dir", conf.TransferDir}
+	if conf.DryRun {
+		localCollectArgs = append(localCollectArgs, "--dry-run")
+	}
+	if conf.RecipientsFile != "" {
+		localCollectArgs = append(localCollectArgs, "--encrypt-to", pathToRecipients)
+	}
+	if conf.CollectionMode != "" {
+		localCollectArgs = append(localCollectArgs, "--collection-mode", conf.CollectionMode)
+	}
+	if !conf.CaptureStart.IsZero() {
+		localCollectArgs = append(localCollectArgs, "--jvm-capture-start-utc", conf.CaptureStart.Format(time.RFC3339))
+	}
 	if skipRESTCollect {
 		//if skipRESTCollect is set blank the pat
 		localCollectArgs = append(localCollectArgs, "--disable-rest-api")
@@ -129,6 +180,12 @@ func Capture(conf HostCaptureConfiguration, localDDCPath, localDDCYamlPath, outp
 		return 0, "", fmt.Errorf("on host %v capture failed due to error '%v' output was %v", host, err, strings.Join(allHostLog, "\n"))
 	}
 
+	if err := ctx.Err(); err != nil {
+		return 0, "", err
+	}
+	if conf.DryRun {
+		return writeHostPlan(conf, outputLoc, allHostLog)
+	}
 	simplelog.Debugf("on host %v capture successful", host)
 	consoleprint.UpdateNodeState(host, "COLLECTED")
 
@@ -140,6 +197,9 @@ func Capture(conf HostCaptureConfiguration, localDDCPath, localDDCYamlPath, outp
 
 	//copy tar.gz back
 	tgzFileName := fmt.Sprintf("%v.tar.gz", strings.TrimSpace(hostname))
+	if conf.RecipientsFile != "" {
+		tgzFileName += encrypt.Suffix
+	}
 	//IMPORTANT we must use path.join and not filepath.join or everything will break
 	tarGZ := path.Join(ddcTmpDir, tgzFileName)
 	outDir := path.Dir(outputLoc)
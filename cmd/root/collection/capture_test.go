@@ -16,7 +16,16 @@
 package collection
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
 	"github.com/dremio/dremio-diagnostic-collector/cmd/root/cli"
+	"github.com/dremio/dremio-diagnostic-collector/cmd/root/helpers"
 )
 
 type MockCollector struct {
@@ -229,3 +238,154 @@ func (m *MockCollector) Name() string {
 // 		t.Errorf("expected %v but was %v", expectedArgs, calls["args"])
 // 	}
 // }
+
+// scriptedCollector answers HostExecute by the command being run and records every call
+type scriptedCollector struct {
+	MockCapCollector
+	shaOutput string
+	shaErr    error
+	calls     []string
+}
+
+func (s *scriptedCollector) HostExecute(_ bool, _ string, _ bool, args ...string) (string, error) {
+	cmd := strings.Join(args, " ")
+	s.calls = append(s.calls, cmd)
+	if strings.HasPrefix(cmd, "sha256sum ") {
+		return s.shaOutput, s.shaErr
+	}
+	if strings.HasPrefix(cmd, "cat /proc/sys/kernel/hostname") {
+		return "node1", nil
+	}
+	return "", nil
+}
+
+func (s *scriptedCollector) HostExecuteAndStream(_ bool, _ string, _ cli.OutputHandler, _ bool, args ...string) error {
+	s.calls = append(s.calls, strings.Join(args, " "))
+	return nil
+}
+
+func (s *scriptedCollector) CopyToHost(_ string, _ bool, source, destination string) (string, error) {
+	s.calls = append(s.calls, fmt.Sprintf("copy %v %v", source, destination))
+	return "", nil
+}
+
+func (s *scriptedCollector) CopyFromHost(_ string, _ bool, source, destination string) (string, error) {
+	s.calls = append(s.calls, fmt.Sprintf("copy %v %v", source, destination))
+	return "", nil
+}
+
+func (s *scriptedCollector) has(prefix string) bool {
+	for _, call := range s.calls {
+		if strings.HasPrefix(call, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// ddcSha256 is the hash of the ddc that captureWithScriptedCollector uploads
+var ddcSha256 = strings.Repeat("ab", 32)
+
+func captureWithScriptedCollector(t *testing.T, collector *scriptedCollector, keep bool) {
+	t.Helper()
+	conf := HostCaptureConfiguration{
+		Collector:        collector,
+		Host:             "node1",
+		DDCfs:            helpers.NewRealFileSystem(),
+		TransferDir:      "/tmp/ddc",
+		DDCSha256:        ddcSha256,
+		KeepDDCInstalled: keep,
+	}
+	if _, _, err := Capture(context.Background(), conf, "local-ddc", "local-ddc.yaml", filepath.Join(t.TempDir(), "out"), true); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestCaptureSkipsUploadWhenDDCMatches(t *testing.T) {
+	collector := &scriptedCollector{
+		shaOutput: ddcSha256 + "  /tmp/ddc/ddc\n",
+	}
+	captureWithScriptedCollector(t, collector, true)
+	if collector.has("copy local-ddc /tmp/ddc/ddc") {
+		t.Errorf("expected ddc to not be uploaded, calls were %v", collector.calls)
+	}
+	if !collector.has("copy local-ddc.yaml /tmp/ddc/ddc.yaml") {
+		t.Errorf("expected ddc.yaml to always be uploaded, calls were %v", collector.calls)
+	}
+	for _, call := range collector.calls {
+		if call == "rm /tmp/ddc/ddc" {
+			t.Errorf("expected ddc to be kept installed, calls were %v", collector.calls)
+		}
+	}
+}
+
+func TestCaptureUploadsWhenDDCDiffers(t *testing.T) {
+	for name, collector := range map[string]*scriptedCollector{
+		"different hash": {shaOutput: strings.Repeat("cd", 32) + "  /tmp/ddc/ddc\n"},
+		"no hash":        {shaOutput: "sha256sum: command not found\n"},
+		"not installed":  {shaErr: errors.New("no such file")},
+	} {
+		t.Run(name, func(t *testing.T) {
+			captureWithScriptedCollector(t, collector, false)
+			if !collector.has("copy local-ddc /tmp/ddc/ddc") {
+				t.Errorf("expected ddc to be uploaded, calls were %v", collector.calls)
+			}
+			if !collector.has("chmod +x /tmp/ddc/ddc") {
+				t.Errorf("expected ddc to be made executable, calls were %v", collector.calls)
+			}
+			removed := false
+			for _, call := range collector.calls {
+				removed = removed || call == "rm /tmp/ddc/ddc"
+			}
+			if !removed {
+				t.Errorf("expected ddc to be removed, calls were %v", collector.calls)
+			}
+		})
+	}
+}
+
+func TestCaptureEncryptsNodeTarball(t *testing.T) {
+	collector := &scriptedCollector{shaErr: errors.New("no such file")}
+	conf := HostCaptureConfiguration{
+		Collector:      collector,
+		Host:           "node1",
+		DDCfs:          helpers.NewRealFileSystem(),
+		TransferDir:    "/tmp/ddc",
+		RecipientsFile: "local-recipients.txt",
+	}
+	outDir := t.TempDir()
+	_, dest, err := Capture(context.Background(), conf, "local-ddc", "local-ddc.yaml", filepath.Join(outDir, "out"), true)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	for _, expected := range []string{
+		"copy local-recipients.txt /tmp/ddc/ddc-recipients.txt",
+		"/tmp/ddc/ddc local-collect --tarball-out-dir /tmp/ddc --encrypt-to /tmp/ddc/ddc-recipients.txt",
+		"copy /tmp/ddc/node1.tar.gz.age " + filepath.Join(outDir, "node1.tar.gz.age"),
+		"rm /tmp/ddc/ddc-recipients.txt",
+	} {
+		if !collector.has(expected) {
+			t.Errorf("expected call %q, calls were %v", expected, collector.calls)
+		}
+	}
+	if expected := filepath.Join(outDir, "node1.tar.gz.age"); dest != expected {
+		t.Errorf("expected the encrypted tarball %v but was %v", expected, dest)
+	}
+}
+
+func TestCapturePassesTheJVMCaptureStart(t *testing.T) {
+	collector := &scriptedCollector{shaErr: errors.New("no such file")}
+	conf := HostCaptureConfiguration{
+		Collector:    collector,
+		Host:         "node1",
+		DDCfs:        helpers.NewRealFileSystem(),
+		TransferDir:  "/tmp/ddc",
+		CaptureStart: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	if _, _, err := Capture(context.Background(), conf, "local-ddc", "local-ddc.yaml", filepath.Join(t.TempDir(), "out"), true); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if expected := "/tmp/ddc/ddc local-collect --tarball-out-dir /tmp/ddc --jvm-capture-start-utc 2024-01-02T03:04:05Z"; !collector.has(expected) {
+		t.Errorf("expected call %q, calls were %v", expected, collector.calls)
+	}
+}
@@ -0,0 +1,285 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// collection package provides the interface for collection implementation and the actual collection execution
+package collection
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dremio/dremio-diagnostic-collector/pkg/encrypt"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/simplelog"
+)
+
+// CheckpointFileName is the name of the manifest inside the checkpoint directory
+const CheckpointFileName = "checkpoint.json"
+
+const (
+	HostCompleted = "COMPLETED"
+	HostFailed    = "FAILED"
+)
+
+// HostCheckpoint is the last known result of a single host
+type HostCheckpoint struct {
+	IsCoordinator bool      `json:"isCoordinator"`
+	Status        string    `json:"status"`
+	Tarball       string    `json:"tarball,omitempty"`
+	Size          int64     `json:"size"`
+	Error         string    `json:"error,omitempty"`
+	UpdatedUTC    time.Time `json:"updatedUTC"`
+}
+
+// Checkpoint records which hosts finished and where their tarballs are so a failed
+// cluster collection can be resumed without collecting from every host again
+type Checkpoint struct {
+	CoordinatorStr string                    `json:"coordinatorStr"`
+	ExecutorsStr   string                    `json:"executorsStr"`
+	StartTimeUTC   time.Time                 `json:"startTimeUTC"`
+	Hosts          map[string]HostCheckpoint `json:"hosts"`
+	dir            string
+	mu             sync.Mutex
+}
+
+// CheckpointDir is the directory next to the output file that holds the checkpoint
+// manifest and the node tarballs until the collection has completed on every host
+func CheckpointDir(outputLoc string) string {
+	base := filepath.Base(outputLoc)
+	base = strings.TrimSuffix(base, filepath.Ext(base))
+	return filepath.Join(filepath.Dir(outputLoc), base+"-checkpoint")
+}
+
+// ErrCheckpointExists is returned by NewCheckpoint when an earlier run left a checkpoint behind
+var ErrCheckpointExists = errors.New("checkpoint of an earlier collection exists")
+
+// NewCheckpoint starts a fresh checkpoint in dir. A checkpoint left by an earlier run holds the node
+// tarballs it collected so it is only removed when discard is set, otherwise ErrCheckpointExists is returned
+func NewCheckpoint(dir, coordinatorStr, executorsStr string, start time.Time, discard bool) (*Checkpoint, error) {
+	if _, err := os.Stat(dir); err == nil {
+		if !discard {
+			return nil, fmt.Errorf("%w in %v, run again with --resume to collect only the hosts it is missing or with --discard-checkpoint to delete it and start over", ErrCheckpointExists, dir)
+		}
+		simplelog.Warningf("deleting the checkpoint %v of an earlier collection and the node tarballs in it", dir)
+		if err := os.RemoveAll(dir); err != nil {
+			return nil, fmt.Errorf("unable to remove old checkpoint %v: %w", dir, err)
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("unable to check for an old checkpoint in %v: %w", dir, err)
+	}
+	if err := os.MkdirAll(dir, DirPerms); err != nil {
+		return nil, fmt.Errorf("unable to create checkpoint directory %v: %w", dir, err)
+	}
+	c := &Checkpoint{
+		CoordinatorStr: coordinatorStr,
+		ExecutorsStr:   executorsStr,
+		StartTimeUTC:   start,
+		Hosts:          make(map[string]HostCheckpoint),
+		dir:            dir,
+	}
+	return c, c.save()
+}
+
+// LoadCheckpoint reads the checkpoint manifest in dir
+func LoadCheckpoint(dir string) (*Checkpoint, error) {
+	b, err := os.ReadFile(filepath.Clean(filepath.Join(dir, CheckpointFileName)))
+	if err != nil {
+		return nil, err
+	}
+	var c Checkpoint
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("unable to parse checkpoint %v: %w", dir, err)
+	}
+	if c.Hosts == nil {
+		c.Hosts = make(map[string]HostCheckpoint)
+	}
+	c.dir = dir
+	return &c, nil
+}
+
+// Dir is where the checkpoint manifest and the node tarballs are kept
+func (c *Checkpoint) Dir() string {
+	return c.dir
+}
+
+// Completed returns the checkpoint of a host that finished in an earlier run and still has its tarball on disk
+func (c *Checkpoint) Completed(host string) (HostCheckpoint, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	h, ok := c.Hosts[host]
+	if !ok || h.Status != HostCompleted {
+		return h, false
+	}
+	if _, err := os.Stat(c.tarballPath(h)); err != nil {
+		simplelog.Warningf("host %v is marked as completed but its tarball %v is not readable so it will be collected again: %v", host, h.Tarball, err)
+		return h, false
+	}
+	return h, true
+}
+
+// MarkCompleted moves the host tarball into the checkpoint directory and records it, the new location is returned
+func (c *Checkpoint) MarkCompleted(host string, isCoordinator bool, tarball string, size int64) (string, error) {
+	name := filepath.Base(tarball)
+	dest := filepath.Join(c.dir, name)
+	if err := moveFile(tarball, dest); err != nil {
+		return tarball, fmt.Errorf("unable to move %v to checkpoint directory %v: %w", tarball, c.dir, err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Hosts[host] = HostCheckpoint{
+		IsCoordinator: isCoordinator,
+		Status:        HostCompleted,
+		Tarball:       name,
+		Size:          size,
+		UpdatedUTC:    time.Now().UTC(),
+	}
+	return dest, c.save()
+}
+
+// MarkFailed records the host failure so a resumed run tries it again
+func (c *Checkpoint) MarkFailed(host string, isCoordinator bool, captureErr error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	h := HostCheckpoint{
+		IsCoordinator: isCoordinator,
+		Status:        HostFailed,
+		UpdatedUTC:    time.Now().UTC(),
+	}
+	if captureErr != nil {
+		h.Error = captureErr.Error()
+	}
+	c.Hosts[host] = h
+	return c.save()
+}
+
+// Tarballs lists the full path of every completed host tarball sorted by host
+func (c *Checkpoint) Tarballs() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var tarballs []string
+	for _, host := range c.hostsWithStatus(HostCompleted) {
+		tarballs = append(tarballs, c.tarballPath(c.Hosts[host]))
+	}
+	return tarballs
+}
+
+// FailedHosts lists the hosts whose last attempt failed
+func (c *Checkpoint) FailedHosts() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hostsWithStatus(HostFailed)
+}
+
+// DropUnencrypted removes the tarballs that are not encrypted and marks their hosts as failed so a resumed
+// run collects them again. With --encrypt-to nothing unencrypted is meant to be left on disk, but only
+// --encrypt-node-tarballs encrypts the node tarballs before they reach the checkpoint. The hosts are returned
+func (c *Checkpoint) DropUnencrypted() ([]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var dropped []string
+	var errs []error
+	for _, host := range c.hostsWithStatus(HostCompleted) {
+		h := c.Hosts[host]
+		if encrypt.IsEncrypted(h.Tarball) {
+			continue
+		}
+		if err := os.Remove(c.tarballPath(h)); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, fmt.Errorf("unable to remove unencrypted tarball %v: %w", c.tarballPath(h), err))
+			continue
+		}
+		c.Hosts[host] = HostCheckpoint{
+			IsCoordinator: h.IsCoordinator,
+			Status:        HostFailed,
+			Error:         "the unencrypted tarball was removed from the checkpoint since the collection is encrypted",
+			UpdatedUTC:    time.Now().UTC(),
+		}
+		dropped = append(dropped, host)
+	}
+	if len(dropped) > 0 {
+		if err := c.save(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return dropped, errors.Join(errs...)
+}
+
+// Remove deletes the checkpoint directory, called once every host has been collected
+func (c *Checkpoint) Remove() error {
+	return os.RemoveAll(c.dir)
+}
+
+func (c *Checkpoint) hostsWithStatus(status string) []string {
+	var hosts []string
+	for host, h := range c.Hosts {
+		if h.Status == status {
+			hosts = append(hosts, host)
+		}
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+func (c *Checkpoint) tarballPath(h HostCheckpoint) string {
+	return filepath.Join(c.dir, h.Tarball)
+}
+
+// save writes the manifest to a temp file first so a crash never leaves a truncated checkpoint behind
+func (c *Checkpoint) save() error {
+	b, err := json.MarshalIndent(c, "", "\t")
+	if err != nil {
+		return fmt.Errorf("unable to serialize checkpoint: %w", err)
+	}
+	manifest := filepath.Join(c.dir, CheckpointFileName)
+	tmp := manifest + ".tmp"
+	if err := os.WriteFile(tmp, b, 0600); err != nil {
+		return fmt.Errorf("unable to write checkpoint %v: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, manifest); err != nil {
+		return fmt.Errorf("unable to write checkpoint %v: %w", manifest, err)
+	}
+	return nil
+}
+
+// moveFile renames the file and falls back to a copy when source and destination are on different devices
+func moveFile(source, dest string) error {
+	if err := os.Rename(source, dest); err == nil {
+		return nil
+	}
+	in, err := os.Open(filepath.Clean(source))
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(filepath.Clean(dest))
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	in.Close()
+	return os.Remove(source)
+}
@@ -0,0 +1,206 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// collection package provides the interface for collection implementation and the actual collection execution
+package collection
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCheckpointDir(t *testing.T) {
+	actual := CheckpointDir(filepath.Join("out", "diag.tgz"))
+	expected := filepath.Join("out", "diag-checkpoint")
+	if actual != expected {
+		t.Errorf("expected %v but was %v", expected, actual)
+	}
+}
+
+func writeTarball(t *testing.T, dir, name string) string {
+	t.Helper()
+	f := filepath.Join(dir, name)
+	if err := os.WriteFile(f, []byte("tarball"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestCheckpointSurvivesReload(t *testing.T) {
+	tmpDir := t.TempDir()
+	dir := CheckpointDir(filepath.Join(tmpDir, "diag.tgz"))
+	c, err := NewCheckpoint(dir, "coord", "exec", time.Now().UTC(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dest, err := c.MarkCompleted("node1", true, writeTarball(t, tmpDir, "node1.tar.gz"), 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dest != filepath.Join(dir, "node1.tar.gz") {
+		t.Errorf("expected the tarball to be moved into the checkpoint but was %v", dest)
+	}
+	if err := c.MarkFailed("node2", false, errors.New("TARBALL TRANSFER")); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadCheckpoint(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, ok := loaded.Completed("node1")
+	if !ok {
+		t.Fatal("expected node1 to be completed")
+	}
+	if h.Size != 7 || !h.IsCoordinator {
+		t.Errorf("unexpected checkpoint for node1 %#v", h)
+	}
+	if _, ok := loaded.Completed("node2"); ok {
+		t.Error("expected node2 to not be completed")
+	}
+	if _, ok := loaded.Completed("node3"); ok {
+		t.Error("expected unknown node3 to not be completed")
+	}
+	if !reflect.DeepEqual(loaded.FailedHosts(), []string{"node2"}) {
+		t.Errorf("expected node2 to be failed but was %v", loaded.FailedHosts())
+	}
+	if !reflect.DeepEqual(loaded.Tarballs(), []string{dest}) {
+		t.Errorf("expected tarballs %v but was %v", []string{dest}, loaded.Tarballs())
+	}
+
+	// a retried host replaces its failure
+	if _, err := loaded.MarkCompleted("node2", false, writeTarball(t, tmpDir, "node2.tar.gz"), 3); err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.FailedHosts()) != 0 {
+		t.Errorf("expected no failed hosts but was %v", loaded.FailedHosts())
+	}
+}
+
+func TestCheckpointMissingTarballIsCollectedAgain(t *testing.T) {
+	tmpDir := t.TempDir()
+	dir := CheckpointDir(filepath.Join(tmpDir, "diag.tgz"))
+	c, err := NewCheckpoint(dir, "coord", "exec", time.Now().UTC(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dest, err := c.MarkCompleted("node1", true, writeTarball(t, tmpDir, "node1.tar.gz"), 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(dest); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.Completed("node1"); ok {
+		t.Error("expected node1 to be collected again when its tarball is gone")
+	}
+}
+
+func TestOpenCheckpoint(t *testing.T) {
+	tmpDir := t.TempDir()
+	args := Args{
+		CoordinatorStr: "coord",
+		ExecutorsStr:   "exec",
+		OutputLoc:      filepath.Join(tmpDir, "diag.tgz"),
+	}
+	c, err := openCheckpoint(args, time.Now().UTC())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.MarkCompleted("node1", true, writeTarball(t, tmpDir, "node1.tar.gz"), 7); err != nil {
+		t.Fatal(err)
+	}
+
+	args.Resume = true
+	resumed, err := openCheckpoint(args, time.Now().UTC())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := resumed.Completed("node1"); !ok {
+		t.Error("expected the resumed checkpoint to have node1 completed")
+	}
+
+	// without --resume the old checkpoint is kept and the collection does not start
+	args.Resume = false
+	if _, err := openCheckpoint(args, time.Now().UTC()); !errors.Is(err, ErrCheckpointExists) {
+		t.Fatalf("expected the old checkpoint to stop a new collection but was %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(CheckpointDir(args.OutputLoc), "node1.tar.gz")); err != nil {
+		t.Errorf("expected the old tarball to be kept but got %v", err)
+	}
+
+	// --discard-checkpoint throws it away
+	args.DiscardCheckpoint = true
+	fresh, err := openCheckpoint(args, time.Now().UTC())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fresh.Completed("node1"); ok {
+		t.Error("expected a fresh checkpoint")
+	}
+	if _, err := os.Stat(filepath.Join(fresh.Dir(), "node1.tar.gz")); !os.IsNotExist(err) {
+		t.Errorf("expected the old tarball to be removed but got %v", err)
+	}
+
+	// resuming with no checkpoint starts a new collection
+	args.Resume = true
+	args.OutputLoc = filepath.Join(tmpDir, "other.tgz")
+	if _, err := openCheckpoint(args, time.Now().UTC()); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestCheckpointDropUnencrypted(t *testing.T) {
+	tmpDir := t.TempDir()
+	dir := CheckpointDir(filepath.Join(tmpDir, "diag.tgz"))
+	c, err := NewCheckpoint(dir, "coord", "exec", time.Now().UTC(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.MarkCompleted("node1", true, writeTarball(t, tmpDir, "node1.tar.gz"), 7); err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := c.MarkCompleted("node2", false, writeTarball(t, tmpDir, "node2.tar.gz.age"), 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.MarkFailed("node3", false, errors.New("TARBALL TRANSFER")); err != nil {
+		t.Fatal(err)
+	}
+	dropped, err := c.DropUnencrypted()
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(dropped, []string{"node1"}) {
+		t.Errorf("expected only node1 to be dropped but was %v", dropped)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "node1.tar.gz")); !os.IsNotExist(err) {
+		t.Errorf("expected the unencrypted tarball to be removed but stat returned %v", err)
+	}
+	if !reflect.DeepEqual(c.Tarballs(), []string{encrypted}) {
+		t.Errorf("expected the encrypted tarball to be kept but was %v", c.Tarballs())
+	}
+	reloaded, err := LoadCheckpoint(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a resumed run collects node1 again along with the host that failed
+	if failed := reloaded.FailedHosts(); !reflect.DeepEqual(failed, []string{"node1", "node3"}) {
+		t.Errorf("expected node1 and node3 to be collected again but was %v", failed)
+	}
+}
@@ -21,14 +21,22 @@ import (
 	"strings"
 	"sync"
 
-	"github.com/dremio/dremio-diagnostic-collector/cmd/root/cli"
 	"github.com/dremio/dremio-diagnostic-collector/cmd/root/helpers"
 	"github.com/dremio/dremio-diagnostic-collector/pkg/consoleprint"
 	"github.com/dremio/dremio-diagnostic-collector/pkg/masking"
 	"github.com/dremio/dremio-diagnostic-collector/pkg/simplelog"
 )
 
-func ClusterK8sExecute(namespace string, cs CopyStrategy, ddfs helpers.Filesystem, c Collector, k string) error {
+// K8sClusterCollector reads the cluster level resources, container logs and node descriptions,
+// it is implemented by both the kubectl and the Kubernetes API based collectors
+type K8sClusterCollector interface {
+	GetClusterResource(resource string) ([]byte, error)
+	GetPodContainers(pod string) ([]string, error)
+	GetPodLogs(pod, container string) (string, error)
+	DescribeNodes() (string, error)
+}
+
+func ClusterK8sExecute(cs CopyStrategy, ddfs helpers.Filesystem, k K8sClusterCollector) error {
 	cmds := []string{"nodes", "sc", "pvc", "pv", "service", "endpoints", "pods", "deployments", "statefulsets", "daemonset", "replicaset", "cronjob", "job", "events", "ingress", "limitrange", "resourcequota", "hpa", "pdb", "pc"}
 	var wg sync.WaitGroup
 	p, err := cs.CreatePath("kubernetes", "dremio-master", "")
@@ -41,14 +49,14 @@ func ClusterK8sExecute(namespace string, cs CopyStrategy, ddfs helpers.Filesyste
 		go func(cmdname string) {
 			defer wg.Done()
 			resource := cmdname
-			out, err := clusterExecuteBytes(namespace, resource, c, k)
+			out, err := k.GetClusterResource(resource)
 			if err != nil {
 				simplelog.Errorf("when getting cluster config, error was %v", err)
 				return
 			}
 			text, err := masking.RemoveSecretsFromK8sJSON(string(out))
 			if err != nil {
-				simplelog.Errorf("unable to mask secrets for %v in namespace %v returning am empty text due to error '%v'", k, namespace, err)
+				simplelog.Errorf("unable to mask secrets for %v returning am empty text due to error '%v'", resource, err)
 				return
 			}
 
@@ -66,7 +74,7 @@ func ClusterK8sExecute(namespace string, cs CopyStrategy, ddfs helpers.Filesyste
 	return nil
 }
 
-func GetClusterLogs(namespace string, cs CopyStrategy, ddfs helpers.Filesystem, k string, pods []string) error {
+func GetClusterLogs(cs CopyStrategy, ddfs helpers.Filesystem, k K8sClusterCollector, pods []string) error {
 	var wg sync.WaitGroup
 	path, err := cs.CreatePath("kubernetes", "container-logs", "")
 	if err != nil {
@@ -79,16 +87,15 @@ func GetClusterLogs(namespace string, cs CopyStrategy, ddfs helpers.Filesystem,
 		wg.Add(1)
 		go func(podname string) {
 			defer wg.Done()
-			kubectlArgs := []string{k, "-n", namespace, "get", "pods", string(podname), "-o", `jsonpath={.spec['containers','initContainers'][*].name}`}
-			containers, err := clusterExecutePod(kubectlArgs)
+			containers, err := k.GetPodContainers(podname)
 			if err != nil {
 				simplelog.Errorf("trying to list containers from pod %v with error %v", podname, err)
 				return
 			}
 			// Loop over each container, construct a path and log file name
-			// write the output of the kubectl logs command to a file
-			for _, container := range strings.Split(containers, " ") {
-				copyContainerLog(cs, ddfs, k, container, namespace, path, podname)
+			// write the output of the logs to a file
+			for _, container := range containers {
+				copyContainerLog(cs, ddfs, k, container, path, podname)
 			}
 			consoleprint.UpdateK8sFiles(fmt.Sprintf("pod %v logs", podname))
 		}(pod)
@@ -97,9 +104,8 @@ func GetClusterLogs(namespace string, cs CopyStrategy, ddfs helpers.Filesystem,
 	return err
 }
 
-func copyContainerLog(cs CopyStrategy, ddfs helpers.Filesystem, k, container, namespace, path, pod string) {
-	kubectlArgs := []string{k, "-n", namespace, "logs", pod, "-c", string(container)}
-	out, err := clusterExecutePod(kubectlArgs)
+func copyContainerLog(cs CopyStrategy, ddfs helpers.Filesystem, k K8sClusterCollector, container, path, pod string) {
+	out, err := k.GetPodLogs(pod, container)
 	if err != nil {
 		simplelog.Errorf("trying to get log from pod: %v container: %v with error: %v", pod, container, err)
 	}
@@ -116,20 +122,19 @@ func copyContainerLog(cs CopyStrategy, ddfs helpers.Filesystem, k, container, na
 	}
 }
 
-func GetClusterNodes(namespace string, cs CopyStrategy, ddfs helpers.Filesystem, k string) error {
+func GetClusterNodes(cs CopyStrategy, ddfs helpers.Filesystem, k K8sClusterCollector) error {
 	path, err := cs.CreatePath("kubernetes", "nodes", "")
 	if err != nil {
 		simplelog.Errorf("trying to construct cluster node path %v with error %v", path, err)
 		return err
 	}
 
-	kubectlArgs := []string{k, "-n", namespace, "describe", "nodes"}
-	nodes, err := clusterExecutePod(kubectlArgs)
+	nodes, err := k.DescribeNodes()
 	if err != nil {
 		simplelog.Errorf("trying to list nodes from cluster with error %v", err)
 		return err
 	}
-	// Write the output of the kubectl describe nodes command to a file
+	// Write the output of the describe nodes command to a file
 	outFile := filepath.Join(path, "describe-nodes.txt")
 	err = ddfs.WriteFile(outFile, []byte(nodes), DirPerms)
 	if err != nil {
@@ -139,28 +144,3 @@ func GetClusterNodes(namespace string, cs CopyStrategy, ddfs helpers.Filesystem,
 
 	return err
 }
-
-// Execute commands at the cluster level
-// Calls a raw execute function and simply writes out the byte array read from the response
-// that comes in directly from kubectl
-func clusterExecuteBytes(namespace, resource string, _ Collector, k string) ([]byte, error) {
-	cli := &cli.Cli{}
-	kubectlArgs := []string{k, "-n", namespace, "get", resource}
-	kubectlArgs = append(kubectlArgs, "-o", "json")
-	res, err := cli.ExecuteBytes(false, kubectlArgs...)
-	if err != nil {
-		return []byte(""), fmt.Errorf("when getting config %v error returned was %v", resource, err)
-	}
-	return res, nil
-}
-
-// Execute commands at the cluster level
-// Returns response as a string (instead of bytes)
-func clusterExecutePod(args []string) (string, error) {
-	cli := &cli.Cli{}
-	res, err := cli.Execute(false, args...)
-	if err != nil {
-		return "", fmt.Errorf("when running command \n%v\nerror returned was %v", args, err)
-	}
-	return res, nil
-}
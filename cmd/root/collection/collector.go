@@ -16,26 +16,28 @@
 package collection
 
 import (
-	"archive/tar"
-	"compress/gzip"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"io/fs"
 	"os"
-	"path"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/dremio/dremio-diagnostic-collector/cmd/local/ddcio"
 	"github.com/dremio/dremio-diagnostic-collector/cmd/root/cli"
-	"github.com/dremio/dremio-diagnostic-collector/cmd/root/ddcbinary"
 	"github.com/dremio/dremio-diagnostic-collector/cmd/root/helpers"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/archive"
 	"github.com/dremio/dremio-diagnostic-collector/pkg/clusterstats"
 	"github.com/dremio/dremio-diagnostic-collector/pkg/consoleprint"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/encrypt"
 	"github.com/dremio/dremio-diagnostic-collector/pkg/simplelog"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/taskresults"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/upload"
 	"github.com/dremio/dremio-diagnostic-collector/pkg/versions"
 )
 
@@ -43,7 +45,7 @@ var DirPerms fs.FileMode = 0750
 
 type CopyStrategy interface {
 	CreatePath(fileType, source, nodeType string) (path string, err error)
-	ArchiveDiag(o string, outputLoc string) error
+	ArchiveDiag(o string, nodes []string, outputLoc string, opts archive.Options) ([]string, error)
 	GetTmpDir() string
 }
 
@@ -72,6 +74,53 @@ type Args struct {
 	Disabled       []string
 	Enabled        []string
 	PATSet         bool
+	Resume         bool
+	// DiscardCheckpoint deletes the checkpoint of an earlier collection instead of refusing to start
+	DiscardCheckpoint bool
+	// MaxConcurrentHosts limits how many hosts are captured at the same time, 0 means no limit
+	MaxConcurrentHosts int
+	// HostTimeout is the wall clock limit for a single host capture, 0 means no limit
+	HostTimeout time.Duration
+	// KeepDDCInstalled leaves the ddc binary in the transfer dir so later runs can skip the upload
+	KeepDDCInstalled bool
+	// CaptureStartDelay is how long after the hosts are launched they all start their ttop, JFR and jstack captures, 0 lets every host start them on its own
+	CaptureStartDelay time.Duration
+	// CollectionMode is the preset of collectors every host runs, it is recorded in the summary
+	CollectionMode string
+	// HostSudoUsers overrides SudoUser for individual hosts
+	HostSudoUsers map[string]string
+	// HostLabels are free form names for hosts that are recorded in the summary
+	HostLabels map[string]string
+	// DryRun writes a plan of what every host would collect instead of collecting
+	DryRun bool
+	// SkipPreflight turns off the checks run on every host before the collection starts
+	SkipPreflight bool
+	// PreflightOnFailure is prompt, abort or continue and decides what happens when a preflight check fails
+	PreflightOnFailure string
+	// PreflightDirs are the dremio directories that must be readable on every host
+	PreflightDirs []string
+	// PreflightMinFreeBytes is the free space needed in the transfer dir
+	PreflightMinFreeBytes int64
+	// ConfirmPreflight asks the user whether to continue when --preflight-on-failure is prompt
+	ConfirmPreflight func(failedHosts []string) (bool, error)
+	// ArchiveFormat is the format of the output file, empty picks it from the OutputLoc extension
+	ArchiveFormat archive.Format
+	// MaxVolumeBytes splits the output file into numbered volumes of at most this size, 0 means no split
+	MaxVolumeBytes int64
+	// UploadTarget receives the archive once it is written, nil keeps it local only
+	UploadTarget upload.Target
+	// EncryptTo are the age or ssh recipients the archive is encrypted to, empty leaves it unencrypted
+	EncryptTo []string
+	// EncryptNodeTarballs has local-collect encrypt every node tarball to EncryptTo before it is copied back
+	EncryptNodeTarballs bool
+}
+
+// sudoUserFor returns the sudo user of the host, falling back to the --sudo-user flag
+func (a Args) sudoUserFor(host string) string {
+	if sudoUser, ok := a.HostSudoUsers[host]; ok {
+		return sudoUser
+	}
+	return a.SudoUser
 }
 
 type HostCaptureConfiguration struct {
@@ -84,20 +133,30 @@ type HostCaptureConfiguration struct {
 	DDCfs          helpers.Filesystem
 	DremioPAT      string
 	TransferDir    string
+	// DDCSha256 is the hash of the ddc binary we upload, a matching copy already on the host is reused
+	DDCSha256        string
+	KeepDDCInstalled bool
+	// DryRun runs local-collect --dry-run and brings back the plan instead of the tarball
+	DryRun bool
+	// RecipientsFile is copied to the host so local-collect encrypts the tarball, empty means no encryption
+	RecipientsFile string
+	// CaptureStart is the common start of the jvm captures of every host, zero means the host starts them on its own
+	CaptureStart time.Time
+	// CollectionMode is passed to local-collect, empty leaves it to ddc.yaml
+	CollectionMode string
 }
 
-func Execute(c Collector, s CopyStrategy, collectionArgs Args, clusterCollection ...func([]string)) error {
+// Execute captures every host and archives the result. When the context is cancelled the hosts that are still
+// capturing are cleaned up and a partial summary.json is left in the checkpoint directory instead of an archive.
+func Execute(ctx context.Context, c Collector, s CopyStrategy, collectionArgs Args, clusterCollection ...func([]string)) error {
 	start := time.Now().UTC()
 	coordinatorStr := collectionArgs.CoordinatorStr
 	executorsStr := collectionArgs.ExecutorsStr
 	outputLoc := collectionArgs.OutputLoc
-	sudoUser := collectionArgs.SudoUser
 	ddcfs := collectionArgs.DDCfs
 	dremioPAT := collectionArgs.DremioPAT
 	transferDir := collectionArgs.TransferDir
 	ddcYamlFilePath := collectionArgs.DDCYamlLoc
-	var ddcLoc string
-	var err error
 	tmpIinstallDir, err := os.MkdirTemp("", "ddcex-output")
 	if err != nil {
 		return err
@@ -107,9 +166,14 @@ func Execute(c Collector, s CopyStrategy, collectionArgs Args, clusterCollection
 			simplelog.Warningf("unable to cleanup temp install directory: '%v'", err)
 		}
 	}()
-	ddcLoc, err = ddcbinary.WriteOutDDC(tmpIinstallDir)
-	if err != nil {
-		return fmt.Errorf("making ddc binary failed: '%v'", err)
+	// the matching ddc build is picked per host since clusters can mix architectures
+	binaries := newDDCBinaries(tmpIinstallDir)
+	var recipientsFile string
+	if collectionArgs.EncryptNodeTarballs {
+		recipientsFile = filepath.Join(tmpIinstallDir, "ddc-recipients.txt")
+		if err := encrypt.WriteRecipientsFile(recipientsFile, collectionArgs.EncryptTo); err != nil {
+			return fmt.Errorf("unable to write recipients for the node tarballs: %w", err)
+		}
 	}
 
 	coordinators, err := c.FindHosts(coordinatorStr)
@@ -126,15 +190,70 @@ func Execute(c Collector, s CopyStrategy, collectionArgs Args, clusterCollection
 	if totalNodes == 0 {
 		return fmt.Errorf("coordinator string '%v' and executor string '%v' were not able to connect: %v ", coordinatorStr, executorsStr, c.HelpText())
 	}
+	if collectionArgs.DryRun {
+		return executeDryRun(ctx, c, s, collectionArgs, binaries, coordinators, executors)
+	}
 	hosts := append(coordinators, executors...)
 
+	checkpoint, err := openCheckpoint(collectionArgs, start)
+	if err != nil {
+		return err
+	}
+	if len(collectionArgs.EncryptTo) > 0 && !collectionArgs.EncryptNodeTarballs {
+		// the checkpoint is kept when hosts failed or the run stopped early, it must not hold unencrypted tarballs
+		defer func() {
+			if _, err := os.Stat(checkpoint.Dir()); err != nil {
+				return
+			}
+			dropped, err := checkpoint.DropUnencrypted()
+			if err != nil {
+				simplelog.Errorf("unable to remove the unencrypted tarballs from checkpoint %v: %v", checkpoint.Dir(), err)
+			}
+			if len(dropped) > 0 {
+				simplelog.Warningf("removed the unencrypted tarballs of hosts %v from checkpoint %v since --encrypt-to is set, --resume collects them again. Pass --encrypt-node-tarballs to keep them encrypted in the checkpoint instead", strings.Join(dropped, ", "), checkpoint.Dir())
+			}
+		}()
+	}
+
+	if !collectionArgs.SkipPreflight {
+		var confs []HostCaptureConfiguration
+		for i, host := range hosts {
+			if _, ok := checkpoint.Completed(host); ok {
+				continue
+			}
+			confs = append(confs, HostCaptureConfiguration{
+				Collector:     c,
+				IsCoordinator: i < len(coordinators),
+				Host:          host,
+				SudoUser:      collectionArgs.sudoUserFor(host),
+				TransferDir:   transferDir,
+			})
+		}
+		results := runPreflight(ctx, confs, collectionArgs.PreflightDirs, collectionArgs.PreflightMinFreeBytes)
+		if ctx.Err() == nil {
+			if err := preflightDecision(results, collectionArgs.PreflightOnFailure, collectionArgs.ConfirmPreflight); err != nil {
+				if !collectionArgs.Resume {
+					// nothing was collected so the fresh checkpoint is of no use
+					if rmErr := checkpoint.Remove(); rmErr != nil {
+						simplelog.Warningf("unable to remove checkpoint directory %v: %v", checkpoint.Dir(), rmErr)
+					}
+				}
+				return err
+			}
+		}
+	}
+
 	//now safe to collect cluster level information
 	for _, c := range clusterCollection {
-		c(hosts)
+		if ctx.Err() == nil {
+			c(hosts)
+		}
 	}
 	var files []helpers.CollectedFile
 	var totalFailedFiles []string
 	var totalSkippedFiles []string
+	var resumedHosts []string
+	var cancelledHosts []string
 	var nodesConnectedTo int
 	var m sync.Mutex
 	var wg sync.WaitGroup
@@ -149,38 +268,109 @@ func Execute(c Collector, s CopyStrategy, collectionArgs Args, clusterCollection
 		0,
 		len(coordinators)+len(executors),
 	)
+	// a nil channel means there is no limit on parallel captures
+	var hostSlots chan struct{}
+	if collectionArgs.MaxConcurrentHosts > 0 {
+		hostSlots = make(chan struct{}, collectionArgs.MaxConcurrentHosts)
+	}
+	captureHost := func(hostCaptureConf HostCaptureConfiguration, skipRESTCalls bool) {
+		host := hostCaptureConf.Host
+		if previous, ok := checkpoint.Completed(host); ok {
+			simplelog.Infof("host %v already completed in %v, skipping it", host, checkpoint.Dir())
+			consoleprint.UpdateNodeState(host, "COMPLETED - FROM CHECKPOINT")
+			m.Lock()
+			files = append(files, helpers.CollectedFile{
+				Path: filepath.Join(checkpoint.Dir(), previous.Tarball),
+				Size: previous.Size,
+			})
+			resumedHosts = append(resumedHosts, host)
+			m.Unlock()
+			return
+		}
+		if hostSlots != nil {
+			consoleprint.UpdateNodeState(host, "QUEUED")
+			select {
+			case hostSlots <- struct{}{}:
+				defer func() { <-hostSlots }()
+			case <-ctx.Done():
+			}
+		}
+		var size int64
+		var f string
+		var err error
+		if ctx.Err() != nil {
+			// nothing was started on the host so there is nothing to clean up
+			consoleprint.UpdateNodeState(host, "FAILED - CANCELLED")
+			err = HostCancelledErr{Host: host, Err: ctx.Err()}
+		} else {
+			size, f, err = captureWithTimeout(ctx, hostCaptureConf, collectionArgs.HostTimeout, func() (int64, string, error) {
+				ddcLoc, ddcSha256, err := binaries.forHost(hostCaptureConf)
+				if err != nil {
+					simplelog.Errorf("skipping host %v: %v", host, err)
+					consoleprint.UpdateNodeState(host, platformFailureStatus(err))
+					return 0, "", err
+				}
+				// copied since the capture may outlive captureHost after a timeout
+				conf := hostCaptureConf
+				conf.DDCSha256 = ddcSha256
+				return Capture(ctx, conf, ddcLoc, ddcYamlFilePath, s.GetTmpDir(), skipRESTCalls)
+			})
+		}
+		if err == nil {
+			f, err = checkpoint.MarkCompleted(host, hostCaptureConf.IsCoordinator, f, size)
+		}
+		if err != nil {
+			if cpErr := checkpoint.MarkFailed(host, hostCaptureConf.IsCoordinator, err); cpErr != nil {
+				simplelog.Errorf("unable to update checkpoint for host %v: %v", host, cpErr)
+			}
+			m.Lock()
+			if errors.As(err, &HostCancelledErr{}) {
+				cancelledHosts = append(cancelledHosts, host)
+			} else {
+				totalFailedFiles = append(totalFailedFiles, f)
+			}
+			m.Unlock()
+			return
+		}
+		m.Lock()
+		files = append(files, helpers.CollectedFile{
+			Path: f,
+			Size: size,
+		})
+		m.Unlock()
+	}
+	// picked once every host is about to be launched, the delay covers copying ddc to them
+	var captureStart time.Time
+	if collectionArgs.CaptureStartDelay > 0 {
+		captureStart = time.Now().UTC().Add(collectionArgs.CaptureStartDelay).Truncate(time.Second)
+		simplelog.Infof("the jvm captures of every host start at %v", captureStart.Format(time.RFC3339))
+		if hostsCount := len(coordinators) + len(executors); collectionArgs.MaxConcurrentHosts > 0 && collectionArgs.MaxConcurrentHosts < hostsCount {
+			simplelog.Warningf("only %v of %v hosts are captured at once, the jvm captures of the queued hosts will start late", collectionArgs.MaxConcurrentHosts, hostsCount)
+		}
+	}
 	for _, coordinator := range coordinators {
 		nodesConnectedTo++
 		wg.Add(1)
 		go func(host string) {
 			defer wg.Done()
 			coordinatorCaptureConf := HostCaptureConfiguration{
-				Collector:      c,
-				IsCoordinator:  true,
-				Host:           host,
-				OutputLocation: s.GetTmpDir(),
-				SudoUser:       sudoUser,
-				CopyStrategy:   s,
-				DDCfs:          ddcfs,
-				TransferDir:    transferDir,
-				DremioPAT:      dremioPAT,
+				Collector:        c,
+				IsCoordinator:    true,
+				Host:             host,
+				OutputLocation:   s.GetTmpDir(),
+				SudoUser:         collectionArgs.sudoUserFor(host),
+				CopyStrategy:     s,
+				DDCfs:            ddcfs,
+				TransferDir:      transferDir,
+				DremioPAT:        dremioPAT,
+				KeepDDCInstalled: collectionArgs.KeepDDCInstalled,
+				RecipientsFile:   recipientsFile,
+				CaptureStart:     captureStart,
+				CollectionMode:   collectionArgs.CollectionMode,
 			}
 			//we want to be able to capture the job profiles of all the nodes
 			skipRESTCalls := false
-			size, f, err := Capture(coordinatorCaptureConf, ddcLoc, ddcYamlFilePath, s.GetTmpDir(), skipRESTCalls)
-			if err != nil {
-				m.Lock()
-				totalFailedFiles = append(totalFailedFiles, f)
-				m.Unlock()
-			} else {
-				m.Lock()
-				files = append(files, helpers.CollectedFile{
-					Path: f,
-					Size: size,
-				})
-				m.Unlock()
-			}
-
+			captureHost(coordinatorCaptureConf, skipRESTCalls)
 		}(coordinator)
 	}
 
@@ -190,30 +380,22 @@ func Execute(c Collector, s CopyStrategy, collectionArgs Args, clusterCollection
 		go func(host string) {
 			defer wg.Done()
 			executorCaptureConf := HostCaptureConfiguration{
-				Collector:      c,
-				IsCoordinator:  false,
-				Host:           host,
-				OutputLocation: s.GetTmpDir(),
-				SudoUser:       sudoUser,
-				CopyStrategy:   s,
-				DDCfs:          ddcfs,
-				TransferDir:    transferDir,
+				Collector:        c,
+				IsCoordinator:    false,
+				Host:             host,
+				OutputLocation:   s.GetTmpDir(),
+				SudoUser:         collectionArgs.sudoUserFor(host),
+				CopyStrategy:     s,
+				DDCfs:            ddcfs,
+				TransferDir:      transferDir,
+				KeepDDCInstalled: collectionArgs.KeepDDCInstalled,
+				RecipientsFile:   recipientsFile,
+				CaptureStart:     captureStart,
+				CollectionMode:   collectionArgs.CollectionMode,
 			}
 			//always skip executor calls
 			skipRESTCalls := true
-			size, f, err := Capture(executorCaptureConf, ddcLoc, ddcYamlFilePath, s.GetTmpDir(), skipRESTCalls)
-			if err != nil {
-				m.Lock()
-				totalFailedFiles = append(totalFailedFiles, f)
-				m.Unlock()
-			} else {
-				m.Lock()
-				files = append(files, helpers.CollectedFile{
-					Path: f,
-					Size: size,
-				})
-				m.Unlock()
-			}
+			captureHost(executorCaptureConf, skipRESTCalls)
 		}(executor)
 	}
 	wg.Wait()
@@ -238,24 +420,35 @@ func Execute(c Collector, s CopyStrategy, collectionArgs Args, clusterCollection
 	collectionInfo.DDCVersion = versions.GetCLIVersion()
 	collectionInfo.CollectionsEnabled = collectionArgs.Enabled
 	collectionInfo.CollectionsDisabled = collectionArgs.Disabled
+	collectionInfo.CollectionMode = collectionArgs.CollectionMode
 	collectionInfo.PatSet = collectionArgs.PATSet
-
-	tarballs, err := FindTarGzFiles(path.Dir(s.GetTmpDir()))
-	if err != nil {
-		return err
+	collectionInfo.ResumedHosts = resumedHosts
+	collectionInfo.HostLabels = collectionArgs.HostLabels
+	if ctx.Err() != nil {
+		collectionInfo.Cancelled = true
+		sort.Strings(cancelledHosts)
+		collectionInfo.CancelledHosts = cancelledHosts
+		return writeCancelledSummary(collectionInfo, checkpoint)
 	}
+
+	// the node tarballs stay in the checkpoint directory until the archive is written
+	// so a resumed run can build the archive from them again
+	tarballs := checkpoint.Tarballs()
 	if len(tarballs) > 0 {
 		simplelog.Debugf("extracting the following tarballs %v", strings.Join(tarballs, ", "))
 		for _, t := range tarballs {
+			if encrypt.IsEncrypted(t) {
+				// only the recipients can read it so it goes into the archive as is
+				if err := ddcio.CopyFile(t, filepath.Join(s.GetTmpDir(), filepath.Base(t))); err != nil {
+					simplelog.Errorf("unable to add encrypted tarball %v due to error %v", t, err)
+				}
+				continue
+			}
 			simplelog.Debugf("extracting %v to %v", t, s.GetTmpDir())
 			if err := ExtractTarGz(t, s.GetTmpDir()); err != nil {
 				simplelog.Errorf("unable to extract tarball %v due to error %v", t, err)
 			}
 			simplelog.Debugf("extracted %v", t)
-			if err := os.Remove(t); err != nil {
-				simplelog.Errorf("unable to delete tarball %v due to error %v", t, err)
-			}
-			simplelog.Debugf("removed %v", t)
 		}
 	}
 
@@ -272,6 +465,18 @@ func Execute(c Collector, s CopyStrategy, collectionArgs Args, clusterCollection
 		collectionInfo.ClusterID = clusterIDs
 		collectionInfo.DremioVersion = versions
 	}
+	nodeResults, err := FindTaskResults(s.GetTmpDir())
+	if err != nil {
+		simplelog.Errorf("unable to read task results in %v: %v", s.GetTmpDir(), err)
+	} else if len(nodeResults) > 0 {
+		collectionInfo.TaskResults = taskresults.Aggregate(nodeResults)
+		if !captureStart.IsZero() {
+			collectionInfo.JVMCaptureStart = taskresults.Skew(captureStart, nodeResults)
+			if collectionInfo.JVMCaptureStart != nil {
+				simplelog.Infof("the jvm captures started at most %vms apart", collectionInfo.JVMCaptureStart.MaxSkewMillis)
+			}
+		}
+	}
 	if len(files) == 0 {
 		return errors.New("no files transferred")
 	}
@@ -285,18 +490,103 @@ func Execute(c Collector, s CopyStrategy, collectionArgs Args, clusterCollection
 
 	// archives the collected files
 	// creates the summary file too
-	err = s.ArchiveDiag(o, outputLoc)
+	format := collectionArgs.ArchiveFormat
+	if format == "" {
+		format = archive.FormatFromName(outputLoc)
+	}
+	archives, err := s.ArchiveDiag(o, nodeNames(tarballs), outputLoc, archive.Options{Format: format, MaxVolumeBytes: collectionArgs.MaxVolumeBytes})
 	if err != nil {
 		return err
 	}
-	fullPath, err := filepath.Abs(outputLoc)
+	if len(collectionArgs.EncryptTo) > 0 {
+		for i, a := range archives {
+			consoleprint.UpdateTarballDir("encrypting " + a)
+			encrypted, err := encrypt.File(a, collectionArgs.EncryptTo)
+			if err != nil {
+				return fmt.Errorf("unable to encrypt the archive, nothing unencrypted is kept: %w", removeUnencrypted(archives[i:], err))
+			}
+			archives[i] = encrypted
+		}
+		simplelog.Infof("archive encrypted to %v recipient(s)", len(collectionArgs.EncryptTo))
+	}
+	var fullPaths []string
+	for _, a := range archives {
+		fullPath, err := filepath.Abs(a)
+		if err != nil {
+			return err
+		}
+		fullPaths = append(fullPaths, fullPath)
+	}
+	if len(fullPaths) > 1 {
+		simplelog.Infof("archive split into %v volumes: %v", len(fullPaths), strings.Join(fullPaths, ", "))
+	}
+	consoleprint.UpdateTarballDir(strings.Join(fullPaths, ", "))
+	if failedHosts := checkpoint.FailedHosts(); len(failedHosts) > 0 {
+		simplelog.Warningf("collection failed on hosts %v, the checkpoint in %v has been kept, run again with --resume to retry only those hosts", strings.Join(failedHosts, ", "), checkpoint.Dir())
+	} else if err := checkpoint.Remove(); err != nil {
+		simplelog.Warningf("unable to remove checkpoint directory %v: %v", checkpoint.Dir(), err)
+	}
+	if collectionArgs.UploadTarget == nil {
+		return nil
+	}
+	return uploadArchive(ctx, collectionArgs.UploadTarget, collectionInfo, outputLoc, archives)
+}
+
+// uploadArchive sends the archive to the upload target and writes the summary with the upload result next
+// to it, the summary.json inside the archive cannot know how its own upload went
+func uploadArchive(ctx context.Context, target upload.Target, collectionInfo SummaryInfo, outputLoc string, archives []string) error {
+	result, uploadErr := upload.Files(ctx, target, archives)
+	collectionInfo.Upload = &result
+	o, err := collectionInfo.String()
 	if err != nil {
 		return err
 	}
-	consoleprint.UpdateTarballDir(fullPath)
+	summaryFile := SummaryFile(outputLoc)
+	if err := os.WriteFile(summaryFile, []byte(o), 0600); err != nil {
+		simplelog.Errorf("unable to write summary %v with the upload result: %v", summaryFile, err)
+	}
+	if uploadErr != nil {
+		return fmt.Errorf("the archive was written to %v but the upload failed, run 'ddc upload %v --upload-to %v' to resume it: %w", outputLoc, archives[0], target.Destination(), uploadErr)
+	}
 	return nil
 }
 
+// writeCancelledSummary leaves a summary.json of what was collected before the cancellation next to the checkpoint.
+// No archive is written so a --resume run only has to collect the remaining hosts.
+func writeCancelledSummary(collectionInfo SummaryInfo, checkpoint *Checkpoint) error {
+	o, err := collectionInfo.String()
+	if err != nil {
+		return err
+	}
+	summaryFile := filepath.Join(checkpoint.Dir(), "summary.json")
+	if err := os.WriteFile(summaryFile, []byte(o), 0600); err != nil {
+		return fmt.Errorf("collection cancelled and unable to write the partial summary %v: %w", summaryFile, err)
+	}
+	return fmt.Errorf("collection cancelled with %v of %v hosts collected, partial summary written to %v, run again with --resume to collect the remaining hosts",
+		len(collectionInfo.CollectedFiles), collectionInfo.ClusterInfo.TotalNodesAttempted, summaryFile)
+}
+
+// openCheckpoint loads the checkpoint of an earlier run when resuming, otherwise a new one is started
+func openCheckpoint(collectionArgs Args, start time.Time) (*Checkpoint, error) {
+	dir := CheckpointDir(collectionArgs.OutputLoc)
+	if collectionArgs.Resume {
+		checkpoint, err := LoadCheckpoint(dir)
+		if err == nil {
+			if checkpoint.CoordinatorStr != collectionArgs.CoordinatorStr || checkpoint.ExecutorsStr != collectionArgs.ExecutorsStr {
+				simplelog.Warningf("resuming checkpoint %v created for coordinators '%v' and executors '%v' with coordinators '%v' and executors '%v'",
+					dir, checkpoint.CoordinatorStr, checkpoint.ExecutorsStr, collectionArgs.CoordinatorStr, collectionArgs.ExecutorsStr)
+			}
+			simplelog.Infof("resuming collection from checkpoint %v, previously failed hosts: %v", dir, strings.Join(checkpoint.FailedHosts(), ", "))
+			return checkpoint, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("unable to resume from checkpoint %v: %w", dir, err)
+		}
+		simplelog.Warningf("no checkpoint found in %v, starting a new collection", dir)
+	}
+	return NewCheckpoint(dir, collectionArgs.CoordinatorStr, collectionArgs.ExecutorsStr, start, collectionArgs.DiscardCheckpoint)
+}
+
 func FindClusterID(outputDir string) (clusterStatsList []clusterstats.ClusterStats, err error) {
 	err = filepath.Walk(outputDir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
@@ -321,71 +611,38 @@ func FindClusterID(outputDir string) (clusterStatsList []clusterstats.ClusterSta
 	return
 }
 
-// Sanitize archive file pathing from "G305: Zip Slip vulnerability"
-func SanitizeArchivePath(d, t string) (v string, err error) {
-	v = filepath.Join(d, t)
-	if strings.HasPrefix(v, filepath.Clean(d)) {
-		return v, nil
-	}
-	return "", fmt.Errorf("%s: %s", "content filepath is tainted", t)
-}
-
-func ExtractTarGz(gzFilePath, dest string) error {
-	reader, err := os.Open(path.Clean(gzFilePath))
-	if err != nil {
-		return err
-	}
-	defer reader.Close()
-
-	gzReader, err := gzip.NewReader(reader)
-	if err != nil {
-		return err
-	}
-	defer gzReader.Close()
-
-	tarReader := tar.NewReader(gzReader)
-
-	for {
-		header, err := tarReader.Next()
-		switch {
-		case err == io.EOF:
-			return nil
-		case err != nil:
+// FindTaskResults reads the task-results.json of every node extracted to outputDir
+func FindTaskResults(outputDir string) (nodeResults []taskresults.NodeResults, err error) {
+	err = filepath.Walk(outputDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
 			return err
-		case header == nil:
-			continue
 		}
-		target, err := SanitizeArchivePath(dest, header.Name)
+		if info.Name() != taskresults.FileName {
+			return nil
+		}
+		b, err := os.ReadFile(filepath.Clean(path))
 		if err != nil {
 			return err
 		}
-
-		switch header.Typeflag {
-		case tar.TypeDir:
-			if _, err := os.Stat(target); err != nil {
-				if err := os.MkdirAll(path.Clean(target), 0750); err != nil {
-					return err
-				}
-			}
-		case tar.TypeReg:
-			file, err := os.OpenFile(path.Clean(target), os.O_CREATE|os.O_RDWR, os.FileMode(header.Mode))
-			if err != nil {
-				simplelog.Errorf("skipping file %v due to error %v", file, err)
-				continue
-			}
-			defer file.Close()
-			for {
-				_, err := io.CopyN(file, tarReader, 1024)
-				if err != nil {
-					if err == io.EOF {
-						break
-					}
-					return err
-				}
-			}
-			simplelog.Debugf("extracted file %v", file.Name())
+		var results taskresults.NodeResults
+		if err := json.Unmarshal(b, &results); err != nil {
+			return fmt.Errorf("unable to read %v: %w", path, err)
 		}
-	}
+		nodeResults = append(nodeResults, results)
+		return nil
+	})
+	return
+}
+
+// Sanitize archive file pathing from "G305: Zip Slip vulnerability"
+func SanitizeArchivePath(d, t string) (v string, err error) {
+	return archive.SanitizeArchivePath(d, t)
+}
+
+// ExtractTarGz extracts a node tarball or a ddc archive, despite the name tar.zst, zip and
+// split archives are read as well
+func ExtractTarGz(gzFilePath, dest string) error {
+	return archive.Extract(gzFilePath, dest)
 }
 
 func FindTarGzFiles(rootDir string) ([]string, error) {
@@ -409,3 +666,22 @@ func FindTarGzFiles(rootDir string) ([]string, error) {
 
 	return files, nil
 }
+
+// removeUnencrypted deletes the archives that could not be encrypted, leaving them would defeat --encrypt-to
+func removeUnencrypted(archives []string, err error) error {
+	for _, a := range archives {
+		if rmErr := os.Remove(a); rmErr != nil && !errors.Is(rmErr, os.ErrNotExist) {
+			simplelog.Errorf("unable to remove unencrypted archive %v due to error %v", a, rmErr)
+		}
+	}
+	return err
+}
+
+// nodeNames are the host names the node tarballs were named after
+func nodeNames(tarballs []string) []string {
+	var nodes []string
+	for _, t := range tarballs {
+		nodes = append(nodes, strings.TrimSuffix(strings.TrimSuffix(filepath.Base(t), encrypt.Suffix), ".tar.gz"))
+	}
+	return nodes
+}
@@ -16,10 +16,13 @@
 package collection
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 	"path"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -28,6 +31,7 @@ import (
 	"github.com/dremio/dremio-diagnostic-collector/cmd/root/helpers"
 	"github.com/dremio/dremio-diagnostic-collector/pkg/archive"
 	"github.com/dremio/dremio-diagnostic-collector/pkg/tests"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/upload"
 )
 
 type MockCopyStrategy struct {
@@ -78,8 +82,8 @@ func (s *MockStrategy) GzipAllFiles(_ string) ([]helpers.CollectedFile, error) {
 	return nil, nil
 }
 
-func (s *MockStrategy) ArchiveDiag(_ string, _ string) error {
-	return nil
+func (s *MockStrategy) ArchiveDiag(_ string, _ []string, outputLoc string, _ archive.Options) ([]string, error) {
+	return []string{outputLoc}, nil
 }
 
 func (s *MockStrategy) Cleanup() error {
@@ -233,7 +237,7 @@ func TestFindHostsCoordinators(t *testing.T) {
 	// Test for incorrect host
 	fakeArgs.CoordinatorStr = "dremio-master-99"
 	expected := "ERROR: no hosts found matching dremio-master-99"
-	err := Execute(mockCollector, fakeArgs.CopyStrategy, fakeArgs)
+	err := Execute(context.Background(), mockCollector, fakeArgs.CopyStrategy, fakeArgs)
 	if err.Error() != expected {
 		t.Errorf("\nERROR: finding coordinators: \nexpected:\t%v\nactual:\t\t%v\n", expected, err)
 	}
@@ -262,12 +266,56 @@ func TestFindHostsExecutors(t *testing.T) {
 
 	fakeArgs.ExecutorsStr = "dremio-executor-99"
 	expected := "ERROR: no hosts found matching dremio-executor-99"
-	err := Execute(mockCollector, fakeArgs.CopyStrategy, fakeArgs)
+	err := Execute(context.Background(), mockCollector, fakeArgs.CopyStrategy, fakeArgs)
 	if err.Error() != expected {
 		t.Errorf("\nERROR: finding executors: \nexpected:\t%v\nactual:\t\t%v\n", expected, err)
 	}
 }
 
+func TestExecuteWhenCancelledWritesPartialSummary(t *testing.T) {
+	fakeFS := helpers.NewFakeFileSystem()
+	mockStrategy := NewMockStrategy(fakeFS)
+	outputLoc := filepath.Join(t.TempDir(), "diag.tgz")
+	args := Args{
+		DDCfs:          fakeFS,
+		CoordinatorStr: "coordinator1",
+		ExecutorsStr:   "executor1",
+		OutputLoc:      outputLoc,
+		CopyStrategy:   mockStrategy,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := Execute(ctx, &MockCapCollector{}, mockStrategy, args)
+	if err == nil || !strings.HasPrefix(err.Error(), "collection cancelled with 0 of 2 hosts collected") {
+		t.Fatalf("expected a cancelled error but was %v", err)
+	}
+	if _, err := os.Stat(outputLoc); err == nil {
+		t.Errorf("expected no archive at %v after cancellation", outputLoc)
+	}
+	b, err := os.ReadFile(filepath.Join(CheckpointDir(outputLoc), "summary.json"))
+	if err != nil {
+		t.Fatalf("expected a partial summary: %v", err)
+	}
+	var summary SummaryInfo
+	if err := json.Unmarshal(b, &summary); err != nil {
+		t.Fatal(err)
+	}
+	if !summary.Cancelled {
+		t.Error("expected the summary to be marked as cancelled")
+	}
+	expectedHosts := []string{"coordinator1", "executor1"}
+	if !reflect.DeepEqual(summary.CancelledHosts, expectedHosts) {
+		t.Errorf("expected cancelled hosts %v but was %v", expectedHosts, summary.CancelledHosts)
+	}
+	checkpoint, err := LoadCheckpoint(CheckpointDir(outputLoc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if failed := checkpoint.FailedHosts(); !reflect.DeepEqual(failed, expectedHosts) {
+		t.Errorf("expected %v to be retried on resume but was %v", expectedHosts, failed)
+	}
+}
+
 func TestTgzArchive(t *testing.T) {
 	tmpDir := t.TempDir()
 	testFile := filepath.Join(tmpDir, "test.txt")
@@ -284,3 +332,65 @@ func TestTgzArchive(t *testing.T) {
 	}
 	tests.TgzContainsFile(t, testFile, archiveFile, "test.txt")
 }
+
+type fakeUploadTarget struct {
+	err error
+}
+
+func (f fakeUploadTarget) Destination() string {
+	return "s3://bucket/support/"
+}
+
+func (f fakeUploadTarget) Prefix() string {
+	return "support/"
+}
+
+func (f fakeUploadTarget) Upload(_ context.Context, file, remotePath string, _ *upload.State) (string, error) {
+	if f.err != nil {
+		return "", f.err
+	}
+	return "s3://bucket/" + remotePath, nil
+}
+
+func TestUploadArchiveWritesSummaryNextToArchive(t *testing.T) {
+	outputLoc := filepath.Join(t.TempDir(), "diag.tgz")
+	if err := os.WriteFile(outputLoc, []byte("archive"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	info := SummaryInfo{Coordinators: []string{"coordinator"}}
+	if err := uploadArchive(context.Background(), fakeUploadTarget{}, info, outputLoc, []string{outputLoc}); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(SummaryFile(outputLoc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var summary SummaryInfo
+	if err := json.Unmarshal(b, &summary); err != nil {
+		t.Fatal(err)
+	}
+	if summary.Upload == nil || summary.Upload.Status != upload.StatusUploaded {
+		t.Fatalf("expected the upload to be recorded as uploaded but was %+v", summary.Upload)
+	}
+	if expected := []string{"s3://bucket/support/diag.tgz"}; !reflect.DeepEqual(summary.Upload.URLs, expected) {
+		t.Errorf("expected urls %v but were %v", expected, summary.Upload.URLs)
+	}
+	if !reflect.DeepEqual(summary.Coordinators, []string{"coordinator"}) {
+		t.Errorf("expected the rest of the summary to be kept but was %+v", summary)
+	}
+
+	err = uploadArchive(context.Background(), fakeUploadTarget{err: fmt.Errorf("connection refused")}, info, outputLoc, []string{outputLoc})
+	if err == nil || !strings.Contains(err.Error(), "ddc upload "+outputLoc) {
+		t.Errorf("expected the error to explain how to resume the upload but was %v", err)
+	}
+	b, err = os.ReadFile(SummaryFile(outputLoc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(b, &summary); err != nil {
+		t.Fatal(err)
+	}
+	if summary.Upload.Status != upload.StatusFailed || summary.Upload.Error == "" {
+		t.Errorf("expected the failed upload to be recorded but was %+v", summary.Upload)
+	}
+}
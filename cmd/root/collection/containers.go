@@ -0,0 +1,88 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// collection module deals with specific docker and podman container level data collection
+package collection
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+
+	"github.com/dremio/dremio-diagnostic-collector/cmd/root/helpers"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/consoleprint"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/masking"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/simplelog"
+)
+
+// ContainerClusterCollector reads the inspect output and logs of docker or podman containers
+type ContainerClusterCollector interface {
+	InspectContainer(container string) ([]byte, error)
+	GetContainerLogs(container string) (string, error)
+}
+
+// ContainerClusterExecute writes the inspect output and logs of every container, the container
+// equivalent of ClusterK8sExecute and GetClusterLogs
+func ContainerClusterExecute(cs CopyStrategy, ddfs helpers.Filesystem, c ContainerClusterCollector, containers []string) error {
+	inspectPath, err := cs.CreatePath("docker", "container-inspect", "")
+	if err != nil {
+		simplelog.Errorf("trying to construct container inspect path %v with error %v", inspectPath, err)
+		return err
+	}
+	logPath, err := cs.CreatePath("docker", "container-logs", "")
+	if err != nil {
+		simplelog.Errorf("trying to construct container log path %v with error %v", logPath, err)
+		return err
+	}
+	var wg sync.WaitGroup
+	for _, container := range containers {
+		wg.Add(1)
+		go func(container string) {
+			defer wg.Done()
+			writeContainerInspect(ddfs, c, container, inspectPath)
+			writeContainerLogs(ddfs, c, container, logPath)
+			consoleprint.UpdateK8sFiles(fmt.Sprintf("container %v inspect and logs", container))
+		}(container)
+	}
+	wg.Wait()
+	return nil
+}
+
+func writeContainerInspect(ddfs helpers.Filesystem, c ContainerClusterCollector, container, path string) {
+	out, err := c.InspectContainer(container)
+	if err != nil {
+		simplelog.Errorf("when inspecting container %v, error was %v", container, err)
+		return
+	}
+	text, err := masking.RemoveSecretsFromDockerInspect(string(out))
+	if err != nil {
+		simplelog.Errorf("unable to mask secrets for container %v so the inspect output is skipped due to error '%v'", container, err)
+		return
+	}
+	outFile := filepath.Join(path, container+".json")
+	if err := ddfs.WriteFile(outFile, []byte(text), DirPerms); err != nil {
+		simplelog.Errorf("trying to write file %v, error was %v", outFile, err)
+	}
+}
+
+func writeContainerLogs(ddfs helpers.Filesystem, c ContainerClusterCollector, container, path string) {
+	out, err := c.GetContainerLogs(container)
+	if err != nil {
+		simplelog.Errorf("trying to get logs of container %v with error %v", container, err)
+	}
+	outFile := filepath.Join(path, container+".txt")
+	if err := ddfs.WriteFile(outFile, []byte(out), DirPerms); err != nil {
+		simplelog.Errorf("trying to write file %v, error was %v", outFile, err)
+	}
+}
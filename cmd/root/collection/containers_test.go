@@ -0,0 +1,77 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// collection package provides the interface for collection implementation and the actual collection execution
+package collection
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dremio/dremio-diagnostic-collector/cmd/root/helpers"
+)
+
+type mockContainerCollector struct{}
+
+func (m *mockContainerCollector) InspectContainer(container string) ([]byte, error) {
+	if container == "missing" {
+		return nil, errors.New("no such container")
+	}
+	return []byte(`[{"Name":"/` + container + `","Config":{"Env":["DREMIO_MAX_MEMORY_SIZE_MB=8192","DREMIO_PASSWORD=abc123"]}}]`), nil
+}
+
+func (m *mockContainerCollector) GetContainerLogs(container string) (string, error) {
+	return "started " + container, nil
+}
+
+func TestContainerClusterExecute(t *testing.T) {
+	ddfs := helpers.NewRealFileSystem()
+	cs, err := helpers.NewHCCopyStrategy(ddfs, &helpers.RealTimeService{})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	defer func() {
+		if err := os.RemoveAll(cs.TmpDir); err != nil {
+			t.Logf("unable to cleanup %v", err)
+		}
+	}()
+	if err := ContainerClusterExecute(cs, ddfs, &mockContainerCollector{}, []string{"dremio-coordinator-1", "missing"}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	inspectDir, _ := cs.CreatePath("docker", "container-inspect", "")
+	inspect, err := os.ReadFile(filepath.Join(inspectDir, "dremio-coordinator-1.json"))
+	if err != nil {
+		t.Fatalf("expected the inspect output to be written: %v", err)
+	}
+	if strings.Contains(string(inspect), "abc123") {
+		t.Errorf("expected the secret to be masked but got %v", string(inspect))
+	}
+	if !strings.Contains(string(inspect), "DREMIO_MAX_MEMORY_SIZE_MB=8192") {
+		t.Errorf("expected the other environment variables to be kept but got %v", string(inspect))
+	}
+	if _, err := os.Stat(filepath.Join(inspectDir, "missing.json")); err == nil {
+		t.Error("expected no inspect output for a container that failed to inspect")
+	}
+	logDir, _ := cs.CreatePath("docker", "container-logs", "")
+	logs, err := os.ReadFile(filepath.Join(logDir, "dremio-coordinator-1.txt"))
+	if err != nil {
+		t.Fatalf("expected the logs to be written: %v", err)
+	}
+	if string(logs) != "started dremio-coordinator-1" {
+		t.Errorf("expected 'started dremio-coordinator-1' but got %v", string(logs))
+	}
+}
@@ -0,0 +1,172 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// collection package provides the interface for collection implementation and the actual collection execution
+package collection
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/dremio/dremio-diagnostic-collector/pkg/consoleprint"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/encrypt"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/simplelog"
+)
+
+// RemoteCleanupTimeout bounds how long we wait on a host that already ran past its timeout
+var RemoteCleanupTimeout = 30 * time.Second
+
+// HostTimeoutErr is returned when a host capture runs past the --host-timeout
+type HostTimeoutErr struct {
+	Host    string
+	Timeout time.Duration
+}
+
+func (e HostTimeoutErr) Error() string {
+	return fmt.Sprintf("host %v did not finish the capture within %v", e.Host, e.Timeout)
+}
+
+// HostCancelledErr is returned for a host whose capture was interrupted because the collection was cancelled
+type HostCancelledErr struct {
+	Host string
+	Err  error
+}
+
+func (e HostCancelledErr) Error() string {
+	return fmt.Sprintf("host %v capture was cancelled: %v", e.Host, e.Err)
+}
+
+func (e HostCancelledErr) Unwrap() error {
+	return e.Err
+}
+
+// captureWithTimeout runs the capture and gives up on it once the timeout passes or the context is cancelled,
+// a timeout of 0 waits forever. The capture cannot be interrupted directly, so ddc is stopped on the host,
+// which makes the capture fail, and the host is cleaned up once the capture returned. Its result is discarded.
+func captureWithTimeout(ctx context.Context, conf HostCaptureConfiguration, timeout time.Duration, capture func() (int64, string, error)) (int64, string, error) {
+	if timeout <= 0 && ctx.Done() == nil {
+		return capture()
+	}
+	type result struct {
+		size int64
+		file string
+		err  error
+	}
+	// buffered so the capture can always finish even though nobody is reading anymore
+	done := make(chan result, 1)
+	returned := make(chan struct{})
+	go func() {
+		defer close(returned)
+		size, file, err := capture()
+		done <- result{size: size, file: file, err: err}
+	}()
+	// a nil channel never fires so without a timeout only the context can interrupt the capture
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	select {
+	case r := <-done:
+		// a Ctrl-C also reaches the ssh or kubectl processes so the capture usually fails just before we notice
+		if r.err == nil || ctx.Err() == nil {
+			return r.size, r.file, r.err
+		}
+	case <-ctx.Done():
+	case <-expired:
+		consoleprint.UpdateNodeState(conf.Host, "FAILED - TIMEOUT")
+		timeoutErr := HostTimeoutErr{Host: conf.Host, Timeout: timeout}
+		simplelog.Errorf("%v, stopping ddc on the host and cleaning up", timeoutErr)
+		cleanupRemote(conf, RemoteCleanupTimeout, returned)
+		return 0, "", timeoutErr
+	}
+	consoleprint.UpdateNodeState(conf.Host, "FAILED - CANCELLED")
+	cancelErr := HostCancelledErr{Host: conf.Host, Err: ctx.Err()}
+	simplelog.Warningf("%v, stopping ddc on the host and cleaning up", cancelErr)
+	cleanupRemote(conf, RemoteCleanupTimeout, returned)
+	return 0, "", cancelErr
+}
+
+// cleanupRemote kills any local-collect still running from the transfer dir and removes the files we copied there
+// along with the tarball it may have been writing. pkill sends SIGTERM so local-collect can stop JFR and ttop first.
+// The files are only removed once captureDone is closed, or after waiting for it, so the capture is not still
+// copying to or from the transfer dir while they are removed. Each step waits at most wait on the host.
+func cleanupRemote(conf HostCaptureConfiguration, wait time.Duration, captureDone <-chan struct{}) {
+	// we cannot use filepath.join here as it will break everything during the transfer
+	pathToDDC := path.Join(conf.TransferDir, "ddc")
+	pathToDDCYAML := path.Join(conf.TransferDir, "ddc.yaml")
+	stopped := withinTimeout(wait, func() {
+		if out, err := ComposeExecute(false, conf, []string{"pkill", "-f", pathToDDC}); err != nil {
+			simplelog.Warningf("on host %v unable to stop ddc due to error '%v' with output '%v'", conf.Host, err, out)
+		}
+	})
+	if !stopped {
+		simplelog.Warningf("host %v did not respond to cleanup within %v, files in %v may need to be removed manually", conf.Host, wait, conf.TransferDir)
+		return
+	}
+	if captureDone != nil {
+		select {
+		case <-captureDone:
+		case <-time.After(wait):
+			simplelog.Warningf("host %v capture did not stop within %v of stopping ddc, removing the files in %v anyway", conf.Host, wait, conf.TransferDir)
+		}
+	}
+	removed := withinTimeout(wait, func() {
+		rm := []string{"rm", "-f", pathToDDCYAML, pathToDDC + ".log"}
+		if conf.RecipientsFile != "" {
+			rm = append(rm, path.Join(conf.TransferDir, "ddc-recipients.txt"))
+		}
+		if !conf.KeepDDCInstalled {
+			rm = append(rm, pathToDDC)
+		}
+		// local-collect names the tarball after the hostname, see Capture
+		if hostname, err := ComposeExecute(false, conf, []string{"cat", "/proc/sys/kernel/hostname"}); err != nil {
+			simplelog.Warningf("on host %v unable to find the hostname so a partial tarball may be left in %v: '%v'", conf.Host, conf.TransferDir, err)
+		} else if hostname = strings.TrimSpace(hostname); hostname != "" {
+			tarball := path.Join(conf.TransferDir, hostname+".tar.gz")
+			rm = append(rm, tarball)
+			if conf.RecipientsFile != "" {
+				// local-collect may have been stopped while it was encrypting
+				rm = append(rm, tarball+encrypt.Suffix)
+			}
+		}
+		if out, err := ComposeExecute(false, conf, rm); err != nil {
+			simplelog.Warningf("on host %v unable to remove ddc files due to error '%v' with output '%v'", conf.Host, err, out)
+		}
+	})
+	if !removed {
+		simplelog.Warningf("host %v did not respond to cleanup within %v, files in %v may need to be removed manually", conf.Host, wait, conf.TransferDir)
+		return
+	}
+	simplelog.Infof("host %v cleaned up", conf.Host)
+}
+
+// withinTimeout runs fn in the background and reports whether it returned within the timeout
+func withinTimeout(timeout time.Duration, fn func()) bool {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fn()
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
@@ -0,0 +1,165 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// collection package provides the interface for collection implementation and the actual collection execution
+package collection
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordingCollector struct {
+	MockCapCollector
+	mu       sync.Mutex
+	commands []string
+	// stopped is closed by pkill the way stopping ddc makes a running capture fail
+	stopped  chan struct{}
+	stopOnce sync.Once
+}
+
+func newRecordingCollector() *recordingCollector {
+	return &recordingCollector{stopped: make(chan struct{})}
+}
+
+func (r *recordingCollector) record(command string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.commands = append(r.commands, command)
+}
+
+func (r *recordingCollector) HostExecute(_ bool, _ string, _ bool, args ...string) (string, error) {
+	command := strings.Join(args, " ")
+	r.record(command)
+	if strings.Contains(command, "pkill ") && r.stopped != nil {
+		r.stopOnce.Do(func() { close(r.stopped) })
+	}
+	if strings.HasSuffix(args[len(args)-1], "/proc/sys/kernel/hostname") {
+		return "node1\n", nil
+	}
+	return "", nil
+}
+
+func TestCaptureWithTimeoutReturnsResult(t *testing.T) {
+	conf := HostCaptureConfiguration{Host: "fast-host", Collector: &recordingCollector{}}
+	size, f, err := captureWithTimeout(context.Background(), conf, time.Minute, func() (int64, string, error) {
+		return 10, "fast-host.tar.gz", nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if size != 10 || f != "fast-host.tar.gz" {
+		t.Errorf("unexpected result %v %v", size, f)
+	}
+
+	expectedErr := errors.New("TARBALL TRANSFER")
+	if _, _, err := captureWithTimeout(context.Background(), conf, 0, func() (int64, string, error) {
+		return 0, "", expectedErr
+	}); err != expectedErr {
+		t.Errorf("expected %v but was %v", expectedErr, err)
+	}
+}
+
+func TestCaptureWithTimeoutCleansUpHungHost(t *testing.T) {
+	collector := newRecordingCollector()
+	conf := HostCaptureConfiguration{
+		Host:        "hung-host",
+		Collector:   collector,
+		TransferDir: "/tmp/ddc",
+		SudoUser:    "dremio",
+	}
+	start := time.Now()
+	_, _, err := captureWithTimeout(context.Background(), conf, 50*time.Millisecond, func() (int64, string, error) {
+		<-collector.stopped
+		// the capture still touches the transfer dir on its way out, the files must not be removed before it returned
+		time.Sleep(50 * time.Millisecond)
+		collector.record("capture returned")
+		return 0, "", errors.New("ddc was stopped")
+	})
+	var timeoutErr HostTimeoutErr
+	if !errors.As(err, &timeoutErr) {
+		t.Fatalf("expected a timeout error but was %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected to return shortly after the timeout but took %v", elapsed)
+	}
+	expected := []string{
+		"sudo -u dremio pkill -f /tmp/ddc/ddc",
+		"capture returned",
+		"sudo -u dremio cat /proc/sys/kernel/hostname",
+		"sudo -u dremio rm -f /tmp/ddc/ddc.yaml /tmp/ddc/ddc.log /tmp/ddc/ddc /tmp/ddc/node1.tar.gz",
+	}
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+	if strings.Join(collector.commands, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected cleanup commands\n%v\nbut was\n%v", strings.Join(expected, "\n"), strings.Join(collector.commands, "\n"))
+	}
+}
+
+func TestCaptureWithTimeoutCleansUpWhenCancelled(t *testing.T) {
+	collector := newRecordingCollector()
+	conf := HostCaptureConfiguration{
+		Host:             "busy-host",
+		Collector:        collector,
+		TransferDir:      "/tmp/ddc",
+		KeepDDCInstalled: true,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	// no timeout so only the cancellation can stop the capture
+	_, _, err := captureWithTimeout(ctx, conf, 0, func() (int64, string, error) {
+		<-collector.stopped
+		collector.record("capture returned")
+		return 0, "", errors.New("ddc was stopped")
+	})
+	var cancelErr HostCancelledErr
+	if !errors.As(err, &cancelErr) {
+		t.Fatalf("expected a cancelled error but was %v", err)
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the error to wrap %v", context.Canceled)
+	}
+	expected := []string{
+		"pkill -f /tmp/ddc/ddc",
+		"capture returned",
+		"cat /proc/sys/kernel/hostname",
+		"rm -f /tmp/ddc/ddc.yaml /tmp/ddc/ddc.log /tmp/ddc/node1.tar.gz",
+	}
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+	if strings.Join(collector.commands, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected cleanup commands\n%v\nbut was\n%v", strings.Join(expected, "\n"), strings.Join(collector.commands, "\n"))
+	}
+}
+
+type hangingCollector struct {
+	MockCapCollector
+}
+
+func (h *hangingCollector) HostExecute(_ bool, _ string, _ bool, _ ...string) (string, error) {
+	select {}
+}
+
+func TestCleanupRemoteDoesNotWaitForever(t *testing.T) {
+	conf := HostCaptureConfiguration{Host: "dead-host", Collector: &hangingCollector{}, TransferDir: "/tmp/ddc"}
+	start := time.Now()
+	cleanupRemote(conf, 50*time.Millisecond, nil)
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected cleanup to give up but took %v", elapsed)
+	}
+}
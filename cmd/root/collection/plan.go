@@ -0,0 +1,210 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// collection package provides the interface for collection implementation and the actual collection execution
+package collection
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/dremio/dremio-diagnostic-collector/pkg/collectplan"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/consoleprint"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/simplelog"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/strutils"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/versions"
+)
+
+// PlanFile is the file next to the output file that ddc --dry-run writes the cluster plan to
+func PlanFile(outputLoc string) string {
+	base := filepath.Base(outputLoc)
+	base = strings.TrimSuffix(base, filepath.Ext(base))
+	return filepath.Join(filepath.Dir(outputLoc), base+"-plan.json")
+}
+
+// writeHostPlan reads the plan printed by local-collect --dry-run and stores it where the tarball would have gone
+func writeHostPlan(conf HostCaptureConfiguration, outputLoc string, output []string) (int64, string, error) {
+	host := conf.Host
+	plan, err := collectplan.ParseNodePlan(strings.Join(output, "\n"))
+	if err != nil {
+		consoleprint.UpdateNodeState(host, "FAILED - DRY RUN - "+strutils.LimitString(err.Error(), 350))
+		return 0, "", fmt.Errorf("on host %v %w", host, err)
+	}
+	b, err := json.Marshal(plan)
+	if err != nil {
+		return 0, "", fmt.Errorf("on host %v unable to marshal plan: %w", host, err)
+	}
+	outDir := path.Dir(outputLoc)
+	if outDir == "" {
+		outDir = fmt.Sprintf(".%v", filepath.Separator)
+	}
+	destFile := filepath.Join(outDir, plan.NodeName+"-plan.json")
+	if err := conf.DDCfs.WriteFile(destFile, b, 0600); err != nil {
+		return 0, "", fmt.Errorf("on host %v unable to write plan %v: %w", host, destFile, err)
+	}
+	consoleprint.UpdateNodeState(host, "COMPLETED - DRY RUN")
+	return int64(len(b)), destFile, nil
+}
+
+// executeDryRun runs local-collect --dry-run on every host and writes the plans to PlanFile, nothing is
+// collected and neither the checkpoint nor the cluster level collection are touched
+func executeDryRun(ctx context.Context, c Collector, s CopyStrategy, collectionArgs Args, binaries *ddcBinaries, coordinators, executors []string) error {
+	ddcfs := collectionArgs.DDCfs
+	defer func() {
+		// the plans are staged where the tarballs would be archived from
+		if err := ddcfs.RemoveAll(path.Dir(s.GetTmpDir())); err != nil {
+			simplelog.Warningf("unable to remove %v due to error %v. It will need to be removed manually", path.Dir(s.GetTmpDir()), err)
+		}
+	}()
+	consoleprint.UpdateRuntime(
+		versions.GetCLIVersion(),
+		simplelog.GetLogLoc(),
+		collectionArgs.DDCYamlLoc,
+		c.Name(),
+		collectionArgs.Enabled,
+		collectionArgs.Disabled,
+		collectionArgs.PATSet,
+		0,
+		len(coordinators)+len(executors),
+	)
+	var hostSlots chan struct{}
+	if collectionArgs.MaxConcurrentHosts > 0 {
+		hostSlots = make(chan struct{}, collectionArgs.MaxConcurrentHosts)
+	}
+	var m sync.Mutex
+	var wg sync.WaitGroup
+	var hostPlans []collectplan.HostPlan
+	planHost := func(host string, isCoordinator bool) {
+		defer wg.Done()
+		hostPlan := collectplan.HostPlan{Host: host, IsCoordinator: isCoordinator}
+		defer func() {
+			m.Lock()
+			hostPlans = append(hostPlans, hostPlan)
+			m.Unlock()
+		}()
+		if hostSlots != nil {
+			consoleprint.UpdateNodeState(host, "QUEUED")
+			select {
+			case hostSlots <- struct{}{}:
+				defer func() { <-hostSlots }()
+			case <-ctx.Done():
+			}
+		}
+		if ctx.Err() != nil {
+			consoleprint.UpdateNodeState(host, "FAILED - CANCELLED")
+			hostPlan.Error = HostCancelledErr{Host: host, Err: ctx.Err()}.Error()
+			return
+		}
+		conf := HostCaptureConfiguration{
+			Collector:        c,
+			IsCoordinator:    isCoordinator,
+			Host:             host,
+			OutputLocation:   s.GetTmpDir(),
+			SudoUser:         collectionArgs.sudoUserFor(host),
+			CopyStrategy:     s,
+			DDCfs:            ddcfs,
+			TransferDir:      collectionArgs.TransferDir,
+			KeepDDCInstalled: collectionArgs.KeepDDCInstalled,
+			DryRun:           true,
+			CollectionMode:   collectionArgs.CollectionMode,
+		}
+		if isCoordinator {
+			conf.DremioPAT = collectionArgs.DremioPAT
+		}
+		_, f, err := captureWithTimeout(ctx, conf, collectionArgs.HostTimeout, func() (int64, string, error) {
+			ddcLoc, ddcSha256, err := binaries.forHost(conf)
+			if err != nil {
+				consoleprint.UpdateNodeState(host, platformFailureStatus(err))
+				return 0, "", err
+			}
+			hostConf := conf
+			hostConf.DDCSha256 = ddcSha256
+			// executors never make REST calls, same as a real collection
+			return Capture(ctx, hostConf, ddcLoc, collectionArgs.DDCYamlLoc, s.GetTmpDir(), !isCoordinator)
+		})
+		if err != nil {
+			simplelog.Errorf("dry run failed on host %v: %v", host, err)
+			hostPlan.Error = err.Error()
+			return
+		}
+		b, err := os.ReadFile(filepath.Clean(f))
+		if err != nil {
+			hostPlan.Error = fmt.Sprintf("unable to read plan %v: %v", f, err)
+			return
+		}
+		var nodePlan collectplan.NodePlan
+		if err := json.Unmarshal(b, &nodePlan); err != nil {
+			hostPlan.Error = fmt.Sprintf("unable to read plan %v: %v", f, err)
+			return
+		}
+		hostPlan.Plan = &nodePlan
+	}
+	for _, coordinator := range coordinators {
+		wg.Add(1)
+		go planHost(coordinator, true)
+	}
+	for _, executor := range executors {
+		wg.Add(1)
+		go planHost(executor, false)
+	}
+	wg.Wait()
+
+	clusterPlan := collectplan.ClusterPlan{
+		DDCVersion:   strings.TrimSpace(versions.GetCLIVersion()),
+		Collector:    c.Name(),
+		Coordinators: coordinators,
+		Executors:    executors,
+		FailedHosts:  []string{},
+	}
+	sort.Slice(hostPlans, func(i, j int) bool {
+		if hostPlans[i].IsCoordinator != hostPlans[j].IsCoordinator {
+			return hostPlans[i].IsCoordinator
+		}
+		return hostPlans[i].Host < hostPlans[j].Host
+	})
+	clusterPlan.Hosts = hostPlans
+	var durations []int
+	for _, h := range hostPlans {
+		if h.Plan == nil {
+			clusterPlan.FailedHosts = append(clusterPlan.FailedHosts, h.Host)
+			continue
+		}
+		durations = append(durations, h.Plan.EstimatedDurationSeconds)
+		clusterPlan.EstimatedBytes += h.Plan.EstimatedBytes
+	}
+	clusterPlan.EstimatedDurationSeconds = collectplan.EstimateDuration(durations, collectionArgs.MaxConcurrentHosts)
+	b, err := json.MarshalIndent(clusterPlan, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to marshal plan: %w", err)
+	}
+	planFile := PlanFile(collectionArgs.OutputLoc)
+	if err := ddcfs.WriteFile(planFile, b, 0600); err != nil {
+		return fmt.Errorf("unable to write plan %v: %w", planFile, err)
+	}
+	simplelog.Infof("dry run plan for %v hosts written to %v", len(hostPlans), planFile)
+	if ctx.Err() != nil {
+		return fmt.Errorf("dry run cancelled, partial plan written to %v", planFile)
+	}
+	if len(clusterPlan.FailedHosts) > 0 {
+		return fmt.Errorf("dry run failed on hosts %v, plan written to %v", strings.Join(clusterPlan.FailedHosts, ", "), planFile)
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// collection package provides the interface for collection implementation and the actual collection execution
+package collection
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dremio/dremio-diagnostic-collector/cmd/root/cli"
+	"github.com/dremio/dremio-diagnostic-collector/cmd/root/helpers"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/collectplan"
+)
+
+type planCollector struct {
+	MockCapCollector
+	streamed []string
+	executed []string
+}
+
+func (p *planCollector) HostExecuteAndStream(_ bool, _ string, output cli.OutputHandler, _ bool, args ...string) error {
+	p.streamed = append(p.streamed, strings.Join(args, " "))
+	b, err := json.MarshalIndent(collectplan.NodePlan{NodeName: "node1", EstimatedBytes: 100}, "", "  ")
+	if err != nil {
+		return err
+	}
+	output("0.9.0")
+	for _, line := range strings.Split(string(b), "\n") {
+		output(line)
+	}
+	return nil
+}
+
+func (p *planCollector) CopyToHost(_ string, _ bool, _, _ string) (string, error) {
+	return "", nil
+}
+
+func (p *planCollector) HostExecute(_ bool, _ string, _ bool, args ...string) (string, error) {
+	p.executed = append(p.executed, strings.Join(args, " "))
+	return "", nil
+}
+
+func TestCaptureDryRunBringsBackThePlan(t *testing.T) {
+	outDir := t.TempDir()
+	collector := &planCollector{}
+	conf := HostCaptureConfiguration{
+		Collector:   collector,
+		Host:        "10.0.0.1",
+		DDCfs:       helpers.NewRealFileSystem(),
+		TransferDir: "/tmp/ddc",
+		DryRun:      true,
+	}
+	size, f, err := Capture(context.Background(), conf, "ddc", "ddc.yaml", filepath.Join(outDir, "staging"), false)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	expected := "/tmp/ddc/ddc local-collect --tarball-out-dir /tmp/ddc --dry-run"
+	if len(collector.streamed) != 1 || collector.streamed[0] != expected {
+		t.Errorf("expected local-collect to be called with %v but was %v", expected, collector.streamed)
+	}
+	if f != filepath.Join(outDir, "node1-plan.json") {
+		t.Errorf("unexpected plan file %v", f)
+	}
+	b, err := os.ReadFile(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != int64(len(b)) {
+		t.Errorf("expected size %v but was %v", len(b), size)
+	}
+	var plan collectplan.NodePlan
+	if err := json.Unmarshal(b, &plan); err != nil {
+		t.Fatal(err)
+	}
+	if plan.NodeName != "node1" || plan.EstimatedBytes != 100 {
+		t.Errorf("unexpected plan %#v", plan)
+	}
+	// there is no tarball so the hostname is never looked up
+	for _, cmd := range collector.executed {
+		if strings.Contains(cmd, "/proc/sys/kernel/hostname") {
+			t.Errorf("did not expect the tarball to be transferred but ran %v", cmd)
+		}
+	}
+}
+
+func TestWriteHostPlanWithoutPlan(t *testing.T) {
+	conf := HostCaptureConfiguration{Host: "10.0.0.1", DDCfs: helpers.NewRealFileSystem()}
+	if _, _, err := writeHostPlan(conf, filepath.Join(t.TempDir(), "staging"), []string{"0.9.0", "unable to read configuration"}); err == nil {
+		t.Error("expected an error when the output has no plan")
+	}
+}
+
+func TestExecuteDryRunWhenCancelledWritesPlan(t *testing.T) {
+	ddcfs := helpers.NewRealFileSystem()
+	mockStrategy := NewMockStrategy(ddcfs)
+	outputLoc := filepath.Join(t.TempDir(), "diag.tgz")
+	args := Args{
+		DDCfs:          ddcfs,
+		CoordinatorStr: "coordinator1",
+		ExecutorsStr:   "executor1",
+		OutputLoc:      outputLoc,
+		CopyStrategy:   mockStrategy,
+		DryRun:         true,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := Execute(ctx, &MockCapCollector{}, mockStrategy, args)
+	if err == nil || !strings.HasPrefix(err.Error(), "dry run cancelled") {
+		t.Fatalf("expected a cancelled error but was %v", err)
+	}
+	b, err := os.ReadFile(PlanFile(outputLoc))
+	if err != nil {
+		t.Fatalf("expected a plan: %v", err)
+	}
+	var plan collectplan.ClusterPlan
+	if err := json.Unmarshal(b, &plan); err != nil {
+		t.Fatal(err)
+	}
+	expectedHosts := []string{"coordinator1", "executor1"}
+	if !reflect.DeepEqual(plan.FailedHosts, expectedHosts) {
+		t.Errorf("expected failed hosts %v but was %v", expectedHosts, plan.FailedHosts)
+	}
+	if _, err := os.Stat(CheckpointDir(outputLoc)); !os.IsNotExist(err) {
+		t.Errorf("expected no checkpoint for a dry run but stat returned %v", err)
+	}
+	if _, err := os.Stat(mockStrategy.TmpDir); !os.IsNotExist(err) {
+		t.Errorf("expected the staging dir %v to be removed but stat returned %v", mockStrategy.TmpDir, err)
+	}
+}
+
+func TestPlanFile(t *testing.T) {
+	if actual := PlanFile(filepath.Join("out", "diag.tgz")); actual != filepath.Join("out", "diag-plan.json") {
+		t.Errorf("unexpected plan file %v", actual)
+	}
+}
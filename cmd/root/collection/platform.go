@@ -0,0 +1,104 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// collection package provides the interface for collection implementation and the actual collection execution
+package collection
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/dremio/dremio-diagnostic-collector/cmd/root/ddcbinary"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/simplelog"
+)
+
+// ddcBuild is an embedded ddc build written out to local disk
+type ddcBuild struct {
+	path   string
+	sha256 string
+	err    error
+}
+
+// ddcBinaries writes out the embedded ddc build for each platform found on the hosts,
+// each platform is only written out once no matter how many hosts share it
+type ddcBinaries struct {
+	dir    string
+	mu     sync.Mutex
+	builds map[ddcbinary.Platform]ddcBuild
+}
+
+func newDDCBinaries(dir string) *ddcBinaries {
+	return &ddcBinaries{
+		dir:    dir,
+		builds: make(map[ddcbinary.Platform]ddcBuild),
+	}
+}
+
+// forHost detects the operating system and architecture of the host and returns the path and hash of the matching ddc build
+func (d *ddcBinaries) forHost(conf HostCaptureConfiguration) (string, string, error) {
+	out, err := ComposeExecute(false, conf, []string{"uname", "-s", "-m"})
+	if err != nil {
+		return "", "", fmt.Errorf("unable to detect the platform of host %v due to error '%w' with output '%v'", conf.Host, err, out)
+	}
+	p, err := ddcbinary.PlatformFromUname(out)
+	if err != nil {
+		return "", "", fmt.Errorf("host %v: %w", conf.Host, err)
+	}
+	simplelog.Infof("host %v is %v", conf.Host, p)
+	b := d.get(p)
+	if b.err != nil {
+		return "", "", fmt.Errorf("host %v: %w", conf.Host, b.err)
+	}
+	return b.path, b.sha256, nil
+}
+
+func (d *ddcBinaries) get(p ddcbinary.Platform) ddcBuild {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if b, ok := d.builds[p]; ok {
+		return b
+	}
+	b := d.writeOut(p)
+	d.builds[p] = b
+	return b
+}
+
+func (d *ddcBinaries) writeOut(p ddcbinary.Platform) ddcBuild {
+	dir := filepath.Join(d.dir, p.OS+"-"+p.Arch)
+	if err := os.MkdirAll(dir, DirPerms); err != nil {
+		return ddcBuild{err: fmt.Errorf("unable to create %v: %w", dir, err)}
+	}
+	ddcLoc, err := ddcbinary.WriteOutDDCForPlatform(dir, p)
+	if err != nil {
+		return ddcBuild{err: err}
+	}
+	ddcSha256, err := ddcbinary.SHA256File(ddcLoc)
+	if err != nil {
+		// not critical, we just always upload
+		simplelog.Warningf("unable to hash %v, ddc will be copied to every %v host: %v", ddcLoc, p, err)
+	}
+	return ddcBuild{path: ddcLoc, sha256: ddcSha256}
+}
+
+// platformFailureStatus is the node state shown when no ddc build could be picked for the host
+func platformFailureStatus(err error) string {
+	var unsupported ddcbinary.UnsupportedPlatformErr
+	if errors.As(err, &unsupported) {
+		return "FAILED - UNSUPPORTED PLATFORM " + unsupported.Platform.String()
+	}
+	return "FAILED - PLATFORM DETECTION"
+}
@@ -0,0 +1,80 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// collection package provides the interface for collection implementation and the actual collection execution
+package collection
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// unameCollector answers every command with a fixed uname output
+type unameCollector struct {
+	MockCapCollector
+	out string
+	err error
+}
+
+func (u *unameCollector) HostExecute(_ bool, _ string, _ bool, _ ...string) (string, error) {
+	return u.out, u.err
+}
+
+func TestDDCBinariesForHost(t *testing.T) {
+	tmpDir := t.TempDir()
+	binaries := newDDCBinaries(tmpDir)
+	collector := &unameCollector{out: "Linux x86_64\n"}
+	conf := HostCaptureConfiguration{Host: "node1", Collector: collector}
+	ddcLoc, sha, err := binaries.forHost(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ddcLoc != filepath.Join(tmpDir, "linux-amd64", "ddc") {
+		t.Errorf("unexpected ddc location %v", ddcLoc)
+	}
+	if _, err := os.Stat(ddcLoc); err != nil {
+		t.Errorf("expected ddc to be written out: %v", err)
+	}
+	if sha == "" {
+		t.Error("expected the ddc build to be hashed")
+	}
+	// a second host of the same platform reuses the build
+	conf.Host = "node2"
+	if again, _, err := binaries.forHost(conf); err != nil || again != ddcLoc {
+		t.Errorf("expected %v to be reused but was %v %v", ddcLoc, again, err)
+	}
+}
+
+func TestDDCBinariesForUnsupportedHost(t *testing.T) {
+	binaries := newDDCBinaries(t.TempDir())
+	conf := HostCaptureConfiguration{Host: "pi", Collector: &unameCollector{out: "Linux armv7l"}}
+	_, _, err := binaries.forHost(conf)
+	if err == nil {
+		t.Fatal("expected an error for a platform that is not bundled")
+	}
+	if status := platformFailureStatus(err); status != "FAILED - UNSUPPORTED PLATFORM linux/armv7l" {
+		t.Errorf("unexpected status %v", status)
+	}
+
+	conf.Collector = &unameCollector{err: errors.New("connection refused")}
+	_, _, err = binaries.forHost(conf)
+	if err == nil {
+		t.Fatal("expected an error when uname fails")
+	}
+	if status := platformFailureStatus(err); status != "FAILED - PLATFORM DETECTION" {
+		t.Errorf("unexpected status %v", status)
+	}
+}
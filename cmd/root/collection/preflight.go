@@ -0,0 +1,239 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// collection package provides the interface for collection implementation and the actual collection execution
+package collection
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dremio/dremio-diagnostic-collector/pkg/consoleprint"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/simplelog"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/strutils"
+)
+
+const (
+	PreflightAuto     = "auto"
+	PreflightPrompt   = "prompt"
+	PreflightAbort    = "abort"
+	PreflightContinue = "continue"
+)
+
+// ResolvePreflightOnFailure turns auto into prompt when stdin is a terminal and into continue otherwise,
+// so unattended runs from cron, CI or ddc schedule still collect when a check fails on one host
+func ResolvePreflightOnFailure(mode string, stdinIsTerminal bool) string {
+	if mode != PreflightAuto {
+		return mode
+	}
+	if stdinIsTerminal {
+		return PreflightPrompt
+	}
+	return PreflightContinue
+}
+
+// PreflightTimeout bounds how long the checks of a single host may take
+var PreflightTimeout = 2 * time.Minute
+
+// PreflightCheck is the outcome of one check on one host
+type PreflightCheck struct {
+	Name   string
+	Passed bool
+	Detail string
+}
+
+// PreflightResult holds every check run on a host
+type PreflightResult struct {
+	Host   string
+	Checks []PreflightCheck
+}
+
+// Failed returns the checks that did not pass
+func (p PreflightResult) Failed() []PreflightCheck {
+	var failed []PreflightCheck
+	for _, check := range p.Checks {
+		if !check.Passed {
+			failed = append(failed, check)
+		}
+	}
+	return failed
+}
+
+// PreflightFailedErr is returned when the collection is stopped because of failed preflight checks
+type PreflightFailedErr struct {
+	Hosts []string
+}
+
+func (e PreflightFailedErr) Error() string {
+	return fmt.Sprintf("preflight checks failed on hosts %v, see the log for details or use --preflight-on-failure continue to collect anyway", strings.Join(e.Hosts, ", "))
+}
+
+// preflightHost checks that the host can run a collection. All checks are run even when one fails so the
+// matrix shows everything that has to be fixed at once.
+func preflightHost(conf HostCaptureConfiguration, dirs []string, minFreeBytes int64) PreflightResult {
+	result := PreflightResult{Host: conf.Host}
+	add := func(name string, err error) {
+		check := PreflightCheck{Name: name, Passed: err == nil}
+		if err != nil {
+			check.Detail = err.Error()
+		}
+		result.Checks = append(result.Checks, check)
+		consoleprint.UpdatePreflight(conf.Host, name, check.Passed)
+	}
+	if conf.SudoUser != "" {
+		// -n makes sudo fail instead of waiting on a password prompt
+		_, err := ComposeExecuteNoSudo(false, conf, []string{"sudo", "-n", "-u", conf.SudoUser, "true"})
+		add("sudo", err)
+	}
+	add("transfer-dir", checkFreeSpace(conf, minFreeBytes))
+	for _, tool := range [][]string{{"jcmd", "-l"}, {"jps", "-q"}, {"java", "-version"}} {
+		_, err := ComposeExecute(false, conf, tool)
+		add(tool[0], err)
+	}
+	for _, dir := range dirs {
+		_, err := ComposeExecute(false, conf, []string{"ls", dir})
+		add("read "+dir, err)
+	}
+	return result
+}
+
+// checkFreeSpace makes sure the transfer dir exists and has room for the tarball
+func checkFreeSpace(conf HostCaptureConfiguration, minFreeBytes int64) error {
+	if out, err := ComposeExecute(false, conf, []string{"mkdir", "-p", conf.TransferDir}); err != nil {
+		return fmt.Errorf("unable to create %v: %v %v", conf.TransferDir, err, out)
+	}
+	out, err := ComposeExecute(false, conf, []string{"df", "-Pk", conf.TransferDir})
+	if err != nil {
+		return err
+	}
+	free, err := parseDfAvailable(out)
+	if err != nil {
+		return err
+	}
+	if free < minFreeBytes {
+		return fmt.Errorf("%v has %v MB free but at least %v MB are needed", conf.TransferDir, free/(1024*1024), minFreeBytes/(1024*1024))
+	}
+	return nil
+}
+
+// parseDfAvailable reads the available bytes from df -Pk output, the second line has the numbers
+// and available is the fourth column in 1024 byte blocks
+func parseDfAvailable(out string) (int64, error) {
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		if lineNumber != 2 {
+			continue
+		}
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 {
+			break
+		}
+		kb, err := strconv.ParseInt(fields[3], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("unable to parse available space from df output '%v': %w", out, err)
+		}
+		return kb * 1024, nil
+	}
+	return 0, fmt.Errorf("unexpected df output '%v'", out)
+}
+
+// runPreflight checks every host in parallel, a host that does not answer within PreflightTimeout fails
+func runPreflight(ctx context.Context, confs []HostCaptureConfiguration, dirs []string, minFreeBytes int64) []PreflightResult {
+	var results []PreflightResult
+	var m sync.Mutex
+	var wg sync.WaitGroup
+	for _, conf := range confs {
+		wg.Add(1)
+		go func(conf HostCaptureConfiguration) {
+			defer wg.Done()
+			consoleprint.UpdateNodeState(conf.Host, "PREFLIGHT")
+			done := make(chan PreflightResult, 1)
+			go func() {
+				done <- preflightHost(conf, dirs, minFreeBytes)
+			}()
+			var result PreflightResult
+			timer := time.NewTimer(PreflightTimeout)
+			defer timer.Stop()
+			select {
+			case result = <-done:
+			case <-timer.C:
+				result = PreflightResult{Host: conf.Host, Checks: []PreflightCheck{{Name: "reachable", Detail: fmt.Sprintf("checks did not finish within %v", PreflightTimeout)}}}
+				consoleprint.UpdatePreflight(conf.Host, "reachable", false)
+			case <-ctx.Done():
+				result = PreflightResult{Host: conf.Host}
+			}
+			if failed := result.Failed(); len(failed) > 0 {
+				var names []string
+				for _, check := range failed {
+					names = append(names, check.Name)
+					simplelog.Warningf("preflight check %v failed on host %v: %v", check.Name, conf.Host, check.Detail)
+				}
+				consoleprint.UpdateNodeState(conf.Host, "PREFLIGHT FAILED - "+strutils.LimitString(strings.Join(names, ", "), 200))
+			} else {
+				consoleprint.UpdateNodeState(conf.Host, "PREFLIGHT PASSED")
+			}
+			m.Lock()
+			results = append(results, result)
+			m.Unlock()
+		}(conf)
+	}
+	wg.Wait()
+	sort.Slice(results, func(i, j int) bool { return results[i].Host < results[j].Host })
+	return results
+}
+
+// preflightDecision applies --preflight-on-failure to the results, nil means the collection goes ahead.
+// An empty onFailure is the same as prompt.
+func preflightDecision(results []PreflightResult, onFailure string, confirm func(failedHosts []string) (bool, error)) error {
+	var failedHosts []string
+	for _, r := range results {
+		if len(r.Failed()) > 0 {
+			failedHosts = append(failedHosts, r.Host)
+		}
+	}
+	if len(failedHosts) == 0 {
+		simplelog.Infof("preflight checks passed on %v hosts", len(results))
+		return nil
+	}
+	simplelog.Warningf("preflight checks failed on hosts %v\n%v", strings.Join(failedHosts, ", "), consoleprint.PreflightMatrix())
+	switch onFailure {
+	case PreflightContinue:
+		simplelog.Warningf("continuing the collection even though preflight checks failed on hosts %v", strings.Join(failedHosts, ", "))
+		return nil
+	case PreflightPrompt, "":
+		if confirm == nil {
+			return PreflightFailedErr{Hosts: failedHosts}
+		}
+		ok, err := confirm(failedHosts)
+		if err != nil {
+			return errors.Join(PreflightFailedErr{Hosts: failedHosts}, err)
+		}
+		if ok {
+			simplelog.Warningf("user chose to continue even though preflight checks failed on hosts %v", strings.Join(failedHosts, ", "))
+			return nil
+		}
+		return PreflightFailedErr{Hosts: failedHosts}
+	default:
+		return PreflightFailedErr{Hosts: failedHosts}
+	}
+}
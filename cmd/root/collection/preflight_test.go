@@ -0,0 +1,183 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// collection package provides the interface for collection implementation and the actual collection execution
+package collection
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/dremio/dremio-diagnostic-collector/cmd/root/helpers"
+)
+
+type preflightCollector struct {
+	MockCapCollector
+	mu        sync.Mutex
+	responses map[string]string
+	failures  map[string]bool
+	commands  []string
+}
+
+func (s *preflightCollector) HostExecute(_ bool, _ string, _ bool, args ...string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cmd := strings.Join(args, " ")
+	s.commands = append(s.commands, cmd)
+	if s.failures[cmd] {
+		return "command not found", errors.New("exit status 127")
+	}
+	return s.responses[cmd], nil
+}
+
+const dfOutput = `Filesystem     1024-blocks    Used Available Capacity Mounted on
+/dev/sda1         10000000 9000000   %v      90%% /
+`
+
+func TestParseDfAvailable(t *testing.T) {
+	free, err := parseDfAvailable(strings.Replace(dfOutput, "%v", "2048", 1))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if free != 2048*1024 {
+		t.Errorf("expected %v but was %v", 2048*1024, free)
+	}
+	if _, err := parseDfAvailable("df: /tmp/ddc: No such file or directory"); err == nil {
+		t.Error("expected an error for output without numbers")
+	}
+}
+
+func TestPreflightHost(t *testing.T) {
+	collector := &preflightCollector{
+		responses: map[string]string{
+			"sudo -u dremio df -Pk /tmp/ddc": strings.Replace(dfOutput, "%v", "1024", 1),
+		},
+		failures: map[string]bool{
+			"sudo -u dremio jcmd -l":          true,
+			"sudo -u dremio ls /var/log/none": true,
+		},
+	}
+	conf := HostCaptureConfiguration{Host: "node1", Collector: collector, SudoUser: "dremio", TransferDir: "/tmp/ddc"}
+	result := preflightHost(conf, []string{"/opt/dremio/conf", "/var/log/none"}, 2*1024*1024)
+	var names []string
+	for _, check := range result.Checks {
+		names = append(names, check.Name)
+	}
+	expectedNames := []string{"sudo", "transfer-dir", "jcmd", "jps", "java", "read /opt/dremio/conf", "read /var/log/none"}
+	if !reflect.DeepEqual(names, expectedNames) {
+		t.Errorf("expected checks %v but was %v", expectedNames, names)
+	}
+	var failed []string
+	for _, check := range result.Failed() {
+		failed = append(failed, check.Name)
+	}
+	// 1 MB free is less than the 2 MB needed
+	expectedFailed := []string{"transfer-dir", "jcmd", "read /var/log/none"}
+	if !reflect.DeepEqual(failed, expectedFailed) {
+		t.Errorf("expected failed checks %v but was %v", expectedFailed, failed)
+	}
+	if collector.commands[0] != "sudo -n -u dremio true" {
+		t.Errorf("expected sudo to be checked without a password prompt but ran %v", collector.commands[0])
+	}
+}
+
+func TestPreflightDecision(t *testing.T) {
+	passed := []PreflightResult{{Host: "node1", Checks: []PreflightCheck{{Name: "jcmd", Passed: true}}}}
+	failed := []PreflightResult{
+		{Host: "node1", Checks: []PreflightCheck{{Name: "jcmd", Passed: true}}},
+		{Host: "node2", Checks: []PreflightCheck{{Name: "jcmd", Detail: "not found"}}},
+	}
+	if err := preflightDecision(passed, PreflightAbort, nil); err != nil {
+		t.Errorf("expected no error when every check passed but was %v", err)
+	}
+	if err := preflightDecision(failed, PreflightContinue, nil); err != nil {
+		t.Errorf("expected continue to ignore the failure but was %v", err)
+	}
+	var preflightErr PreflightFailedErr
+	if err := preflightDecision(failed, PreflightAbort, nil); !errors.As(err, &preflightErr) || !reflect.DeepEqual(preflightErr.Hosts, []string{"node2"}) {
+		t.Errorf("expected abort to fail on node2 but was %v", err)
+	}
+	var asked []string
+	yes := func(hosts []string) (bool, error) {
+		asked = hosts
+		return true, nil
+	}
+	if err := preflightDecision(failed, PreflightPrompt, yes); err != nil {
+		t.Errorf("expected the user to be able to continue but was %v", err)
+	}
+	if !reflect.DeepEqual(asked, []string{"node2"}) {
+		t.Errorf("expected to be asked about node2 but was %v", asked)
+	}
+	no := func(_ []string) (bool, error) { return false, nil }
+	if err := preflightDecision(failed, PreflightPrompt, no); !errors.As(err, &preflightErr) {
+		t.Errorf("expected the user to be able to abort but was %v", err)
+	}
+	if err := preflightDecision(failed, "", nil); !errors.As(err, &preflightErr) {
+		t.Errorf("expected a prompt without a way to ask to abort but was %v", err)
+	}
+}
+
+func TestExecuteStopsWhenPreflightFails(t *testing.T) {
+	ddcfs := helpers.NewRealFileSystem()
+	mockStrategy := NewMockStrategy(ddcfs)
+	outputLoc := filepath.Join(t.TempDir(), "diag.tgz")
+	args := Args{
+		DDCfs:              ddcfs,
+		CoordinatorStr:     "coordinator1",
+		ExecutorsStr:       "executor1",
+		OutputLoc:          outputLoc,
+		CopyStrategy:       mockStrategy,
+		TransferDir:        "/tmp/ddc",
+		PreflightOnFailure: PreflightAbort,
+	}
+	// the mock output is not df output so the transfer dir check fails everywhere
+	collector := &preflightCollector{}
+	err := Execute(context.Background(), collector, mockStrategy, args)
+	var preflightErr PreflightFailedErr
+	if !errors.As(err, &preflightErr) {
+		t.Fatalf("expected a preflight error but was %v", err)
+	}
+	if !reflect.DeepEqual(preflightErr.Hosts, []string{"coordinator1", "executor1"}) {
+		t.Errorf("unexpected failed hosts %v", preflightErr.Hosts)
+	}
+	if _, err := os.Stat(CheckpointDir(outputLoc)); !os.IsNotExist(err) {
+		t.Errorf("expected the checkpoint to be removed but stat returned %v", err)
+	}
+	for _, cmd := range collector.commands {
+		if strings.Contains(cmd, "local-collect") {
+			t.Errorf("expected nothing to be collected but ran %v", cmd)
+		}
+	}
+}
+
+func TestResolvePreflightOnFailure(t *testing.T) {
+	if mode := ResolvePreflightOnFailure(PreflightAuto, true); mode != PreflightPrompt {
+		t.Errorf("expected auto to prompt on a terminal but was %v", mode)
+	}
+	// cron, CI and ddc schedule have nobody to ask so they collect like they did before the checks
+	if mode := ResolvePreflightOnFailure(PreflightAuto, false); mode != PreflightContinue {
+		t.Errorf("expected auto to continue without a terminal but was %v", mode)
+	}
+	for _, mode := range []string{PreflightPrompt, PreflightAbort, PreflightContinue} {
+		if resolved := ResolvePreflightOnFailure(mode, false); resolved != mode {
+			t.Errorf("expected %v to be kept but was %v", mode, resolved)
+		}
+	}
+}
@@ -18,11 +18,22 @@ package collection
 import (
 	"encoding/json"
 	"fmt"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/dremio/dremio-diagnostic-collector/cmd/root/helpers"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/taskresults"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/upload"
 )
 
+// SummaryFile is the file next to the output file that the summary is written to once the archive is uploaded
+func SummaryFile(outputLoc string) string {
+	base := filepath.Base(outputLoc)
+	base = strings.TrimSuffix(base, filepath.Ext(base))
+	return filepath.Join(filepath.Dir(outputLoc), base+"-summary.json")
+}
+
 type SummaryInfo struct {
 	ClusterInfo         ClusterInfo             `json:"clusterInfo"`
 	CollectedFiles      []helpers.CollectedFile `json:"collectedFiles"`
@@ -39,7 +50,19 @@ type SummaryInfo struct {
 	DDCVersion          string                  `json:"ddcVersion"`
 	CollectionsEnabled  []string                `json:"collectionsEnabled"`
 	CollectionsDisabled []string                `json:"collectionsDisabled"`
+	CollectionMode      string                  `json:"collectionMode,omitempty"`
 	PatSet              bool                    `json:"patSet"`
+	ResumedHosts        []string                `json:"resumedHosts"`
+	HostLabels          map[string]string       `json:"hostLabels,omitempty"`
+	// TaskResults are the collectors of every node that was not encrypted, from the task-results.json in its tarball
+	TaskResults []taskresults.Summary `json:"taskResults,omitempty"`
+	// JVMCaptureStart is the common start of the ttop, JFR and jstack captures and how far apart they really started
+	JVMCaptureStart *taskresults.CaptureSkew `json:"jvmCaptureStart,omitempty"`
+	// Cancelled is set when the collection was interrupted and this is a partial summary
+	Cancelled      bool     `json:"cancelled,omitempty"`
+	CancelledHosts []string `json:"cancelledHosts,omitempty"`
+	// Upload is only in the summary written next to the archive after it was uploaded
+	Upload *upload.Result `json:"upload,omitempty"`
 }
 
 type ClusterInfo struct {
@@ -16,23 +16,138 @@ package ddcbinary
 
 import (
 	"archive/zip"
+	"crypto/sha256"
 	"embed"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/dremio/dremio-diagnostic-collector/pkg/simplelog"
 )
 
-//go:embed output/ddc.zip
+//go:embed output/*.zip
 var binaryData embed.FS
 
+// legacyZipName is the embedded build from before multiple architectures were bundled, it is always linux/amd64
+const legacyZipName = "ddc.zip"
+
+// Platform is an operating system and architecture in GOOS and GOARCH notation
+type Platform struct {
+	OS   string
+	Arch string
+}
+
+// LinuxAMD64 is the platform WriteOutDDC writes out
+var LinuxAMD64 = Platform{OS: "linux", Arch: "amd64"}
+
+func (p Platform) String() string {
+	return p.OS + "/" + p.Arch
+}
+
+func (p Platform) zipName() string {
+	return fmt.Sprintf("ddc-%v-%v.zip", p.OS, p.Arch)
+}
+
+// UnsupportedPlatformErr is returned when no ddc build for the platform was bundled into this binary
+type UnsupportedPlatformErr struct {
+	Platform Platform
+	Bundled  []Platform
+}
+
+func (u UnsupportedPlatformErr) Error() string {
+	var bundled []string
+	for _, p := range u.Bundled {
+		bundled = append(bundled, p.String())
+	}
+	return fmt.Sprintf("no ddc build for %v is bundled, this ddc only bundles [%v]", u.Platform, strings.Join(bundled, ", "))
+}
+
+// BundledPlatforms lists the platforms a ddc build is embedded for, empty placeholders used during the build are skipped
+func BundledPlatforms() []Platform {
+	entries, err := binaryData.ReadDir("output")
+	if err != nil {
+		return []Platform{}
+	}
+	var platforms []Platform
+	for _, entry := range entries {
+		name := entry.Name()
+		if info, err := entry.Info(); err != nil || info.Size() == 0 {
+			continue
+		}
+		if name == legacyZipName {
+			platforms = append(platforms, LinuxAMD64)
+			continue
+		}
+		parts := strings.Split(strings.TrimSuffix(strings.TrimPrefix(name, "ddc-"), ".zip"), "-")
+		if len(parts) != 2 {
+			continue
+		}
+		p := Platform{OS: parts[0], Arch: parts[1]}
+		if !containsPlatform(platforms, p) {
+			platforms = append(platforms, p)
+		}
+	}
+	sort.Slice(platforms, func(i, j int) bool { return platforms[i].String() < platforms[j].String() })
+	return platforms
+}
+
+func containsPlatform(platforms []Platform, p Platform) bool {
+	for _, existing := range platforms {
+		if existing == p {
+			return true
+		}
+	}
+	return false
+}
+
+func readZip(p Platform) ([]byte, error) {
+	names := []string{p.zipName()}
+	if p == LinuxAMD64 {
+		names = append(names, legacyZipName)
+	}
+	for _, name := range names {
+		data, err := binaryData.ReadFile("output/" + name)
+		if err == nil && len(data) > 0 {
+			return data, nil
+		}
+	}
+	return nil, UnsupportedPlatformErr{Platform: p, Bundled: BundledPlatforms()}
+}
+
+// PlatformFromUname maps the output of 'uname -s -m' to GOOS and GOARCH names, only the last line is read
+// since login banners and sudo warnings can end up in the output
+func PlatformFromUname(out string) (Platform, error) {
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	fields := strings.Fields(lines[len(lines)-1])
+	if len(fields) != 2 {
+		return Platform{}, fmt.Errorf("unable to read the operating system and architecture from uname output '%v'", strings.TrimSpace(out))
+	}
+	// names we do not know are passed through so the caller reports them as not bundled
+	p := Platform{OS: strings.ToLower(fields[0]), Arch: strings.ToLower(fields[1])}
+	switch p.Arch {
+	case "x86_64":
+		p.Arch = "amd64"
+	case "aarch64":
+		p.Arch = "arm64"
+	case "i386", "i686":
+		p.Arch = "386"
+	}
+	return p, nil
+}
+
+// WriteOutDDC writes out the linux/amd64 ddc build to the target dir
 func WriteOutDDC(targetDir string) (string, error) {
-	data, err := binaryData.ReadFile("output/ddc.zip")
+	return WriteOutDDCForPlatform(targetDir, LinuxAMD64)
+}
+
+// WriteOutDDCForPlatform writes out the ddc build for the platform to the target dir and returns its path
+func WriteOutDDCForPlatform(targetDir string, p Platform) (string, error) {
+	data, err := readZip(p)
 	if err != nil {
-		// Handle error
 		return "", err
 	}
 	outFileName := filepath.Join(targetDir, "ddc.zip")
@@ -117,3 +232,33 @@ func Unzip(src string) error {
 
 	return nil
 }
+
+// SHA256Prefix marks the hash line printed by 'ddc version --sha256'
+const SHA256Prefix = "sha256:"
+
+// SHA256File returns the hex encoded sha256 of the file
+func SHA256File(file string) (string, error) {
+	f, err := os.Open(filepath.Clean(file))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("unable to hash %v: %w", file, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// ParseSHA256SumOutput returns the hash printed by 'sha256sum <file>', an empty string when there is none
+// so it never matches
+func ParseSHA256SumOutput(out string) string {
+	fields := strings.Fields(out)
+	if len(fields) == 0 || len(fields[0]) != sha256.Size*2 {
+		return ""
+	}
+	if _, err := hex.DecodeString(fields[0]); err != nil {
+		return ""
+	}
+	return strings.ToLower(fields[0])
+}
@@ -15,8 +15,10 @@
 package ddcbinary
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -89,3 +91,76 @@ func TestUnzipWithTooManyFilesInZip(t *testing.T) {
 		t.Errorf("the total file count changed by %v but we were expecting no change, we have some bad cleanup behavior to fix", len(entriesAfter)-len(entriesBefore))
 	}
 }
+
+func TestSHA256File(t *testing.T) {
+	f := filepath.Join(t.TempDir(), "ddc")
+	if err := os.WriteFile(f, []byte("ddc"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	sha, err := SHA256File(f)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	expected := "b98de57cfa222e221b085c4b9f245d498f6390de11b4aebc07af8db65d5987cd"
+	if sha != expected {
+		t.Errorf("expected %v but got %v", expected, sha)
+	}
+	if _, err := SHA256File(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
+
+func TestParseSHA256SumOutput(t *testing.T) {
+	sha := strings.Repeat("ab", 32)
+	if parsed := ParseSHA256SumOutput(sha + "  /tmp/ddc/ddc\n"); parsed != sha {
+		t.Errorf("expected %v but was %q", sha, parsed)
+	}
+	for _, out := range []string{"", "sha256sum: /tmp/ddc/ddc: No such file or directory\n", "1234  /tmp/ddc/ddc\n"} {
+		if parsed := ParseSHA256SumOutput(out); parsed != "" {
+			t.Errorf("expected no hash for %q but was %q", out, parsed)
+		}
+	}
+}
+
+func TestPlatformFromUname(t *testing.T) {
+	tests := []struct {
+		out      string
+		expected Platform
+	}{
+		{"Linux x86_64\n", Platform{OS: "linux", Arch: "amd64"}},
+		{"Linux aarch64", Platform{OS: "linux", Arch: "arm64"}},
+		{"Darwin arm64", Platform{OS: "darwin", Arch: "arm64"}},
+		{"Welcome to node1\nLinux aarch64\n", Platform{OS: "linux", Arch: "arm64"}},
+		{"Linux armv7l", Platform{OS: "linux", Arch: "armv7l"}},
+	}
+	for _, tt := range tests {
+		actual, err := PlatformFromUname(tt.out)
+		if err != nil {
+			t.Errorf("unexpected error for %q: %v", tt.out, err)
+		}
+		if actual != tt.expected {
+			t.Errorf("expected %v for %q but was %v", tt.expected, tt.out, actual)
+		}
+	}
+	if _, err := PlatformFromUname("command not found"); err == nil {
+		t.Error("expected an error for output that is not from uname")
+	}
+}
+
+func TestWriteOutDDCForUnsupportedPlatform(t *testing.T) {
+	_, err := WriteOutDDCForPlatform(t.TempDir(), Platform{OS: "linux", Arch: "armv7l"})
+	var unsupported UnsupportedPlatformErr
+	if !errors.As(err, &unsupported) {
+		t.Fatalf("expected an unsupported platform error but was %v", err)
+	}
+	if unsupported.Platform.String() != "linux/armv7l" {
+		t.Errorf("unexpected platform %v", unsupported.Platform)
+	}
+}
+
+func TestBundledPlatformsIncludesLegacyBuild(t *testing.T) {
+	// the build always bundles linux/amd64, either as ddc.zip or ddc-linux-amd64.zip
+	if !containsPlatform(BundledPlatforms(), LinuxAMD64) {
+		t.Errorf("expected linux/amd64 to be bundled but was %v", BundledPlatforms())
+	}
+}
@@ -0,0 +1,158 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// docker package provides access to log collections on docker and podman containers
+package docker
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/dremio/dremio-diagnostic-collector/cmd/root/cli"
+)
+
+const (
+	RuntimeDocker = "docker"
+	RuntimePodman = "podman"
+	// composeServiceLabel is set by docker compose and podman-compose on every container of a service
+	composeServiceLabel = "com.docker.compose.service"
+)
+
+type Args struct {
+	// Enabled is set by the --docker flag
+	Enabled bool
+	// Runtime is the container cli to use, docker or podman
+	Runtime string
+}
+
+// NewDockerActions is the only supported way to initialize the DockerActions struct
+func NewDockerActions(dockerArgs Args) *DockerActions {
+	runtime := dockerArgs.Runtime
+	if runtime == "" {
+		runtime = RuntimeDocker
+	}
+	return &DockerActions{
+		cli:     &cli.Cli{},
+		runtime: runtime,
+	}
+}
+
+// DockerActions runs commands with docker exec and copies files with docker cp, podman is used
+// the same way since its cli is compatible for everything we need
+type DockerActions struct {
+	cli     cli.CmdExecutor
+	runtime string
+}
+
+func (c *DockerActions) Name() string {
+	if c.runtime == RuntimePodman {
+		return "Podman"
+	}
+	return "Docker"
+}
+
+func (c *DockerActions) HostExecuteAndStream(mask bool, hostString string, output cli.OutputHandler, _ bool, args ...string) error {
+	dockerArgs := []string{c.runtime, "exec", hostString}
+	dockerArgs = append(dockerArgs, args...)
+	return c.cli.ExecuteAndStreamOutput(mask, output, dockerArgs...)
+}
+
+func (c *DockerActions) HostExecute(mask bool, hostString string, _ bool, args ...string) (string, error) {
+	dockerArgs := []string{c.runtime, "exec", hostString}
+	dockerArgs = append(dockerArgs, args...)
+	return c.cli.Execute(mask, dockerArgs...)
+}
+
+func (c *DockerActions) CopyFromHost(hostString string, _ bool, source, destination string) (string, error) {
+	return c.cli.Execute(false, c.runtime, "cp", fmt.Sprintf("%v:%v", hostString, source), destination)
+}
+
+func (c *DockerActions) CopyFromHostSudo(hostString string, isCoordinator bool, _, source, destination string) (string, error) {
+	// docker cp reads the container filesystem directly so there is no sudo user to switch to
+	return c.CopyFromHost(hostString, isCoordinator, source, destination)
+}
+
+func (c *DockerActions) CopyToHost(hostString string, _ bool, source, destination string) (string, error) {
+	return c.cli.Execute(false, c.runtime, "cp", source, fmt.Sprintf("%v:%v", hostString, destination))
+}
+
+func (c *DockerActions) CopyToHostSudo(hostString string, isCoordinator bool, _, source, destination string) (string, error) {
+	// docker cp writes the container filesystem directly so there is no sudo user to switch to
+	return c.CopyToHost(hostString, isCoordinator, source, destination)
+}
+
+// FindHosts finds running containers. The search term is one of
+//
+//	service:<compose service>  containers of a docker compose or podman-compose service
+//	name:<pattern>             containers whose name matches, see docker ps --filter name
+//	label:<key>=<value>        containers with the label, a bare <key>=<value> works too
+//	<name>,<name>              the containers with exactly these names
+func (c *DockerActions) FindHosts(searchTerm string) ([]string, error) {
+	var filter string
+	switch {
+	case strings.HasPrefix(searchTerm, "service:"):
+		filter = fmt.Sprintf("label=%v=%v", composeServiceLabel, strings.TrimPrefix(searchTerm, "service:"))
+	case strings.HasPrefix(searchTerm, "name:"):
+		filter = "name=" + strings.TrimPrefix(searchTerm, "name:")
+	case strings.HasPrefix(searchTerm, "label:"):
+		filter = "label=" + strings.TrimPrefix(searchTerm, "label:")
+	case strings.Contains(searchTerm, "="):
+		filter = "label=" + searchTerm
+	default:
+		var containers []string
+		for _, container := range strings.Split(searchTerm, ",") {
+			if container = strings.TrimSpace(container); container != "" {
+				containers = append(containers, container)
+			}
+		}
+		return containers, nil
+	}
+	out, err := c.cli.Execute(false, c.runtime, "ps", "--filter", filter, "--format", "{{.Names}}")
+	if err != nil {
+		return []string{}, err
+	}
+	var containers []string
+	for _, line := range strings.Split(out, "\n") {
+		if container := strings.TrimSpace(line); container != "" {
+			containers = append(containers, container)
+		}
+	}
+	sort.Strings(containers)
+	return containers, nil
+}
+
+// InspectContainer returns the docker inspect json of the container
+func (c *DockerActions) InspectContainer(container string) ([]byte, error) {
+	dockerArgs := []string{c.runtime, "inspect", container}
+	out, err := c.cli.Execute(false, dockerArgs...)
+	if err != nil {
+		return []byte(""), fmt.Errorf("when running command \n%v\nerror returned was %v", dockerArgs, err)
+	}
+	return []byte(out), nil
+}
+
+// GetContainerLogs returns the stdout and stderr logs of the container
+func (c *DockerActions) GetContainerLogs(container string) (string, error) {
+	dockerArgs := []string{c.runtime, "logs", "--timestamps", container}
+	out, err := c.cli.Execute(false, dockerArgs...)
+	if err != nil {
+		return out, fmt.Errorf("when running command \n%v\nerror returned was %v", dockerArgs, err)
+	}
+	return out, nil
+}
+
+func (c *DockerActions) HelpText() string {
+	return fmt.Sprintf("Make sure the containers are running and the search terms match them: try something like 'ddc --docker --coordinator service:dremio-coordinator --executors service:dremio-executor' for a compose project or 'ddc --docker --coordinator dremio'. You can also run '%v ps' to see the container names and labels", c.runtime)
+}
@@ -0,0 +1,145 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// docker package provides access to log collections on docker and podman containers
+package docker
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/dremio/dremio-diagnostic-collector/pkg/tests"
+)
+
+func TestDockerExec(t *testing.T) {
+	cli := &tests.MockCli{
+		StoredResponse: []string{"success"},
+		StoredErrors:   []error{nil},
+	}
+	d := DockerActions{cli: cli, runtime: RuntimeDocker}
+	out, err := d.HostExecute(false, "dremio-coordinator-1", true, "ls", "-l")
+	if err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	if out != "success" {
+		t.Errorf("expected success but got %v", out)
+	}
+	expectedCall := []string{"docker", "exec", "dremio-coordinator-1", "ls", "-l"}
+	if !reflect.DeepEqual(cli.Calls[0], expectedCall) {
+		t.Errorf("\nexpected call\n%v\nbut got\n%v", expectedCall, cli.Calls[0])
+	}
+}
+
+func TestPodmanCopy(t *testing.T) {
+	cli := &tests.MockCli{
+		StoredResponse: []string{"", ""},
+		StoredErrors:   []error{nil, nil},
+	}
+	d := DockerActions{cli: cli, runtime: RuntimePodman}
+	if _, err := d.CopyFromHostSudo("dremio", true, "dremio", "/tmp/out.tgz", "/local/out.tgz"); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	if _, err := d.CopyToHost("dremio", true, "/local/ddc", "/tmp/ddc"); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	expectedCalls := [][]string{
+		{"podman", "cp", "dremio:/tmp/out.tgz", "/local/out.tgz"},
+		{"podman", "cp", "/local/ddc", "dremio:/tmp/ddc"},
+	}
+	if !reflect.DeepEqual(cli.Calls, expectedCalls) {
+		t.Errorf("\nexpected calls\n%v\nbut got\n%v", expectedCalls, cli.Calls)
+	}
+	if d.Name() != "Podman" {
+		t.Errorf("expected Podman but got %v", d.Name())
+	}
+}
+
+func TestDockerFindHosts(t *testing.T) {
+	testCases := []struct {
+		searchTerm string
+		filter     string
+	}{
+		{"service:dremio-executor", "label=com.docker.compose.service=dremio-executor"},
+		{"name:dremio", "name=dremio"},
+		{"label:role=executor", "label=role=executor"},
+		{"role=executor", "label=role=executor"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.searchTerm, func(t *testing.T) {
+			cli := &tests.MockCli{
+				StoredResponse: []string{"dremio-executor-2\ndremio-executor-1\n"},
+				StoredErrors:   []error{nil},
+			}
+			d := DockerActions{cli: cli, runtime: RuntimeDocker}
+			containers, err := d.FindHosts(tc.searchTerm)
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			expected := []string{"dremio-executor-1", "dremio-executor-2"}
+			if !reflect.DeepEqual(containers, expected) {
+				t.Errorf("expected %v but got %v", expected, containers)
+			}
+			expectedCall := []string{"docker", "ps", "--filter", tc.filter, "--format", "{{.Names}}"}
+			if !reflect.DeepEqual(cli.Calls[0], expectedCall) {
+				t.Errorf("\nexpected call\n%v\nbut got\n%v", expectedCall, cli.Calls[0])
+			}
+		})
+	}
+}
+
+func TestDockerFindHostsByName(t *testing.T) {
+	cli := &tests.MockCli{}
+	d := DockerActions{cli: cli, runtime: RuntimeDocker}
+	containers, err := d.FindHosts("dremio-executor-1, dremio-executor-2,")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	expected := []string{"dremio-executor-1", "dremio-executor-2"}
+	if !reflect.DeepEqual(containers, expected) {
+		t.Errorf("expected %v but got %v", expected, containers)
+	}
+	if len(cli.Calls) != 0 {
+		t.Errorf("expected no calls but got %v", cli.Calls)
+	}
+}
+
+func TestDockerInspectAndLogs(t *testing.T) {
+	cli := &tests.MockCli{
+		StoredResponse: []string{"[{}]", "", "log line"},
+		StoredErrors:   []error{nil, errors.New("no such container"), nil},
+	}
+	d := DockerActions{cli: cli, runtime: RuntimeDocker}
+	out, err := d.InspectContainer("dremio")
+	if err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	if string(out) != "[{}]" {
+		t.Errorf("expected [{}] but got %v", string(out))
+	}
+	if _, err := d.InspectContainer("missing"); err == nil {
+		t.Error("expected an error for a missing container")
+	}
+	logs, err := d.GetContainerLogs("dremio")
+	if err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	if logs != "log line" {
+		t.Errorf("expected log line but got %v", logs)
+	}
+	expectedCall := []string{"docker", "logs", "--timestamps", "dremio"}
+	if !reflect.DeepEqual(cli.Calls[2], expectedCall) {
+		t.Errorf("\nexpected call\n%v\nbut got\n%v", expectedCall, cli.Calls[2])
+	}
+}
@@ -23,6 +23,7 @@ import (
 	"time"
 
 	"github.com/dremio/dremio-diagnostic-collector/pkg/archive"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/manifest"
 	"github.com/dremio/dremio-diagnostic-collector/pkg/simplelog"
 )
 
@@ -104,6 +105,7 @@ func (s *CopyStrategyHC) CreatePath(fileType, source, nodeType string) (path str
 		strings.Contains(source, "dremio-executor") ||
 		strings.Contains(source, "dremio-coordinator") ||
 		strings.Contains(source, "container-logs") ||
+		strings.Contains(source, "container-inspect") ||
 		strings.Contains(source, "nodes") {
 		isK8s = true
 	}
@@ -138,12 +140,13 @@ func (s *CopyStrategyHC) ClusterPath() (path string, err error) {
 	return path, nil
 }
 
-// Archive calls out to the main archive function
-func (s *CopyStrategyHC) ArchiveDiag(o string, outputLoc string) error {
+// Archive calls out to the main archive function and returns the files written, more than one when the archive is split.
+// nodes are the hosts collected from, they are used to attribute the files listed in the manifest
+func (s *CopyStrategyHC) ArchiveDiag(o string, nodes []string, outputLoc string, opts archive.Options) ([]string, error) {
 	// creates the summary file
 	summaryFile := filepath.Join(s.TmpDir, "summary.json")
 	if err := s.Fs.WriteFile(summaryFile, []byte(o), 0600); err != nil {
-		return fmt.Errorf("failed writing summary file '%v' due to error %v", summaryFile, err)
+		return nil, fmt.Errorf("failed writing summary file '%v' due to error %v", summaryFile, err)
 	}
 
 	// cleanup when done
@@ -157,11 +160,17 @@ func (s *CopyStrategyHC) ArchiveDiag(o string, outputLoc string) error {
 
 	// create completed file (its not gzipped)
 	if _, err := s.createHCFiles(); err != nil {
-		return err
+		return nil, err
 	}
 
+	// the manifest goes first so a truncated archive can still be checked with ddc verify
+	if _, err := manifest.Write(s.TmpDir, s.BaseDir, nodes); err != nil {
+		return nil, err
+	}
+	opts.First = append(opts.First, manifest.FileName)
+
 	// call general archive routine
-	return archive.TarGzDir(s.TmpDir, outputLoc)
+	return archive.ArchiveDir(s.TmpDir, outputLoc, opts)
 }
 
 // This function creates a couple of supplemental files required for the HC data to be uploaded
@@ -19,6 +19,9 @@ import (
 	"path/filepath"
 	"testing"
 	"time"
+
+	"github.com/dremio/dremio-diagnostic-collector/pkg/archive"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/manifest"
 )
 
 type MockTimeService struct {
@@ -108,10 +111,18 @@ func TestArchiveDiagHC(t *testing.T) {
 		}
 
 		// Test Archive, pushes a teal test file into a zip archive
-		err = testStrat.ArchiveDiag("test", archiveFile)
+		_, err = testStrat.ArchiveDiag("test", []string{"node1"}, archiveFile, archive.Options{Format: archive.TarGz})
 		if err != nil {
 			t.Errorf("\nERROR: gzip file: \nexpected:\t%v\nactual:\t\t%v\n", nil, err)
 		}
+		// the summary and completed marker are listed in the manifest so the archive verifies
+		report, err := manifest.Verify(archiveFile)
+		if err != nil {
+			t.Fatalf("unable to verify archive %v", err)
+		}
+		if !report.OK() || report.Verified != 2 {
+			t.Errorf("expected the summary and completed file to verify but was %#v", report)
+		}
 	}
 
 }
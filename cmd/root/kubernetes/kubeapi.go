@@ -0,0 +1,572 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// kubernetes package provides access to log collections on k8s
+package kubernetes
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/dremio/dremio-diagnostic-collector/cmd/root/cli"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/simplelog"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	k8sclient "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+const (
+	// TransportKubectl runs all operations through the kubectl binary
+	TransportKubectl = "kubectl"
+	// TransportAPI talks to the Kubernetes API server directly
+	TransportAPI = "api"
+)
+
+// resourceKinds maps the resource names passed to kubectl get to the api group, version and kind,
+// namespaced is false for cluster scoped resources
+var resourceKinds = map[string]struct {
+	gvr        schema.GroupVersionResource
+	kind       string
+	namespaced bool
+}{
+	"nodes":         {schema.GroupVersionResource{Version: "v1", Resource: "nodes"}, "Node", false},
+	"pvc":           {schema.GroupVersionResource{Version: "v1", Resource: "persistentvolumeclaims"}, "PersistentVolumeClaim", true},
+	"pv":            {schema.GroupVersionResource{Version: "v1", Resource: "persistentvolumes"}, "PersistentVolume", false},
+	"service":       {schema.GroupVersionResource{Version: "v1", Resource: "services"}, "Service", true},
+	"endpoints":     {schema.GroupVersionResource{Version: "v1", Resource: "endpoints"}, "Endpoints", true},
+	"pods":          {schema.GroupVersionResource{Version: "v1", Resource: "pods"}, "Pod", true},
+	"events":        {schema.GroupVersionResource{Version: "v1", Resource: "events"}, "Event", true},
+	"limitrange":    {schema.GroupVersionResource{Version: "v1", Resource: "limitranges"}, "LimitRange", true},
+	"resourcequota": {schema.GroupVersionResource{Version: "v1", Resource: "resourcequotas"}, "ResourceQuota", true},
+	"deployments":   {schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}, "Deployment", true},
+	"statefulsets":  {schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "statefulsets"}, "StatefulSet", true},
+	"daemonset":     {schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "daemonsets"}, "DaemonSet", true},
+	"replicaset":    {schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "replicasets"}, "ReplicaSet", true},
+	"cronjob":       {schema.GroupVersionResource{Group: "batch", Version: "v1", Resource: "cronjobs"}, "CronJob", true},
+	"job":           {schema.GroupVersionResource{Group: "batch", Version: "v1", Resource: "jobs"}, "Job", true},
+	"sc":            {schema.GroupVersionResource{Group: "storage.k8s.io", Version: "v1", Resource: "storageclasses"}, "StorageClass", false},
+	"ingress":       {schema.GroupVersionResource{Group: "networking.k8s.io", Version: "v1", Resource: "ingresses"}, "Ingress", true},
+	"hpa":           {schema.GroupVersionResource{Group: "autoscaling", Version: "v1", Resource: "horizontalpodautoscalers"}, "HorizontalPodAutoscaler", true},
+	"pdb":           {schema.GroupVersionResource{Group: "policy", Version: "v1", Resource: "poddisruptionbudgets"}, "PodDisruptionBudget", true},
+	"pc":            {schema.GroupVersionResource{Group: "scheduling.k8s.io", Version: "v1", Resource: "priorityclasses"}, "PriorityClass", false},
+}
+
+// streamFunc runs a command in a container wiring up the optional stdin and the stdout and stderr writers
+type streamFunc func(pod, container string, command []string, stdin io.Reader, stdout, stderr io.Writer) error
+
+// NewKubeAPIActions is the only supported way to initialize the KubeAPIActions struct,
+// the client configuration is read from --kubeconfig, $KUBECONFIG or ~/.kube/config in that order
+// and falls back to the in cluster service account when none are available
+func NewKubeAPIActions(kubeArgs KubeArgs) (*KubeAPIActions, error) {
+	restConfig, err := loadRestConfig(kubeArgs.KubeConfig)
+	if err != nil {
+		return nil, err
+	}
+	client, err := k8sclient.NewForConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create kubernetes client: %w", err)
+	}
+	dynamicClient, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create kubernetes dynamic client: %w", err)
+	}
+	c := &KubeAPIActions{
+		client:               client,
+		dynamic:              dynamicClient,
+		coordinatorContainer: kubeArgs.CoordinatorContainer,
+		executorContainer:    kubeArgs.ExecutorsContainer,
+		namespace:            kubeArgs.Namespace,
+	}
+	c.stream = func(pod, container string, command []string, stdin io.Reader, stdout, stderr io.Writer) error {
+		req := client.CoreV1().RESTClient().Post().
+			Resource("pods").
+			Name(pod).
+			Namespace(c.namespace).
+			SubResource("exec").
+			VersionedParams(&corev1.PodExecOptions{
+				Container: container,
+				Command:   command,
+				Stdin:     stdin != nil,
+				Stdout:    true,
+				Stderr:    true,
+			}, scheme.ParameterCodec)
+		executor, err := remotecommand.NewSPDYExecutor(restConfig, "POST", req.URL())
+		if err != nil {
+			return fmt.Errorf("unable to setup exec for pod %v: %w", pod, err)
+		}
+		return executor.StreamWithContext(context.Background(), remotecommand.StreamOptions{
+			Stdin:  stdin,
+			Stdout: stdout,
+			Stderr: stderr,
+		})
+	}
+	return c, nil
+}
+
+func loadRestConfig(kubeConfig string) (*rest.Config, error) {
+	if kubeConfig != "" {
+		restConfig, err := clientcmd.BuildConfigFromFlags("", kubeConfig)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read kubeconfig %v: %w", kubeConfig, err)
+		}
+		return restConfig, nil
+	}
+	loader := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(clientcmd.NewDefaultClientConfigLoadingRules(), &clientcmd.ConfigOverrides{})
+	restConfig, err := loader.ClientConfig()
+	if err == nil {
+		return restConfig, nil
+	}
+	simplelog.Debugf("no usable kubeconfig found (%v), trying in cluster configuration", err)
+	restConfig, inClusterErr := rest.InClusterConfig()
+	if inClusterErr != nil {
+		return nil, fmt.Errorf("unable to find a kubeconfig (%v) or an in cluster configuration (%v)", err, inClusterErr)
+	}
+	return restConfig, nil
+}
+
+// KubeAPIActions provides a way to collect and copy files using the Kubernetes API
+type KubeAPIActions struct {
+	client               k8sclient.Interface
+	dynamic              dynamic.Interface
+	stream               streamFunc
+	coordinatorContainer string
+	executorContainer    string
+	namespace            string
+}
+
+func (c *KubeAPIActions) getContainerName(podName string, isCoordinator bool) string {
+	if isCoordinator {
+		containers, err := c.GetPodContainers(podName)
+		if err != nil {
+			simplelog.Warningf("unable to list containers for pod %v: %v", podName, err)
+		}
+		expectedContainers := strings.Split(c.coordinatorContainer, ",")
+		for _, container := range containers {
+			for _, expectedContainer := range expectedContainers {
+				if container == expectedContainer {
+					return container
+				}
+			}
+		}
+	}
+	// All other pod types are executors
+	return c.executorContainer
+}
+
+func (c *KubeAPIActions) Name() string {
+	return "Kubernetes API"
+}
+
+func (c *KubeAPIActions) logExec(mask bool, pod, container string, args []string) {
+	if mask {
+		simplelog.Infof("pod %v container %v: running masked command", pod, container)
+		return
+	}
+	simplelog.Infof("pod %v container %v: running %v", pod, container, strings.Join(args, " "))
+}
+
+// lockedWriter lets stdout and stderr share one buffer, remotecommand writes them from separate goroutines
+type lockedWriter struct {
+	mu *sync.Mutex
+	w  io.Writer
+}
+
+func (l lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
+
+func (c *KubeAPIActions) HostExecute(mask bool, hostString string, isCoordinator bool, args ...string) (out string, err error) {
+	container := c.getContainerName(hostString, isCoordinator)
+	c.logExec(mask, hostString, container, args)
+	var buf bytes.Buffer
+	w := lockedWriter{mu: &sync.Mutex{}, w: &buf}
+	if err := c.stream(hostString, container, args, nil, w, w); err != nil {
+		return buf.String(), fmt.Errorf("unable to execute command on pod %v: %w", hostString, err)
+	}
+	return buf.String(), nil
+}
+
+func (c *KubeAPIActions) HostExecuteAndStream(mask bool, hostString string, output cli.OutputHandler, isCoordinator bool, args ...string) (err error) {
+	container := c.getContainerName(hostString, isCoordinator)
+	c.logExec(mask, hostString, container, args)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	scan := func(r io.Reader) {
+		defer wg.Done()
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			mu.Lock()
+			output(scanner.Text())
+			mu.Unlock()
+		}
+		// drain anything left so the writer never blocks
+		_, _ = io.Copy(io.Discard, r)
+	}
+	stdoutReader, stdoutWriter := io.Pipe()
+	stderrReader, stderrWriter := io.Pipe()
+	wg.Add(2)
+	go scan(stdoutReader)
+	go scan(stderrReader)
+	err = c.stream(hostString, container, args, nil, stdoutWriter, stderrWriter)
+	stdoutWriter.Close()
+	stderrWriter.Close()
+	wg.Wait()
+	if err != nil {
+		return fmt.Errorf("unable to execute command on pod %v: %w", hostString, err)
+	}
+	return nil
+}
+
+func (c *KubeAPIActions) CopyFromHost(hostString string, isCoordinator bool, source, destination string) (out string, err error) {
+	container := c.getContainerName(hostString, isCoordinator)
+	source = path.Clean(source)
+	command := []string{"tar", "cf", "-", "-C", path.Dir(source), path.Base(source)}
+	simplelog.Infof("pod %v container %v: copying %v to %v", hostString, container, source, destination)
+	reader, writer := io.Pipe()
+	var stderr bytes.Buffer
+	errCh := make(chan error, 1)
+	go func() {
+		err := c.stream(hostString, container, command, nil, writer, &stderr)
+		writer.CloseWithError(err)
+		errCh <- err
+	}()
+	untarErr := untarTo(reader, path.Base(source), destination)
+	// drain so the stream can always complete
+	_, _ = io.Copy(io.Discard, reader)
+	if err := <-errCh; err != nil {
+		return stderr.String(), fmt.Errorf("unable to copy %v from pod %v: %w", source, hostString, err)
+	}
+	if untarErr != nil {
+		return stderr.String(), fmt.Errorf("unable to copy %v from pod %v: %w", source, hostString, untarErr)
+	}
+	return stderr.String(), nil
+}
+
+func (c *KubeAPIActions) CopyFromHostSudo(hostString string, isCoordinator bool, _, source, destination string) (out string, err error) {
+	// We dont have any sudo user in the container so no addition of sudo commands used
+	return c.CopyFromHost(hostString, isCoordinator, source, destination)
+}
+
+func (c *KubeAPIActions) CopyToHost(hostString string, isCoordinator bool, source, destination string) (out string, err error) {
+	container := c.getContainerName(hostString, isCoordinator)
+	destination = path.Clean(destination)
+	command := []string{"tar", "xmf", "-", "-C", path.Dir(destination)}
+	simplelog.Infof("pod %v container %v: copying %v to %v", hostString, container, source, destination)
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(tarFrom(writer, source, path.Base(destination)))
+	}()
+	var buf bytes.Buffer
+	w := lockedWriter{mu: &sync.Mutex{}, w: &buf}
+	err = c.stream(hostString, container, command, reader, w, w)
+	// unblock the tar writer if the remote side stopped reading early
+	reader.Close()
+	if err != nil {
+		return buf.String(), fmt.Errorf("unable to copy %v to pod %v: %w", source, hostString, err)
+	}
+	return buf.String(), nil
+}
+
+func (c *KubeAPIActions) CopyToHostSudo(hostString string, isCoordinator bool, _, source, destination string) (out string, err error) {
+	// We dont have any sudo user in the container so no addition of sudo commands used
+	return c.CopyToHost(hostString, isCoordinator, source, destination)
+}
+
+func (c *KubeAPIActions) FindHosts(searchTerm string) (podName []string, err error) {
+	pods, err := c.client.CoreV1().Pods(c.namespace).List(context.Background(), metav1.ListOptions{LabelSelector: searchTerm})
+	if err != nil {
+		return []string{}, fmt.Errorf("unable to list pods with label %v: %w", searchTerm, err)
+	}
+	for _, pod := range pods.Items {
+		podName = append(podName, pod.Name)
+	}
+	sort.Strings(podName)
+	return podName, nil
+}
+
+// GetClusterResource returns the resource list in the same json layout kubectl get -o json produces
+func (c *KubeAPIActions) GetClusterResource(resource string) ([]byte, error) {
+	rk, ok := resourceKinds[resource]
+	if !ok {
+		return []byte(""), fmt.Errorf("unsupported resource %v", resource)
+	}
+	var client dynamic.ResourceInterface = c.dynamic.Resource(rk.gvr)
+	if rk.namespaced {
+		client = c.dynamic.Resource(rk.gvr).Namespace(c.namespace)
+	}
+	list, err := client.List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		return []byte(""), fmt.Errorf("when getting config %v error returned was %v", resource, err)
+	}
+	apiVersion := rk.gvr.GroupVersion().String()
+	items := make([]map[string]interface{}, 0, len(list.Items))
+	for _, item := range list.Items {
+		obj := item.Object
+		// list items from the api server do not carry their type, kubectl adds it and the secret masking needs it
+		obj["apiVersion"] = apiVersion
+		obj["kind"] = rk.kind
+		items = append(items, obj)
+	}
+	return json.MarshalIndent(map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "List",
+		"metadata":   map[string]interface{}{"resourceVersion": ""},
+		"items":      items,
+	}, "", "    ")
+}
+
+// GetPodContainers lists the containers and init containers of the pod
+func (c *KubeAPIActions) GetPodContainers(podName string) ([]string, error) {
+	pod, err := c.client.CoreV1().Pods(c.namespace).Get(context.Background(), podName, metav1.GetOptions{})
+	if err != nil {
+		return []string{}, fmt.Errorf("unable to get pod %v: %w", podName, err)
+	}
+	var containers []string
+	for _, container := range pod.Spec.Containers {
+		containers = append(containers, container.Name)
+	}
+	for _, container := range pod.Spec.InitContainers {
+		containers = append(containers, container.Name)
+	}
+	return containers, nil
+}
+
+// GetPodLogs returns the logs of a container in the pod
+func (c *KubeAPIActions) GetPodLogs(podName, container string) (string, error) {
+	out, err := c.client.CoreV1().Pods(c.namespace).GetLogs(podName, &corev1.PodLogOptions{Container: container}).DoRaw(context.Background())
+	if err != nil {
+		return string(out), fmt.Errorf("unable to get logs for pod %v container %v: %w", podName, container, err)
+	}
+	return string(out), nil
+}
+
+// DescribeNodes returns a plain text summary of all nodes similar to kubectl describe nodes
+func (c *KubeAPIActions) DescribeNodes() (string, error) {
+	nodes, err := c.client.CoreV1().Nodes().List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		return "", fmt.Errorf("unable to list nodes: %w", err)
+	}
+	var b strings.Builder
+	for i, node := range nodes.Items {
+		if i > 0 {
+			b.WriteString("\n\n")
+		}
+		describeNode(&b, node)
+	}
+	return b.String(), nil
+}
+
+func describeNode(b *strings.Builder, node corev1.Node) {
+	var roles []string
+	for label := range node.Labels {
+		if strings.HasPrefix(label, "node-role.kubernetes.io/") {
+			roles = append(roles, strings.TrimPrefix(label, "node-role.kubernetes.io/"))
+		}
+	}
+	sort.Strings(roles)
+	if len(roles) == 0 {
+		roles = []string{"<none>"}
+	}
+	fmt.Fprintf(b, "Name:               %v\n", node.Name)
+	fmt.Fprintf(b, "Roles:              %v\n", strings.Join(roles, ","))
+	writeSortedMap(b, "Labels:", node.Labels)
+	writeSortedMap(b, "Annotations:", node.Annotations)
+	fmt.Fprintf(b, "CreationTimestamp:  %v\n", node.CreationTimestamp.UTC().Format("Mon, 02 Jan 2006 15:04:05 -0700"))
+	if len(node.Spec.Taints) == 0 {
+		b.WriteString("Taints:             <none>\n")
+	} else {
+		for i, taint := range node.Spec.Taints {
+			label := ""
+			if i == 0 {
+				label = "Taints:"
+			}
+			fmt.Fprintf(b, "%-20v%v\n", label, taint.ToString())
+		}
+	}
+	fmt.Fprintf(b, "Unschedulable:      %v\n", node.Spec.Unschedulable)
+	b.WriteString("Conditions:\n")
+	fmt.Fprintf(b, "  %-22v%-8v%-32v%v\n", "Type", "Status", "Reason", "Message")
+	for _, condition := range node.Status.Conditions {
+		fmt.Fprintf(b, "  %-22v%-8v%-32v%v\n", condition.Type, condition.Status, condition.Reason, condition.Message)
+	}
+	b.WriteString("Addresses:\n")
+	for _, address := range node.Status.Addresses {
+		fmt.Fprintf(b, "  %v: %v\n", address.Type, address.Address)
+	}
+	writeResourceList(b, "Capacity:", node.Status.Capacity)
+	writeResourceList(b, "Allocatable:", node.Status.Allocatable)
+	info := node.Status.NodeInfo
+	b.WriteString("System Info:\n")
+	fmt.Fprintf(b, "  Machine ID:                 %v\n", info.MachineID)
+	fmt.Fprintf(b, "  System UUID:                %v\n", info.SystemUUID)
+	fmt.Fprintf(b, "  Boot ID:                    %v\n", info.BootID)
+	fmt.Fprintf(b, "  Kernel Version:             %v\n", info.KernelVersion)
+	fmt.Fprintf(b, "  OS Image:                   %v\n", info.OSImage)
+	fmt.Fprintf(b, "  Operating System:           %v\n", info.OperatingSystem)
+	fmt.Fprintf(b, "  Architecture:               %v\n", info.Architecture)
+	fmt.Fprintf(b, "  Container Runtime Version:  %v\n", info.ContainerRuntimeVersion)
+	fmt.Fprintf(b, "  Kubelet Version:            %v\n", info.KubeletVersion)
+	fmt.Fprintf(b, "  Kube-Proxy Version:         %v\n", info.KubeProxyVersion)
+	if node.Spec.PodCIDR != "" {
+		fmt.Fprintf(b, "PodCIDR:            %v\n", node.Spec.PodCIDR)
+	}
+	if node.Spec.ProviderID != "" {
+		fmt.Fprintf(b, "ProviderID:         %v\n", node.Spec.ProviderID)
+	}
+}
+
+func writeSortedMap(b *strings.Builder, label string, m map[string]string) {
+	if len(m) == 0 {
+		fmt.Fprintf(b, "%-20v<none>\n", label)
+		return
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for i, k := range keys {
+		if i > 0 {
+			label = ""
+		}
+		fmt.Fprintf(b, "%-20v%v=%v\n", label, k, m[k])
+	}
+}
+
+func writeResourceList(b *strings.Builder, label string, resources corev1.ResourceList) {
+	b.WriteString(label + "\n")
+	keys := make([]string, 0, len(resources))
+	for k := range resources {
+		keys = append(keys, string(k))
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		q := resources[corev1.ResourceName(k)]
+		fmt.Fprintf(b, "  %-22v%v\n", k+":", q.String())
+	}
+}
+
+// untarTo extracts the tar stream produced by 'tar cf - -C dir base' so that base lands at destination
+func untarTo(r io.Reader, base, destination string) error {
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("unable to read tar stream: %w", err)
+		}
+		name := path.Clean(header.Name)
+		rel := strings.TrimPrefix(strings.TrimPrefix(name, base), "/")
+		if name != base && !strings.HasPrefix(name, base+"/") {
+			return fmt.Errorf("unexpected entry %v in tar stream", header.Name)
+		}
+		if strings.Contains(rel, "..") {
+			return fmt.Errorf("illegal path %v in tar stream", header.Name)
+		}
+		target := filepath.Join(destination, filepath.FromSlash(rel))
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0o750); err != nil {
+				return fmt.Errorf("unable to create directory %v: %w", target, err)
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0o750); err != nil {
+				return fmt.Errorf("unable to create directory %v: %w", filepath.Dir(target), err)
+			}
+			if err := writeTarEntry(tr, target, header); err != nil {
+				return err
+			}
+		default:
+			simplelog.Debugf("skipping tar entry %v of type %v", header.Name, header.Typeflag)
+		}
+	}
+}
+
+func writeTarEntry(tr io.Reader, target string, header *tar.Header) error {
+	f, err := os.OpenFile(filepath.Clean(target), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(header.Mode).Perm()|0o600)
+	if err != nil {
+		return fmt.Errorf("unable to create file %v: %w", target, err)
+	}
+	// limit the copy to the header size, the stream comes from the pod
+	if _, err := io.CopyN(f, tr, header.Size); err != nil {
+		f.Close()
+		return fmt.Errorf("unable to write file %v: %w", target, err)
+	}
+	return f.Close()
+}
+
+// tarFrom writes source as a tar stream naming the top level entry base, the counterpart of 'tar xf - -C dir'
+func tarFrom(w io.Writer, source, base string) error {
+	tw := tar.NewWriter(w)
+	err := filepath.Walk(source, func(file string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(source, file)
+		if err != nil {
+			return err
+		}
+		header, err := tar.FileInfoHeader(fi, "")
+		if err != nil {
+			return err
+		}
+		header.Name = path.Join(base, filepath.ToSlash(rel))
+		if rel == "." {
+			header.Name = base
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+		f, err := os.Open(filepath.Clean(file))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("unable to tar %v: %w", source, err)
+	}
+	return tw.Close()
+}
+
+func (c *KubeAPIActions) HelpText() string {
+	return "Make sure the labels and namespace you use actually correspond to your dremio pods: try something like 'ddc -n mynamespace --coordinator app=dremio-coordinator --executor app=dremio-executor'. Also make sure your kubeconfig (--kubeconfig, $KUBECONFIG or ~/.kube/config) points at the right cluster and allows exec and log access to the pods"
+}
@@ -0,0 +1,280 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// kubernetes package provides access to log collections on k8s
+package kubernetes
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+func testPod(name string, labels map[string]string, containers ...string) *corev1.Pod {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "testns", Labels: labels},
+	}
+	for _, container := range containers {
+		pod.Spec.Containers = append(pod.Spec.Containers, corev1.Container{Name: container})
+	}
+	return pod
+}
+
+// localStream runs the command on this machine, so the tar based copies can be tested without a cluster
+func localStream(t *testing.T, calls *[]string) streamFunc {
+	return func(pod, container string, command []string, stdin io.Reader, stdout, stderr io.Writer) error {
+		*calls = append(*calls, pod+"/"+container+": "+strings.Join(command, " "))
+		// #nosec G204 -- test only
+		cmd := exec.Command(command[0], command[1:]...)
+		cmd.Stdin = stdin
+		cmd.Stdout = stdout
+		cmd.Stderr = stderr
+		return cmd.Run()
+	}
+}
+
+func newTestKubeAPIActions(t *testing.T, objects ...runtime.Object) (*KubeAPIActions, *[]string) {
+	var calls []string
+	return &KubeAPIActions{
+		client:               fake.NewSimpleClientset(objects...),
+		dynamic:              dynamicfake.NewSimpleDynamicClient(scheme.Scheme, objects...),
+		stream:               localStream(t, &calls),
+		coordinatorContainer: "dremio-master-coordinator,dremio-coordinator",
+		executorContainer:    "dremio-executor",
+		namespace:            "testns",
+	}, &calls
+}
+
+func TestKubeAPIExecPicksContainer(t *testing.T) {
+	k, calls := newTestKubeAPIActions(t, testPod("dremio-master-0", nil, "dremio-master-coordinator", "sidecar"))
+	out, err := k.HostExecute(false, "dremio-master-0", true, "echo", "hello")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if out != "hello\n" {
+		t.Errorf("expected 'hello' but got %q", out)
+	}
+	expected := []string{"dremio-master-0/dremio-master-coordinator: echo hello"}
+	if !reflect.DeepEqual(*calls, expected) {
+		t.Errorf("expected %v but got %v", expected, *calls)
+	}
+	if _, err := k.HostExecute(false, "dremio-executor-0", false, "true"); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if (*calls)[1] != "dremio-executor-0/dremio-executor: true" {
+		t.Errorf("expected the executor container but got %v", (*calls)[1])
+	}
+}
+
+func TestKubeAPIExecAndStream(t *testing.T) {
+	k, _ := newTestKubeAPIActions(t)
+	var lines []string
+	err := k.HostExecuteAndStream(false, "dremio-executor-0", func(line string) {
+		lines = append(lines, line)
+	}, false, "sh", "-c", "echo out; echo err 1>&2")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	joined := strings.Join(lines, ",")
+	if !strings.Contains(joined, "out") || !strings.Contains(joined, "err") {
+		t.Errorf("expected stdout and stderr lines but got %v", lines)
+	}
+	if err := k.HostExecuteAndStream(false, "dremio-executor-0", func(string) {}, false, "false"); err == nil {
+		t.Error("expected an error for a failing command")
+	}
+}
+
+func TestKubeAPICopyToAndFromHost(t *testing.T) {
+	if _, err := exec.LookPath("tar"); err != nil {
+		t.Skip("tar is not available")
+	}
+	k, _ := newTestKubeAPIActions(t)
+	tmpDir := t.TempDir()
+	source := filepath.Join(tmpDir, "source.txt")
+	if err := os.WriteFile(source, []byte("my row"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	remote := filepath.Join(tmpDir, "remote.txt")
+	if _, err := k.CopyToHost("dremio-executor-0", false, source, remote); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	back := filepath.Join(tmpDir, "back.txt")
+	if _, err := k.CopyFromHost("dremio-executor-0", false, remote, back); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	b, err := os.ReadFile(back)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "my row" {
+		t.Errorf("expected 'my row' but got %q", string(b))
+	}
+
+	// directories are copied with their contents
+	remoteDir := filepath.Join(tmpDir, "remote-dir")
+	if err := os.MkdirAll(filepath.Join(remoteDir, "nested"), 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(remoteDir, "nested", "file.txt"), []byte("nested row"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	backDir := filepath.Join(tmpDir, "back-dir")
+	if _, err := k.CopyFromHost("dremio-executor-0", false, remoteDir, backDir); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	b, err = os.ReadFile(filepath.Join(backDir, "nested", "file.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "nested row" {
+		t.Errorf("expected 'nested row' but got %q", string(b))
+	}
+
+	if _, err := k.CopyFromHost("dremio-executor-0", false, filepath.Join(tmpDir, "missing"), back); err == nil {
+		t.Error("expected an error copying a missing file")
+	}
+}
+
+func TestKubeAPIFindHosts(t *testing.T) {
+	k, _ := newTestKubeAPIActions(t,
+		testPod("dremio-executor-1", map[string]string{"role": "dremio-executor"}),
+		testPod("dremio-executor-0", map[string]string{"role": "dremio-executor"}),
+		testPod("dremio-master-0", map[string]string{"role": "dremio-coordinator"}),
+	)
+	pods, err := k.FindHosts("role=dremio-executor")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	expected := []string{"dremio-executor-0", "dremio-executor-1"}
+	if !reflect.DeepEqual(pods, expected) {
+		t.Errorf("expected %v but got %v", expected, pods)
+	}
+}
+
+func TestKubeAPIGetClusterResource(t *testing.T) {
+	k, _ := newTestKubeAPIActions(t,
+		&corev1.Pod{
+			TypeMeta:   metav1.TypeMeta{Kind: "Pod", APIVersion: "v1"},
+			ObjectMeta: metav1.ObjectMeta{Name: "dremio-master-0", Namespace: "testns"},
+		},
+		&corev1.Pod{
+			TypeMeta:   metav1.TypeMeta{Kind: "Pod", APIVersion: "v1"},
+			ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "otherns"},
+		},
+	)
+	out, err := k.GetClusterResource("pods")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	var list struct {
+		Kind  string                   `json:"kind"`
+		Items []map[string]interface{} `json:"items"`
+	}
+	if err := json.Unmarshal(out, &list); err != nil {
+		t.Fatalf("unable to parse %v: %v", string(out), err)
+	}
+	if list.Kind != "List" {
+		t.Errorf("expected List but got %v", list.Kind)
+	}
+	if len(list.Items) != 1 {
+		t.Fatalf("expected 1 pod in the namespace but got %v", len(list.Items))
+	}
+	if list.Items[0]["kind"] != "Pod" {
+		t.Errorf("expected every item to have a kind but got %v", list.Items[0]["kind"])
+	}
+
+	if _, err := k.GetClusterResource("nosuchthing"); err == nil {
+		t.Error("expected an error for an unsupported resource")
+	}
+}
+
+func TestKubeAPIPodContainersAndLogs(t *testing.T) {
+	pod := testPod("dremio-master-0", nil, "dremio-master-coordinator")
+	pod.Spec.InitContainers = []corev1.Container{{Name: "chown"}}
+	k, _ := newTestKubeAPIActions(t, pod)
+	containers, err := k.GetPodContainers("dremio-master-0")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	expected := []string{"dremio-master-coordinator", "chown"}
+	if !reflect.DeepEqual(containers, expected) {
+		t.Errorf("expected %v but got %v", expected, containers)
+	}
+	if _, err := k.GetPodContainers("missing"); err == nil {
+		t.Error("expected an error for a missing pod")
+	}
+	logs, err := k.GetPodLogs("dremio-master-0", "dremio-master-coordinator")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	// the fake client always returns this text
+	if logs != "fake logs" {
+		t.Errorf("expected 'fake logs' but got %q", logs)
+	}
+}
+
+func TestKubeAPIDescribeNodes(t *testing.T) {
+	k, _ := newTestKubeAPIActions(t, &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "node-1",
+			Labels: map[string]string{"node-role.kubernetes.io/worker": ""},
+		},
+		Status: corev1.NodeStatus{
+			Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionTrue, Reason: "KubeletReady"}},
+			Capacity:   corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("4")},
+			NodeInfo:   corev1.NodeSystemInfo{KubeletVersion: "v1.28.2"},
+		},
+	})
+	out, err := k.DescribeNodes()
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	for _, expected := range []string{"Name:               node-1", "Roles:              worker", "KubeletReady", "cpu:", "v1.28.2"} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("expected %q in\n%v", expected, out)
+		}
+	}
+}
+
+func TestUntarRejectsUnexpectedEntries(t *testing.T) {
+	tmpDir := t.TempDir()
+	var buf strings.Builder
+	if err := tarFrom(&writerAdapter{&buf}, tmpDir, "other"); err != nil {
+		t.Fatal(err)
+	}
+	if err := untarTo(strings.NewReader(buf.String()), "expected", filepath.Join(tmpDir, "out")); err == nil {
+		t.Error("expected an error for an entry outside of the requested path")
+	}
+}
+
+type writerAdapter struct {
+	b *strings.Builder
+}
+
+func (w *writerAdapter) Write(p []byte) (int, error) {
+	return w.b.Write(p)
+}
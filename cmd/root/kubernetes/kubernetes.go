@@ -27,6 +27,8 @@ type KubeArgs struct {
 	CoordinatorContainer string
 	ExecutorsContainer   string
 	KubectlPath          string
+	Transport            string
+	KubeConfig           string
 }
 
 // NewKubectlK8sActions is the only supported way to initialize the KubectlK8sActions struct
@@ -148,6 +150,45 @@ func (c *KubectlK8sActions) FindHosts(searchTerm string) (podName []string, err
 	return pods, nil
 }
 
+// GetClusterResource returns the json list of a resource type in the namespace, resource is any name kubectl get accepts
+func (c *KubectlK8sActions) GetClusterResource(resource string) ([]byte, error) {
+	out, err := c.cli.Execute(false, c.kubectlPath, "-n", c.namespace, "get", resource, "-o", "json")
+	if err != nil {
+		return []byte(""), fmt.Errorf("when getting config %v error returned was %v", resource, err)
+	}
+	return []byte(out), nil
+}
+
+// GetPodContainers lists the containers and init containers of the pod
+func (c *KubectlK8sActions) GetPodContainers(podName string) ([]string, error) {
+	kubectlArgs := []string{c.kubectlPath, "-n", c.namespace, "get", "pods", podName, "-o", `jsonpath={.spec['containers','initContainers'][*].name}`}
+	out, err := c.cli.Execute(false, kubectlArgs...)
+	if err != nil {
+		return []string{}, fmt.Errorf("when running command \n%v\nerror returned was %v", kubectlArgs, err)
+	}
+	return strings.Split(out, " "), nil
+}
+
+// GetPodLogs returns the logs of a container in the pod
+func (c *KubectlK8sActions) GetPodLogs(podName, container string) (string, error) {
+	kubectlArgs := []string{c.kubectlPath, "-n", c.namespace, "logs", podName, "-c", container}
+	out, err := c.cli.Execute(false, kubectlArgs...)
+	if err != nil {
+		return out, fmt.Errorf("when running command \n%v\nerror returned was %v", kubectlArgs, err)
+	}
+	return out, nil
+}
+
+// DescribeNodes returns the kubectl describe output for all nodes
+func (c *KubectlK8sActions) DescribeNodes() (string, error) {
+	kubectlArgs := []string{c.kubectlPath, "-n", c.namespace, "describe", "nodes"}
+	out, err := c.cli.Execute(false, kubectlArgs...)
+	if err != nil {
+		return "", fmt.Errorf("when running command \n%v\nerror returned was %v", kubectlArgs, err)
+	}
+	return out, nil
+}
+
 func (c *KubectlK8sActions) HelpText() string {
 	return "Make sure the labels and namespace you use actually correspond to your dremio pods: try something like 'ddc -n mynamespace --coordinator app=dremio-coordinator --executor app=dremio-executor'.  You can also run 'kubectl get pods --show-labels' to see what labels are available to use for your dremio pods"
 }
@@ -0,0 +1,318 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ssh
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	RoleCoordinator = "coordinator"
+	RoleExecutor    = "executor"
+	// maxExpandedHosts stops a typo like 10.0.0.0/8 from turning into millions of ssh connections
+	maxExpandedHosts = 4096
+)
+
+// InventoryHost is one entry of the hosts inventory, the host may be a range or a CIDR block
+// in which case every address it expands to gets the same settings
+type InventoryHost struct {
+	Host     string `yaml:"host" json:"host"`
+	Role     string `yaml:"role" json:"role"`
+	User     string `yaml:"user,omitempty" json:"user,omitempty"`
+	Key      string `yaml:"key,omitempty" json:"key,omitempty"`
+	Port     int    `yaml:"port,omitempty" json:"port,omitempty"`
+	SudoUser string `yaml:"sudo-user,omitempty" json:"sudo-user,omitempty"`
+	Label    string `yaml:"label,omitempty" json:"label,omitempty"`
+	// JumpHosts replaces the inventory and --ssh-jump-host hops for this host
+	JumpHosts []JumpHost `yaml:"jump-hosts,omitempty" json:"jump-hosts,omitempty"`
+}
+
+// Inventory is the parsed --hosts-inventory file, hosts are kept in file order after expansion
+type Inventory struct {
+	// JumpHosts are the hops for every host that does not list its own, they replace --ssh-jump-host
+	JumpHosts []JumpHost      `yaml:"jump-hosts,omitempty" json:"jump-hosts,omitempty"`
+	Hosts     []InventoryHost `yaml:"hosts" json:"hosts"`
+}
+
+// LoadInventory reads a YAML or JSON inventory file and expands any ranges or CIDR blocks in it
+func LoadInventory(file string) (*Inventory, error) {
+	b, err := os.ReadFile(filepath.Clean(file))
+	if err != nil {
+		return nil, fmt.Errorf("unable to read hosts inventory %v: %w", file, err)
+	}
+	// JSON is valid YAML so one parser covers both
+	var raw Inventory
+	if err := yaml.Unmarshal(b, &raw); err != nil {
+		return nil, fmt.Errorf("unable to parse hosts inventory %v: %w", file, err)
+	}
+	inv, err := raw.expand()
+	if err != nil {
+		return nil, fmt.Errorf("invalid hosts inventory %v: %w", file, err)
+	}
+	return inv, nil
+}
+
+func (i *Inventory) expand() (*Inventory, error) {
+	if len(i.Hosts) == 0 {
+		return nil, errors.New("no hosts listed under 'hosts'")
+	}
+	if err := validateJumpHosts("the inventory", i.JumpHosts); err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	expanded := &Inventory{JumpHosts: i.JumpHosts}
+	for n, h := range i.Hosts {
+		if h.Host == "" {
+			return nil, fmt.Errorf("entry %v has no host", n+1)
+		}
+		if h.Role != RoleCoordinator && h.Role != RoleExecutor {
+			return nil, fmt.Errorf("host %v has role '%v', valid roles are '%v' and '%v'", h.Host, h.Role, RoleCoordinator, RoleExecutor)
+		}
+		if h.Port < 0 || h.Port > 65535 {
+			return nil, fmt.Errorf("host %v has invalid port %v", h.Host, h.Port)
+		}
+		if err := validateJumpHosts("host "+h.Host, h.JumpHosts); err != nil {
+			return nil, err
+		}
+		addrs, err := expandHost(h.Host)
+		if err != nil {
+			return nil, err
+		}
+		for _, addr := range addrs {
+			if seen[addr] {
+				return nil, fmt.Errorf("host %v is listed more than once", addr)
+			}
+			seen[addr] = true
+			entry := h
+			entry.Host = addr
+			expanded.Hosts = append(expanded.Hosts, entry)
+		}
+	}
+	if len(expanded.Hosts) > maxExpandedHosts {
+		return nil, fmt.Errorf("the inventory expands to %v hosts which is more than the limit of %v", len(expanded.Hosts), maxExpandedHosts)
+	}
+	return expanded, nil
+}
+
+// Coordinators lists the coordinator addresses in inventory order
+func (i *Inventory) Coordinators() []string {
+	return i.withRole(RoleCoordinator)
+}
+
+// Executors lists the executor addresses in inventory order
+func (i *Inventory) Executors() []string {
+	return i.withRole(RoleExecutor)
+}
+
+func (i *Inventory) withRole(role string) []string {
+	var hosts []string
+	for _, h := range i.Hosts {
+		if h.Role == role {
+			hosts = append(hosts, h.Host)
+		}
+	}
+	return hosts
+}
+
+// Host returns the inventory entry for the address
+func (i *Inventory) Host(addr string) (InventoryHost, bool) {
+	if i == nil {
+		return InventoryHost{}, false
+	}
+	for _, h := range i.Hosts {
+		if h.Host == addr {
+			return h, true
+		}
+	}
+	return InventoryHost{}, false
+}
+
+// SudoUsers maps every host with its own sudo-user to that user
+func (i *Inventory) SudoUsers() map[string]string {
+	sudoUsers := make(map[string]string)
+	for _, h := range i.Hosts {
+		if h.SudoUser != "" {
+			sudoUsers[h.Host] = h.SudoUser
+		}
+	}
+	return sudoUsers
+}
+
+// Labels maps every labeled host to its label
+func (i *Inventory) Labels() map[string]string {
+	labels := make(map[string]string)
+	for _, h := range i.Hosts {
+		if h.Label != "" {
+			labels[h.Host] = h.Label
+		}
+	}
+	return labels
+}
+
+// Validate checks every host ends up with a user, and with a key when the ssh binaries are used,
+// once the --ssh-user and --ssh-key defaults are applied
+func (i *Inventory) Validate(sshArgs Args) error {
+	for _, h := range i.Hosts {
+		if h.User == "" && sshArgs.SSHUser == "" {
+			return fmt.Errorf("host %v has no user in the inventory, set 'user' or pass --ssh-user", h.Host)
+		}
+		// the native transport can fall back to the ssh-agent
+		if h.Key == "" && sshArgs.SSHKeyLoc == "" && sshArgs.Transport != TransportNative {
+			return fmt.Errorf("host %v has no key in the inventory, set 'key' or pass --ssh-key", h.Host)
+		}
+	}
+	return nil
+}
+
+func validateJumpHosts(owner string, hops []JumpHost) error {
+	for n, hop := range hops {
+		if hop.Host == "" {
+			return fmt.Errorf("jump host %v of %v has no host", n+1, owner)
+		}
+		if hop.Port < 0 || hop.Port > 65535 {
+			return fmt.Errorf("jump host %v of %v has invalid port %v", hop.Host, owner, hop.Port)
+		}
+	}
+	return nil
+}
+
+func (i *Inventory) everyHostHasKey() bool {
+	if i == nil {
+		return false
+	}
+	for _, h := range i.Hosts {
+		if h.Key == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// ExpandHosts splits a comma separated host list and expands any ranges such as 10.0.0.20-30
+// or 10.0.0.20-10.0.0.30 and CIDR blocks such as 10.0.0.16/29
+func ExpandHosts(searchTerm string) ([]string, error) {
+	var hosts []string
+	for _, rawHost := range strings.Split(searchTerm, ",") {
+		rawHost = strings.TrimSpace(rawHost)
+		if rawHost == "" {
+			continue
+		}
+		expanded, err := expandHost(rawHost)
+		if err != nil {
+			return nil, err
+		}
+		hosts = append(hosts, expanded...)
+	}
+	if len(hosts) > maxExpandedHosts {
+		return nil, fmt.Errorf("'%v' expands to %v hosts which is more than the limit of %v", searchTerm, len(hosts), maxExpandedHosts)
+	}
+	return hosts, nil
+}
+
+func expandHost(host string) ([]string, error) {
+	// [fe80::1] is accepted since that is how IPv6 addresses are written next to a port or user
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	if strings.Contains(host, "/") {
+		return expandCIDR(host)
+	}
+	if start, end, ok := parseRange(host); ok {
+		return expandRange(host, start, end)
+	}
+	return []string{host}, nil
+}
+
+// parseRange only treats the host as a range when the start is an IPv4 address, host names such as dremio-executor-1 are left alone
+func parseRange(host string) (net.IP, net.IP, bool) {
+	dash := strings.LastIndex(host, "-")
+	if dash < 0 {
+		return nil, nil, false
+	}
+	start := net.ParseIP(host[:dash]).To4()
+	if start == nil {
+		return nil, nil, false
+	}
+	endStr := host[dash+1:]
+	if end := net.ParseIP(endStr).To4(); end != nil {
+		return start, end, true
+	}
+	lastOctet, err := strconv.Atoi(endStr)
+	if err != nil || lastOctet < 0 || lastOctet > 255 {
+		return nil, nil, false
+	}
+	end := make(net.IP, len(start))
+	copy(end, start)
+	end[3] = byte(lastOctet)
+	return start, end, true
+}
+
+func expandRange(host string, start, end net.IP) ([]string, error) {
+	first := binary.BigEndian.Uint32(start)
+	last := binary.BigEndian.Uint32(end)
+	if last < first {
+		return nil, fmt.Errorf("invalid host range %v, the end is before the start", host)
+	}
+	if last-first >= maxExpandedHosts {
+		return nil, fmt.Errorf("host range %v has more than %v hosts", host, maxExpandedHosts)
+	}
+	var hosts []string
+	for n := first; ; n++ {
+		ip := make(net.IP, 4)
+		binary.BigEndian.PutUint32(ip, n)
+		hosts = append(hosts, ip.String())
+		if n == last {
+			break
+		}
+	}
+	return hosts, nil
+}
+
+func expandCIDR(host string) ([]string, error) {
+	ip, ipNet, err := net.ParseCIDR(host)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CIDR block %v: %w", host, err)
+	}
+	ones, bits := ipNet.Mask.Size()
+	if bits-ones > 12 {
+		return nil, fmt.Errorf("CIDR block %v has more than %v hosts", host, maxExpandedHosts)
+	}
+	base := ipNet.IP
+	if ip.To4() != nil {
+		base = base.To4()
+	}
+	size := 1 << (bits - ones)
+	start := new(big.Int).SetBytes(base)
+	var hosts []string
+	for n := 0; n < size; n++ {
+		// the network and broadcast addresses of IPv4 blocks are not hosts
+		if ip.To4() != nil && size > 2 && (n == 0 || n == size-1) {
+			continue
+		}
+		addr := new(big.Int).Add(start, big.NewInt(int64(n))).Bytes()
+		ipBytes := make(net.IP, len(base))
+		copy(ipBytes[len(ipBytes)-len(addr):], addr)
+		hosts = append(hosts, ipBytes.String())
+	}
+	return hosts, nil
+}
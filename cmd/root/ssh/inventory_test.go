@@ -0,0 +1,131 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ssh
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestExpandHosts(t *testing.T) {
+	tests := []struct {
+		term     string
+		expected []string
+	}{
+		{"10.0.0.1, 10.0.0.2,", []string{"10.0.0.1", "10.0.0.2"}},
+		{"10.0.0.20-23", []string{"10.0.0.20", "10.0.0.21", "10.0.0.22", "10.0.0.23"}},
+		{"10.0.0.254-10.0.1.1", []string{"10.0.0.254", "10.0.0.255", "10.0.1.0", "10.0.1.1"}},
+		{"10.0.0.16/30", []string{"10.0.0.17", "10.0.0.18"}},
+		{"10.0.0.16/32", []string{"10.0.0.16"}},
+		{"fd00::/127", []string{"fd00::", "fd00::1"}},
+		{"[fe80::1],dremio-executor-1", []string{"fe80::1", "dremio-executor-1"}},
+	}
+	for _, tt := range tests {
+		actual, err := ExpandHosts(tt.term)
+		if err != nil {
+			t.Errorf("unexpected error for %v: %v", tt.term, err)
+			continue
+		}
+		if !reflect.DeepEqual(actual, tt.expected) {
+			t.Errorf("expected %v for %v but was %v", tt.expected, tt.term, actual)
+		}
+	}
+}
+
+func TestExpandHostsRejectsBadRanges(t *testing.T) {
+	for _, term := range []string{"10.0.0.30-20", "10.0.0.0/8", "10.0.0.0/33", "10.0.0.1-10.0.255.1"} {
+		if hosts, err := ExpandHosts(term); err == nil {
+			t.Errorf("expected an error for %v but got %v", term, hosts)
+		}
+	}
+}
+
+func writeInventory(t *testing.T, name, content string) string {
+	t.Helper()
+	f := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(f, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestLoadInventoryYAML(t *testing.T) {
+	f := writeInventory(t, "hosts.yaml", `hosts:
+  - host: "[fd00::10]"
+    role: coordinator
+    user: dremio
+    port: 2222
+    label: main
+  - host: 10.0.0.20-21
+    role: executor
+    key: /keys/exec.pem
+    sudo-user: dremio
+`)
+	inventory, err := LoadInventory(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(inventory.Coordinators(), []string{"fd00::10"}) {
+		t.Errorf("unexpected coordinators %v", inventory.Coordinators())
+	}
+	if !reflect.DeepEqual(inventory.Executors(), []string{"10.0.0.20", "10.0.0.21"}) {
+		t.Errorf("unexpected executors %v", inventory.Executors())
+	}
+	h, ok := inventory.Host("10.0.0.21")
+	if !ok || h.Key != "/keys/exec.pem" || h.SudoUser != "dremio" {
+		t.Errorf("expected the range settings on every expanded host but was %#v", h)
+	}
+	if !reflect.DeepEqual(inventory.Labels(), map[string]string{"fd00::10": "main"}) {
+		t.Errorf("unexpected labels %v", inventory.Labels())
+	}
+	if !reflect.DeepEqual(inventory.SudoUsers(), map[string]string{"10.0.0.20": "dremio", "10.0.0.21": "dremio"}) {
+		t.Errorf("unexpected sudo users %v", inventory.SudoUsers())
+	}
+	if err := inventory.Validate(Args{}); err == nil {
+		t.Error("expected an error since the executors have no user")
+	}
+	if err := inventory.Validate(Args{SSHUser: "ubuntu", SSHKeyLoc: "/keys/default.pem"}); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestLoadInventoryJSON(t *testing.T) {
+	f := writeInventory(t, "hosts.json", `{"hosts": [{"host": "coord", "role": "coordinator"}, {"host": "exec", "role": "executor", "port": 22}]}`)
+	inventory, err := LoadInventory(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(inventory.Coordinators(), []string{"coord"}) || !reflect.DeepEqual(inventory.Executors(), []string{"exec"}) {
+		t.Errorf("unexpected hosts %#v", inventory.Hosts)
+	}
+}
+
+func TestLoadInventoryErrors(t *testing.T) {
+	tests := map[string]string{
+		"no hosts":     `hosts: []`,
+		"bad role":     "hosts:\n  - host: a\n    role: master\n",
+		"no host":      "hosts:\n  - role: executor\n",
+		"bad port":     "hosts:\n  - host: a\n    role: executor\n    port: 70000\n",
+		"duplicate":    "hosts:\n  - host: 10.0.0.1\n    role: coordinator\n  - host: 10.0.0.1-2\n    role: executor\n",
+		"invalid yaml": "hosts: [",
+	}
+	for name, content := range tests {
+		if _, err := LoadInventory(writeInventory(t, "hosts.yaml", content)); err == nil {
+			t.Errorf("%v: expected an error", name)
+		}
+	}
+}
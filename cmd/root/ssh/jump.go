@@ -0,0 +1,191 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ssh
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// JumpHost is one hop on the way to a host, hops without a user or key use --ssh-user and --ssh-key
+type JumpHost struct {
+	Host string `yaml:"host" json:"host"`
+	User string `yaml:"user,omitempty" json:"user,omitempty"`
+	Key  string `yaml:"key,omitempty" json:"key,omitempty"`
+	Port int    `yaml:"port,omitempty" json:"port,omitempty"`
+}
+
+// String formats the hop as user@host:port for logging
+func (j JumpHost) String() string {
+	s := j.Host
+	if j.Port != 0 {
+		s = net.JoinHostPort(j.Host, strconv.Itoa(j.Port))
+	}
+	if j.User != "" {
+		s = j.User + "@" + s
+	}
+	return s
+}
+
+// ParseJumpHosts reads the --ssh-jump-host list, hops are comma separated in the order they are connected
+// to and each is [user@]host[:port]. keys is either empty, a single key for every hop or one key per hop
+func ParseJumpHosts(jumpHosts, keys string) ([]JumpHost, error) {
+	var hops []JumpHost
+	for _, spec := range strings.Split(jumpHosts, ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		hop, err := parseJumpHost(spec)
+		if err != nil {
+			return nil, err
+		}
+		hops = append(hops, hop)
+	}
+	var hopKeys []string
+	for _, key := range strings.Split(keys, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			hopKeys = append(hopKeys, key)
+		}
+	}
+	switch {
+	case len(hopKeys) == 0:
+	case len(hops) == 0:
+		return nil, fmt.Errorf("--ssh-jump-key was set to '%v' but there is no --ssh-jump-host", keys)
+	case len(hopKeys) == 1:
+		for i := range hops {
+			hops[i].Key = hopKeys[0]
+		}
+	case len(hopKeys) == len(hops):
+		for i := range hops {
+			hops[i].Key = hopKeys[i]
+		}
+	default:
+		return nil, fmt.Errorf("there are %v jump hosts but %v jump keys, pass a single key or one per jump host", len(hops), len(hopKeys))
+	}
+	return hops, nil
+}
+
+func parseJumpHost(spec string) (JumpHost, error) {
+	var hop JumpHost
+	hostPort := spec
+	if at := strings.LastIndex(spec, "@"); at >= 0 {
+		hop.User = spec[:at]
+		hostPort = spec[at+1:]
+	}
+	switch {
+	case strings.HasPrefix(hostPort, "["):
+		// [fd00::1] or [fd00::1]:2222
+		end := strings.Index(hostPort, "]")
+		if end < 0 {
+			return JumpHost{}, fmt.Errorf("invalid jump host '%v', missing ']'", spec)
+		}
+		hop.Host = hostPort[1:end]
+		if rest := hostPort[end+1:]; rest != "" {
+			if !strings.HasPrefix(rest, ":") {
+				return JumpHost{}, fmt.Errorf("invalid jump host '%v'", spec)
+			}
+			port, err := parsePort(rest[1:])
+			if err != nil {
+				return JumpHost{}, fmt.Errorf("invalid jump host '%v': %w", spec, err)
+			}
+			hop.Port = port
+		}
+	case strings.Count(hostPort, ":") == 1:
+		host, portStr, _ := strings.Cut(hostPort, ":")
+		port, err := parsePort(portStr)
+		if err != nil {
+			return JumpHost{}, fmt.Errorf("invalid jump host '%v': %w", spec, err)
+		}
+		hop.Host = host
+		hop.Port = port
+	default:
+		// a host name, an IPv4 address or an IPv6 address without a port
+		hop.Host = hostPort
+	}
+	if hop.Host == "" {
+		return JumpHost{}, fmt.Errorf("invalid jump host '%v', the host is empty", spec)
+	}
+	return hop, nil
+}
+
+func parsePort(portStr string) (int, error) {
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port < 1 || port > 65535 {
+		return 0, fmt.Errorf("invalid port '%v'", portStr)
+	}
+	return port, nil
+}
+
+// withDefaults fills in the user and key of hops that do not set their own
+func withDefaults(hops []JumpHost, defaultUser, defaultKey string) []JumpHost {
+	var resolved []JumpHost
+	for _, hop := range hops {
+		if hop.User == "" {
+			hop.User = defaultUser
+		}
+		if hop.Key == "" {
+			hop.Key = defaultKey
+		}
+		resolved = append(resolved, hop)
+	}
+	return resolved
+}
+
+// jumpHostKeyOptions are the ssh options that check the host keys of the jump hosts against knownHostsFile,
+// or ~/.ssh/known_hosts when it is empty. Only insecure turns the check off
+func jumpHostKeyOptions(knownHostsFile string, insecure bool) []string {
+	if insecure {
+		return []string{"-o", "UserKnownHostsFile=/dev/null", "-o", "StrictHostKeyChecking=no"}
+	}
+	opts := []string{"-o", "StrictHostKeyChecking=yes"}
+	if knownHostsFile != "" {
+		opts = append(opts, "-o", shellQuote("UserKnownHostsFile="+knownHostsFile))
+	}
+	return opts
+}
+
+// proxyCommand builds the ssh ProxyCommand that tunnels to %h:%p through the hops, each hop is checked with
+// hostKeyOptions. Each hop before the last is reached with a nested ProxyCommand, its % tokens are doubled
+// so only the ssh that runs it expands them
+func proxyCommand(hops []JumpHost, hostKeyOptions []string) string {
+	last := hops[len(hops)-1]
+	args := []string{"ssh"}
+	if last.Key != "" {
+		args = append(args, "-i", shellQuote(last.Key))
+	}
+	args = append(args, "-o", "LogLevel=error")
+	args = append(args, hostKeyOptions...)
+	if last.Port != 0 {
+		args = append(args, "-p", strconv.Itoa(last.Port))
+	}
+	if len(hops) > 1 {
+		inner := strings.ReplaceAll(proxyCommand(hops[:len(hops)-1], hostKeyOptions), "%", "%%")
+		args = append(args, "-o", shellQuote("ProxyCommand="+inner))
+	}
+	target := last.Host
+	if last.User != "" {
+		target = last.User + "@" + last.Host
+	}
+	args = append(args, "-W", "%h:%p", shellQuote(target))
+	return strings.Join(args, " ")
+}
+
+// shellQuote single quotes s for /bin/sh, which is what ssh runs the ProxyCommand with
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,132 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ssh
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/dremio/dremio-diagnostic-collector/pkg/tests"
+)
+
+func TestParseJumpHosts(t *testing.T) {
+	hops, err := ParseJumpHosts("ops@bastion.example.com:2222, 10.0.0.5,[fd00::1]:22,fd00::2", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []JumpHost{
+		{Host: "bastion.example.com", User: "ops", Port: 2222},
+		{Host: "10.0.0.5"},
+		{Host: "fd00::1", Port: 22},
+		{Host: "fd00::2"},
+	}
+	if !reflect.DeepEqual(hops, expected) {
+		t.Errorf("expected %v but was %v", expected, hops)
+	}
+
+	hops, err = ParseJumpHosts("a,b", "a.pem, b.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hops[0].Key != "a.pem" || hops[1].Key != "b.pem" {
+		t.Errorf("expected a key per hop but was %v", hops)
+	}
+	hops, err = ParseJumpHosts("a,b", "shared.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hops[0].Key != "shared.pem" || hops[1].Key != "shared.pem" {
+		t.Errorf("expected the key on every hop but was %v", hops)
+	}
+}
+
+func TestParseJumpHostsErrors(t *testing.T) {
+	tests := [][2]string{
+		{"a,b,c", "a.pem,b.pem"},
+		{"", "a.pem"},
+		{"bastion:ssh", ""},
+		{"bastion:70000", ""},
+		{"[fd00::1", ""},
+		{"ops@", ""},
+	}
+	for _, tt := range tests {
+		if hops, err := ParseJumpHosts(tt[0], tt[1]); err == nil {
+			t.Errorf("expected an error for hosts '%v' keys '%v' but got %v", tt[0], tt[1], hops)
+		}
+	}
+}
+
+func TestProxyCommand(t *testing.T) {
+	single := proxyCommand([]JumpHost{{Host: "bastion", User: "ops", Key: "/keys/b.pem", Port: 2222}}, jumpHostKeyOptions("", true))
+	expected := "ssh -i '/keys/b.pem' -o LogLevel=error -o UserKnownHostsFile=/dev/null -o StrictHostKeyChecking=no -p 2222 -W %h:%p 'ops@bastion'"
+	if single != expected {
+		t.Errorf("expected\n%v\nbut was\n%v", expected, single)
+	}
+
+	chained := proxyCommand([]JumpHost{
+		{Host: "outer", User: "ops", Key: "/keys/outer.pem"},
+		{Host: "inner", User: "dremio", Key: "/keys/inner.pem"},
+	}, jumpHostKeyOptions("/keys/known_hosts", false))
+	// the outer hop tokens are escaped so they reach the ssh that connects to the inner hop, both hops check their host key
+	expected = "ssh -i '/keys/inner.pem' -o LogLevel=error -o StrictHostKeyChecking=yes -o 'UserKnownHostsFile=/keys/known_hosts' " +
+		`-o 'ProxyCommand=ssh -i '\''/keys/outer.pem'\'' -o LogLevel=error -o StrictHostKeyChecking=yes -o '\''UserKnownHostsFile=/keys/known_hosts'\'' -W %%h:%%p '\''ops@outer'\''' ` +
+		"-W %h:%p 'dremio@inner'"
+	if chained != expected {
+		t.Errorf("expected\n%v\nbut was\n%v", expected, chained)
+	}
+}
+
+func TestSSHExecThroughJumpHost(t *testing.T) {
+	cli := &tests.MockCli{
+		StoredResponse: []string{"success"},
+		StoredErrors:   []error{nil},
+	}
+	k := &CmdSSHActions{
+		cli:       cli,
+		sshKey:    "id_rsa",
+		sshUser:   "root",
+		jumpHosts: []JumpHost{{Host: "bastion"}},
+	}
+	if _, err := k.HostExecute(false, "10.0.0.1", false, "ls"); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	// the hop takes --ssh-user and --ssh-key when it has none of its own and its host key is checked against ~/.ssh/known_hosts
+	expectedCall := []string{"ssh", "-i", "id_rsa", "-o", "LogLevel=error", "-o", "UserKnownHostsFile=/dev/null", "-o", "StrictHostKeyChecking=no",
+		"-o", "ProxyCommand=ssh -i 'id_rsa' -o LogLevel=error -o StrictHostKeyChecking=yes -W %h:%p 'root@bastion'",
+		"root@10.0.0.1", "ls"}
+	if !reflect.DeepEqual(cli.Calls[0], expectedCall) {
+		t.Errorf("expected %v call but got %v", expectedCall, cli.Calls[0])
+	}
+}
+
+func TestInventoryJumpHostsOverrideFlags(t *testing.T) {
+	inventory := &Inventory{
+		JumpHosts: []JumpHost{{Host: "inventory-bastion"}},
+		Hosts: []InventoryHost{
+			{Host: "a", Role: RoleCoordinator},
+			{Host: "b", Role: RoleExecutor, JumpHosts: []JumpHost{{Host: "b-bastion", User: "ops", Key: "b.pem"}}},
+		},
+	}
+	flagHops := []JumpHost{{Host: "flag-bastion"}}
+	if hops := settingsFor(inventory, "a", "root", "id_rsa", flagHops).jumpHosts; !reflect.DeepEqual(hops, []JumpHost{{Host: "inventory-bastion", User: "root", Key: "id_rsa"}}) {
+		t.Errorf("expected the inventory jump host but was %v", hops)
+	}
+	if hops := settingsFor(inventory, "b", "root", "id_rsa", flagHops).jumpHosts; !reflect.DeepEqual(hops, []JumpHost{{Host: "b-bastion", User: "ops", Key: "b.pem"}}) {
+		t.Errorf("expected the host jump host but was %v", hops)
+	}
+	if hops := settingsFor(nil, "c", "root", "id_rsa", flagHops).jumpHosts; !reflect.DeepEqual(hops, []JumpHost{{Host: "flag-bastion", User: "root", Key: "id_rsa"}}) {
+		t.Errorf("expected the flag jump host but was %v", hops)
+	}
+}
@@ -0,0 +1,722 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ssh
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dremio/dremio-diagnostic-collector/cmd/root/cli"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/masking"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/simplelog"
+	"github.com/google/uuid"
+	"github.com/pkg/sftp"
+	gossh "golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const (
+	// TransportCLI shells out to the ssh and scp binaries
+	TransportCLI = "cli"
+	// TransportNative uses the in process ssh client and sftp for copies
+	TransportNative = "native"
+	// KeyPassphraseEnv is read before prompting for the passphrase of an encrypted ssh key
+	KeyPassphraseEnv = "DDC_SSH_KEY_PASSPHRASE" // #nosec G101
+)
+
+// NewNativeSSHActions is the only supported way to initialize the NativeSSHActions struct
+func NewNativeSSHActions(sshArgs Args) (*NativeSSHActions, error) {
+	authMethods, err := authMethods(sshArgs.SSHKeyLoc, os.Getenv("SSH_AUTH_SOCK"), passphraseFromEnvOrPrompt)
+	if err != nil {
+		// there is no default key to fall back on but every host brings its own
+		if !sshArgs.Inventory.everyHostHasKey() {
+			return &NativeSSHActions{}, err
+		}
+		simplelog.Debugf("no default ssh key, using the keys from the inventory: %v", err)
+	}
+	var hostKeyCallback gossh.HostKeyCallback
+	if sshArgs.InsecureIgnoreHostKey {
+		simplelog.Warning("host key checking is disabled for ssh, the identity of the remote hosts will not be verified")
+		hostKeyCallback = gossh.InsecureIgnoreHostKey() // #nosec G106
+	} else {
+		hostKeyCallback, err = knownHostsCallback(sshArgs.KnownHostsFile)
+		if err != nil {
+			return &NativeSSHActions{}, err
+		}
+	}
+	return &NativeSSHActions{
+		sshUser:   sshArgs.SSHUser,
+		sshKey:    sshArgs.SSHKeyLoc,
+		port:      22,
+		inventory: sshArgs.Inventory,
+		jumpHosts: sshArgs.JumpHosts,
+		config: &gossh.ClientConfig{
+			User:            sshArgs.SSHUser,
+			Auth:            authMethods,
+			HostKeyCallback: hostKeyCallback,
+			Timeout:         30 * time.Second,
+		},
+		passphrase:  passphraseFromEnvOrPrompt,
+		keyAuth:     make(map[string]*keyAuthMethods),
+		clients:     make(map[string]*nativeConn),
+		jumpClients: make(map[string]*nativeConn),
+	}, nil
+}
+
+// ClientConfigFor returns a func making the client config for any user with the same key and host key
+// checking, it is what the sftp upload connects with
+func ClientConfigFor(keyLoc, knownHostsFile string, insecureIgnoreHostKey bool) func(user string) (*gossh.ClientConfig, error) {
+	return func(user string) (*gossh.ClientConfig, error) {
+		return ClientConfig(user, keyLoc, knownHostsFile, insecureIgnoreHostKey)
+	}
+}
+
+// ClientConfig builds the client config used by the native transport for a single user and key,
+// so other ssh based features such as sftp uploads verify hosts and authenticate the same way
+func ClientConfig(user, keyLoc, knownHostsFile string, insecureIgnoreHostKey bool) (*gossh.ClientConfig, error) {
+	auth, err := authMethods(keyLoc, os.Getenv("SSH_AUTH_SOCK"), passphraseFromEnvOrPrompt)
+	if err != nil {
+		return nil, err
+	}
+	var hostKeyCallback gossh.HostKeyCallback
+	if insecureIgnoreHostKey {
+		simplelog.Warning("host key checking is disabled for ssh, the identity of the remote hosts will not be verified")
+		hostKeyCallback = gossh.InsecureIgnoreHostKey() // #nosec G106
+	} else {
+		hostKeyCallback, err = knownHostsCallback(knownHostsFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &gossh.ClientConfig{
+		User:            user,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         30 * time.Second,
+	}, nil
+}
+
+// NativeSSHActions executes commands and copies files with an in process ssh client instead of the
+// ssh and scp programs. One connection is kept per host and every command or sftp transfer is a new
+// session on that connection
+type NativeSSHActions struct {
+	sshUser   string
+	sshKey    string
+	port      int
+	inventory *Inventory
+	jumpHosts []JumpHost
+	config    *gossh.ClientConfig
+	// passphrase asks for the passphrase of an encrypted inventory key
+	passphrase func(keyLoc string) ([]byte, error)
+	// keyAuth caches the auth methods of inventory keys so each key is only read and decrypted once,
+	// loadMu keeps two passphrase prompts from showing at the same time
+	keyAuth map[string]*keyAuthMethods
+	loadMu  sync.Mutex
+	clients map[string]*nativeConn
+	// jumpClients are keyed by the chain of hops leading to them so hosts behind the same bastion share one connection
+	jumpClients map[string]*nativeConn
+	mu          sync.Mutex
+}
+
+// keyAuthMethods are the auth methods of one key, ready is closed once the key was read and auth and err are set
+type keyAuthMethods struct {
+	ready chan struct{}
+	auth  []gossh.AuthMethod
+	err   error
+}
+
+type nativeConn struct {
+	// ready is closed once the dial finished, client and err are only read after it
+	ready  chan struct{}
+	err    error
+	client *gossh.Client
+	sftp   *sftp.Client
+	mu     sync.Mutex
+}
+
+func (c *NativeSSHActions) Name() string {
+	return "SSH/SFTP (native)"
+}
+
+func (c *NativeSSHActions) HelpText() string {
+	return "no hosts found did you specify a comma separated list for the ssh-hosts? Something like: ddc --coordinator 192.168.1.10,192.168.1.11 --excecutors 192.168.1.14,192.168.1.15"
+}
+
+func (c *NativeSSHActions) FindHosts(searchTerm string) (hosts []string, err error) {
+	return ExpandHosts(searchTerm)
+}
+
+// Close closes every connection opened by the collector. Connections still being dialed are
+// dropped from the maps and closed by their dial when it returns
+func (c *NativeSSHActions) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var errs []error
+	for host, conn := range c.clients {
+		delete(c.clients, host)
+		if conn.client == nil {
+			continue
+		}
+		if conn.sftp != nil {
+			if err := conn.sftp.Close(); err != nil {
+				simplelog.Debugf("host %v closing sftp client failed: %v", host, err)
+			}
+		}
+		if err := conn.client.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("host %v: %w", host, err))
+		}
+	}
+	// the hosts are closed first since their connections are tunneled through the jump hosts,
+	// then the jump hosts from the last hop back to the first
+	chains := make([]string, 0, len(c.jumpClients))
+	for chain := range c.jumpClients {
+		chains = append(chains, chain)
+	}
+	sort.Slice(chains, func(i, j int) bool {
+		return strings.Count(chains[i], chainSeparator) > strings.Count(chains[j], chainSeparator)
+	})
+	for _, chain := range chains {
+		conn := c.jumpClients[chain]
+		delete(c.jumpClients, chain)
+		if conn.client == nil {
+			continue
+		}
+		if err := conn.client.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("jump host %v: %w", chain, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (c *NativeSSHActions) conn(hostName string) (*nativeConn, error) {
+	return c.once(c.clients, hostName, func() (*gossh.Client, error) {
+		settings := settingsFor(c.inventory, hostName, c.sshUser, c.sshKey, c.jumpHosts)
+		config, err := c.configFor(settings.user, settings.key)
+		if err != nil {
+			return nil, fmt.Errorf("host %v: %w", hostName, err)
+		}
+		addr := c.addr(hostName, settings.port)
+		simplelog.Infof("opening ssh connection to %v as %v", addr, settings.user)
+		client, err := c.dial(addr, config, settings.jumpHosts)
+		if err != nil {
+			return nil, fmt.Errorf("unable to connect to %v: %w", addr, err)
+		}
+		return client, nil
+	})
+}
+
+// once returns the connection kept under key in conns. The first caller dials it while later callers
+// wait for that dial, only the map is touched under c.mu so a host that never answers does not hold up
+// the connections to the other hosts or Close. A failed dial is not kept so the next caller tries again
+func (c *NativeSSHActions) once(conns map[string]*nativeConn, key string, dial func() (*gossh.Client, error)) (*nativeConn, error) {
+	c.mu.Lock()
+	conn, ok := conns[key]
+	if !ok {
+		conn = &nativeConn{ready: make(chan struct{})}
+		conns[key] = conn
+	}
+	c.mu.Unlock()
+	if ok {
+		<-conn.ready
+		if conn.err != nil {
+			return nil, conn.err
+		}
+		return conn, nil
+	}
+	client, err := dial()
+	c.mu.Lock()
+	if err != nil {
+		delete(conns, key)
+	} else if conns[key] != conn {
+		// Close ran while dialing
+		_ = client.Close()
+		client = nil
+		err = fmt.Errorf("connection to %v was closed while it was being opened", key)
+	}
+	conn.client = client
+	conn.err = err
+	c.mu.Unlock()
+	close(conn.ready)
+	if err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+func (c *NativeSSHActions) addr(hostName string, port int) string {
+	if port == 0 {
+		port = c.port
+	}
+	return net.JoinHostPort(hostName, strconv.Itoa(port))
+}
+
+// dial connects to addr directly or through the jump hosts, both the tcp connect and the ssh handshake
+// are bounded by the config timeout
+func (c *NativeSSHActions) dial(addr string, config *gossh.ClientConfig, hops []JumpHost) (*gossh.Client, error) {
+	if len(hops) == 0 {
+		conn, err := net.DialTimeout("tcp", addr, config.Timeout)
+		if err != nil {
+			return nil, err
+		}
+		return handshake(conn, addr, config)
+	}
+	jump, err := c.jumpClient(hops)
+	if err != nil {
+		return nil, err
+	}
+	tunnel, err := dialTunnel(jump, addr, config.Timeout)
+	if err != nil {
+		return nil, fmt.Errorf("unable to reach %v through jump host %v: %w", addr, hops[len(hops)-1], err)
+	}
+	return handshake(tunnel, addr, config)
+}
+
+// handshake runs the ssh handshake over conn and closes conn when it fails or does not finish within
+// the config timeout
+func handshake(conn net.Conn, addr string, config *gossh.ClientConfig) (*gossh.Client, error) {
+	var timer *time.Timer
+	if config.Timeout > 0 {
+		if err := conn.SetDeadline(time.Now().Add(config.Timeout)); err != nil {
+			// connections tunneled through a jump host do not support deadlines so they are closed instead
+			timer = time.AfterFunc(config.Timeout, func() { _ = conn.Close() })
+		}
+	}
+	sshConn, chans, reqs, err := gossh.NewClientConn(conn, addr, config)
+	if timer != nil && !timer.Stop() && err == nil {
+		// the timer fired just as the handshake finished, the connection is already closed
+		_ = sshConn.Close()
+		err = errors.New("connection closed")
+	}
+	if err != nil {
+		_ = conn.Close()
+		if config.Timeout > 0 {
+			return nil, fmt.Errorf("ssh handshake did not complete within %v: %w", config.Timeout, err)
+		}
+		return nil, err
+	}
+	if timer == nil && config.Timeout > 0 {
+		if err := conn.SetDeadline(time.Time{}); err != nil {
+			_ = sshConn.Close()
+			return nil, fmt.Errorf("unable to clear the handshake deadline: %w", err)
+		}
+	}
+	return gossh.NewClient(sshConn, chans, reqs), nil
+}
+
+// dialTunnel opens a connection to addr through the jump host, giving up after the timeout when the
+// jump host does not answer
+func dialTunnel(jump *gossh.Client, addr string, timeout time.Duration) (net.Conn, error) {
+	if timeout <= 0 {
+		return jump.Dial("tcp", addr)
+	}
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		conn, err := jump.Dial("tcp", addr)
+		done <- result{conn: conn, err: err}
+	}()
+	select {
+	case r := <-done:
+		return r.conn, r.err
+	case <-time.After(timeout):
+		// the dial may still succeed later, close the connection nobody is waiting for
+		go func() {
+			if r := <-done; r.conn != nil {
+				_ = r.conn.Close()
+			}
+		}()
+		return nil, fmt.Errorf("jump host did not open the tunnel within %v", timeout)
+	}
+}
+
+const chainSeparator = " -> "
+
+// jumpClient returns the connection to the last hop, connecting to the hops before it first when needed
+func (c *NativeSSHActions) jumpClient(hops []JumpHost) (*gossh.Client, error) {
+	var names []string
+	for _, hop := range hops {
+		names = append(names, hop.String()+" ("+hop.Key+")")
+	}
+	chain := strings.Join(names, chainSeparator)
+	conn, err := c.once(c.jumpClients, chain, func() (*gossh.Client, error) {
+		last := hops[len(hops)-1]
+		config, err := c.configFor(last.User, last.Key)
+		if err != nil {
+			return nil, fmt.Errorf("jump host %v: %w", last, err)
+		}
+		addr := c.addr(last.Host, last.Port)
+		simplelog.Infof("opening ssh connection to jump host %v as %v", addr, last.User)
+		client, err := c.dial(addr, config, hops[:len(hops)-1])
+		if err != nil {
+			return nil, fmt.Errorf("unable to connect to jump host %v: %w", addr, err)
+		}
+		return client, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return conn.client, nil
+}
+
+// configFor returns the client config for the user and key
+func (c *NativeSSHActions) configFor(user, key string) (*gossh.ClientConfig, error) {
+	if user == c.config.User && key == c.sshKey {
+		return c.config, nil
+	}
+	config := *c.config
+	config.User = user
+	if key != c.sshKey {
+		auth, err := c.authFor(key)
+		if err != nil {
+			return nil, err
+		}
+		config.Auth = auth
+	}
+	return &config, nil
+}
+
+// authFor returns the auth methods of key. Like once the first caller reads and decrypts the key while
+// later callers wait for it, c.mu is only held to look up the cache so a passphrase prompt does not hold
+// up the other hosts or Close. A key that failed to load is not kept so the next caller tries again
+func (c *NativeSSHActions) authFor(key string) ([]gossh.AuthMethod, error) {
+	c.mu.Lock()
+	methods, ok := c.keyAuth[key]
+	if !ok {
+		methods = &keyAuthMethods{ready: make(chan struct{})}
+		c.keyAuth[key] = methods
+	}
+	c.mu.Unlock()
+	if ok {
+		<-methods.ready
+		return methods.auth, methods.err
+	}
+	c.loadMu.Lock()
+	auth, err := authMethods(key, os.Getenv("SSH_AUTH_SOCK"), c.passphrase)
+	c.loadMu.Unlock()
+	if err != nil {
+		c.mu.Lock()
+		delete(c.keyAuth, key)
+		c.mu.Unlock()
+	}
+	methods.auth = auth
+	methods.err = err
+	close(methods.ready)
+	return auth, err
+}
+
+func (c *NativeSSHActions) sftpClient(hostName string) (*sftp.Client, error) {
+	conn, err := c.conn(hostName)
+	if err != nil {
+		return nil, err
+	}
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	if conn.sftp != nil {
+		return conn.sftp, nil
+	}
+	client, err := sftp.NewClient(conn.client)
+	if err != nil {
+		return nil, fmt.Errorf("unable to start sftp on host %v: %w", hostName, err)
+	}
+	conn.sftp = client
+	return client, nil
+}
+
+func (c *NativeSSHActions) HostExecute(mask bool, hostName string, _ bool, args ...string) (string, error) {
+	return c.run(mask, hostName, strings.Join(args, " "))
+}
+
+func (c *NativeSSHActions) HostExecuteSudo(mask bool, hostName string, sudoUser string, args ...string) (string, error) {
+	return c.run(mask, hostName, fmt.Sprintf("sudo -u %v %v", sudoUser, strings.Join(args, " ")))
+}
+
+func (c *NativeSSHActions) run(mask bool, hostName, command string) (string, error) {
+	logCommand(mask, hostName, command)
+	conn, err := c.conn(hostName)
+	if err != nil {
+		return "", err
+	}
+	session, err := conn.client.NewSession()
+	if err != nil {
+		return "", fmt.Errorf("unable to open ssh session on host %v: %w", hostName, err)
+	}
+	defer session.Close()
+	out, err := session.CombinedOutput(command)
+	if err != nil {
+		return string(out), cli.UnableToStartErr{Err: err, Cmd: maskedCommand(mask, command)}
+	}
+	return string(out), nil
+}
+
+func (c *NativeSSHActions) HostExecuteAndStream(mask bool, hostName string, output cli.OutputHandler, _ bool, args ...string) error {
+	command := strings.Join(args, " ")
+	logCommand(mask, hostName, command)
+	conn, err := c.conn(hostName)
+	if err != nil {
+		return err
+	}
+	session, err := conn.client.NewSession()
+	if err != nil {
+		return fmt.Errorf("unable to open ssh session on host %v: %w", hostName, err)
+	}
+	defer session.Close()
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return cli.UnableToStartErr{Err: err, Cmd: maskedCommand(mask, command)}
+	}
+	stderr, err := session.StderrPipe()
+	if err != nil {
+		return cli.UnableToStartErr{Err: err, Cmd: maskedCommand(mask, command)}
+	}
+	if err := session.Start(command); err != nil {
+		return cli.UnableToStartErr{Err: err, Cmd: maskedCommand(mask, command)}
+	}
+	var outputMu sync.Mutex
+	var wg sync.WaitGroup
+	wg.Add(2)
+	scan := func(r io.Reader) {
+		defer wg.Done()
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			outputMu.Lock()
+			output(scanner.Text())
+			outputMu.Unlock()
+		}
+	}
+	go scan(stdout)
+	go scan(stderr)
+	wg.Wait()
+	if err := session.Wait(); err != nil {
+		return cli.UnableToStartErr{Err: err, Cmd: maskedCommand(mask, command)}
+	}
+	return nil
+}
+
+func (c *NativeSSHActions) CopyFromHost(hostName string, _ bool, source, destination string) (string, error) {
+	simplelog.Infof("sftp copy from %v:%v to %v", hostName, source, destination)
+	client, err := c.sftpClient(hostName)
+	if err != nil {
+		return "", err
+	}
+	remote, err := client.Open(source)
+	if err != nil {
+		return "", fmt.Errorf("unable to open %v on host %v: %w", source, hostName, err)
+	}
+	defer remote.Close()
+	local, err := os.Create(filepath.Clean(destination))
+	if err != nil {
+		return "", fmt.Errorf("unable to create %v: %w", destination, err)
+	}
+	written, err := remote.WriteTo(local)
+	if err != nil {
+		_ = local.Close()
+		return "", fmt.Errorf("unable to copy %v from host %v: %w", source, hostName, err)
+	}
+	if err := local.Close(); err != nil {
+		return "", fmt.Errorf("unable to close %v: %w", destination, err)
+	}
+	return fmt.Sprintf("copied %v bytes", written), nil
+}
+
+func (c *NativeSSHActions) CopyToHost(hostName string, _ bool, source, destination string) (string, error) {
+	simplelog.Infof("sftp copy from %v to %v:%v", source, hostName, destination)
+	client, err := c.sftpClient(hostName)
+	if err != nil {
+		return "", err
+	}
+	local, err := os.Open(filepath.Clean(source))
+	if err != nil {
+		return "", fmt.Errorf("unable to open %v: %w", source, err)
+	}
+	defer local.Close()
+	remote, err := client.Create(destination)
+	if err != nil {
+		return "", fmt.Errorf("unable to create %v on host %v: %w", destination, hostName, err)
+	}
+	written, err := remote.ReadFrom(local)
+	if err != nil {
+		_ = remote.Close()
+		return "", fmt.Errorf("unable to copy %v to host %v: %w", source, hostName, err)
+	}
+	if err := remote.Close(); err != nil {
+		return "", fmt.Errorf("unable to close %v on host %v: %w", destination, hostName, err)
+	}
+	return fmt.Sprintf("copied %v bytes", written), nil
+}
+
+func (c *NativeSSHActions) CopyFromHostSudo(hostName string, _ bool, sudoUser, source, destination string) (string, error) {
+	// create a tmp dir for sftp
+	tmpDir := path.Join("/tmp/", "ddc-sftp-"+uuid.New().String())
+	out, err := c.HostExecute(false, hostName, false, "mkdir", "-p", tmpDir)
+	if err != nil {
+		return out, err
+	}
+	defer func() {
+		if _, err := c.HostExecute(false, hostName, false, "rm", "-rf", tmpDir); err != nil {
+			simplelog.Errorf("host %v unable to remove tmp dir %v", hostName, tmpDir)
+		}
+	}()
+	// the tmp dir is owned by the ssh user so let the sudo user write into it
+	out, err = c.HostExecute(false, hostName, false, "chmod", "777", tmpDir)
+	if err != nil {
+		return out, err
+	}
+	tmpFilePath := path.Join(tmpDir, path.Base(source))
+	out, err = c.HostExecuteSudo(false, hostName, sudoUser, "cp", source, tmpFilePath)
+	if err != nil {
+		return out, err
+	}
+	// next copy from tmp dir as non-sudo
+	return c.CopyFromHost(hostName, false, tmpFilePath, destination)
+}
+
+func (c *NativeSSHActions) CopyToHostSudo(hostName string, _ bool, sudoUser, source, destination string) (string, error) {
+	// create a tmp dir for sftp
+	tmpDir := path.Join("/tmp/", "ddc-sftp-"+uuid.New().String())
+	out, err := c.HostExecute(false, hostName, false, "mkdir", "-p", tmpDir)
+	if err != nil {
+		return out, err
+	}
+	defer func() {
+		if _, err := c.HostExecute(false, hostName, false, "rm", "-rf", tmpDir); err != nil {
+			simplelog.Errorf("host %v unable to remove tmp dir %v", hostName, tmpDir)
+		}
+	}()
+	tmpFilePath := path.Join(tmpDir, filepath.Base(source))
+	// first copy to tmp dir as non-sudo
+	out, err = c.CopyToHost(hostName, false, source, tmpFilePath)
+	if err != nil {
+		return out, err
+	}
+	// chmod dir for sudo user to be able to read it even if the two users cannot
+	out, err = c.HostExecute(false, hostName, false, "chmod", "777", "-R", tmpDir)
+	if err != nil {
+		return out, err
+	}
+	// next move from tmp dir to destination as sudo
+	return c.HostExecuteSudo(false, hostName, sudoUser, "cp", tmpFilePath, destination)
+}
+
+func logCommand(mask bool, hostName, command string) {
+	simplelog.Infof("host %v args: %v", hostName, maskedCommand(mask, command))
+}
+
+func maskedCommand(mask bool, command string) string {
+	if mask {
+		return masking.MaskPAT(command)
+	}
+	return command
+}
+
+// authMethods builds the public key auth from the ssh-agent (when available) and the private key file.
+// Encrypted keys ask for their passphrase through the passphrase function
+func authMethods(keyLoc, agentSock string, passphrase func(keyLoc string) ([]byte, error)) ([]gossh.AuthMethod, error) {
+	var signers []gossh.Signer
+	if agentSock != "" {
+		agentConn, err := net.Dial("unix", agentSock)
+		if err != nil {
+			simplelog.Warningf("unable to connect to ssh-agent at %v, skipping agent auth: %v", agentSock, err)
+		} else {
+			agentSigners, err := agent.NewClient(agentConn).Signers()
+			if err != nil {
+				simplelog.Warningf("unable to list ssh-agent keys, skipping agent auth: %v", err)
+			} else {
+				simplelog.Infof("using %v key(s) from ssh-agent", len(agentSigners))
+				signers = append(signers, agentSigners...)
+			}
+		}
+	}
+	if keyLoc != "" {
+		signer, err := loadKey(keyLoc, passphrase)
+		if err != nil {
+			// the agent may still have a valid key so only fail when there is nothing else to try
+			if len(signers) == 0 {
+				return nil, err
+			}
+			simplelog.Warningf("unable to use ssh key %v, continuing with ssh-agent keys only: %v", keyLoc, err)
+		} else {
+			signers = append(signers, signer)
+		}
+	}
+	if len(signers) == 0 {
+		return nil, errors.New("no ssh keys available, pass --ssh-key or start an ssh-agent with SSH_AUTH_SOCK set")
+	}
+	return []gossh.AuthMethod{gossh.PublicKeys(signers...)}, nil
+}
+
+func loadKey(keyLoc string, passphrase func(keyLoc string) ([]byte, error)) (gossh.Signer, error) {
+	pemBytes, err := os.ReadFile(filepath.Clean(keyLoc))
+	if err != nil {
+		return nil, fmt.Errorf("unable to read ssh key %v: %w", keyLoc, err)
+	}
+	signer, err := gossh.ParsePrivateKey(pemBytes)
+	if err == nil {
+		return signer, nil
+	}
+	var missingErr *gossh.PassphraseMissingError
+	if !errors.As(err, &missingErr) {
+		return nil, fmt.Errorf("unable to parse ssh key %v: %w", keyLoc, err)
+	}
+	pass, err := passphrase(keyLoc)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get passphrase for ssh key %v: %w", keyLoc, err)
+	}
+	signer, err = gossh.ParsePrivateKeyWithPassphrase(pemBytes, pass)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decrypt ssh key %v: %w", keyLoc, err)
+	}
+	return signer, nil
+}
+
+func passphraseFromEnvOrPrompt(keyLoc string) ([]byte, error) {
+	if pass := os.Getenv(KeyPassphraseEnv); pass != "" {
+		return []byte(pass), nil
+	}
+	pass, err := masking.PromptForSecret(fmt.Sprintf("Enter passphrase for ssh key %v", keyLoc))
+	if err != nil {
+		return nil, err
+	}
+	return []byte(pass), nil
+}
+
+func knownHostsCallback(knownHostsFile string) (gossh.HostKeyCallback, error) {
+	if knownHostsFile == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("unable to find home dir for known_hosts: %w", err)
+		}
+		knownHostsFile = filepath.Join(home, ".ssh", "known_hosts")
+	}
+	callback, err := knownhosts.New(knownHostsFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read known hosts file %v, add the hosts with ssh-keyscan or pass --ssh-known-hosts: %w", knownHostsFile, err)
+	}
+	return callback, nil
+}
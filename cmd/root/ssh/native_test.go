@@ -0,0 +1,478 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ssh
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/sftp"
+	gossh "golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// testSSHServer is a minimal ssh server supporting exec and the sftp subsystem
+type testSSHServer struct {
+	listener    net.Listener
+	hostKey     gossh.Signer
+	port        int
+	connections int32
+	forwards    int32
+}
+
+func newTestSSHServer(t *testing.T, clientKey gossh.PublicKey) *testSSHServer {
+	t.Helper()
+	_, hostPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostKey, err := gossh.NewSignerFromKey(hostPriv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &gossh.ServerConfig{
+		PublicKeyCallback: func(_ gossh.ConnMetadata, key gossh.PublicKey) (*gossh.Permissions, error) {
+			if string(key.Marshal()) == string(clientKey.Marshal()) {
+				return nil, nil
+			}
+			return nil, errors.New("unknown key")
+		},
+	}
+	config.AddHostKey(hostKey)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &testSSHServer{
+		listener: listener,
+		hostKey:  hostKey,
+		port:     listener.Addr().(*net.TCPAddr).Port,
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			nConn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(&s.connections, 1)
+			go s.handle(nConn, config)
+		}
+	}()
+	return s
+}
+
+func (s *testSSHServer) handle(nConn net.Conn, config *gossh.ServerConfig) {
+	_, chans, reqs, err := gossh.NewServerConn(nConn, config)
+	if err != nil {
+		return
+	}
+	go gossh.DiscardRequests(reqs)
+	for newChannel := range chans {
+		if newChannel.ChannelType() == "direct-tcpip" {
+			go s.forward(newChannel)
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+		go func(channel gossh.Channel, requests <-chan *gossh.Request) {
+			defer channel.Close()
+			for req := range requests {
+				switch req.Type {
+				case "exec":
+					length := binary.BigEndian.Uint32(req.Payload[:4])
+					command := string(req.Payload[4 : 4+length])
+					_ = req.Reply(true, nil)
+					cmd := exec.Command("sh", "-c", command)
+					cmd.Stdout = channel
+					cmd.Stderr = channel.Stderr()
+					status := uint32(0)
+					if err := cmd.Run(); err != nil {
+						status = 1
+					}
+					_, _ = channel.SendRequest("exit-status", false, gossh.Marshal(struct{ Status uint32 }{status}))
+					return
+				case "subsystem":
+					_ = req.Reply(true, nil)
+					server, err := sftp.NewServer(channel)
+					if err != nil {
+						return
+					}
+					_ = server.Serve()
+					return
+				default:
+					_ = req.Reply(false, nil)
+				}
+			}
+		}(channel, requests)
+	}
+}
+
+// forward serves a jump host tunnel the way ssh -W and ProxyJump use it
+func (s *testSSHServer) forward(newChannel gossh.NewChannel) {
+	var target struct {
+		Host       string
+		Port       uint32
+		OriginHost string
+		OriginPort uint32
+	}
+	if err := gossh.Unmarshal(newChannel.ExtraData(), &target); err != nil {
+		_ = newChannel.Reject(gossh.ConnectionFailed, err.Error())
+		return
+	}
+	conn, err := net.Dial("tcp", net.JoinHostPort(target.Host, strconv.Itoa(int(target.Port))))
+	if err != nil {
+		_ = newChannel.Reject(gossh.ConnectionFailed, err.Error())
+		return
+	}
+	channel, requests, err := newChannel.Accept()
+	if err != nil {
+		conn.Close()
+		return
+	}
+	atomic.AddInt32(&s.forwards, 1)
+	go gossh.DiscardRequests(requests)
+	go func() {
+		_, _ = io.Copy(conn, channel)
+		conn.Close()
+	}()
+	_, _ = io.Copy(channel, conn)
+	channel.Close()
+}
+
+func writeClientKey(t *testing.T, passphrase string) (string, gossh.PublicKey) {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var block *pem.Block
+	if passphrase == "" {
+		block, err = gossh.MarshalPrivateKey(priv, "")
+	} else {
+		block, err = gossh.MarshalPrivateKeyWithPassphrase(priv, "", []byte(passphrase))
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(t.TempDir(), "id_ed25519")
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatal(err)
+	}
+	pub, err := gossh.NewPublicKey(priv.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keyFile, pub
+}
+
+func writeKnownHosts(t *testing.T, port int, key gossh.PublicKey) string {
+	t.Helper()
+	knownHostsFile := filepath.Join(t.TempDir(), "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.Normalize(net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))}, key)
+	if err := os.WriteFile(knownHostsFile, []byte(line+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return knownHostsFile
+}
+
+func newTestNativeActions(t *testing.T, keyFile, knownHostsFile string, port int) *NativeSSHActions {
+	t.Helper()
+	auth, err := authMethods(keyFile, "", func(string) ([]byte, error) { return nil, errors.New("no passphrase expected") })
+	if err != nil {
+		t.Fatal(err)
+	}
+	callback, err := knownHostsCallback(knownHostsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &NativeSSHActions{
+		sshUser: "dremio",
+		port:    port,
+		config: &gossh.ClientConfig{
+			User:            "dremio",
+			Auth:            auth,
+			HostKeyCallback: callback,
+		},
+		passphrase:  passphraseFromEnvOrPrompt,
+		keyAuth:     make(map[string]*keyAuthMethods),
+		clients:     make(map[string]*nativeConn),
+		jumpClients: make(map[string]*nativeConn),
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestNativeHostExecuteReusesConnection(t *testing.T) {
+	keyFile, pub := writeClientKey(t, "")
+	server := newTestSSHServer(t, pub)
+	c := newTestNativeActions(t, keyFile, writeKnownHosts(t, server.port, server.hostKey.PublicKey()), server.port)
+
+	out, err := c.HostExecute(false, "127.0.0.1", false, "echo", "hello")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if out != "hello\n" {
+		t.Errorf("expected 'hello' but got %q", out)
+	}
+	if _, err := c.HostExecute(false, "127.0.0.1", false, "true"); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if connections := atomic.LoadInt32(&server.connections); connections != 1 {
+		t.Errorf("expected 1 connection but got %v", connections)
+	}
+	if _, err := c.HostExecute(false, "127.0.0.1", false, "false"); err == nil {
+		t.Error("expected an error for a failing command")
+	}
+}
+
+func TestNativeHostExecuteAndStream(t *testing.T) {
+	keyFile, pub := writeClientKey(t, "")
+	server := newTestSSHServer(t, pub)
+	c := newTestNativeActions(t, keyFile, writeKnownHosts(t, server.port, server.hostKey.PublicKey()), server.port)
+
+	var mu sync.Mutex
+	var lines []string
+	err := c.HostExecuteAndStream(false, "127.0.0.1", func(line string) {
+		mu.Lock()
+		defer mu.Unlock()
+		lines = append(lines, line)
+	}, false, "echo", "out;", "echo", "err", "1>&2")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	joined := strings.Join(lines, ",")
+	if !strings.Contains(joined, "out") || !strings.Contains(joined, "err") {
+		t.Errorf("expected stdout and stderr lines but got %v", lines)
+	}
+}
+
+func TestNativeCopyToAndFromHost(t *testing.T) {
+	keyFile, pub := writeClientKey(t, "")
+	server := newTestSSHServer(t, pub)
+	c := newTestNativeActions(t, keyFile, writeKnownHosts(t, server.port, server.hostKey.PublicKey()), server.port)
+
+	tmpDir := t.TempDir()
+	source := filepath.Join(tmpDir, "source.txt")
+	if err := os.WriteFile(source, []byte("my row"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	remote := filepath.Join(tmpDir, "remote.txt")
+	if _, err := c.CopyToHost("127.0.0.1", false, source, remote); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	back := filepath.Join(tmpDir, "back.txt")
+	if _, err := c.CopyFromHost("127.0.0.1", false, remote, back); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	b, err := os.ReadFile(back)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "my row" {
+		t.Errorf("expected 'my row' but got %q", string(b))
+	}
+}
+
+func TestNativeRejectsUnknownHostKey(t *testing.T) {
+	keyFile, pub := writeClientKey(t, "")
+	server := newTestSSHServer(t, pub)
+	_, otherKey := writeClientKey(t, "")
+	c := newTestNativeActions(t, keyFile, writeKnownHosts(t, server.port, otherKey), server.port)
+
+	if _, err := c.HostExecute(false, "127.0.0.1", false, "true"); err == nil {
+		t.Error("expected the connection to fail on a mismatched host key")
+	}
+}
+
+func TestLoadEncryptedKey(t *testing.T) {
+	keyFile, pub := writeClientKey(t, "secret")
+	signer, err := loadKey(keyFile, func(string) ([]byte, error) { return []byte("secret"), nil })
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if string(signer.PublicKey().Marshal()) != string(pub.Marshal()) {
+		t.Error("decrypted key does not match")
+	}
+	if _, err := loadKey(keyFile, func(string) ([]byte, error) { return []byte("wrong"), nil }); err == nil {
+		t.Error("expected an error with the wrong passphrase")
+	}
+}
+
+func TestNativeThroughJumpHosts(t *testing.T) {
+	keyFile, pub := writeClientKey(t, "")
+	bastionKeyFile, bastionPub := writeClientKey(t, "")
+	target := newTestSSHServer(t, pub)
+	bastion := newTestSSHServer(t, bastionPub)
+	knownHosts := filepath.Join(t.TempDir(), "known_hosts")
+	var lines []string
+	for _, server := range []*testSSHServer{target, bastion} {
+		lines = append(lines, knownhosts.Line([]string{knownhosts.Normalize(net.JoinHostPort("127.0.0.1", strconv.Itoa(server.port)))}, server.hostKey.PublicKey()))
+	}
+	if err := os.WriteFile(knownHosts, []byte(strings.Join(lines, "\n")+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	c := newTestNativeActions(t, keyFile, knownHosts, target.port)
+	// the bastion only accepts its own key so this also checks each hop uses its own credentials
+	c.jumpHosts = withDefaults([]JumpHost{{Host: "127.0.0.1", Port: bastion.port, Key: bastionKeyFile}}, "dremio", keyFile)
+
+	out, err := c.HostExecute(false, "127.0.0.1", false, "echo", "hello")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if out != "hello\n" {
+		t.Errorf("expected 'hello' but got %q", out)
+	}
+	if forwards := atomic.LoadInt32(&bastion.forwards); forwards != 1 {
+		t.Errorf("expected the connection to go through the bastion but it forwarded %v", forwards)
+	}
+	if err := c.Close(); err != nil {
+		t.Errorf("unexpected error closing %v", err)
+	}
+	if len(c.jumpClients) != 0 {
+		t.Errorf("expected the jump host connection to be closed")
+	}
+}
+
+func TestNativeHostThatNeverAnswersDoesNotBlockOthers(t *testing.T) {
+	keyFile, pub := writeClientKey(t, "")
+	server := newTestSSHServer(t, pub)
+	// accepts the tcp connection but never sends the ssh version or anything else
+	silent, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { silent.Close() })
+	go func() {
+		var conns []net.Conn
+		for {
+			conn, err := silent.Accept()
+			if err != nil {
+				for _, conn := range conns {
+					conn.Close()
+				}
+				return
+			}
+			conns = append(conns, conn)
+		}
+	}()
+	c := newTestNativeActions(t, keyFile, writeKnownHosts(t, server.port, server.hostKey.PublicKey()), server.port)
+	c.config.Timeout = 2 * time.Second
+	c.inventory = &Inventory{Hosts: []InventoryHost{{Host: "localhost", Port: silent.Addr().(*net.TCPAddr).Port}}}
+
+	silentErr := make(chan error, 1)
+	go func() {
+		_, err := c.HostExecute(false, "localhost", false, "true")
+		silentErr <- err
+	}()
+	// give the silent host time to start its handshake
+	time.Sleep(100 * time.Millisecond)
+	start := time.Now()
+	out, err := c.HostExecute(false, "127.0.0.1", false, "echo", "hello")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if out != "hello\n" {
+		t.Errorf("expected 'hello' but got %q", out)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected the responsive host to connect without waiting on the silent one but it took %v", elapsed)
+	}
+	select {
+	case err := <-silentErr:
+		if err == nil {
+			t.Error("expected the silent host to fail")
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("expected the handshake with the silent host to time out")
+	}
+	closed := make(chan error, 1)
+	go func() { closed <- c.Close() }()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("expected Close to return")
+	}
+}
+
+func TestConfigForAsksForThePassphraseOutsideTheLock(t *testing.T) {
+	t.Setenv("SSH_AUTH_SOCK", "")
+	keyFile, _ := writeClientKey(t, "secret")
+	prompted := make(chan struct{})
+	answer := make(chan struct{})
+	var prompts int32
+	c := &NativeSSHActions{
+		sshKey: "id_rsa",
+		config: &gossh.ClientConfig{User: "dremio"},
+		passphrase: func(string) ([]byte, error) {
+			if atomic.AddInt32(&prompts, 1) == 1 {
+				close(prompted)
+			}
+			<-answer
+			return []byte("secret"), nil
+		},
+		keyAuth:     make(map[string]*keyAuthMethods),
+		clients:     make(map[string]*nativeConn),
+		jumpClients: make(map[string]*nativeConn),
+	}
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			config, err := c.configFor("ops", keyFile)
+			if err == nil && (config.User != "ops" || len(config.Auth) != 1) {
+				err = fmt.Errorf("unexpected config for user %v with %v auth methods", config.User, len(config.Auth))
+			}
+			errs <- err
+		}()
+	}
+	<-prompted
+	// the other hosts and Close can take the lock while the passphrase is typed
+	locked := false
+	for deadline := time.Now().Add(time.Second); !locked && time.Now().Before(deadline); {
+		if locked = c.mu.TryLock(); !locked {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	if !locked {
+		t.Fatal("expected the lock to be free while asking for the passphrase")
+	}
+	c.mu.Unlock()
+	close(answer)
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+	if prompts != 1 {
+		t.Errorf("expected the passphrase to be asked for once but was %v times", prompts)
+	}
+}
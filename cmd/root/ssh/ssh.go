@@ -12,7 +12,8 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-// ssh package uses ssh and scp binaries to execute commands remotely and translate the results back to the calling node
+// ssh package executes commands on remote hosts and copies files to and from them over ssh, either with the ssh
+// and scp binaries or with a built in client using sftp for the copies
 package ssh
 
 import (
@@ -20,6 +21,7 @@ import (
 	"fmt"
 	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/dremio/dremio-diagnostic-collector/cmd/root/cli"
@@ -28,15 +30,30 @@ import (
 )
 
 type Args struct {
-	SSHKeyLoc string
-	SSHUser   string
+	SSHKeyLoc             string
+	SSHUser               string
+	Transport             string
+	KnownHostsFile        string
+	InsecureIgnoreHostKey bool
+	// InventoryFile is the --hosts-inventory file, Inventory is set once it has been loaded
+	InventoryFile string
+	Inventory     *Inventory
+	// JumpHostsStr and JumpKeysStr are the --ssh-jump-host and --ssh-jump-key flags, JumpHosts is set once they are parsed
+	JumpHostsStr string
+	JumpKeysStr  string
+	JumpHosts    []JumpHost
 }
 
 func NewCmdSSHActions(sshArgs Args) *CmdSSHActions {
 	return &CmdSSHActions{
-		cli:     &cli.Cli{},
-		sshKey:  sshArgs.SSHKeyLoc,
-		sshUser: sshArgs.SSHUser,
+		cli:       &cli.Cli{},
+		sshKey:    sshArgs.SSHKeyLoc,
+		sshUser:   sshArgs.SSHUser,
+		inventory: sshArgs.Inventory,
+		jumpHosts: sshArgs.JumpHosts,
+
+		jumpKnownHosts:       sshArgs.KnownHostsFile,
+		insecureJumpHostKeys: sshArgs.InsecureIgnoreHostKey,
 	}
 }
 
@@ -44,9 +61,83 @@ func NewCmdSSHActions(sshArgs Args) *CmdSSHActions {
 // then assumes ssh public key auth is in place since it has no support for using
 // password based authentication
 type CmdSSHActions struct {
-	cli     cli.CmdExecutor
-	sshKey  string
-	sshUser string
+	cli       cli.CmdExecutor
+	sshKey    string
+	sshUser   string
+	inventory *Inventory
+	jumpHosts []JumpHost
+	// jumpKnownHosts and insecureJumpHostKeys decide how the host keys of the jump hosts are checked
+	jumpKnownHosts       string
+	insecureJumpHostKeys bool
+}
+
+// hostSettings is the user, key, port and jump hosts to use for a host, the inventory entry wins over the command line flags
+type hostSettings struct {
+	user      string
+	key       string
+	port      int
+	jumpHosts []JumpHost
+}
+
+func settingsFor(inventory *Inventory, hostName, defaultUser, defaultKey string, defaultJumpHosts []JumpHost) hostSettings {
+	settings := hostSettings{user: defaultUser, key: defaultKey}
+	jumpHosts := defaultJumpHosts
+	if inventory != nil && len(inventory.JumpHosts) > 0 {
+		jumpHosts = inventory.JumpHosts
+	}
+	if h, ok := inventory.Host(hostName); ok {
+		if h.User != "" {
+			settings.user = h.User
+		}
+		if h.Key != "" {
+			settings.key = h.Key
+		}
+		settings.port = h.Port
+		if len(h.JumpHosts) > 0 {
+			jumpHosts = h.JumpHosts
+		}
+	}
+	settings.jumpHosts = withDefaults(jumpHosts, defaultUser, defaultKey)
+	return settings
+}
+
+func (c *CmdSSHActions) settings(hostName string) hostSettings {
+	return settingsFor(c.inventory, hostName, c.sshUser, c.sshKey, c.jumpHosts)
+}
+
+// connectOptions are the ssh options shared by ssh and scp, the port flag differs between them
+func (c *CmdSSHActions) connectOptions(settings hostSettings, portFlag string) []string {
+	opts := []string{"-i", settings.key, "-o", "LogLevel=error", "-o", "UserKnownHostsFile=/dev/null", "-o", "StrictHostKeyChecking=no"}
+	if settings.port != 0 {
+		opts = append(opts, portFlag, strconv.Itoa(settings.port))
+	}
+	if len(settings.jumpHosts) > 0 {
+		// ProxyJump cannot take a key per hop so the hops are chained with ProxyCommand instead
+		opts = append(opts, "-o", "ProxyCommand="+proxyCommand(settings.jumpHosts, jumpHostKeyOptions(c.jumpKnownHosts, c.insecureJumpHostKeys)))
+	}
+	return opts
+}
+
+// sshCommand is the ssh invocation up to and including the user@host target
+func (c *CmdSSHActions) sshCommand(hostName string) []string {
+	settings := c.settings(hostName)
+	sshArgs := append([]string{"ssh"}, c.connectOptions(settings, "-p")...)
+	// ssh reads user@fe80::1 fine, only scp needs brackets around IPv6 addresses
+	return append(sshArgs, fmt.Sprintf("%v@%v", settings.user, hostName))
+}
+
+// scpCommand is the scp invocation for the host with the source and destination still to be added
+func (c *CmdSSHActions) scpCommand(hostName string) []string {
+	return append([]string{"scp"}, c.connectOptions(c.settings(hostName), "-P")...)
+}
+
+// scpTarget formats user@host:path, IPv6 addresses are put in brackets so their colons are not read as the path separator
+func (c *CmdSSHActions) scpTarget(hostName, remotePath string) string {
+	settings := c.settings(hostName)
+	if strings.Contains(hostName, ":") {
+		return fmt.Sprintf("%v@[%v]:%v", settings.user, hostName, remotePath)
+	}
+	return fmt.Sprintf("%v@%v:%v", settings.user, hostName, remotePath)
 }
 
 func (c *CmdSSHActions) Name() string {
@@ -54,14 +145,13 @@ func (c *CmdSSHActions) Name() string {
 }
 
 func (c *CmdSSHActions) HostExecuteAndStream(mask bool, hostString string, output cli.OutputHandler, _ bool, args ...string) (err error) {
-	sshArgs := []string{"ssh", "-i", c.sshKey, "-o", "LogLevel=error", "-o", "UserKnownHostsFile=/dev/null", "-o", "StrictHostKeyChecking=no"}
-	sshArgs = append(sshArgs, fmt.Sprintf("%v@%v", c.sshUser, hostString))
+	sshArgs := c.sshCommand(hostString)
 	sshArgs = append(sshArgs, strings.Join(args, " "))
 	return c.cli.ExecuteAndStreamOutput(mask, output, sshArgs...)
 }
 
 func (c *CmdSSHActions) CopyFromHost(hostName string, _ bool, source, destination string) (string, error) {
-	return c.cli.Execute(false, "scp", "-i", c.sshKey, "-o", "LogLevel=error", "-o", "UserKnownHostsFile=/dev/null", "-o", "StrictHostKeyChecking=no", fmt.Sprintf("%v@%v:%v", c.sshUser, hostName, source), destination)
+	return c.cli.Execute(false, append(c.scpCommand(hostName), c.scpTarget(hostName, source), destination)...)
 }
 
 func (c *CmdSSHActions) CopyFromHostSudo(hostName string, _ bool, sudoUser, source, destination string) (string, error) {
@@ -87,11 +177,11 @@ func (c *CmdSSHActions) CopyFromHostSudo(hostName string, _ bool, sudoUser, sour
 		return out, err
 	}
 	// next copy from tmp dir as non-sudo
-	return c.cli.Execute(false, "scp", "-i", c.sshKey, "-o", "LogLevel=error", "-o", "UserKnownHostsFile=/dev/null", "-o", "StrictHostKeyChecking=no", tmpFilePath, fmt.Sprintf("%v@%v:%v", c.sshUser, hostName, destination))
+	return c.cli.Execute(false, append(c.scpCommand(hostName), c.scpTarget(hostName, tmpFilePath), destination)...)
 }
 
 func (c *CmdSSHActions) CopyToHost(hostName string, _ bool, source, destination string) (string, error) {
-	return c.cli.Execute(false, "scp", "-i", c.sshKey, "-o", "LogLevel=error", "-o", "UserKnownHostsFile=/dev/null", "-o", "StrictHostKeyChecking=no", source, fmt.Sprintf("%v@%v:%v", c.sshUser, hostName, destination))
+	return c.cli.Execute(false, append(c.scpCommand(hostName), source, c.scpTarget(hostName, destination))...)
 }
 
 func (c *CmdSSHActions) CopyToHostSudo(hostName string, _ bool, sudoUser, source, destination string) (string, error) {
@@ -112,7 +202,7 @@ func (c *CmdSSHActions) CopyToHostSudo(hostName string, _ bool, sudoUser, source
 	tmpFilePath := path.Join(tmpDir, sourceFileName)
 	// first copy to tmp dir as non-sudo
 
-	out, err = c.cli.Execute(false, "scp", "-i", c.sshKey, "-o", "LogLevel=error", "-o", "UserKnownHostsFile=/dev/null", "-o", "StrictHostKeyChecking=no", source, fmt.Sprintf("%v@%v:%v", c.sshUser, hostName, tmpFilePath))
+	out, err = c.cli.Execute(false, append(c.scpCommand(hostName), source, c.scpTarget(hostName, tmpFilePath))...)
 	if err != nil {
 		return out, err
 	}
@@ -128,8 +218,7 @@ func (c *CmdSSHActions) CopyToHostSudo(hostName string, _ bool, sudoUser, source
 }
 
 func (c *CmdSSHActions) HostExecute(mask bool, hostName string, _ bool, args ...string) (string, error) {
-	sshArgs := []string{"ssh", "-i", c.sshKey, "-o", "LogLevel=error", "-o", "UserKnownHostsFile=/dev/null", "-o", "StrictHostKeyChecking=no"}
-	sshArgs = append(sshArgs, fmt.Sprintf("%v@%v", c.sshUser, hostName))
+	sshArgs := c.sshCommand(hostName)
 	sshArgs = append(sshArgs, strings.Join(args, " "))
 	out, err := c.cli.Execute(mask, sshArgs...)
 	if err != nil {
@@ -141,8 +230,7 @@ func (c *CmdSSHActions) HostExecute(mask bool, hostName string, _ bool, args ...
 
 func (c *CmdSSHActions) HostExecuteSudo(mask bool, hostName string, sudoUser string, args ...string) (string, error) {
 	sudoArgs := []string{"sudo", "-u", sudoUser}
-	sshArgs := []string{"ssh", "-i", c.sshKey, "-o", "LogLevel=error", "-o", "UserKnownHostsFile=/dev/null", "-o", "StrictHostKeyChecking=no"}
-	sshArgs = append(sshArgs, fmt.Sprintf("%v@%v", c.sshUser, hostName))
+	sshArgs := c.sshCommand(hostName)
 	sshArgs = append(sshArgs, strings.Join(sudoArgs, " "))
 	sshArgs = append(sshArgs, strings.Join(args, " "))
 	out, err := c.cli.Execute(mask, sshArgs...)
@@ -173,14 +261,7 @@ func CleanOut(out string) string {
 }
 
 func (c *CmdSSHActions) FindHosts(searchTerm string) (hosts []string, err error) {
-	rawHosts := strings.Split(searchTerm, ",")
-	for _, host := range rawHosts {
-		if host == "" {
-			continue
-		}
-		hosts = append(hosts, strings.TrimSpace(host))
-	}
-	return hosts, nil
+	return ExpandHosts(searchTerm)
 }
 
 func (c *CmdSSHActions) HelpText() string {
@@ -84,3 +84,31 @@ func TestSCP(t *testing.T) {
 		t.Errorf("expected %v call but got %v", expectedCall, calls[0])
 	}
 }
+
+func TestSSHExecWithInventory(t *testing.T) {
+	cli := &tests.MockCli{
+		StoredResponse: []string{"success", "success"},
+		StoredErrors:   []error{nil, nil},
+	}
+	k := &CmdSSHActions{
+		cli:     cli,
+		sshKey:  "id_rsa",
+		sshUser: "root",
+		inventory: &Inventory{Hosts: []InventoryHost{
+			{Host: "fd00::10", Role: RoleExecutor, User: "centos", Key: "exec.pem", Port: 2222},
+		}},
+	}
+	if _, err := k.HostExecute(false, "fd00::10", false, "ls", "-l"); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	if _, err := k.CopyFromHost("fd00::10", false, "/tmp/a.tar.gz", "/local/a.tar.gz"); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	expectedCalls := [][]string{
+		{"ssh", "-i", "exec.pem", "-o", "LogLevel=error", "-o", "UserKnownHostsFile=/dev/null", "-o", "StrictHostKeyChecking=no", "-p", "2222", "centos@fd00::10", "ls -l"},
+		{"scp", "-i", "exec.pem", "-o", "LogLevel=error", "-o", "UserKnownHostsFile=/dev/null", "-o", "StrictHostKeyChecking=no", "-P", "2222", "centos@[fd00::10]:/tmp/a.tar.gz", "/local/a.tar.gz"},
+	}
+	if !reflect.DeepEqual(cli.Calls, expectedCalls) {
+		t.Errorf("expected %v calls but got %v", expectedCalls, cli.Calls)
+	}
+}
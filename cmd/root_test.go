@@ -20,10 +20,15 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/dremio/dremio-diagnostic-collector/cmd/local/conf"
 	"github.com/dremio/dremio-diagnostic-collector/cmd/root/collection"
+	"github.com/dremio/dremio-diagnostic-collector/cmd/root/docker"
+	"github.com/dremio/dremio-diagnostic-collector/cmd/root/kubernetes"
 	"github.com/dremio/dremio-diagnostic-collector/cmd/root/ssh"
 	"github.com/dremio/dremio-diagnostic-collector/pkg/output"
 	"github.com/dremio/dremio-diagnostic-collector/pkg/simplelog"
@@ -47,7 +52,7 @@ func TestValidateParameters(t *testing.T) {
 	err := validateParameters(tc, ssh.Args{
 		SSHKeyLoc: "/home/dremio/.ssh",
 		SSHUser:   "dremio",
-	}, true)
+	}, kubernetes.KubeArgs{}, docker.Args{}, true)
 	expectedError := "the coordinator string was empty you must pass a label that will match your coordinators --coordinator or -c arguments. Example: -c \"mylabel=coordinator\""
 	if expectedError != err.Error() {
 		t.Errorf("expected: %v but was %v", expectedError, err.Error())
@@ -57,7 +62,7 @@ func TestValidateParameters(t *testing.T) {
 	err = validateParameters(tc, ssh.Args{
 		SSHKeyLoc: "",
 		SSHUser:   "dremio",
-	}, false)
+	}, kubernetes.KubeArgs{}, docker.Args{}, false)
 	expectedError = "the ssh private key location was empty, pass --ssh-key or -s with the key to get past this error. Example --ssh-key ~/.ssh/id_rsa"
 	if expectedError != err.Error() {
 		t.Errorf("expected: %v but was %v", expectedError, err.Error())
@@ -67,12 +72,117 @@ func TestValidateParameters(t *testing.T) {
 	err = validateParameters(tc, ssh.Args{
 		SSHKeyLoc: "/home/dremio/.ssh",
 		SSHUser:   "",
-	}, false)
+	}, kubernetes.KubeArgs{}, docker.Args{}, false)
 	expectedError = "the ssh user was empty, pass --ssh-user or -u with the user name you want to use to get past this error. Example --ssh-user ubuntu"
 
 	if expectedError != err.Error() {
 		t.Errorf("expected: %v but was %v", expectedError, err.Error())
 	}
+
+	tc = makeTestCollection()
+	err = validateParameters(tc, ssh.Args{}, kubernetes.KubeArgs{
+		Transport: "oc",
+	}, docker.Args{}, true)
+	expectedError = "invalid --k8s-transport 'oc', valid values are 'kubectl' and 'api'"
+	if err == nil || expectedError != err.Error() {
+		t.Errorf("expected: %v but was %v", expectedError, err)
+	}
+
+	tc = makeTestCollection()
+	err = validateParameters(tc, ssh.Args{InventoryFile: "hosts.yaml"}, kubernetes.KubeArgs{}, docker.Args{}, false)
+	expectedError = "--hosts-inventory lists the coordinators and executors, do not pass --coordinator or --executors with it"
+	if err == nil || expectedError != err.Error() {
+		t.Errorf("expected: %v but was %v", expectedError, err)
+	}
+
+	// the ssh user and key come from the inventory so they are not required here
+	tc = collection.Args{OutputLoc: "/tmp/diags"}
+	if err := validateParameters(tc, ssh.Args{InventoryFile: "hosts.yaml"}, kubernetes.KubeArgs{}, docker.Args{}, false); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestValidateParametersJumpHostWithK8s(t *testing.T) {
+	err := validateParameters(makeTestCollection(), ssh.Args{JumpHostsStr: "bastion"}, kubernetes.KubeArgs{}, docker.Args{}, true)
+	expectedError := "--ssh-jump-host and --ssh-jump-key are only for ssh collections"
+	if err == nil || expectedError != err.Error() {
+		t.Errorf("expected: %v but was %v", expectedError, err)
+	}
+}
+
+func TestValidateParametersDocker(t *testing.T) {
+	testCases := []struct {
+		name          string
+		args          collection.Args
+		sshArgs       ssh.Args
+		dockerArgs    docker.Args
+		isK8s         bool
+		expectedError string
+	}{
+		{"valid without ssh settings", makeTestCollection(), ssh.Args{}, docker.Args{Enabled: true, Runtime: docker.RuntimePodman}, false, ""},
+		{"with k8s", makeTestCollection(), ssh.Args{}, docker.Args{Enabled: true}, true, "--docker and --k8s cannot be used together"},
+		{"unknown runtime", makeTestCollection(), ssh.Args{}, docker.Args{Enabled: true, Runtime: "nerdctl"}, false, "invalid --container-runtime 'nerdctl', valid values are 'docker' and 'podman'"},
+		{"with jump host", makeTestCollection(), ssh.Args{JumpHostsStr: "bastion"}, docker.Args{Enabled: true}, false, "--hosts-inventory, --ssh-jump-host and --ssh-jump-key are only for ssh collections"},
+		{"no coordinator", collection.Args{OutputLoc: "/tmp/diags"}, ssh.Args{}, docker.Args{Enabled: true}, false, "the coordinator string was empty you must pass the container names, a label or a compose service that will match your coordinators to --coordinator or -c arguments. Example: -c service:dremio-coordinator"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateParameters(tc.args, tc.sshArgs, kubernetes.KubeArgs{}, tc.dockerArgs, tc.isK8s)
+			if tc.expectedError == "" {
+				if err != nil {
+					t.Errorf("unexpected error %v", err)
+				}
+				return
+			}
+			if err == nil || tc.expectedError != err.Error() {
+				t.Errorf("expected: %v but was %v", tc.expectedError, err)
+			}
+		})
+	}
+}
+
+func TestApplyInventory(t *testing.T) {
+	inventoryFile := filepath.Join(t.TempDir(), "hosts.yaml")
+	inventory := `hosts:
+  - host: 10.0.0.10
+    role: coordinator
+    sudo-user: dremio
+    label: main
+  - host: 10.0.0.20-21
+    role: executor
+    user: centos
+    key: /keys/exec.pem
+    port: 2222
+`
+	if err := os.WriteFile(inventoryFile, []byte(inventory), 0600); err != nil {
+		t.Fatal(err)
+	}
+	args := collection.Args{SudoUser: "root"}
+	sshArgs := ssh.Args{InventoryFile: inventoryFile, SSHUser: "ubuntu", SSHKeyLoc: "/keys/default.pem"}
+	if err := applyInventory(&args, &sshArgs); err != nil {
+		t.Fatal(err)
+	}
+	if args.CoordinatorStr != "10.0.0.10" {
+		t.Errorf("unexpected coordinators %v", args.CoordinatorStr)
+	}
+	if args.ExecutorsStr != "10.0.0.20,10.0.0.21" {
+		t.Errorf("unexpected executors %v", args.ExecutorsStr)
+	}
+	if args.HostSudoUsers["10.0.0.10"] != "dremio" || len(args.HostSudoUsers) != 1 {
+		t.Errorf("unexpected sudo users %v", args.HostSudoUsers)
+	}
+	if args.HostLabels["10.0.0.10"] != "main" {
+		t.Errorf("unexpected labels %v", args.HostLabels)
+	}
+	if sshArgs.Inventory == nil {
+		t.Error("expected the inventory to be passed on to the ssh collector")
+	}
+
+	// without a default user every host needs its own
+	sshArgs = ssh.Args{InventoryFile: inventoryFile, SSHKeyLoc: "/keys/default.pem"}
+	if err := applyInventory(&collection.Args{}, &sshArgs); err == nil {
+		t.Error("expected an error for a host without a user")
+	}
 }
 
 func TestExecute(t *testing.T) {
@@ -138,7 +248,7 @@ func TestAllSubCommandsAreWiredUp(t *testing.T) {
 	if err != nil {
 		t.Errorf("unexpected error %v", err)
 	}
-	expected := "Available Commands:\n  awselogs      Log only collect of AWSE from the coordinator node\n  local-collect retrieves all the dremio logs and diagnostics for the local node and saves the results in a compatible format for Dremio support\n  version       Print the version number of DDC\n"
+	expected := "Available Commands:\n  awselogs      Log only collect of AWSE from the coordinator node\n  decrypt       Decrypt archives and node tarballs written with --encrypt-to\n  diff          Compare two diagnostic bundles of the same cluster\n  inspect       Summarize a diagnostic bundle without extracting it\n  local-collect retrieves all the dremio logs and diagnostics for the local node and saves the results in a compatible format for Dremio support\n  schedule      Run a collection on a cron expression and keep the last bundles in tarball-out-dir\n  upload        Upload an archive to S3 compatible storage, SFTP or HTTP\n  verify        Check a diagnostic bundle against its manifest for missing or corrupted files\n  version       Print the version number of DDC\n  watch         Watch the local Dremio process and capture it when a threshold is crossed\n"
 	if !strings.Contains(helpText, expected) {
 		t.Errorf("missing command text in `%q`", helpText)
 	}
@@ -147,7 +257,7 @@ func TestAllSubCommandsAreWiredUp(t *testing.T) {
 func TestValidateDDCYamlValid(t *testing.T) {
 
 	valid := filepath.Join("testdata", "ddc-valid.yaml")
-	_, err := ValidateAndReadYaml(valid)
+	_, err := ValidateAndReadYaml(valid, make(map[string]string))
 	if err != nil {
 		t.Errorf("expected no error for valid yaml: %v", err)
 	}
@@ -155,7 +265,7 @@ func TestValidateDDCYamlValid(t *testing.T) {
 
 func TestValidateDDCYamlNotPresent(t *testing.T) {
 	valid := filepath.Join("testdata", "not-found-anwhere.yaml")
-	_, err := ValidateAndReadYaml(valid)
+	_, err := ValidateAndReadYaml(valid, make(map[string]string))
 	if err == nil {
 		t.Error("expected an error for missing yaml")
 	}
@@ -163,7 +273,7 @@ func TestValidateDDCYamlNotPresent(t *testing.T) {
 
 func TestValidateDDCYamlNotValid(t *testing.T) {
 	valid := filepath.Join("testdata", "ddc-invalid.yaml")
-	_, err := ValidateAndReadYaml(valid)
+	_, err := ValidateAndReadYaml(valid, make(map[string]string))
 	if err == nil {
 		t.Errorf("expected an error for invalid yaml: %v", err)
 	}
@@ -183,7 +293,7 @@ func TestValidateDDCYamlMaskPAT(t *testing.T) {
 		simplelog.InitLoggerWithFile(4, filepath.Join(os.TempDir(), "ddc.log"))
 	}()
 	valid := filepath.Join("testdata", "ddc-valid.yaml")
-	_, err := ValidateAndReadYaml(valid)
+	_, err := ValidateAndReadYaml(valid, make(map[string]string))
 	if err != nil {
 		t.Errorf("expected no error for valid yaml: %v", err)
 	}
@@ -197,3 +307,103 @@ func TestValidateDDCYamlMaskPAT(t *testing.T) {
 		t.Errorf("expected redacted pat: '%v'", string(b))
 	}
 }
+
+func TestValidateParametersDryRunWithResume(t *testing.T) {
+	args := makeTestCollection()
+	args.DryRun = true
+	args.Resume = true
+	err := validateParameters(args, ssh.Args{SSHKeyLoc: "/home/dremio/.ssh", SSHUser: "dremio"}, kubernetes.KubeArgs{}, docker.Args{}, false)
+	expectedError := "--dry-run cannot be used with --resume"
+	if err == nil || expectedError != err.Error() {
+		t.Errorf("expected: %v but was %v", expectedError, err)
+	}
+}
+
+func TestValidateParametersPreflightOnFailure(t *testing.T) {
+	args := makeTestCollection()
+	args.PreflightOnFailure = "ignore"
+	err := validateParameters(args, ssh.Args{SSHKeyLoc: "/home/dremio/.ssh", SSHUser: "dremio"}, kubernetes.KubeArgs{}, docker.Args{}, false)
+	expectedError := "--preflight-on-failure must be auto, prompt, abort or continue but was 'ignore'"
+	if err == nil || expectedError != err.Error() {
+		t.Errorf("expected: %v but was %v", expectedError, err)
+	}
+}
+
+func TestPreflightDirs(t *testing.T) {
+	confData := map[string]interface{}{
+		conf.KeyDremioLogDir:    "/var/log/dremio",
+		conf.KeyDremioConfDir:   "/opt/dremio/conf",
+		conf.KeyDremioGCLogsDir: "",
+	}
+	expected := []string{"/var/log/dremio", "/opt/dremio/conf"}
+	if actual := preflightDirs(confData); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v but was %v", expected, actual)
+	}
+}
+
+func TestValidateParametersOutputFormat(t *testing.T) {
+	args := makeTestCollection()
+	args.ArchiveFormat = "rar"
+	err := validateParameters(args, ssh.Args{SSHKeyLoc: "/home/dremio/.ssh", SSHUser: "dremio"}, kubernetes.KubeArgs{}, docker.Args{}, false)
+	expectedError := "invalid --output-format: unsupported archive format 'rar', must be one of [tar.gz tar.zst zip]"
+	if err == nil || expectedError != err.Error() {
+		t.Errorf("expected: %v but was %v", expectedError, err)
+	}
+	args.ArchiveFormat = "zip"
+	args.MaxVolumeBytes = -1024 * 1024
+	err = validateParameters(args, ssh.Args{SSHKeyLoc: "/home/dremio/.ssh", SSHUser: "dremio"}, kubernetes.KubeArgs{}, docker.Args{}, false)
+	expectedError = "--output-max-volume-mb must be 0 or more but was -1"
+	if err == nil || expectedError != err.Error() {
+		t.Errorf("expected: %v but was %v", expectedError, err)
+	}
+}
+
+func TestEncryptionSettings(t *testing.T) {
+	recipient := "age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p"
+	testCases := []struct {
+		name          string
+		confData      map[string]interface{}
+		flags         []string
+		nodeTarballs  bool
+		expectedCount int
+		expectedNodes bool
+		expectErr     bool
+	}{
+		{"off", map[string]interface{}{}, nil, false, 0, false, false},
+		{"flag only", map[string]interface{}{}, []string{recipient}, false, 1, false, false},
+		{"node tarballs", map[string]interface{}{}, []string{recipient}, true, 1, true, false},
+		{"node tarballs without recipients", map[string]interface{}{}, nil, true, 0, false, true},
+		{"required without recipients", map[string]interface{}{conf.KeyRequireEncryption: true}, nil, false, 0, false, true},
+		{"required encrypts the nodes", map[string]interface{}{conf.KeyRequireEncryption: true}, []string{recipient}, false, 1, true, false},
+		{"ddc.yaml recipients encrypt the nodes", map[string]interface{}{conf.KeyEncryptTo: recipient}, nil, false, 1, true, false},
+		{"invalid recipient", map[string]interface{}{}, []string{"age1invalid"}, false, 0, false, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			recipients, nodes, err := encryptionSettings(tc.confData, tc.flags, tc.nodeTarballs)
+			if tc.expectErr {
+				if err == nil {
+					t.Error("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if len(recipients) != tc.expectedCount || nodes != tc.expectedNodes {
+				t.Errorf("expected %v recipients and node encryption %v but got %v and %v", tc.expectedCount, tc.expectedNodes, recipients, nodes)
+			}
+		})
+	}
+}
+
+func TestMinimumHostTimeout(t *testing.T) {
+	if minimum := minimumHostTimeout(0); minimum != 10*time.Minute {
+		t.Errorf("expected 10m for a host with nothing to wait for but was %v", minimum)
+	}
+	// the performance mode with a PAT: 1m start delay, 5m captures and 50000 job profiles at 25 a second
+	expected := time.Minute + 5*time.Minute + 2000*time.Second
+	if minimum := minimumHostTimeout(expected); minimum != 69*time.Minute {
+		t.Errorf("expected a minimum of 69m for %v but was %v", expected, minimum)
+	}
+}
@@ -0,0 +1,131 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schedule
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/dremio/dremio-diagnostic-collector/pkg/simplelog"
+)
+
+// IndexFileName is the index of the scheduled runs kept in the tarball-out-dir
+const IndexFileName = "ddc-schedule-index.json"
+
+const (
+	StatusOK        = "ok"
+	StatusFailed    = "failed"
+	StatusCancelled = "cancelled"
+)
+
+// Run is one scheduled collection, Dir is the directory of the run in the tarball-out-dir and Bundles
+// are the archives or node tarballs it wrote there
+type Run struct {
+	ID       string    `json:"id"`
+	Mode     string    `json:"mode"`
+	Dir      string    `json:"dir"`
+	StartUTC time.Time `json:"startUTC"`
+	EndUTC   time.Time `json:"endUTC"`
+	Status   string    `json:"status"`
+	Error    string    `json:"error,omitempty"`
+	Bundles  []string  `json:"bundles"`
+	Bytes    int64     `json:"bytes"`
+}
+
+// Index lists the runs that are still on disk, oldest first
+type Index struct {
+	Runs []Run `json:"runs"`
+}
+
+// ReadIndex reads the index in outDir, an index that does not exist yet is empty
+func ReadIndex(outDir string) (Index, error) {
+	var index Index
+	b, err := os.ReadFile(filepath.Clean(filepath.Join(outDir, IndexFileName)))
+	if errors.Is(err, os.ErrNotExist) {
+		return index, nil
+	}
+	if err != nil {
+		return index, fmt.Errorf("unable to read schedule index: %w", err)
+	}
+	if err := json.Unmarshal(b, &index); err != nil {
+		return index, fmt.Errorf("unable to parse schedule index %v: %w", filepath.Join(outDir, IndexFileName), err)
+	}
+	return index, nil
+}
+
+// writeIndex replaces the index through a temp file so a crash never leaves half an index behind
+func writeIndex(outDir string, index Index) error {
+	b, err := json.MarshalIndent(index, "", "\t")
+	if err != nil {
+		return fmt.Errorf("unable to marshal schedule index: %w", err)
+	}
+	name := filepath.Join(outDir, IndexFileName)
+	if err := os.WriteFile(name+".tmp", b, 0600); err != nil {
+		return fmt.Errorf("unable to write schedule index: %w", err)
+	}
+	if err := os.Rename(name+".tmp", name); err != nil {
+		return fmt.Errorf("unable to write schedule index: %w", err)
+	}
+	return nil
+}
+
+// retain splits the runs into the ones to keep and the ones to remove. The newest keep runs are kept,
+// or all of them when keep is 0, as long as they are not older than keepDays, 0 keeps them regardless
+// of age. The newest run is always kept.
+func retain(runs []Run, now time.Time, keep, keepDays int) (kept, removed []Run) {
+	sorted := append([]Run{}, runs...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].StartUTC.Before(sorted[j].StartUTC) })
+	for i, r := range sorted {
+		rank := len(sorted) - 1 - i
+		tooMany := keep > 0 && rank >= keep
+		tooOld := keepDays > 0 && now.Sub(r.StartUTC) > time.Duration(keepDays)*24*time.Hour
+		if rank > 0 && (tooMany || tooOld) {
+			removed = append(removed, r)
+		} else {
+			kept = append(kept, r)
+		}
+	}
+	return kept, removed
+}
+
+// addRun records the run in the index and removes the runs that fall out of retention, only directories
+// listed in the index are ever removed so nothing else in outDir is touched
+func addRun(outDir string, run Run, now time.Time, keep, keepDays int) (Index, error) {
+	index, err := ReadIndex(outDir)
+	if err != nil {
+		return index, err
+	}
+	kept, removed := retain(append(index.Runs, run), now, keep, keepDays)
+	for _, r := range removed {
+		if r.Dir == "" || r.Dir != filepath.Base(r.Dir) || r.Dir == "." || r.Dir == ".." {
+			simplelog.Warningf("not removing run %v with unexpected directory %q", r.ID, r.Dir)
+			continue
+		}
+		simplelog.Infof("removing run %v started at %v", r.ID, r.StartUTC)
+		if err := os.RemoveAll(filepath.Join(outDir, r.Dir)); err != nil {
+			// keep it in the index so the next run tries again
+			simplelog.Errorf("unable to remove run %v due to error %v", r.ID, err)
+			kept = append(kept, r)
+		}
+	}
+	sort.SliceStable(kept, func(i, j int) bool { return kept[i].StartUTC.Before(kept[j].StartUTC) })
+	index.Runs = kept
+	return index, writeIndex(outDir, index)
+}
@@ -0,0 +1,437 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// package schedule provides the ddc schedule command that runs collections on a cron expression
+package schedule
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/dremio/dremio-diagnostic-collector/cmd/local/conf"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/archive"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/cron"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/simplelog"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/versions"
+	"github.com/spf13/cobra"
+)
+
+const (
+	ModeLocal   = "local"
+	ModeCluster = "cluster"
+
+	// ConfigFileName is written in every run directory with the configuration the run was started with
+	ConfigFileName = "effective-config.json"
+	// OutputFileName is written in every run directory with everything ddc printed during the run
+	OutputFileName = "ddc-output.log"
+)
+
+var cronExpr string
+var tarballOutDir string
+var keep int
+var keepDays int
+var runNow bool
+var ddcYamlLoc string
+
+var ScheduleCmd = &cobra.Command{
+	Use:   "schedule --cron <expression> -- <local-collect or ddc flags>",
+	Short: "Run a collection on a cron expression and keep the last bundles in tarball-out-dir",
+	Long: `Run as a long lived service that starts a collection every time the cron expression fires.
+Everything after -- is what each run collects: 'local-collect' and its flags collect the node ddc runs on,
+the flags of ddc itself (--coordinator, --executors, --k8s...) collect the cluster.
+Every run gets its own directory in --tarball-out-dir with the bundle, the output of ddc and the effective
+configuration it used. ddc-schedule-index.json lists the runs and runs beyond --keep or older than --keep-days
+are removed. Runs never overlap, a run that is still going when the expression fires next skips that time.
+Runs are unattended so they need --accept-collection-consent. Cluster runs collect even when a preflight check fails
+unless --preflight-on-failure abort is passed.`,
+	Example: `  ddc schedule --cron "0 */6 * * *" --keep 8 -- local-collect --accept-collection-consent
+  ddc schedule --cron "@daily" --keep-days 14 -- --coordinator 10.0.0.10 --executors 10.0.0.20-30 --ssh-user dremio`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		simplelog.LogStartMessage()
+		defer simplelog.LogEndMessage()
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		if err := execute(ctx, args); err != nil {
+			simplelog.Errorf("exiting %v", err)
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	},
+}
+
+func execute(ctx context.Context, args []string) error {
+	if cronExpr == "" {
+		return errors.New("--cron is required")
+	}
+	schedule, err := cron.Parse(cronExpr)
+	if err != nil {
+		return fmt.Errorf("invalid --cron: %w", err)
+	}
+	s := &Scheduler{
+		Schedule: schedule,
+		OutDir:   tarballOutDir,
+		Keep:     keep,
+		KeepDays: keepDays,
+		Args:     args,
+		DDCYaml:  ddcYamlLoc,
+		Exec:     execDDC,
+	}
+	if flag, ok := flagValue(args, "ddc-yaml"); ok {
+		s.DDCYaml = flag
+	}
+	if s.OutDir == "" {
+		// the same tarball-out-dir local-collect would write to
+		s.OutDir = "/tmp/ddc"
+		if confData, err := conf.ParseConfig(s.DDCYaml, map[string]string{}); err == nil {
+			if dir := conf.GetString(confData, conf.KeyTarballOutDir); dir != "" {
+				s.OutDir = dir
+			}
+		}
+	}
+	if err := s.validate(); err != nil {
+		return err
+	}
+	if runNow {
+		if _, err := s.RunOnce(ctx); err != nil {
+			return err
+		}
+	}
+	return s.Loop(ctx)
+}
+
+// Scheduler starts a collection each time Schedule fires, Exec runs ddc with the arguments of a run and
+// writes what it prints to out
+type Scheduler struct {
+	Schedule cron.Schedule
+	OutDir   string
+	Keep     int
+	KeepDays int
+	Args     []string
+	DDCYaml  string
+	Exec     func(ctx context.Context, args []string, out io.Writer) error
+	Now      func() time.Time
+}
+
+// Mode is local when the scheduled arguments are a local-collect and cluster when they are ddc flags
+func (s *Scheduler) Mode() string {
+	if len(s.Args) > 0 && s.Args[0] == "local-collect" {
+		return ModeLocal
+	}
+	return ModeCluster
+}
+
+func (s *Scheduler) validate() error {
+	if len(s.Args) == 0 || (s.Args[0] != "local-collect" && !strings.HasPrefix(s.Args[0], "-")) {
+		return errors.New("only local-collect or the flags of a ddc cluster collection can be scheduled")
+	}
+	if s.Keep < 0 || s.KeepDays < 0 {
+		return errors.New("--keep and --keep-days cannot be negative")
+	}
+	owned := "output-file"
+	if s.Mode() == ModeLocal {
+		owned = "tarball-out-dir"
+	}
+	if _, ok := flagValue(s.Args, owned); ok {
+		return fmt.Errorf("--%v is set by ddc schedule for every run, set --tarball-out-dir on ddc schedule instead", owned)
+	}
+	if err := os.MkdirAll(s.OutDir, 0700); err != nil {
+		return fmt.Errorf("unable to create tarball-out-dir %v: %w", s.OutDir, err)
+	}
+	return nil
+}
+
+func (s *Scheduler) now() time.Time {
+	if s.Now != nil {
+		return s.Now()
+	}
+	return time.Now()
+}
+
+// Loop waits for the schedule to fire and runs a collection until ctx is done. A failed run is recorded
+// and the schedule carries on.
+func (s *Scheduler) Loop(ctx context.Context) error {
+	for {
+		next := s.Schedule.Next(s.now())
+		if next.IsZero() {
+			return fmt.Errorf("cron expression %q never fires", s.Schedule)
+		}
+		simplelog.Infof("next %v collection at %v", s.Mode(), next.Format(time.RFC1123))
+		fmt.Printf("next %v collection at %v\n", s.Mode(), next.Format(time.RFC1123))
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			simplelog.Info("schedule stopped")
+			return nil
+		case <-timer.C:
+		}
+		if _, err := s.RunOnce(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+// RunOnce runs one collection in a new directory of OutDir, records it in the index and applies the
+// retention. The error is only for problems with OutDir itself, a failed collection is in the run status.
+func (s *Scheduler) RunOnce(ctx context.Context) (Run, error) {
+	start := s.now().UTC()
+	run := Run{
+		ID:       start.Format("20060102-150405"),
+		Mode:     s.Mode(),
+		StartUTC: start,
+		Bundles:  []string{},
+	}
+	run.Dir = "ddc-" + run.ID
+	dir := filepath.Join(s.OutDir, run.Dir)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return run, fmt.Errorf("unable to create run directory: %w", err)
+	}
+	args := s.runArgs(dir)
+	if err := writeConfig(filepath.Join(dir, ConfigFileName), s.effectiveConfig(args)); err != nil {
+		simplelog.Warningf("unable to record the configuration of run %v: %v", run.ID, err)
+	}
+
+	simplelog.Infof("starting %v collection %v: ddc %v", run.Mode, run.ID, strings.Join(redact(args), " "))
+	fmt.Printf("starting %v collection %v\n", run.Mode, run.ID)
+	runErr := s.runDDC(ctx, dir, args)
+	run.EndUTC = s.now().UTC()
+	run.Bundles, run.Bytes = bundles(dir, run.Mode)
+	switch {
+	case ctx.Err() != nil:
+		run.Status = StatusCancelled
+		run.Error = ctx.Err().Error()
+	case runErr != nil:
+		run.Status = StatusFailed
+		run.Error = runErr.Error()
+	case len(run.Bundles) == 0:
+		// ddc reports a failed cluster collection on screen and still exits with 0
+		run.Status = StatusFailed
+		run.Error = fmt.Sprintf("no bundle was written, see %v", filepath.Join(dir, OutputFileName))
+	default:
+		run.Status = StatusOK
+	}
+	simplelog.Infof("%v collection %v finished as %v in %v with %v bundle(s) %v", run.Mode, run.ID, run.Status, run.EndUTC.Sub(run.StartUTC), len(run.Bundles), run.Error)
+	fmt.Printf("%v collection %v %v in %v %v\n", run.Mode, run.ID, run.Status, run.EndUTC.Sub(run.StartUTC).Round(time.Second), run.Error)
+
+	if _, err := addRun(s.OutDir, run, s.now(), s.Keep, s.KeepDays); err != nil {
+		return run, err
+	}
+	return run, nil
+}
+
+func (s *Scheduler) runDDC(ctx context.Context, dir string, args []string) error {
+	out, err := os.Create(filepath.Clean(filepath.Join(dir, OutputFileName)))
+	if err != nil {
+		return fmt.Errorf("unable to create output log: %w", err)
+	}
+	defer func() {
+		if err := out.Close(); err != nil {
+			simplelog.Warningf("unable to close %v: %v", out.Name(), err)
+		}
+	}()
+	return s.Exec(ctx, args, out)
+}
+
+// runArgs points the output of the collection at the run directory
+func (s *Scheduler) runArgs(dir string) []string {
+	args := append([]string{}, s.Args...)
+	if s.Mode() == ModeLocal {
+		return append(args, "--tarball-out-dir", dir)
+	}
+	name := "diag.tgz"
+	if format, ok := flagValue(args, "output-format"); ok {
+		switch archive.Format(format) {
+		case archive.TarZst:
+			name = "diag.tar.zst"
+		case archive.Zip:
+			name = "diag.zip"
+		}
+	}
+	return append(args, "--output-file", filepath.Join(dir, name))
+}
+
+// EffectiveConfig is what a run was started with. Config is ddc.yaml with its defaults and, for local-collect,
+// the flags that override it, the PAT is never written out.
+type EffectiveConfig struct {
+	DDCVersion  string                 `json:"ddcVersion"`
+	Cron        string                 `json:"cron"`
+	Mode        string                 `json:"mode"`
+	Command     []string               `json:"command"`
+	DDCYaml     string                 `json:"ddcYaml"`
+	Config      map[string]interface{} `json:"config"`
+	ConfigError string                 `json:"configError,omitempty"`
+}
+
+func (s *Scheduler) effectiveConfig(args []string) EffectiveConfig {
+	c := EffectiveConfig{
+		DDCVersion: strings.TrimSpace(versions.GetCLIVersion()),
+		Cron:       s.Schedule.String(),
+		Mode:       s.Mode(),
+		Command:    redact(args),
+		DDCYaml:    s.DDCYaml,
+	}
+	overrides := make(map[string]string)
+	if c.Mode == ModeLocal {
+		overrides = flagOverrides(args[1:])
+	}
+	confData, err := conf.ParseConfig(s.DDCYaml, overrides)
+	if err != nil {
+		c.ConfigError = err.Error()
+		return c
+	}
+	if err := conf.SetViperDefaults(confData, "", 0, ""); err != nil {
+		c.ConfigError = err.Error()
+		return c
+	}
+	if v, ok := confData[conf.KeyDremioPatToken]; ok && v != "" {
+		confData[conf.KeyDremioPatToken] = "REDACTED"
+	}
+	c.Config = confData
+	return c
+}
+
+func writeConfig(name string, c EffectiveConfig) error {
+	b, err := json.MarshalIndent(c, "", "\t")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(name, b, 0600)
+}
+
+// flagOverrides reads the long flags the way local-collect applies them over ddc.yaml
+func flagOverrides(args []string) map[string]string {
+	overrides := make(map[string]string)
+	for i := 0; i < len(args); i++ {
+		if !strings.HasPrefix(args[i], "--") {
+			continue
+		}
+		name, value, hasValue := strings.Cut(strings.TrimPrefix(args[i], "--"), "=")
+		if !hasValue {
+			value = "true"
+			if i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+				value = args[i+1]
+				i++
+			}
+		}
+		switch name {
+		case "ddc-yaml", "dry-run":
+		default:
+			overrides[name] = value
+		}
+	}
+	return overrides
+}
+
+// flagValue finds the value of a long flag given as --name value or --name=value
+func flagValue(args []string, name string) (string, bool) {
+	for i, a := range args {
+		if a == "--"+name {
+			if i+1 < len(args) {
+				return args[i+1], true
+			}
+			return "", true
+		}
+		if strings.HasPrefix(a, "--"+name+"=") {
+			return strings.TrimPrefix(a, "--"+name+"="), true
+		}
+	}
+	return "", false
+}
+
+// redact hides the value of --dremio-pat-token
+func redact(args []string) []string {
+	redacted := append([]string{}, args...)
+	for i, a := range redacted {
+		if a == "--"+conf.KeyDremioPatToken && i+1 < len(redacted) {
+			redacted[i+1] = "REDACTED"
+		} else if strings.HasPrefix(a, "--"+conf.KeyDremioPatToken+"=") {
+			redacted[i] = "--" + conf.KeyDremioPatToken + "=REDACTED"
+		}
+	}
+	return redacted
+}
+
+// bundles lists the node tarballs of a local run or the archive and its volumes of a cluster run
+func bundles(dir, mode string) ([]string, int64) {
+	found := []string{}
+	var total int64
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		simplelog.Warningf("unable to list run directory %v: %v", dir, err)
+		return found, 0
+	}
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		name := e.Name()
+		var bundle bool
+		if mode == ModeLocal {
+			bundle = strings.HasSuffix(name, ".tar.gz") || strings.HasSuffix(name, ".tar.gz.age")
+		} else {
+			// diag.tgz, diag.tgz.age and volumes like diag.tgz.001 but not the diag-summary.json sidecars
+			bundle = strings.HasPrefix(name, "diag.") && !strings.HasSuffix(name, ".json")
+		}
+		if !bundle {
+			continue
+		}
+		found = append(found, name)
+		if info, err := e.Info(); err == nil {
+			total += info.Size()
+		}
+	}
+	return found, total
+}
+
+// execDDC runs this ddc binary so every run has a fresh process, on cancellation ddc gets a SIGTERM to clean
+// up the nodes like it does for Ctrl-C
+func execDDC(ctx context.Context, args []string, out io.Writer) error {
+	ddc, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("unable to find ddc: %w", err)
+	}
+	cmd := exec.CommandContext(ctx, ddc, args...) // #nosec G204
+	cmd.Stdout = out
+	cmd.Stderr = out
+	cmd.Cancel = func() error {
+		return cmd.Process.Signal(syscall.SIGTERM)
+	}
+	cmd.WaitDelay = 10 * time.Minute
+	return cmd.Run()
+}
+
+func init() {
+	ScheduleCmd.Flags().StringVar(&cronExpr, "cron", "", "when to collect as a five field cron expression in local time such as '0 */6 * * *', or @hourly, @daily, @weekly and @monthly")
+	ScheduleCmd.Flags().StringVar(&tarballOutDir, "tarball-out-dir", "", "directory the runs are written to and rotated in, defaults to tarball-out-dir of ddc.yaml")
+	ScheduleCmd.Flags().IntVar(&keep, "keep", 10, "number of runs to keep, older runs are removed, 0 keeps every run")
+	ScheduleCmd.Flags().IntVar(&keepDays, "keep-days", 0, "remove runs older than this many days, 0 keeps runs of any age")
+	ScheduleCmd.Flags().BoolVar(&runNow, "run-now", false, "also collect right away when the schedule starts")
+	execLoc, err := os.Executable()
+	if err != nil {
+		fmt.Printf("unable to find ddc, critical error %v", err)
+		os.Exit(1)
+	}
+	ScheduleCmd.Flags().StringVar(&ddcYamlLoc, "ddc-yaml", filepath.Join(filepath.Dir(execLoc), "ddc.yaml"), "location of ddc.yaml used for the default tarball-out-dir, the scheduled command can still set its own --ddc-yaml")
+}
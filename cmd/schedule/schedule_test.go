@@ -0,0 +1,194 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// package schedule provides the ddc schedule command that runs collections on a cron expression
+package schedule
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dremio/dremio-diagnostic-collector/pkg/cron"
+)
+
+// fakeLocalCollect writes a node tarball to the --tarball-out-dir it is given
+func fakeLocalCollect(ctx context.Context, args []string, out io.Writer) error {
+	dir, _ := flagValue(args, "tarball-out-dir")
+	fmt.Fprintln(out, "collected")
+	return os.WriteFile(filepath.Join(dir, "node1.tar.gz"), []byte("tarball"), 0600)
+}
+
+func newScheduler(t *testing.T, args ...string) (*Scheduler, *time.Time) {
+	t.Helper()
+	ddcYaml := filepath.Join(t.TempDir(), "ddc.yaml")
+	if err := os.WriteFile(ddcYaml, []byte("dremio-log-dir: /opt/dremio/log\ndremio-pat-token: secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	schedule, err := cron.Parse("@hourly")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2023, 11, 15, 10, 0, 0, 0, time.UTC)
+	s := &Scheduler{
+		Schedule: schedule,
+		OutDir:   t.TempDir(),
+		Keep:     10,
+		Args:     args,
+		DDCYaml:  ddcYaml,
+		Exec:     fakeLocalCollect,
+		Now:      func() time.Time { return now },
+	}
+	if err := s.validate(); err != nil {
+		t.Fatal(err)
+	}
+	return s, &now
+}
+
+func TestRunOnceLocal(t *testing.T) {
+	s, _ := newScheduler(t, "local-collect", "--accept-collection-consent", "--number-threads", "4", "--dremio-pat-token=other")
+	run, err := s.RunOnce(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.Status != StatusOK || run.Mode != ModeLocal || !reflect.DeepEqual(run.Bundles, []string{"node1.tar.gz"}) || run.Bytes != 7 {
+		t.Errorf("unexpected run %#v", run)
+	}
+	index, err := ReadIndex(s.OutDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(index.Runs) != 1 || index.Runs[0].Dir != "ddc-20231115-100000" {
+		t.Fatalf("unexpected index %#v", index)
+	}
+
+	b, err := os.ReadFile(filepath.Join(s.OutDir, run.Dir, ConfigFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var c EffectiveConfig
+	if err := json.Unmarshal(b, &c); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"dremio-log-dir":            "/opt/dremio/log",
+		"number-threads":            "4",
+		"accept-collection-consent": "true",
+		"tarball-out-dir":           filepath.Join(s.OutDir, run.Dir),
+		"dremio-pat-token":          "REDACTED",
+	}
+	for k, v := range expected {
+		if c.Config[k] != v {
+			t.Errorf("expected %v to be %v in the effective config but was %v", k, v, c.Config[k])
+		}
+	}
+	if c.Cron != "@hourly" || c.Command[len(c.Command)-3] != "--dremio-pat-token=REDACTED" {
+		t.Errorf("unexpected effective config %#v", c)
+	}
+	if out, err := os.ReadFile(filepath.Join(s.OutDir, run.Dir, OutputFileName)); err != nil || string(out) != "collected\n" {
+		t.Errorf("unexpected output %q %v", out, err)
+	}
+}
+
+func TestRunOnceRotatesRuns(t *testing.T) {
+	s, now := newScheduler(t, "local-collect")
+	s.Keep = 2
+	var runs []Run
+	for i := 0; i < 4; i++ {
+		run, err := s.RunOnce(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		runs = append(runs, run)
+		*now = now.Add(time.Hour)
+	}
+	index, err := ReadIndex(s.OutDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(index.Runs) != 2 || index.Runs[0].ID != runs[2].ID || index.Runs[1].ID != runs[3].ID {
+		t.Fatalf("expected the last 2 runs in the index but was %#v", index.Runs)
+	}
+	for i, r := range runs {
+		_, err := os.Stat(filepath.Join(s.OutDir, r.Dir))
+		if removed := os.IsNotExist(err); removed != (i < 2) {
+			t.Errorf("run %v removed %v", r.ID, removed)
+		}
+	}
+}
+
+func TestRunOnceClusterWithoutBundleFails(t *testing.T) {
+	s, _ := newScheduler(t, "--coordinator", "10.0.0.10", "--output-format", "zip")
+	var got []string
+	s.Exec = func(ctx context.Context, args []string, out io.Writer) error {
+		got = args
+		return nil
+	}
+	run, err := s.RunOnce(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.Status != StatusFailed || run.Mode != ModeCluster {
+		t.Errorf("expected a failed cluster run but was %#v", run)
+	}
+	if output, _ := flagValue(got, "output-file"); output != filepath.Join(s.OutDir, run.Dir, "diag.zip") {
+		t.Errorf("unexpected output file %v", output)
+	}
+}
+
+func TestRetain(t *testing.T) {
+	now := time.Date(2023, 11, 15, 0, 0, 0, 0, time.UTC)
+	var runs []Run
+	for i := 5; i >= 0; i-- {
+		runs = append(runs, Run{ID: fmt.Sprint(i), StartUTC: now.AddDate(0, 0, -i)})
+	}
+	ids := func(runs []Run) (ids []string) {
+		for _, r := range runs {
+			ids = append(ids, r.ID)
+		}
+		return ids
+	}
+	kept, removed := retain(runs, now, 0, 2)
+	if !reflect.DeepEqual(ids(kept), []string{"2", "1", "0"}) || !reflect.DeepEqual(ids(removed), []string{"5", "4", "3"}) {
+		t.Errorf("unexpected retention by age kept %v removed %v", ids(kept), ids(removed))
+	}
+	kept, _ = retain(runs, now, 1, 0)
+	if !reflect.DeepEqual(ids(kept), []string{"0"}) {
+		t.Errorf("unexpected retention by count %v", ids(kept))
+	}
+	// the newest run is kept even when it is too old
+	kept, _ = retain(runs, now.AddDate(1, 0, 0), 0, 2)
+	if !reflect.DeepEqual(ids(kept), []string{"0"}) {
+		t.Errorf("expected the newest run to be kept but was %v", ids(kept))
+	}
+}
+
+func TestValidateRejectsOutputFlags(t *testing.T) {
+	for _, args := range [][]string{
+		{"local-collect", "--tarball-out-dir", "/tmp"},
+		{"--coordinator", "a", "--output-file=/tmp/diag.tgz"},
+		{"verify", "diag.tgz"},
+	} {
+		s := &Scheduler{OutDir: t.TempDir(), Args: args}
+		if err := s.validate(); err == nil {
+			t.Errorf("expected %v to be rejected", args)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// package upload provides the ddc upload command that sends an archive written earlier to the upload target
+package upload
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/dremio/dremio-diagnostic-collector/cmd/root/collection"
+	"github.com/dremio/dremio-diagnostic-collector/cmd/root/ssh"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/archive"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/simplelog"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/upload"
+	"github.com/spf13/cobra"
+)
+
+var uploadArgs upload.Args
+var sshKeyLoc string
+var sshKnownHosts string
+var sshInsecureIgnoreHostKey bool
+
+var UploadCmd = &cobra.Command{
+	Use:   "upload <archive>",
+	Short: "Upload an archive to S3 compatible storage, SFTP or HTTP",
+	Long: `Upload an archive written by ddc to S3 compatible storage, SFTP or HTTP. Every volume of a split archive is uploaded.
+An upload that was interrupted, either here or by ddc --upload-to, continues from the last chunk that was sent.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		simplelog.LogStartMessage()
+		defer simplelog.LogEndMessage()
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		result, err := Execute(ctx, args[0], uploadArgs)
+		if err != nil {
+			simplelog.Errorf("exiting %v", err)
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Printf("uploaded %v bytes to %v\n", result.Bytes, strings.Join(result.URLs, ", "))
+	},
+}
+
+// Execute uploads every volume of file and records the result in the summary next to it when ddc wrote one
+func Execute(ctx context.Context, file string, args upload.Args) (upload.Result, error) {
+	if args.URL == "" {
+		return upload.Result{}, errors.New("--upload-to is required")
+	}
+	if args.SSHConfig == nil {
+		args.SSHConfig = ssh.ClientConfigFor(sshKeyLoc, sshKnownHosts, sshInsecureIgnoreHostKey)
+	}
+	target, err := upload.NewTarget(args)
+	if err != nil {
+		return upload.Result{}, err
+	}
+	files, err := archive.Volumes(file)
+	if err != nil {
+		return upload.Result{}, err
+	}
+	result, err := upload.Files(ctx, target, files)
+	if summaryErr := updateSummary(file, result); summaryErr != nil {
+		simplelog.Warningf("unable to record the upload in the summary: %v", summaryErr)
+	}
+	return result, err
+}
+
+// updateSummary sets the upload result in the summary written next to the archive by an earlier
+// ddc --upload-to run, there is nothing to update for archives that were never uploaded by ddc
+func updateSummary(file string, result upload.Result) error {
+	summaryFile := collection.SummaryFile(filepath.Clean(strings.TrimSuffix(file, archive.VolumeSuffix(file))))
+	b, err := os.ReadFile(filepath.Clean(summaryFile))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	var summary collection.SummaryInfo
+	if err := json.Unmarshal(b, &summary); err != nil {
+		return fmt.Errorf("unable to read %v: %w", summaryFile, err)
+	}
+	summary.Upload = &result
+	o, err := summary.String()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(summaryFile, []byte(o), 0600)
+}
+
+func init() {
+	upload.AddFlags(UploadCmd.Flags(), &uploadArgs)
+	UploadCmd.Flags().StringVarP(&sshKeyLoc, "ssh-key", "s", "", "for sftp uploads: ssh key to login with, ssh-agent keys are used as well")
+	UploadCmd.Flags().StringVar(&sshKnownHosts, "ssh-known-hosts", "", "for sftp uploads: known_hosts file used to verify the host key, defaults to ~/.ssh/known_hosts")
+	UploadCmd.Flags().BoolVar(&sshInsecureIgnoreHostKey, "ssh-insecure-ignore-host-key", false, "for sftp uploads: skip host key verification, not recommended")
+}
@@ -0,0 +1,96 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// package verify provides the ddc verify command that checks a bundle against its manifest
+package verify
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/dremio/dremio-diagnostic-collector/pkg/manifest"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/simplelog"
+	"github.com/spf13/cobra"
+)
+
+var jsonOutput bool
+
+var VerifyCmd = &cobra.Command{
+	Use:   "verify <bundle>",
+	Short: "Check a diagnostic bundle against its manifest for missing or corrupted files",
+	Long: `Check every file of a diagnostic bundle against the sizes and SHA-256 checksums in its manifest.json.
+The bundle is an archive written by ddc, any volume of a split archive, or the directory it was extracted to.
+Exits with 1 when a file is missing or corrupted or the archive is truncated.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		simplelog.LogStartMessage()
+		defer simplelog.LogEndMessage()
+		report, err := manifest.Verify(args[0])
+		if err != nil {
+			simplelog.Errorf("exiting %v", err)
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		if err := Print(os.Stdout, report, jsonOutput); err != nil {
+			simplelog.Errorf("exiting %v", err)
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		if !report.OK() {
+			os.Exit(1)
+		}
+	},
+}
+
+// Print writes the report as text or as indented json
+func Print(w io.Writer, report manifest.Report, asJSON bool) error {
+	if asJSON {
+		b, err := json.MarshalIndent(report, "", "\t")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(b))
+		return err
+	}
+	var lines []string
+	for _, m := range report.Missing {
+		lines = append(lines, fmt.Sprintf("MISSING   %v", m))
+	}
+	for _, c := range report.Corrupted {
+		lines = append(lines, fmt.Sprintf("CORRUPTED %v: %v", c.Path, c.Reason))
+	}
+	for _, u := range report.Unlisted {
+		lines = append(lines, fmt.Sprintf("UNLISTED  %v", u))
+	}
+	if report.ReadError != "" {
+		lines = append(lines, fmt.Sprintf("the bundle could not be read to the end, it is likely truncated: %v", report.ReadError))
+	}
+	result := "OK"
+	if !report.OK() {
+		result = "FAILED"
+	}
+	lines = append(lines, fmt.Sprintf("%v: %v of %v files verified in %v", result, report.Verified, report.Expected, report.Bundle))
+	for _, l := range lines {
+		if _, err := fmt.Fprintln(w, l); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func init() {
+	VerifyCmd.Flags().BoolVar(&jsonOutput, "json", false, "print the report as json")
+}
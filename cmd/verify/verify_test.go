@@ -0,0 +1,56 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// package verify provides the ddc verify command that checks a bundle against its manifest
+package verify
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/dremio/dremio-diagnostic-collector/pkg/manifest"
+)
+
+func TestPrintFailedReport(t *testing.T) {
+	report := manifest.Report{
+		Bundle:    "diag.tgz",
+		Expected:  3,
+		Verified:  1,
+		Missing:   []string{"logs/node1/server.log"},
+		Corrupted: []manifest.Problem{{Path: "jfr/node1.jfr", Reason: "sha256 does not match"}},
+		ReadError: "unexpected EOF",
+	}
+	var out bytes.Buffer
+	if err := Print(&out, report, false); err != nil {
+		t.Fatal(err)
+	}
+	expected := `MISSING   logs/node1/server.log
+CORRUPTED jfr/node1.jfr: sha256 does not match
+the bundle could not be read to the end, it is likely truncated: unexpected EOF
+FAILED: 1 of 3 files verified in diag.tgz
+`
+	if out.String() != expected {
+		t.Errorf("expected\n%v\nbut was\n%v", expected, out.String())
+	}
+}
+
+func TestPrintOKReport(t *testing.T) {
+	var out bytes.Buffer
+	if err := Print(&out, manifest.Report{Bundle: "diag.tgz", Expected: 2, Verified: 2}, false); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "OK: 2 of 2 files verified in diag.tgz\n" {
+		t.Errorf("unexpected output %v", out.String())
+	}
+}
@@ -17,16 +17,37 @@ package cmd
 
 import (
 	"fmt"
+	"os"
 
+	"github.com/dremio/dremio-diagnostic-collector/cmd/root/ddcbinary"
 	"github.com/dremio/dremio-diagnostic-collector/pkg/versions"
 	"github.com/spf13/cobra"
 )
 
+var printSHA256 bool
+
 var VersionCmd = &cobra.Command{
 	Use:   "version",
 	Short: "Print the version number of DDC",
 	Long:  `All software has versions. This is DDC's`,
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		fmt.Println(versions.GetCLIVersion())
+		if printSHA256 {
+			// used by the remote collection to see if the copy already on a host matches the one we would upload
+			exe, err := os.Executable()
+			if err != nil {
+				return fmt.Errorf("unable to find the ddc executable: %w", err)
+			}
+			sha, err := ddcbinary.SHA256File(exe)
+			if err != nil {
+				return err
+			}
+			fmt.Println(ddcbinary.SHA256Prefix + sha)
+		}
+		return nil
 	},
 }
+
+func init() {
+	VersionCmd.Flags().BoolVar(&printSHA256, "sha256", false, "also print the sha256 of the ddc executable")
+}
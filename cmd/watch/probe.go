@@ -0,0 +1,445 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package watch
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dremio/dremio-diagnostic-collector/pkg/strutils"
+)
+
+// clockTicks is USER_HZ, the unit of the cpu times in /proc/<pid>/stat, which is 100 on every linux we support
+const clockTicks = 100
+
+// maxTailBytes limits how much of a log is read in one poll, when more was written only the end is read
+const maxTailBytes = 4 * 1024 * 1024
+
+// maxLogMatches limits how many matching server.log lines are kept in a sample
+const maxLogMatches = 5
+
+// Sample is one reading of the Dremio process, metrics that are not watched or could not be read are left at
+// zero and the reason a metric could not be read is kept in Errors under the name of its trigger
+type Sample struct {
+	PID           int               `json:"pid"`
+	TimeUTC       time.Time         `json:"timeUTC"`
+	RSSBytes      int64             `json:"rssBytes,omitempty"`
+	HeapUsedBytes int64             `json:"heapUsedBytes,omitempty"`
+	HeapMaxBytes  int64             `json:"heapMaxBytes,omitempty"`
+	GCPauseMillis float64           `json:"gcPauseMillis,omitempty"`
+	Threads       int               `json:"threads,omitempty"`
+	CPUPercent    float64           `json:"cpuPercent,omitempty"`
+	LogMatches    []string          `json:"logMatches,omitempty"`
+	Errors        map[string]string `json:"errors,omitempty"`
+}
+
+func (s *Sample) fail(metric string, err error) {
+	if s.Errors == nil {
+		s.Errors = make(map[string]string)
+	}
+	s.Errors[metric] = err.Error()
+}
+
+// failedMetrics lists the metrics that could not be read in a stable order
+func (s Sample) failedMetrics() []string {
+	metrics := make([]string, 0, len(s.Errors))
+	for metric := range s.Errors {
+		metrics = append(metrics, metric)
+	}
+	sort.Strings(metrics)
+	return metrics
+}
+
+// HeapPercent is the used heap as a percentage of the maximum heap
+func (s Sample) HeapPercent() float64 {
+	if s.HeapMaxBytes == 0 {
+		return 0
+	}
+	return float64(s.HeapUsedBytes) * 100 / float64(s.HeapMaxBytes)
+}
+
+// DefaultCommandTimeout bounds the jcmd and jstat calls of a sample when the probe has no CommandTimeout
+const DefaultCommandTimeout = 30 * time.Second
+
+// Probe reads the metrics of the Dremio process, the jvm ones with jstat and jcmd, the others from /proc
+// and the logs. Only the metrics of the thresholds are read.
+type Probe struct {
+	PID            int
+	Thresholds     Thresholds
+	ProcDir        string
+	GCLogDir       string
+	GCPattern      string
+	ServerLog      string
+	Shell          func(ctx context.Context, w io.Writer, commandLine string) error
+	CommandTimeout time.Duration
+
+	heapMax   int64
+	lastTicks uint64
+	lastTime  time.Time
+	gcTail    tail
+	logTail   tail
+}
+
+// Sample reads every watched metric. Each metric is read on its own so one that cannot be read, like a
+// missing gc log or a jcmd that hangs on a struggling jvm, is recorded in the sample errors and the other
+// metrics are still checked. A process that is gone fails the whole sample with an error wrapping os.ErrNotExist.
+func (p *Probe) Sample(ctx context.Context, now time.Time) (Sample, error) {
+	s := Sample{PID: p.PID, TimeUTC: now.UTC()}
+	if _, err := os.Stat(filepath.Join(p.ProcDir, strconv.Itoa(p.PID))); err != nil {
+		return s, fmt.Errorf("unable to find pid %v: %w", p.PID, err)
+	}
+	t := p.Thresholds
+	if t.RSSMB > 0 || t.Threads > 0 {
+		rss, threads, err := p.status()
+		if err != nil {
+			if t.RSSMB > 0 {
+				s.fail("rss", err)
+			}
+			if t.Threads > 0 {
+				s.fail("threads", err)
+			}
+		} else {
+			s.RSSBytes, s.Threads = rss, threads
+		}
+	}
+	if t.CPUPercent > 0 {
+		if cpu, err := p.cpu(now); err != nil {
+			s.fail("cpu", err)
+		} else {
+			s.CPUPercent = cpu
+		}
+	}
+	if t.HeapPercent > 0 {
+		if used, err := p.heap(ctx); err != nil {
+			s.fail("heap", err)
+		} else {
+			s.HeapUsedBytes, s.HeapMaxBytes = used, p.heapMax
+		}
+	}
+	if t.GCPauseMillis > 0 {
+		if pause, err := p.gcPause(); err != nil {
+			s.fail("gc-pause", err)
+		} else {
+			s.GCPauseMillis = pause
+		}
+	}
+	if t.LogRegex != nil {
+		if text, err := p.logTail.next(p.ServerLog); err != nil {
+			s.fail("server-log", err)
+		} else {
+			s.LogMatches = matchingLines(string(text), t.LogRegex)
+		}
+	}
+	return s, nil
+}
+
+func (p *Probe) status() (rssBytes int64, threads int, err error) {
+	b, err := os.ReadFile(filepath.Join(p.ProcDir, strconv.Itoa(p.PID), "status"))
+	if err != nil {
+		return 0, 0, fmt.Errorf("unable to read status of pid %v: %w", p.PID, err)
+	}
+	return parseStatus(string(b))
+}
+
+// cpu is the cpu used since the last sample, the first sample has nothing to compare with and is 0
+func (p *Probe) cpu(now time.Time) (float64, error) {
+	b, err := os.ReadFile(filepath.Join(p.ProcDir, strconv.Itoa(p.PID), "stat"))
+	if err != nil {
+		return 0, fmt.Errorf("unable to read stat of pid %v: %w", p.PID, err)
+	}
+	ticks, err := parseStatTicks(string(b))
+	if err != nil {
+		return 0, err
+	}
+	var cpu float64
+	if !p.lastTime.IsZero() && ticks >= p.lastTicks {
+		if elapsed := now.Sub(p.lastTime).Seconds(); elapsed > 0 {
+			cpu = float64(ticks-p.lastTicks) / clockTicks / elapsed * 100
+		}
+	}
+	p.lastTicks, p.lastTime = ticks, now
+	return cpu, nil
+}
+
+// heap is the used heap from jstat, the maximum heap is read once with jcmd
+func (p *Probe) heap(ctx context.Context) (int64, error) {
+	if p.heapMax == 0 {
+		var w bytes.Buffer
+		if err := p.shell(ctx, &w, fmt.Sprintf("jcmd %v VM.flags", p.PID)); err != nil {
+			return 0, fmt.Errorf("unable to read the jvm flags of pid %v: %w", p.PID, err)
+		}
+		max, err := parseMaxHeap(w.String())
+		if err != nil {
+			return 0, err
+		}
+		p.heapMax = max
+	}
+	var w bytes.Buffer
+	if err := p.shell(ctx, &w, fmt.Sprintf("jstat -gc %v", p.PID)); err != nil {
+		return 0, fmt.Errorf("unable to read the heap of pid %v: %w", p.PID, err)
+	}
+	return parseJstatGC(w.String())
+}
+
+// shell runs the command under the command timeout so a jvm that does not answer cannot stall the watcher
+func (p *Probe) shell(ctx context.Context, w io.Writer, commandLine string) error {
+	timeout := p.CommandTimeout
+	if timeout <= 0 {
+		timeout = DefaultCommandTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	err := p.Shell(ctx, w, commandLine)
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%v did not finish within %v: %w", commandLine, timeout, err)
+	}
+	return err
+}
+
+func (p *Probe) gcPause() (float64, error) {
+	gcLog, err := newestFile(p.GCLogDir, p.GCPattern)
+	if err != nil {
+		return 0, err
+	}
+	text, err := p.gcTail.next(gcLog)
+	if err != nil {
+		return 0, err
+	}
+	return maxGCPause(string(text)), nil
+}
+
+// Reset points the probe at a new process, the cpu and heap readings of the old one no longer apply
+func (p *Probe) Reset(pid int) {
+	p.PID = pid
+	p.heapMax = 0
+	p.lastTicks, p.lastTime = 0, time.Time{}
+}
+
+// parseStatus reads the resident memory and thread count from /proc/<pid>/status
+func parseStatus(status string) (rssBytes int64, threads int, err error) {
+	var foundRSS, foundThreads bool
+	scanner := bufio.NewScanner(strings.NewReader(status))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(value)
+		if len(fields) == 0 {
+			continue
+		}
+		switch key {
+		case "VmRSS":
+			kb, err := strconv.ParseInt(fields[0], 10, 64)
+			if err != nil {
+				return 0, 0, fmt.Errorf("invalid VmRSS %q: %w", value, err)
+			}
+			rssBytes, foundRSS = kb*1024, true
+		case "Threads":
+			n, err := strconv.Atoi(fields[0])
+			if err != nil {
+				return 0, 0, fmt.Errorf("invalid Threads %q: %w", value, err)
+			}
+			threads, foundThreads = n, true
+		}
+	}
+	if !foundRSS || !foundThreads {
+		return 0, 0, errors.New("no VmRSS or Threads in process status")
+	}
+	return rssBytes, threads, nil
+}
+
+// parseStatTicks adds up the user and system cpu time from /proc/<pid>/stat, the fields are counted from
+// the end of the process name as it can contain spaces
+func parseStatTicks(stat string) (uint64, error) {
+	i := strings.LastIndex(stat, ")")
+	if i < 0 {
+		return 0, fmt.Errorf("invalid process stat %q", strutils.LimitString(stat, 100))
+	}
+	// after the name come state, ppid, pgrp, session, tty_nr, tpgid, flags, minflt, cminflt, majflt, cmajflt, utime and stime
+	fields := strings.Fields(stat[i+1:])
+	if len(fields) < 13 {
+		return 0, fmt.Errorf("invalid process stat %q", strutils.LimitString(stat, 100))
+	}
+	utime, err := strconv.ParseUint(fields[11], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid utime %q: %w", fields[11], err)
+	}
+	stime, err := strconv.ParseUint(fields[12], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid stime %q: %w", fields[12], err)
+	}
+	return utime + stime, nil
+}
+
+var maxHeapRegex = regexp.MustCompile(`-XX:MaxHeapSize=(\d+)`)
+
+// parseMaxHeap reads -XX:MaxHeapSize from the output of jcmd VM.flags
+func parseMaxHeap(flags string) (int64, error) {
+	m := maxHeapRegex.FindStringSubmatch(flags)
+	if m == nil {
+		return 0, fmt.Errorf("no -XX:MaxHeapSize in jvm flags %q", strutils.LimitString(flags, 200))
+	}
+	return strconv.ParseInt(m[1], 10, 64)
+}
+
+// parseJstatGC adds up the used survivor, eden and old space of jstat -gc, which is in KB
+func parseJstatGC(out string) (int64, error) {
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) < 2 {
+		return 0, fmt.Errorf("unexpected jstat output %q", strutils.LimitString(out, 200))
+	}
+	headers := strings.Fields(lines[len(lines)-2])
+	values := strings.Fields(lines[len(lines)-1])
+	if len(headers) != len(values) {
+		return 0, fmt.Errorf("unexpected jstat output %q", strutils.LimitString(out, 200))
+	}
+	var usedKB float64
+	var found int
+	for i, h := range headers {
+		switch h {
+		case "S0U", "S1U", "EU", "OU":
+			v, err := strconv.ParseFloat(values[i], 64)
+			if err != nil {
+				return 0, fmt.Errorf("invalid jstat %v %q: %w", h, values[i], err)
+			}
+			usedKB += v
+			found++
+		}
+	}
+	if found != 4 {
+		return 0, fmt.Errorf("unexpected jstat output %q", strutils.LimitString(out, 200))
+	}
+	return int64(usedKB * 1024), nil
+}
+
+var (
+	// [2023-11-15T10:00:00.123+0000][info][gc] GC(12) Pause Young (Normal) (G1 Evacuation Pause) 100M->50M(1024M) 12.345ms
+	unifiedPauseRegex = regexp.MustCompile(`(?m)Pause.*\s(\d+(?:\.\d+)?)ms\s*$`)
+	// java 8: [Times: user=0.10 sys=0.00, real=0.05 secs]
+	java8PauseRegex = regexp.MustCompile(`real=(\d+(?:\.\d+)?) secs`)
+	// java 8 with -XX:+PrintGCApplicationStoppedTime
+	stoppedRegex = regexp.MustCompile(`application threads were stopped: (\d+(?:\.\d+)?) seconds`)
+)
+
+// maxGCPause finds the longest pause in milliseconds in java 8 or unified jvm gc log lines
+func maxGCPause(text string) float64 {
+	var max float64
+	for _, m := range unifiedPauseRegex.FindAllStringSubmatch(text, -1) {
+		if v, err := strconv.ParseFloat(m[1], 64); err == nil && v > max {
+			max = v
+		}
+	}
+	for _, r := range []*regexp.Regexp{java8PauseRegex, stoppedRegex} {
+		for _, m := range r.FindAllStringSubmatch(text, -1) {
+			if v, err := strconv.ParseFloat(m[1], 64); err == nil && v*1000 > max {
+				max = v * 1000
+			}
+		}
+	}
+	return max
+}
+
+func matchingLines(text string, r *regexp.Regexp) []string {
+	var matches []string
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	scanner.Buffer(make([]byte, 64*1024), maxTailBytes)
+	for scanner.Scan() && len(matches) < maxLogMatches {
+		if line := scanner.Text(); r.MatchString(line) {
+			matches = append(matches, strutils.LimitString(line, 500))
+		}
+	}
+	return matches
+}
+
+// newestFile finds the last modified file matching the pattern, gc logs rotate to new names
+func newestFile(dir, pattern string) (string, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, pattern))
+	if err != nil {
+		return "", fmt.Errorf("invalid gc log pattern %v: %w", pattern, err)
+	}
+	var newest string
+	var newestTime time.Time
+	for _, m := range matches {
+		info, err := os.Stat(m)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		if newest == "" || info.ModTime().After(newestTime) {
+			newest, newestTime = m, info.ModTime()
+		}
+	}
+	if newest == "" {
+		return "", fmt.Errorf("no gc log matching %v in %v", pattern, dir)
+	}
+	return newest, nil
+}
+
+// tail follows a log across polls
+type tail struct {
+	file   string
+	offset int64
+}
+
+// next returns what was written to the file since the last call. The first call only remembers where the
+// file ends so older trouble does not trigger a capture, a new file is read from the start and a file that
+// got shorter was rotated and is read again from the start.
+func (t *tail) next(file string) ([]byte, error) {
+	info, err := os.Stat(file)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read %v: %w", file, err)
+	}
+	if file != t.file {
+		first := t.file == ""
+		t.file, t.offset = file, 0
+		if first {
+			t.offset = info.Size()
+			return nil, nil
+		}
+	}
+	if info.Size() < t.offset {
+		t.offset = 0
+	}
+	if info.Size() == t.offset {
+		return nil, nil
+	}
+	start := t.offset
+	if info.Size()-start > maxTailBytes {
+		start = info.Size() - maxTailBytes
+	}
+	f, err := os.Open(filepath.Clean(file))
+	if err != nil {
+		return nil, fmt.Errorf("unable to read %v: %w", file, err)
+	}
+	defer f.Close()
+	b := make([]byte, info.Size()-start)
+	n, err := f.ReadAt(b, start)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("unable to read %v: %w", file, err)
+	}
+	t.offset = start + int64(n)
+	return b[:n], nil
+}
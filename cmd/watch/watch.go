@@ -0,0 +1,470 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// package watch provides the ddc watch command that captures the Dremio JVM when it crosses a threshold
+package watch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/dremio/dremio-diagnostic-collector/cmd/local/conf"
+	"github.com/dremio/dremio-diagnostic-collector/cmd/local/conf/autodetect"
+	"github.com/dremio/dremio-diagnostic-collector/cmd/local/consent"
+	"github.com/dremio/dremio-diagnostic-collector/cmd/local/ddcio"
+	"github.com/dremio/dremio-diagnostic-collector/cmd/local/jvmcollect"
+	"github.com/dremio/dremio-diagnostic-collector/cmd/local/threading"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/archive"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/encrypt"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/simplelog"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// CaptureHeapHistogram is the only capture of watch that local-collect does not have,
+	// jstack, jfr and ttop use the capture names of jvmcollect
+	CaptureHeapHistogram = "heap-histogram"
+
+	// TriggerFileName is written at the top of every capture with what triggered it
+	TriggerFileName = "trigger.json"
+)
+
+var ddcYamlLoc string
+var acceptCollectionConsent bool
+var thresholds Thresholds
+var logRegex string
+var pollInterval time.Duration
+var cooldown time.Duration
+var maxCapturesPerDay int
+var captures []string
+
+var WatchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Watch the local Dremio process and capture it when a threshold is crossed",
+	Long: `Poll the Dremio process on this node and start a targeted capture when one of the --trigger flags is crossed.
+A capture runs the jstack burst, JFR and ttop of local-collect at the same time, and optionally a heap histogram,
+using the durations of ddc.yaml. It is written to tarball-out-dir as <node>-watch-<time>.tar.gz with trigger.json
+describing what was crossed. After a capture no other capture starts until --cooldown has passed and at most
+--max-captures-per-day captures are taken in any 24 hours.`,
+	Example: `  ddc watch --accept-collection-consent --trigger-heap-percent 90 --trigger-gc-pause-ms 5000
+  ddc watch --accept-collection-consent --trigger-log-regex "OutOfMemoryError|ChannelClosedException" --capture jstack,ttop`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		simplelog.LogStartMessage()
+		defer simplelog.LogEndMessage()
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		if err := execute(ctx, cmd.Flags().Changed("accept-collection-consent")); err != nil {
+			simplelog.Errorf("exiting %v", err)
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	},
+}
+
+func execute(ctx context.Context, consentSet bool) error {
+	if err := validateSchedule(pollInterval, cooldown, maxCapturesPerDay); err != nil {
+		return err
+	}
+	overrides := make(map[string]string)
+	if consentSet {
+		overrides[conf.KeyAcceptCollectionConsent] = fmt.Sprint(acceptCollectionConsent)
+	}
+	c, err := conf.ReadConf(overrides, ddcYamlLoc)
+	if err != nil {
+		return fmt.Errorf("unable to read configuration %w", err)
+	}
+	if !c.AcceptCollectionConsent() {
+		fmt.Println(consent.OutputConsent(c))
+		return errors.New("no consent given")
+	}
+	if c.DremioPID() < 1 {
+		return errors.New("no dremio process found to watch, set dremio-pid in ddc.yaml")
+	}
+	t := thresholds
+	if logRegex != "" {
+		if t.LogRegex, err = regexp.Compile(logRegex); err != nil {
+			return fmt.Errorf("invalid --trigger-log-regex: %w", err)
+		}
+	}
+	if !t.Any() {
+		return errors.New("no trigger set, set at least one of the --trigger flags")
+	}
+	for _, kind := range captures {
+		switch kind {
+		case jvmcollect.CaptureJStack, jvmcollect.CaptureJFR, jvmcollect.CaptureTtop, CaptureHeapHistogram:
+		default:
+			return fmt.Errorf("unknown --capture %q, use %v, %v, %v or %v", kind, jvmcollect.CaptureJStack, jvmcollect.CaptureJFR, jvmcollect.CaptureTtop, CaptureHeapHistogram)
+		}
+	}
+	if len(captures) == 0 {
+		return errors.New("--capture cannot be empty")
+	}
+	probe := &Probe{
+		PID:        c.DremioPID(),
+		Thresholds: t,
+		ProcDir:    "/proc",
+		GCLogDir:   c.GcLogsDir(),
+		GCPattern:  c.DremioGCFilePattern(),
+		ServerLog:  filepath.Join(c.DremioLogDir(), "server.log"),
+		Shell:      ddcio.ShellContext,
+	}
+	pidDetection := c.DremioPIDDetection()
+	capturer := &capturer{overrides: overrides, kinds: captures}
+	w := &Watcher{
+		Thresholds:   t,
+		PollInterval: pollInterval,
+		Cooldown:     cooldown,
+		MaxPerDay:    maxCapturesPerDay,
+		Node:         c.NodeName(),
+		Sample: func(ctx context.Context, now time.Time) (Sample, error) {
+			s, err := probe.Sample(ctx, now)
+			if errors.Is(err, os.ErrNotExist) && pidDetection {
+				// dremio was restarted, pick up the new process for the next poll
+				if pid, pidErr := autodetect.GetDremioPID(); pidErr == nil && pid != probe.PID {
+					simplelog.Warningf("dremio pid changed from %v to %v", probe.PID, pid)
+					probe.Reset(pid)
+				}
+			}
+			return s, err
+		},
+		Capture: capturer.capture,
+	}
+	fmt.Printf("watching dremio pid %v on %v every %v for %v\n", probe.PID, w.Node, w.PollInterval, t)
+	return w.Loop(ctx)
+}
+
+// validateSchedule checks the flags that decide when the Watcher polls and captures
+func validateSchedule(pollInterval, cooldown time.Duration, maxPerDay int) error {
+	if pollInterval <= 0 {
+		return fmt.Errorf("--poll-interval must be more than 0 but was %v", pollInterval)
+	}
+	if cooldown < 0 {
+		return fmt.Errorf("--cooldown cannot be negative but was %v", cooldown)
+	}
+	if maxPerDay < 0 {
+		return fmt.Errorf("--max-captures-per-day cannot be negative but was %v", maxPerDay)
+	}
+	return nil
+}
+
+// Thresholds are the limits that trigger a capture, zero values are not watched
+type Thresholds struct {
+	RSSMB         int64
+	HeapPercent   float64
+	GCPauseMillis float64
+	Threads       int
+	CPUPercent    float64
+	LogRegex      *regexp.Regexp
+}
+
+// Any is true when at least one threshold is set
+func (t Thresholds) Any() bool {
+	return t.RSSMB > 0 || t.HeapPercent > 0 || t.GCPauseMillis > 0 || t.Threads > 0 || t.CPUPercent > 0 || t.LogRegex != nil
+}
+
+func (t Thresholds) String() string {
+	var watched []string
+	if t.RSSMB > 0 {
+		watched = append(watched, fmt.Sprintf("rss over %vMB", t.RSSMB))
+	}
+	if t.HeapPercent > 0 {
+		watched = append(watched, fmt.Sprintf("heap over %v%%", t.HeapPercent))
+	}
+	if t.GCPauseMillis > 0 {
+		watched = append(watched, fmt.Sprintf("gc pauses over %vms", t.GCPauseMillis))
+	}
+	if t.Threads > 0 {
+		watched = append(watched, fmt.Sprintf("over %v threads", t.Threads))
+	}
+	if t.CPUPercent > 0 {
+		watched = append(watched, fmt.Sprintf("cpu over %v%%", t.CPUPercent))
+	}
+	if t.LogRegex != nil {
+		watched = append(watched, fmt.Sprintf("server.log lines matching %q", t.LogRegex))
+	}
+	return strings.Join(watched, ", ")
+}
+
+// Trigger is a threshold a sample crossed
+type Trigger struct {
+	Name      string `json:"name"`
+	Value     string `json:"value"`
+	Threshold string `json:"threshold"`
+}
+
+func (t Trigger) String() string {
+	if t.Name == "server-log" {
+		return fmt.Sprintf("server.log line %q matching %q", t.Value, t.Threshold)
+	}
+	return fmt.Sprintf("%v %v over %v", t.Name, t.Value, t.Threshold)
+}
+
+// Check lists the thresholds the sample crossed
+func (t Thresholds) Check(s Sample) []Trigger {
+	var triggers []Trigger
+	if t.RSSMB > 0 && s.RSSBytes > t.RSSMB*1024*1024 {
+		triggers = append(triggers, Trigger{Name: "rss", Value: fmt.Sprintf("%vMB", s.RSSBytes/1024/1024), Threshold: fmt.Sprintf("%vMB", t.RSSMB)})
+	}
+	if t.HeapPercent > 0 && s.HeapPercent() > t.HeapPercent {
+		triggers = append(triggers, Trigger{Name: "heap", Value: fmt.Sprintf("%.1f%%", s.HeapPercent()), Threshold: fmt.Sprintf("%v%%", t.HeapPercent)})
+	}
+	if t.GCPauseMillis > 0 && s.GCPauseMillis > t.GCPauseMillis {
+		triggers = append(triggers, Trigger{Name: "gc-pause", Value: fmt.Sprintf("%.1fms", s.GCPauseMillis), Threshold: fmt.Sprintf("%vms", t.GCPauseMillis)})
+	}
+	if t.Threads > 0 && s.Threads > t.Threads {
+		triggers = append(triggers, Trigger{Name: "threads", Value: fmt.Sprint(s.Threads), Threshold: fmt.Sprint(t.Threads)})
+	}
+	if t.CPUPercent > 0 && s.CPUPercent > t.CPUPercent {
+		triggers = append(triggers, Trigger{Name: "cpu", Value: fmt.Sprintf("%.1f%%", s.CPUPercent), Threshold: fmt.Sprintf("%v%%", t.CPUPercent)})
+	}
+	if t.LogRegex != nil && len(s.LogMatches) > 0 {
+		triggers = append(triggers, Trigger{Name: "server-log", Value: s.LogMatches[0], Threshold: t.LogRegex.String()})
+	}
+	return triggers
+}
+
+// Capture is what triggered a capture, it is written to trigger.json in the capture
+type Capture struct {
+	Node     string    `json:"node"`
+	TimeUTC  time.Time `json:"timeUTC"`
+	Triggers []Trigger `json:"triggers"`
+	Sample   Sample    `json:"sample"`
+}
+
+// Watcher polls Sample every PollInterval and runs Capture when a threshold is crossed, as long as the
+// cooldown has passed and there were fewer than MaxPerDay captures in the last 24 hours
+type Watcher struct {
+	Thresholds   Thresholds
+	PollInterval time.Duration
+	Cooldown     time.Duration
+	MaxPerDay    int
+	Node         string
+	Sample       func(ctx context.Context, now time.Time) (Sample, error)
+	Capture      func(ctx context.Context, c Capture) (string, error)
+	Now          func() time.Time
+
+	captured []time.Time
+}
+
+func (w *Watcher) now() time.Time {
+	if w.Now != nil {
+		return w.Now()
+	}
+	return time.Now()
+}
+
+// Loop polls until ctx is done
+func (w *Watcher) Loop(ctx context.Context) error {
+	ticker := time.NewTicker(w.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			simplelog.Info("watch stopped")
+			return nil
+		case <-ticker.C:
+		}
+		if _, err := w.Poll(ctx); err != nil {
+			simplelog.Warningf("poll failed: %v", err)
+		}
+	}
+}
+
+// Poll takes one sample and captures when it crossed a threshold, it returns the written capture if any
+func (w *Watcher) Poll(ctx context.Context) (string, error) {
+	now := w.now()
+	s, err := w.Sample(ctx, now)
+	if err != nil {
+		return "", err
+	}
+	// the metrics that could be read are still checked
+	for _, metric := range s.failedMetrics() {
+		simplelog.Warningf("unable to read %v: %v", metric, s.Errors[metric])
+	}
+	triggers := w.Thresholds.Check(s)
+	if len(triggers) == 0 {
+		return "", nil
+	}
+	var names []string
+	for _, t := range triggers {
+		names = append(names, t.String())
+	}
+	if reason := w.suppressed(now); reason != "" {
+		simplelog.Infof("not capturing for %v: %v", strings.Join(names, ", "), reason)
+		return "", nil
+	}
+	w.captured = append(w.captured, now)
+	msg := fmt.Sprintf("capturing %v for %v", w.Node, strings.Join(names, ", "))
+	simplelog.Info(msg)
+	fmt.Println(msg)
+	out, err := w.Capture(ctx, Capture{Node: w.Node, TimeUTC: now.UTC(), Triggers: triggers, Sample: s})
+	if err != nil {
+		return "", fmt.Errorf("capture failed: %w", err)
+	}
+	simplelog.Infof("capture written to %v", out)
+	fmt.Printf("capture written to %v\n", out)
+	return out, nil
+}
+
+// suppressed explains why no capture can start now, or is empty when one can
+func (w *Watcher) suppressed(now time.Time) string {
+	var lastDay []time.Time
+	for _, t := range w.captured {
+		if now.Sub(t) < 24*time.Hour {
+			lastDay = append(lastDay, t)
+		}
+	}
+	w.captured = lastDay
+	if len(lastDay) == 0 {
+		return ""
+	}
+	if last := lastDay[len(lastDay)-1]; now.Sub(last) < w.Cooldown {
+		return fmt.Sprintf("in cooldown until %v", last.Add(w.Cooldown).Format(time.RFC1123))
+	}
+	if w.MaxPerDay > 0 && len(lastDay) >= w.MaxPerDay {
+		return fmt.Sprintf("%v captures in the last 24 hours, the next one can start at %v", len(lastDay), lastDay[0].Add(24*time.Hour).Format(time.RFC1123))
+	}
+	return ""
+}
+
+type capturer struct {
+	overrides map[string]string
+	kinds     []string
+}
+
+// capture runs the selected collectors of local-collect at the same time in their usual directories and
+// archives them to tarball-out-dir
+func (cp *capturer) capture(ctx context.Context, capture Capture) (string, error) {
+	name := fmt.Sprintf("%v-watch-%v", capture.Node, capture.TimeUTC.Format("20060102-150405"))
+	outDir := filepath.Join(os.TempDir(), "ddc", name)
+	overrides := map[string]string{conf.KeyTmpOutputDir: outDir}
+	for k, v := range cp.overrides {
+		overrides[k] = v
+	}
+	// read again so a restarted dremio and changes to ddc.yaml are picked up
+	c, err := conf.ReadConf(overrides, ddcYamlLoc)
+	if err != nil {
+		return "", fmt.Errorf("unable to read configuration %w", err)
+	}
+	defer func() {
+		if err := os.RemoveAll(outDir); err != nil {
+			simplelog.Warningf("unable to remove %v: %v", outDir, err)
+		}
+	}()
+	for _, dir := range []string{c.ThreadDumpsOutDir(), c.JFROutDir(), c.TtopOutDir(), c.NodeInfoOutDir()} {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return "", fmt.Errorf("unable to create %v: %w", dir, err)
+		}
+	}
+	b, err := json.MarshalIndent(capture, "", "\t")
+	if err != nil {
+		return "", fmt.Errorf("unable to marshal trigger: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(outDir, TriggerFileName), b, 0600); err != nil {
+		return "", fmt.Errorf("unable to write trigger: %w", err)
+	}
+
+	t, err := threading.NewThreadPool(len(cp.kinds), 1)
+	if err != nil {
+		return "", fmt.Errorf("unable to start capture: %w", err)
+	}
+	for _, kind := range cp.kinds {
+		var run func(ctx context.Context) error
+		switch kind {
+		case jvmcollect.CaptureJStack:
+			run = func(ctx context.Context) error { return jvmcollect.RunCollectJStacks(ctx, c) }
+		case jvmcollect.CaptureJFR:
+			run = func(ctx context.Context) error { return jvmcollect.RunCollectJFR(ctx, c) }
+		case jvmcollect.CaptureTtop:
+			run = func(ctx context.Context) error { return jvmcollect.RunTtopCollect(ctx, c) }
+		case CaptureHeapHistogram:
+			run = func(context.Context) error { return collectHeapHistogram(c) }
+		}
+		t.Add(threading.Job{Name: kind, Timeout: captureTimeout(c), Run: run})
+	}
+	if err := t.ProcessAndWaitContext(ctx); err != nil {
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		// what did get captured is still worth keeping
+		simplelog.Warningf("part of the capture failed: %v", err)
+	}
+
+	tarball := filepath.Join(c.TarballOutDir(), name+".tar.gz")
+	if err := os.MkdirAll(c.TarballOutDir(), 0700); err != nil {
+		return "", fmt.Errorf("unable to create %v: %w", c.TarballOutDir(), err)
+	}
+	if err := archive.TarGzDir(outDir, tarball); err != nil {
+		return "", fmt.Errorf("unable to archive capture: %w", err)
+	}
+	if len(c.EncryptTo()) > 0 {
+		return encrypt.ReplaceFile(tarball, c.EncryptTo())
+	}
+	return tarball, nil
+}
+
+// captureTimeout is the longest capture plus collector-timeout-seconds so a hung jcmd does not stall the watch, 0 when it is turned off
+func captureTimeout(c *conf.CollectConf) time.Duration {
+	if c.CollectorTimeoutSeconds() <= 0 {
+		return 0
+	}
+	longest := c.DremioJStackTimeSeconds()
+	for _, seconds := range []int{c.DremioJFRTimeSeconds(), c.DremioTtopTimeSeconds()} {
+		if seconds > longest {
+			longest = seconds
+		}
+	}
+	return time.Duration(longest+c.CollectorTimeoutSeconds()) * time.Second
+}
+
+// collectHeapHistogram counts the live objects per class, this runs a full gc
+func collectHeapHistogram(c *conf.CollectConf) error {
+	var w bytes.Buffer
+	if err := ddcio.Shell(&w, fmt.Sprintf("jcmd %v GC.class_histogram", c.DremioPID())); err != nil {
+		return fmt.Errorf("unable to capture heap histogram of pid %v: %w", c.DremioPID(), err)
+	}
+	return os.WriteFile(filepath.Join(c.NodeInfoOutDir(), "class_histogram.txt"), w.Bytes(), 0600)
+}
+
+func init() {
+	WatchCmd.Flags().BoolVar(&acceptCollectionConsent, "accept-collection-consent", false, "consent for collection of files, if not true, then watch will stop and a log message will be generated")
+	WatchCmd.Flags().Int64Var(&thresholds.RSSMB, "trigger-rss-mb", 0, "capture when the resident memory of dremio is over this many MB, 0 does not watch it")
+	WatchCmd.Flags().Float64Var(&thresholds.HeapPercent, "trigger-heap-percent", 0, "capture when the used heap is over this percentage of the max heap, read with jstat, 0 does not watch it")
+	WatchCmd.Flags().Float64Var(&thresholds.GCPauseMillis, "trigger-gc-pause-ms", 0, "capture when a gc pause in the gc log is longer than this many milliseconds, 0 does not watch it")
+	WatchCmd.Flags().IntVar(&thresholds.Threads, "trigger-threads", 0, "capture when dremio has more than this many threads, 0 does not watch it")
+	WatchCmd.Flags().Float64Var(&thresholds.CPUPercent, "trigger-cpu-percent", 0, "capture when dremio uses more cpu than this between polls, 100 is one full core, 0 does not watch it")
+	WatchCmd.Flags().StringVar(&logRegex, "trigger-log-regex", "", "capture when a new line of server.log matches this regular expression")
+	WatchCmd.Flags().DurationVar(&pollInterval, "poll-interval", 10*time.Second, "how often dremio is checked")
+	WatchCmd.Flags().DurationVar(&cooldown, "cooldown", 30*time.Minute, "minimum time between the start of two captures")
+	WatchCmd.Flags().IntVar(&maxCapturesPerDay, "max-captures-per-day", 4, "maximum number of captures in any 24 hours, 0 has no maximum")
+	WatchCmd.Flags().StringSliceVar(&captures, "capture", []string{jvmcollect.CaptureJStack, jvmcollect.CaptureJFR, jvmcollect.CaptureTtop}, "what to capture at the same time when triggered: jstack, jfr, ttop and heap-histogram, the heap histogram runs a full gc")
+
+	execLoc, err := os.Executable()
+	if err != nil {
+		fmt.Printf("unable to find ddc, critical error %v", err)
+		os.Exit(1)
+	}
+	WatchCmd.Flags().StringVar(&ddcYamlLoc, "ddc-yaml", filepath.Join(filepath.Dir(execLoc), "ddc.yaml"), "location of ddc.yaml with the dremio pid, log dirs, node name, tarball-out-dir and capture durations")
+}
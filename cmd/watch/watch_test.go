@@ -0,0 +1,293 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// package watch provides the ddc watch command that captures the Dremio JVM when it crosses a threshold
+package watch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+const status = `Name:	java
+State:	S (sleeping)
+VmRSS:	 2097152 kB
+Threads:	412
+`
+
+const jstatGC = ` S0C    S1C    S0U    S1U      EC       EU        OC         OU       MC     MU    CCSC   CCSU   YGC     YGCT    FGC    FGCT    CGC    CGCT     GCT
+   0.0    0.0    0.0    0.0 1048576.0 524288.0 3145728.0 2621440.0 131072.0 125000.0 16384.0 15000.0    120    1.500     0    0.000    10    0.100    1.600
+`
+
+func TestParseStatus(t *testing.T) {
+	rss, threads, err := parseStatus(status)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rss != 2*1024*1024*1024 || threads != 412 {
+		t.Errorf("unexpected rss %v threads %v", rss, threads)
+	}
+	if _, _, err := parseStatus("Name:\tjava\n"); err == nil {
+		t.Error("expected an error without VmRSS and Threads")
+	}
+}
+
+func TestParseStatTicks(t *testing.T) {
+	ticks, err := parseStatTicks("1234 (java main) S 1 1234 1234 0 -1 4194560 5000 0 3 0 700 300 0 0 20 0 412 0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ticks != 1000 {
+		t.Errorf("expected 1000 ticks but was %v", ticks)
+	}
+}
+
+func TestParseHeap(t *testing.T) {
+	used, err := parseJstatGC(jstatGC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if used != (524288+2621440)*1024 {
+		t.Errorf("unexpected used heap %v", used)
+	}
+	max, err := parseMaxHeap("1234:\n-XX:CICompilerCount=4 -XX:MaxHeapSize=8589934592 -XX:+UseG1GC\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if max != 8589934592 {
+		t.Errorf("unexpected max heap %v", max)
+	}
+}
+
+func TestMaxGCPause(t *testing.T) {
+	unified := `[2023-11-15T10:00:00.123+0000][info][gc] GC(12) Pause Young (Normal) (G1 Evacuation Pause) 100M->50M(1024M) 12.345ms
+[2023-11-15T10:00:01.123+0000][info][gc] GC(13) Pause Full (G1 Compaction Pause) 1000M->900M(1024M) 5321.5ms
+[2023-11-15T10:00:02.123+0000][info][gc] GC(14) Concurrent Mark Cycle 9000.000ms
+`
+	if pause := maxGCPause(unified); pause != 5321.5 {
+		t.Errorf("expected 5321.5ms but was %v", pause)
+	}
+	java8 := `2023-11-15T10:00:00.123+0000: [GC pause (G1 Evacuation Pause) (young), 0.0123 secs] [Times: user=0.10 sys=0.00, real=0.25 secs]
+2023-11-15T10:00:01.123+0000: Total time for which application threads were stopped: 0.0500000 seconds`
+	if pause := maxGCPause(java8); pause != 250 {
+		t.Errorf("expected 250ms but was %v", pause)
+	}
+}
+
+func TestTail(t *testing.T) {
+	log := filepath.Join(t.TempDir(), "server.log")
+	if err := os.WriteFile(log, []byte("old trouble\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	var tl tail
+	if text, err := tl.next(log); err != nil || len(text) != 0 {
+		t.Fatalf("expected the first read to skip what is already there but was %q %v", text, err)
+	}
+	appendTo(t, log, "new trouble\n")
+	if text, err := tl.next(log); err != nil || string(text) != "new trouble\n" {
+		t.Fatalf("expected the new line but was %q %v", text, err)
+	}
+	// rotated
+	if err := os.WriteFile(log, []byte("x\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if text, err := tl.next(log); err != nil || string(text) != "x\n" {
+		t.Fatalf("expected the rotated log from the start but was %q %v", text, err)
+	}
+}
+
+func appendTo(t *testing.T, name, text string) {
+	t.Helper()
+	f, err := os.OpenFile(name, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString(text); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProbeSample(t *testing.T) {
+	procDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(procDir, "1234"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(procDir, "1234", "status"), []byte(status), 0600); err != nil {
+		t.Fatal(err)
+	}
+	logDir := t.TempDir()
+	serverLog := filepath.Join(logDir, "server.log")
+	if err := os.WriteFile(serverLog, []byte(""), 0600); err != nil {
+		t.Fatal(err)
+	}
+	p := &Probe{
+		PID:        1234,
+		Thresholds: Thresholds{RSSMB: 1024, HeapPercent: 30, LogRegex: regexp.MustCompile("OutOfMemoryError")},
+		ProcDir:    procDir,
+		ServerLog:  serverLog,
+		Shell: func(_ context.Context, w io.Writer, commandLine string) error {
+			if strings.HasPrefix(commandLine, "jstat") {
+				_, err := io.WriteString(w, jstatGC)
+				return err
+			}
+			_, err := io.WriteString(w, "-XX:MaxHeapSize=4294967296")
+			return err
+		},
+	}
+	if _, err := p.Sample(context.Background(), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	appendTo(t, serverLog, "INFO all good\nERROR java.lang.OutOfMemoryError: Direct buffer memory\n")
+	s, err := p.Sample(context.Background(), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.RSSBytes != 2*1024*1024*1024 || s.HeapMaxBytes != 4294967296 || !reflect.DeepEqual(s.LogMatches, []string{"ERROR java.lang.OutOfMemoryError: Direct buffer memory"}) {
+		t.Errorf("unexpected sample %#v", s)
+	}
+	var names []string
+	for _, tr := range p.Thresholds.Check(s) {
+		names = append(names, tr.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"rss", "heap", "server-log"}) {
+		t.Errorf("unexpected triggers %v", names)
+	}
+
+	p.PID = 4321
+	if _, err := p.Sample(context.Background(), time.Now()); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected a missing process to be reported as not existing but was %v", err)
+	}
+}
+
+func TestProbeSampleChecksEachMetricOnItsOwn(t *testing.T) {
+	procDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(procDir, "1234"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(procDir, "1234", "status"), []byte(status), 0600); err != nil {
+		t.Fatal(err)
+	}
+	p := &Probe{
+		PID:        1234,
+		Thresholds: Thresholds{RSSMB: 1024, HeapPercent: 30, GCPauseMillis: 500},
+		ProcDir:    procDir,
+		// there is no gc log and jcmd never answers, like a jvm in a long gc
+		GCLogDir:  t.TempDir(),
+		GCPattern: "gc*.log",
+		Shell: func(ctx context.Context, _ io.Writer, _ string) error {
+			<-ctx.Done()
+			return ctx.Err()
+		},
+		CommandTimeout: 50 * time.Millisecond,
+	}
+	start := time.Now()
+	s, err := p.Sample(context.Background(), time.Now())
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected jcmd to be given up on but the sample took %v", elapsed)
+	}
+	if s.RSSBytes != 2*1024*1024*1024 {
+		t.Errorf("expected rss to be read but was %v", s.RSSBytes)
+	}
+	if len(s.Errors) != 2 || s.Errors["heap"] == "" || s.Errors["gc-pause"] == "" {
+		t.Errorf("expected heap and gc-pause errors but was %v", s.Errors)
+	}
+	var names []string
+	for _, tr := range p.Thresholds.Check(s) {
+		names = append(names, tr.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"rss"}) {
+		t.Errorf("expected the rss trigger to still fire but was %v", names)
+	}
+}
+
+func TestWatcherCooldownAndMaxPerDay(t *testing.T) {
+	now := time.Date(2023, 11, 15, 0, 0, 0, 0, time.UTC)
+	var captured []time.Time
+	w := &Watcher{
+		Thresholds: Thresholds{Threads: 100},
+		Cooldown:   time.Hour,
+		MaxPerDay:  2,
+		Node:       "node1",
+		Now:        func() time.Time { return now },
+		Sample: func(_ context.Context, now time.Time) (Sample, error) {
+			return Sample{Threads: 500}, nil
+		},
+		Capture: func(ctx context.Context, c Capture) (string, error) {
+			captured = append(captured, c.TimeUTC)
+			return fmt.Sprintf("capture-%v", len(captured)), nil
+		},
+	}
+	for _, step := range []struct {
+		after    time.Duration
+		captured bool
+	}{
+		{0, true},
+		// in cooldown
+		{30 * time.Minute, false},
+		{31 * time.Minute, true},
+		// two captures in the last 24 hours
+		{2 * time.Hour, false},
+		// the first capture is more than 24 hours ago
+		{22 * time.Hour, true},
+	} {
+		now = now.Add(step.after)
+		out, err := w.Poll(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (out != "") != step.captured {
+			t.Errorf("at %v expected captured %v but was %q", now, step.captured, out)
+		}
+	}
+	if len(captured) != 3 {
+		t.Errorf("expected 3 captures but was %v", captured)
+	}
+}
+
+func TestValidateSchedule(t *testing.T) {
+	if err := validateSchedule(10*time.Second, 0, 0); err != nil {
+		t.Errorf("expected no cooldown and no daily maximum to be valid but was %v", err)
+	}
+	for _, tc := range []struct {
+		pollInterval time.Duration
+		cooldown     time.Duration
+		maxPerDay    int
+		flag         string
+	}{
+		{0, time.Minute, 4, "--poll-interval"},
+		{-time.Second, time.Minute, 4, "--poll-interval"},
+		{time.Second, -time.Minute, 4, "--cooldown"},
+		{time.Second, time.Minute, -1, "--max-captures-per-day"},
+	} {
+		err := validateSchedule(tc.pollInterval, tc.cooldown, tc.maxPerDay)
+		if err == nil || !strings.Contains(err.Error(), tc.flag) {
+			t.Errorf("expected an error for %v but was %v", tc.flag, err)
+		}
+	}
+}
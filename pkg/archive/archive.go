@@ -16,6 +16,7 @@ package archive
 
 import (
 	"archive/tar"
+	"archive/zip"
 	"compress/gzip"
 	"fmt"
 	"io"
@@ -23,100 +24,276 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/klauspost/compress/zstd"
+
 	"github.com/dremio/dremio-diagnostic-collector/pkg/simplelog"
 )
 
+// Format is the layout and compression of an archive
+type Format string
+
+const (
+	TarGz  Format = "tar.gz"
+	TarZst Format = "tar.zst"
+	Zip    Format = "zip"
+)
+
+// Formats lists every supported format
+var Formats = []Format{TarGz, TarZst, Zip}
+
+// extensions maps file name suffixes to the format they are written in
+var extensions = []struct {
+	suffix string
+	format Format
+}{
+	{".tar.gz", TarGz},
+	{".tgz", TarGz},
+	{".tar.zst", TarZst},
+	{".tzst", TarZst},
+	{".zip", Zip},
+}
+
+// ParseFormat validates a format name as passed on the command line
+func ParseFormat(name string) (Format, error) {
+	for _, f := range Formats {
+		if string(f) == name {
+			return f, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported archive format '%v', must be one of %v", name, Formats)
+}
+
+// FormatFromName picks the format from the extension of the file name, names
+// without a known extension are tar.gz
+func FormatFromName(name string) Format {
+	name = strings.ToLower(trimVolumeSuffix(name))
+	for _, e := range extensions {
+		if strings.HasSuffix(name, e.suffix) {
+			return e.format
+		}
+	}
+	return TarGz
+}
+
+// IsArchive is true for file names with a known archive extension, only the first volume of
+// a split archive counts so every archive is only found once
+func IsArchive(name string) bool {
+	if isVolume(name) && !strings.HasSuffix(name, firstVolumeSuffix) {
+		return false
+	}
+	name = strings.ToLower(trimVolumeSuffix(name))
+	for _, e := range extensions {
+		if strings.HasSuffix(name, e.suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Options control how ArchiveDir writes the archive
+type Options struct {
+	Format Format
+	// MaxVolumeBytes splits the archive into numbered volumes of at most this size, 0 means a single file
+	MaxVolumeBytes int64
+	// First lists files relative to srcDir that are written before everything else, readers of a
+	// truncated archive still find them
+	First []string
+	// Exclude lists dirs inside srcDir that are left out with everything under them
+	Exclude []string
+}
+
+// TarGzDir writes every file in srcDir to a single tar.gz at dest
 func TarGzDir(srcDir, dest string) error {
-	tarGzFile, err := os.Create(filepath.Clean(dest))
+	_, err := ArchiveDir(srcDir, dest, Options{Format: TarGz})
+	return err
+}
+
+// dirWriter adds the files walked in a directory to an archive
+type dirWriter interface {
+	add(relativePath, filePath string, fileInfo os.FileInfo) error
+	Close() error
+}
+
+// ArchiveDir writes every file in srcDir to dest and returns the files written, that is dest
+// unless the archive is split into volumes
+func ArchiveDir(srcDir, dest string, opts Options) ([]string, error) {
+	if opts.Format == "" {
+		opts.Format = TarGz
+	}
+	volumes, err := newVolumeWriter(dest, opts.MaxVolumeBytes)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer func() {
-		if err := tarGzFile.Close(); err != nil {
-			simplelog.Debugf("failed extra close to tgz file %v", err)
+		if err := volumes.Close(); err != nil {
+			simplelog.Debugf("failed extra close to archive %v", err)
 		}
 	}()
 
-	gzWriter := gzip.NewWriter(tarGzFile)
-	defer func() {
-		if err := gzWriter.Close(); err != nil {
-			simplelog.Debugf("failed extra close to gz file %v", err)
+	var w dirWriter
+	switch opts.Format {
+	case TarGz:
+		w = newTarWriter(gzip.NewWriter(volumes))
+	case TarZst:
+		zw, err := zstd.NewWriter(volumes)
+		if err != nil {
+			return nil, fmt.Errorf("unable to create zstd writer: %w", err)
 		}
-	}()
-
-	tarWriter := tar.NewWriter(gzWriter)
+		w = newTarWriter(zw)
+	case Zip:
+		w = &zipDirWriter{zipWriter: zip.NewWriter(volumes)}
+	default:
+		return nil, fmt.Errorf("unsupported archive format '%v'", opts.Format)
+	}
 	defer func() {
-		if err := tarWriter.Close(); err != nil {
-			simplelog.Debugf("failed extra close to tar file %v", err)
+		if err := w.Close(); err != nil {
+			simplelog.Debugf("failed extra close to %v writer %v", opts.Format, err)
 		}
 	}()
 
 	srcDir = strings.TrimSuffix(srcDir, string(os.PathSeparator))
 
+	excluded := make(map[string]bool)
+	for _, dir := range opts.Exclude {
+		excluded[filepath.Clean(dir)] = true
+	}
+	first := make(map[string]bool)
+	for _, f := range opts.First {
+		filePath := filepath.Join(srcDir, f)
+		fileInfo, err := os.Stat(filePath)
+		if err != nil {
+			return nil, err
+		}
+		if err := w.add(f, filePath, fileInfo); err != nil {
+			return nil, err
+		}
+		first[filepath.Clean(f)] = true
+	}
+
 	if err := filepath.Walk(srcDir, func(filePath string, fileInfo os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
 		//don't try and archive the tarbal itself
-		if filePath == dest {
+		if filePath == dest || isVolumeOf(filePath, dest) {
 			return nil
 		}
+		if fileInfo.IsDir() && excluded[filePath] {
+			return filepath.SkipDir
+		}
 		// Get the relative path of the file
 		relativePath, err := filepath.Rel(srcDir, filePath)
 		if err != nil {
 			return err
 		}
-
-		header, err := tar.FileInfoHeader(fileInfo, relativePath)
-		if err != nil {
-			return err
+		if first[relativePath] {
+			return nil
 		}
+		return w.add(relativePath, filePath, fileInfo)
+	}); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("failed close to %v writer %w", opts.Format, err)
+	}
+	if err := volumes.Close(); err != nil {
+		return nil, fmt.Errorf("failed close to archive %w", err)
+	}
+	return volumes.Files(), nil
+}
 
-		// Convert path to use forward slashes
-		header.Name = filepath.ToSlash(relativePath)
+// tarDirWriter writes a tar stream through a compressor
+type tarDirWriter struct {
+	compressor io.WriteCloser
+	tarWriter  *tar.Writer
+	closed     bool
+}
 
-		header.Size = fileInfo.Size()
+func newTarWriter(compressor io.WriteCloser) *tarDirWriter {
+	return &tarDirWriter{compressor: compressor, tarWriter: tar.NewWriter(compressor)}
+}
 
-		if err := tarWriter.WriteHeader(header); err != nil {
-			return err
-		}
+func (t *tarDirWriter) add(relativePath, filePath string, fileInfo os.FileInfo) error {
+	header, err := tar.FileInfoHeader(fileInfo, relativePath)
+	if err != nil {
+		return err
+	}
 
-		if !fileInfo.Mode().IsRegular() { //nothing more to do for non-regular
-			return nil
-		}
+	// Convert path to use forward slashes
+	header.Name = filepath.ToSlash(relativePath)
 
-		if !fileInfo.IsDir() {
-			file, err := os.Open(filepath.Clean(filePath))
-			if err != nil {
-				return err
-			}
-
-			defer func() {
-				if err := file.Close(); err != nil {
-					simplelog.Debugf("optional file close for file %v failed %v", filePath, err)
-				}
-			}()
-			if _, err := io.Copy(tarWriter, file); err != nil {
-				return fmt.Errorf("unable to copy file %v to tar due to error %w", filePath, err)
-			}
-			// if err := file.Close(); err != nil {
-			// 	return fmt.Errorf("failed closing file %v: %v", filePath, err)
-			// }
-			return nil
-		}
+	header.Size = fileInfo.Size()
 
-		return nil
-	}); err != nil {
+	if err := t.tarWriter.WriteHeader(header); err != nil {
 		return err
 	}
-	if err := tarWriter.Close(); err != nil {
+
+	if !fileInfo.Mode().IsRegular() { //nothing more to do for non-regular
+		return nil
+	}
+	return copyFile(t.tarWriter, filePath)
+}
+
+func (t *tarDirWriter) Close() error {
+	if t.closed {
+		return nil
+	}
+	t.closed = true
+	if err := t.tarWriter.Close(); err != nil {
 		return fmt.Errorf("failed close to tar file %w", err)
 	}
-	if err := gzWriter.Close(); err != nil {
-		return fmt.Errorf("failed close to gz file %w", err)
+	return t.compressor.Close()
+}
+
+// zipDirWriter writes deflated zip entries
+type zipDirWriter struct {
+	zipWriter *zip.Writer
+	closed    bool
+}
+
+func (z *zipDirWriter) add(relativePath, filePath string, fileInfo os.FileInfo) error {
+	// zip has no entry for the root and no way to store devices or links
+	if relativePath == "." || !(fileInfo.IsDir() || fileInfo.Mode().IsRegular()) {
+		return nil
+	}
+	header, err := zip.FileInfoHeader(fileInfo)
+	if err != nil {
+		return err
 	}
-	if err := tarGzFile.Close(); err != nil {
-		return fmt.Errorf("failed close to tgz file %w", err)
+	header.Name = filepath.ToSlash(relativePath)
+	if fileInfo.IsDir() {
+		header.Name += "/"
+		_, err := z.zipWriter.CreateHeader(header)
+		return err
+	}
+	header.Method = zip.Deflate
+	entry, err := z.zipWriter.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	return copyFile(entry, filePath)
+}
+
+func (z *zipDirWriter) Close() error {
+	if z.closed {
+		return nil
+	}
+	z.closed = true
+	return z.zipWriter.Close()
+}
+
+func copyFile(w io.Writer, filePath string) error {
+	file, err := os.Open(filepath.Clean(filePath))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			simplelog.Debugf("optional file close for file %v failed %v", filePath, err)
+		}
+	}()
+	if _, err := io.Copy(w, file); err != nil {
+		return fmt.Errorf("unable to copy file %v to archive due to error %w", filePath, err)
 	}
 	return nil
 }
@@ -17,7 +17,9 @@ package archive_test
 import (
 	"archive/tar"
 	"compress/gzip"
+	"fmt"
 	"io"
+	"math/rand"
 	"os"
 	"path/filepath"
 	"reflect"
@@ -132,3 +134,269 @@ func TestTarGzDir(t *testing.T) {
 		t.Errorf("expected '%q' but got '%q'", string(original2), string(copied2))
 	}
 }
+
+func writeTestDir(t *testing.T) string {
+	t.Helper()
+	src := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(src, "node1", "logs"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "summary.json"), []byte(`{"ddcVersion": "0.9.0"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// random bytes do not compress so the archive is big enough to split
+	noise := make([]byte, 64*1024)
+	if _, err := rand.New(rand.NewSource(1)).Read(noise); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "node1", "logs", "server.log"), noise, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return src
+}
+
+func assertExtracted(t *testing.T, src, dest string) {
+	t.Helper()
+	for _, f := range []string{"summary.json", filepath.Join("node1", "logs", "server.log")} {
+		expected, err := os.ReadFile(filepath.Join(src, f))
+		if err != nil {
+			t.Fatal(err)
+		}
+		actual, err := os.ReadFile(filepath.Join(dest, f))
+		if err != nil {
+			t.Fatalf("file %v missing from the extracted archive: %v", f, err)
+		}
+		if !reflect.DeepEqual(expected, actual) {
+			t.Errorf("file %v does not match after extracting", f)
+		}
+	}
+}
+
+func TestArchiveDirRoundTrip(t *testing.T) {
+	src := writeTestDir(t)
+	for _, format := range archive.Formats {
+		t.Run(string(format), func(t *testing.T) {
+			dest := filepath.Join(t.TempDir(), "diag."+string(format))
+			files, err := archive.ArchiveDir(src, dest, archive.Options{Format: format})
+			if err != nil {
+				t.Fatalf("unable to archive %v", err)
+			}
+			if !reflect.DeepEqual(files, []string{dest}) {
+				t.Errorf("expected a single file %v but was %v", dest, files)
+			}
+			detected, err := archive.DetectFormat(dest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if detected != format {
+				t.Errorf("expected format %v but detected %v", format, detected)
+			}
+			out := t.TempDir()
+			if err := archive.Extract(dest, out); err != nil {
+				t.Fatalf("unable to extract %v", err)
+			}
+			assertExtracted(t, src, out)
+		})
+	}
+}
+
+func TestArchiveDirSplitsIntoVolumes(t *testing.T) {
+	src := writeTestDir(t)
+	for _, format := range archive.Formats {
+		t.Run(string(format), func(t *testing.T) {
+			dest := filepath.Join(t.TempDir(), "diag."+string(format))
+			var max int64 = 20 * 1024
+			files, err := archive.ArchiveDir(src, dest, archive.Options{Format: format, MaxVolumeBytes: max})
+			if err != nil {
+				t.Fatalf("unable to archive %v", err)
+			}
+			if len(files) < 4 {
+				t.Fatalf("expected at least 4 volumes for 64KB of noise but was %v", files)
+			}
+			for i, f := range files {
+				if f != fmt.Sprintf("%v.%03d", dest, i+1) {
+					t.Errorf("unexpected volume name %v", f)
+				}
+				info, err := os.Stat(f)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if info.Size() > max {
+					t.Errorf("volume %v is %v bytes which is more than %v", f, info.Size(), max)
+				}
+			}
+			if _, err := os.Stat(dest); !os.IsNotExist(err) {
+				t.Errorf("expected no unsplit %v but stat returned %v", dest, err)
+			}
+			// both the first volume and the name it was split from find every volume
+			for _, name := range []string{dest, files[0]} {
+				volumes, err := archive.Volumes(name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(volumes, files) {
+					t.Errorf("expected volumes %v for %v but was %v", files, name, volumes)
+				}
+			}
+			out := t.TempDir()
+			if err := archive.Extract(files[0], out); err != nil {
+				t.Fatalf("unable to extract %v", err)
+			}
+			assertExtracted(t, src, out)
+		})
+	}
+}
+
+func TestWalkReadsEveryFile(t *testing.T) {
+	src := writeTestDir(t)
+	for _, format := range archive.Formats {
+		t.Run(string(format), func(t *testing.T) {
+			dest := filepath.Join(t.TempDir(), "diag."+string(format))
+			if _, err := archive.ArchiveDir(src, dest, archive.Options{Format: format}); err != nil {
+				t.Fatal(err)
+			}
+			sizes := make(map[string]int)
+			if err := archive.Walk(dest, func(e archive.Entry, r io.Reader) error {
+				if r == nil {
+					if !e.IsDir() {
+						t.Errorf("expected content for %v", e.Name)
+					}
+					return nil
+				}
+				b, err := io.ReadAll(r)
+				if err != nil {
+					return err
+				}
+				if int64(len(b)) != e.Size {
+					t.Errorf("read %v bytes of %v but its size is %v", len(b), e.Name, e.Size)
+				}
+				sizes[e.Name] = len(b)
+				return nil
+			}); err != nil {
+				t.Fatal(err)
+			}
+			expected := map[string]int{"summary.json": 23, "node1/logs/server.log": 64 * 1024}
+			if !reflect.DeepEqual(sizes, expected) {
+				t.Errorf("expected %v but was %v", expected, sizes)
+			}
+		})
+	}
+}
+
+func TestArchiveDirWritesFirstFilesFirst(t *testing.T) {
+	src := writeTestDir(t)
+	for _, format := range archive.Formats {
+		t.Run(string(format), func(t *testing.T) {
+			dest := filepath.Join(t.TempDir(), "diag."+string(format))
+			if _, err := archive.ArchiveDir(src, dest, archive.Options{Format: format, First: []string{"summary.json"}}); err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			if err := archive.Walk(dest, func(e archive.Entry, r io.Reader) error {
+				if r != nil {
+					names = append(names, e.Name)
+				}
+				return nil
+			}); err != nil {
+				t.Fatal(err)
+			}
+			expected := []string{"summary.json", "node1/logs/server.log"}
+			if !reflect.DeepEqual(names, expected) {
+				t.Errorf("expected %v but was %v", expected, names)
+			}
+		})
+	}
+}
+
+func TestArchiveDirExcludesDirs(t *testing.T) {
+	src := writeTestDir(t)
+	dest := filepath.Join(t.TempDir(), "diag.tar.gz")
+	if _, err := archive.ArchiveDir(src, dest, archive.Options{Format: archive.TarGz, Exclude: []string{filepath.Join(src, "node1")}}); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	if err := archive.Walk(dest, func(e archive.Entry, r io.Reader) error {
+		if r != nil {
+			names = append(names, e.Name)
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"summary.json"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected %v but was %v", expected, names)
+	}
+}
+
+func TestWalkReportsTruncatedArchive(t *testing.T) {
+	src := writeTestDir(t)
+	dest := filepath.Join(t.TempDir(), "diag.tgz")
+	if _, err := archive.ArchiveDir(src, dest, archive.Options{Format: archive.TarGz}); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(dest, info.Size()/2); err != nil {
+		t.Fatal(err)
+	}
+	err = archive.Walk(dest, func(e archive.Entry, r io.Reader) error {
+		if r != nil {
+			_, err := io.Copy(io.Discard, r)
+			return err
+		}
+		return nil
+	})
+	if err == nil {
+		t.Error("expected an error walking a truncated archive")
+	}
+}
+
+func TestArchiveDirDoesNotSplitWhenItFits(t *testing.T) {
+	src := writeTestDir(t)
+	dest := filepath.Join(t.TempDir(), "diag.tgz")
+	files, err := archive.ArchiveDir(src, dest, archive.Options{Format: archive.TarGz, MaxVolumeBytes: 1024 * 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(files, []string{dest}) {
+		t.Errorf("expected only %v but was %v", dest, files)
+	}
+}
+
+func TestFormatFromName(t *testing.T) {
+	cases := map[string]archive.Format{
+		"diag.tgz":         archive.TarGz,
+		"diag.tar.gz":      archive.TarGz,
+		"diag.tar.zst":     archive.TarZst,
+		"DIAG.ZIP":         archive.Zip,
+		"diag.zip.002":     archive.Zip,
+		"diag":             archive.TarGz,
+		"diag.tar.zst.001": archive.TarZst,
+	}
+	for name, expected := range cases {
+		if actual := archive.FormatFromName(name); actual != expected {
+			t.Errorf("expected %v for %v but was %v", expected, name, actual)
+		}
+	}
+	if _, err := archive.ParseFormat("rar"); err == nil {
+		t.Error("expected rar to be rejected")
+	}
+}
+
+func TestIsArchive(t *testing.T) {
+	cases := map[string]bool{
+		"node1.tar.gz":     true,
+		"diag.zip":         true,
+		"diag.tar.zst.001": true,
+		"diag.tar.zst.002": false,
+		"server.log":       false,
+		"server.log.001":   false,
+	}
+	for name, expected := range cases {
+		if actual := archive.IsArchive(name); actual != expected {
+			t.Errorf("expected %v for %v but was %v", expected, name, actual)
+		}
+	}
+}
@@ -0,0 +1,268 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/dremio/dremio-diagnostic-collector/pkg/simplelog"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	zipMagic  = []byte("PK\x03\x04")
+	// an empty zip is only the end of central directory record
+	emptyZipMagic = []byte("PK\x05\x06")
+)
+
+// DetectFormat reads the start of the archive to find its format, split archives are read
+// from their first volume
+func DetectFormat(name string) (Format, error) {
+	volumes, err := Volumes(name)
+	if err != nil {
+		return "", err
+	}
+	m, err := openVolumes(volumes)
+	if err != nil {
+		return "", err
+	}
+	defer m.Close()
+	return detectFormat(m)
+}
+
+func detectFormat(r io.ReaderAt) (Format, error) {
+	magic := make([]byte, 4)
+	n, err := r.ReadAt(magic, 0)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	magic = magic[:n]
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		return TarGz, nil
+	case bytes.HasPrefix(magic, zstdMagic):
+		return TarZst, nil
+	case bytes.HasPrefix(magic, zipMagic), bytes.HasPrefix(magic, emptyZipMagic):
+		return Zip, nil
+	}
+	return "", fmt.Errorf("unknown archive format, expected one of %v", Formats)
+}
+
+// Entry is a file or directory read from an archive by Walk
+type Entry struct {
+	// Name is the slash separated path of the entry inside the archive
+	Name    string
+	Size    int64
+	Mode    os.FileMode
+	ModTime time.Time
+}
+
+// IsDir is true for directory entries
+func (e Entry) IsDir() bool {
+	return e.Mode.IsDir()
+}
+
+// Walk calls fn for every entry of a tar.gz, tar.zst or zip archive in the order they were written,
+// r reads the content of regular files and is nil for everything else. The format is detected from
+// the content and the volumes of a split archive are read in order. An error reading the archive,
+// for example because it was truncated, is returned after fn has seen every entry before it.
+// A directory, such as the one an archive was extracted to, is walked the same way
+func Walk(name string, fn func(e Entry, r io.Reader) error) error {
+	if info, err := os.Stat(name); err == nil && info.IsDir() {
+		return walkDir(name, fn)
+	}
+	volumes, err := Volumes(name)
+	if err != nil {
+		return err
+	}
+	m, err := openVolumes(volumes)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+	format, err := detectFormat(m)
+	if err != nil {
+		return fmt.Errorf("unable to read %v: %w", name, err)
+	}
+	stream := io.NewSectionReader(m, 0, m.size)
+	switch format {
+	case TarGz:
+		gzReader, err := gzip.NewReader(stream)
+		if err != nil {
+			return err
+		}
+		defer gzReader.Close()
+		return walkTar(gzReader, fn)
+	case TarZst:
+		zstdReader, err := zstd.NewReader(stream)
+		if err != nil {
+			return err
+		}
+		defer zstdReader.Close()
+		return walkTar(zstdReader, fn)
+	default:
+		zipReader, err := zip.NewReader(m, m.size)
+		if err != nil {
+			return err
+		}
+		return walkZip(zipReader, fn)
+	}
+}
+
+func walkDir(root string, fn func(e Entry, r io.Reader) error) error {
+	return filepath.Walk(root, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, filePath)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		e := Entry{Name: filepath.ToSlash(rel), Size: info.Size(), Mode: info.Mode(), ModTime: info.ModTime()}
+		if !info.Mode().IsRegular() {
+			return fn(e, nil)
+		}
+		f, err := os.Open(filepath.Clean(filePath))
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err := f.Close(); err != nil {
+				simplelog.Debugf("optional close of %v failed %v", filePath, err)
+			}
+		}()
+		return fn(e, f)
+	})
+}
+
+func walkTar(r io.Reader, fn func(e Entry, r io.Reader) error) error {
+	tarReader := tar.NewReader(r)
+	for {
+		header, err := tarReader.Next()
+		switch {
+		case err == io.EOF:
+			return nil
+		case err != nil:
+			return err
+		case header == nil:
+			continue
+		}
+		e := Entry{Name: header.Name, Size: header.Size, Mode: header.FileInfo().Mode(), ModTime: header.ModTime}
+		var content io.Reader
+		if header.Typeflag == tar.TypeReg {
+			content = tarReader
+		}
+		if err := fn(e, content); err != nil {
+			return err
+		}
+	}
+}
+
+func walkZip(r *zip.Reader, fn func(e Entry, r io.Reader) error) error {
+	for _, f := range r.File {
+		e := Entry{Name: f.Name, Size: int64(f.UncompressedSize64), Mode: f.Mode(), ModTime: f.Modified}
+		if !f.Mode().IsRegular() {
+			if err := fn(e, nil); err != nil {
+				return err
+			}
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return fmt.Errorf("unable to open %v in zip: %w", f.Name, err)
+		}
+		err = fn(e, rc)
+		if closeErr := rc.Close(); closeErr != nil {
+			simplelog.Debugf("failed close to zip entry %v %v", f.Name, closeErr)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Extract writes the contents of a tar.gz, tar.zst or zip archive to dest, the format is
+// detected from the content and the volumes of a split archive are read in order
+func Extract(name, dest string) error {
+	return Walk(name, func(e Entry, r io.Reader) error {
+		target, err := SanitizeArchivePath(dest, e.Name)
+		if err != nil {
+			return err
+		}
+		switch {
+		case e.IsDir():
+			if _, err := os.Stat(target); err != nil {
+				if err := os.MkdirAll(filepath.Clean(target), 0750); err != nil {
+					return err
+				}
+			}
+		case r != nil:
+			return writeFile(target, e.Mode.Perm(), r)
+		}
+		return nil
+	})
+}
+
+func writeFile(target string, mode os.FileMode, r io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0750); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(filepath.Clean(target), os.O_CREATE|os.O_RDWR|os.O_TRUNC, mode)
+	if err != nil {
+		simplelog.Errorf("skipping file %v due to error %v", target, err)
+		return nil
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			simplelog.Debugf("optional file close for file %v failed %v", target, err)
+		}
+	}()
+	for {
+		_, err := io.CopyN(file, r, 1024)
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+	}
+	simplelog.Debugf("extracted file %v", file.Name())
+	return nil
+}
+
+// Sanitize archive file pathing from "G305: Zip Slip vulnerability"
+func SanitizeArchivePath(d, t string) (v string, err error) {
+	v = filepath.Join(d, t)
+	if strings.HasPrefix(v, filepath.Clean(d)) {
+		return v, nil
+	}
+	return "", fmt.Errorf("%s: %s", "content filepath is tainted", t)
+}
@@ -0,0 +1,247 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package archive
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+
+	"github.com/dremio/dremio-diagnostic-collector/pkg/simplelog"
+)
+
+// volumes are numbered dest.001, dest.002 and so on so they can also be joined with cat
+const firstVolumeSuffix = ".001"
+
+var volumeSuffix = regexp.MustCompile(`\.\d{3}$`)
+
+func volumeName(dest string, i int) string {
+	return fmt.Sprintf("%v.%03d", dest, i)
+}
+
+func isVolume(name string) bool {
+	return volumeSuffix.MatchString(name)
+}
+
+func isVolumeOf(name, dest string) bool {
+	return isVolume(name) && trimVolumeSuffix(name) == dest
+}
+
+// VolumeSuffix is the volume number of a split archive file like .001, or empty for an unsplit archive
+func VolumeSuffix(name string) string {
+	return volumeSuffix.FindString(name)
+}
+
+func trimVolumeSuffix(name string) string {
+	return volumeSuffix.ReplaceAllString(name, "")
+}
+
+// volumeWriter writes to dest, or to numbered volumes of at most max bytes when max is set.
+// An archive that fits in one volume is renamed to dest so it is not split needlessly.
+type volumeWriter struct {
+	dest    string
+	max     int64
+	current *os.File
+	written int64
+	files   []string
+	closed  bool
+}
+
+func newVolumeWriter(dest string, max int64) (*volumeWriter, error) {
+	if max < 0 {
+		return nil, fmt.Errorf("maximum volume size must not be negative but was %v", max)
+	}
+	// volumes of an earlier archive with the same name would look like part of this one
+	old, err := filepath.Glob(dest + ".[0-9][0-9][0-9]")
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range old {
+		if err := os.Remove(f); err != nil {
+			return nil, fmt.Errorf("unable to remove old volume %v: %w", f, err)
+		}
+	}
+	if max > 0 {
+		if err := os.Remove(dest); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("unable to remove old archive %v: %w", dest, err)
+		}
+	}
+	w := &volumeWriter{dest: dest, max: max}
+	if err := w.next(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *volumeWriter) next() error {
+	if w.current != nil {
+		if err := w.current.Close(); err != nil {
+			return fmt.Errorf("failed close to volume %v: %w", w.current.Name(), err)
+		}
+	}
+	name := w.dest
+	if w.max > 0 {
+		name = volumeName(w.dest, len(w.files)+1)
+	}
+	f, err := os.Create(filepath.Clean(name))
+	if err != nil {
+		return err
+	}
+	w.current = f
+	w.written = 0
+	w.files = append(w.files, name)
+	return nil
+}
+
+func (w *volumeWriter) Write(p []byte) (int, error) {
+	total := 0
+	for len(p) > 0 {
+		chunk := p
+		if w.max > 0 {
+			if w.written >= w.max {
+				if err := w.next(); err != nil {
+					return total, err
+				}
+			}
+			if remaining := w.max - w.written; int64(len(chunk)) > remaining {
+				chunk = chunk[:remaining]
+			}
+		}
+		n, err := w.current.Write(chunk)
+		total += n
+		w.written += int64(n)
+		if err != nil {
+			return total, err
+		}
+		p = p[n:]
+	}
+	return total, nil
+}
+
+func (w *volumeWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	if err := w.current.Close(); err != nil {
+		return fmt.Errorf("failed close to volume %v: %w", w.current.Name(), err)
+	}
+	if w.max > 0 && len(w.files) == 1 {
+		if err := os.Rename(w.files[0], w.dest); err != nil {
+			return fmt.Errorf("unable to rename %v to %v: %w", w.files[0], w.dest, err)
+		}
+		w.files[0] = w.dest
+	}
+	return nil
+}
+
+// Files are the volumes written
+func (w *volumeWriter) Files() []string {
+	return w.files
+}
+
+// Volumes finds the files of the archive, name can be the archive itself, its first volume
+// or the name the volumes were split from
+func Volumes(name string) ([]string, error) {
+	base := name
+	if isVolume(name) {
+		base = trimVolumeSuffix(name)
+	} else if _, err := os.Stat(name); err == nil {
+		return []string{name}, nil
+	}
+	var volumes []string
+	for i := 1; ; i++ {
+		v := volumeName(base, i)
+		if _, err := os.Stat(v); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				break
+			}
+			return nil, err
+		}
+		volumes = append(volumes, v)
+	}
+	if len(volumes) == 0 {
+		return nil, fmt.Errorf("archive %v not found: %w", name, os.ErrNotExist)
+	}
+	sort.Strings(volumes)
+	return volumes, nil
+}
+
+// multiVolume reads the volumes of an archive as if they were one file
+type multiVolume struct {
+	files   []*os.File
+	offsets []int64
+	size    int64
+}
+
+func openVolumes(volumes []string) (*multiVolume, error) {
+	m := &multiVolume{}
+	for _, v := range volumes {
+		f, err := os.Open(filepath.Clean(v))
+		if err != nil {
+			m.Close()
+			return nil, err
+		}
+		info, err := f.Stat()
+		if err != nil {
+			m.Close()
+			if closeErr := f.Close(); closeErr != nil {
+				simplelog.Debugf("failed close to volume %v %v", v, closeErr)
+			}
+			return nil, err
+		}
+		m.files = append(m.files, f)
+		m.offsets = append(m.offsets, m.size)
+		m.size += info.Size()
+	}
+	return m, nil
+}
+
+func (m *multiVolume) ReadAt(p []byte, off int64) (int, error) {
+	if off >= m.size {
+		return 0, io.EOF
+	}
+	// the last volume starting at or before off
+	i := sort.Search(len(m.offsets), func(i int) bool { return m.offsets[i] > off }) - 1
+	total := 0
+	for len(p) > 0 && i < len(m.files) {
+		n, err := m.files[i].ReadAt(p, off-m.offsets[i])
+		total += n
+		off += int64(n)
+		p = p[n:]
+		if err != nil && err != io.EOF {
+			return total, err
+		}
+		if len(p) > 0 {
+			i++
+		}
+	}
+	if len(p) > 0 {
+		return total, io.EOF
+	}
+	return total, nil
+}
+
+func (m *multiVolume) Close() {
+	for _, f := range m.files {
+		if err := f.Close(); err != nil {
+			simplelog.Debugf("failed close to volume %v %v", f.Name(), err)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// package collectplan provides the dry run plan written by local-collect --dry-run and aggregated by ddc --dry-run
+package collectplan
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// CollectorPlan describes what a single collector would do on the node
+type CollectorPlan struct {
+	Name            string   `json:"name"`
+	Commands        []string `json:"commands,omitempty"`
+	Reads           []string `json:"reads,omitempty"`
+	Requests        []string `json:"requests,omitempty"`
+	DurationSeconds int      `json:"durationSeconds"`
+	// EstimatedBytes is the size of what is read or captured before it is compressed into the tarball
+	EstimatedBytes int64 `json:"estimatedBytes"`
+}
+
+// NodePlan is the resolved configuration of a node and every collector local-collect would schedule on it
+type NodePlan struct {
+	NodeName                 string          `json:"nodeName"`
+	DDCVersion               string          `json:"ddcVersion"`
+	CollectionMode           string          `json:"collectionMode,omitempty"`
+	DremioPID                int             `json:"dremioPID"`
+	DremioPIDDetection       bool            `json:"dremioPIDDetection"`
+	DremioLogDir             string          `json:"dremioLogDir"`
+	DremioConfDir            string          `json:"dremioConfDir"`
+	DremioGCLogsDir          string          `json:"dremioGCLogsDir"`
+	DremioRocksDBDir         string          `json:"dremioRocksDBDir"`
+	OutputDir                string          `json:"outputDir"`
+	Tarball                  string          `json:"tarball"`
+	NumberThreads            int             `json:"numberThreads"`
+	Collectors               []CollectorPlan `json:"collectors"`
+	Skipped                  []string        `json:"skipped"`
+	EstimatedDurationSeconds int             `json:"estimatedDurationSeconds"`
+	EstimatedBytes           int64           `json:"estimatedBytes"`
+}
+
+// HostPlan is the plan of one host as seen by ddc, Error is set when the plan could not be made
+type HostPlan struct {
+	Host          string    `json:"host"`
+	IsCoordinator bool      `json:"isCoordinator"`
+	Error         string    `json:"error,omitempty"`
+	Plan          *NodePlan `json:"plan,omitempty"`
+}
+
+// ClusterPlan is written by ddc --dry-run with the plan of every host found
+type ClusterPlan struct {
+	DDCVersion               string     `json:"ddcVersion"`
+	Collector                string     `json:"collector"`
+	Coordinators             []string   `json:"coordinators"`
+	Executors                []string   `json:"executors"`
+	Hosts                    []HostPlan `json:"hosts"`
+	FailedHosts              []string   `json:"failedHosts"`
+	EstimatedDurationSeconds int        `json:"estimatedDurationSeconds"`
+	EstimatedBytes           int64      `json:"estimatedBytes"`
+}
+
+// EstimateDuration returns how long the durations take when spread over the number of workers,
+// each one goes to the worker that frees up first. Workers of 0 or less run everything at once.
+func EstimateDuration(durations []int, workers int) int {
+	if workers <= 0 || workers > len(durations) {
+		workers = len(durations)
+	}
+	if workers == 0 {
+		return 0
+	}
+	sorted := append([]int{}, durations...)
+	sort.Sort(sort.Reverse(sort.IntSlice(sorted)))
+	busy := make([]int, workers)
+	for _, d := range sorted {
+		next := 0
+		for i := range busy {
+			if busy[i] < busy[next] {
+				next = i
+			}
+		}
+		busy[next] += d
+	}
+	longest := 0
+	for _, b := range busy {
+		if b > longest {
+			longest = b
+		}
+	}
+	return longest
+}
+
+// ParseNodePlan finds the plan in the output of local-collect --dry-run, the plan is printed last
+// as indented json so it starts at the last line that is only an opening brace, nested objects are indented
+func ParseNodePlan(output string) (NodePlan, error) {
+	lines := strings.Split(output, "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		if strings.TrimRight(lines[i], "\r") != "{" {
+			continue
+		}
+		var plan NodePlan
+		dec := json.NewDecoder(strings.NewReader(strings.Join(lines[i:], "\n")))
+		if err := dec.Decode(&plan); err != nil {
+			return NodePlan{}, fmt.Errorf("unable to read the plan from the local-collect output: %w", err)
+		}
+		return plan, nil
+	}
+	return NodePlan{}, errors.New("no plan found in the local-collect output")
+}
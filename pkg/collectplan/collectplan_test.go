@@ -0,0 +1,67 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// package collectplan provides the dry run plan written by local-collect --dry-run and aggregated by ddc --dry-run
+package collectplan
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestEstimateDuration(t *testing.T) {
+	tests := []struct {
+		name      string
+		durations []int
+		workers   int
+		expected  int
+	}{
+		{"nothing to run", nil, 2, 0},
+		{"more workers than jobs", []int{60, 60, 60}, 4, 60},
+		{"two workers", []int{60, 60, 60, 0, 0}, 2, 120},
+		{"longest first", []int{10, 30, 20, 40}, 2, 50},
+		{"no limit", []int{10, 60}, 0, 60},
+	}
+	for _, tt := range tests {
+		if actual := EstimateDuration(tt.durations, tt.workers); actual != tt.expected {
+			t.Errorf("%v: expected %v but was %v", tt.name, tt.expected, actual)
+		}
+	}
+}
+
+func TestParseNodePlan(t *testing.T) {
+	plan := NodePlan{
+		NodeName:  "node1",
+		DremioPID: 100,
+		Collectors: []CollectorPlan{
+			{Name: "jfr", Commands: []string{"jcmd 100 JFR.start"}, DurationSeconds: 60},
+		},
+	}
+	b, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := "0.9.0\nconfigured log dir is /var/log/dremio\n{\nnot json\n" + string(b) + "\n"
+	parsed, err := ParseNodePlan(output)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if parsed.NodeName != "node1" || parsed.DremioPID != 100 || len(parsed.Collectors) != 1 || parsed.Collectors[0].DurationSeconds != 60 {
+		t.Errorf("unexpected plan %#v", parsed)
+	}
+
+	if _, err := ParseNodePlan("0.9.0\nunable to read configuration"); err == nil {
+		t.Error("expected an error when there is no plan")
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"sort"
 	"strings"
 	"sync"
+	"text/tabwriter"
 	"time"
 )
 
@@ -42,11 +43,14 @@ type CollectionStats struct {
 	tarball              string
 	nodeCaptureStats     map[string]*NodeCaptureStats
 	result               string
+	upload               string
 	k8sFilesCollected    []string
 	lastK8sFileCollected string
 	enabled              []string
 	disabled             []string
 	patSet               bool
+	preflightChecks      []string
+	preflight            map[string]map[string]bool
 	mu                   sync.RWMutex // Mutex to protect access
 }
 
@@ -72,18 +76,41 @@ func UpdateK8sFiles(fileName string) {
 	defer c.mu.Unlock()
 	c.k8sFilesCollected = append(c.k8sFilesCollected, fileName)
 	c.lastK8sFileCollected = fileName
+	emit(Event{Event: EventK8sFile, File: fileName})
 }
 
 func UpdateTarballDir(tarballDir string) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	c.tarball = tarballDir
+	emit(Event{Event: EventTarball, Tarball: tarballDir})
 }
 
 func UpdateResult(result string) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	c.result = result
+	emit(Event{Event: EventResult, Result: result})
+}
+
+// UpdateUpload sets the progress or outcome of the archive upload, it is shown on the result line
+func UpdateUpload(upload string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.upload = upload
+	emit(Event{Event: EventUpload, Upload: upload})
+}
+
+// resultLine is the result followed by the upload status, called with c.mu held
+func resultLine() string {
+	switch {
+	case c.upload == "":
+		return c.result
+	case c.result == "":
+		return c.upload
+	default:
+		return c.result + " - " + c.upload
+	}
 }
 
 var c *CollectionStats
@@ -91,6 +118,7 @@ var c *CollectionStats
 func init() {
 	c = &CollectionStats{
 		nodeCaptureStats: make(map[string]*NodeCaptureStats),
+		preflight:        make(map[string]map[string]bool),
 	}
 	if strings.HasSuffix(os.Args[0], ".test") {
 		clearCode = "CLEAR SCREEN"
@@ -100,28 +128,115 @@ func init() {
 // Update updates the CollectionStats fields in a thread-safe manner.
 func UpdateNodeState(node string, status string) {
 	c.mu.Lock()
-	if _, ok := c.nodeCaptureStats[node]; ok {
-		c.nodeCaptureStats[node].status = status
-		if status == "COMPLETED" || strings.HasPrefix(status, "FAILED") {
-			if c.nodeCaptureStats[node].endTime == 0 {
-				c.TransfersComplete++
-				c.nodeCaptureStats[node].endTime = time.Now().Unix()
-			}
-		}
-	} else {
-		c.nodeCaptureStats[node] = &NodeCaptureStats{
+	stats, ok := c.nodeCaptureStats[node]
+	if !ok {
+		stats = &NodeCaptureStats{
 			startTime: time.Now().Unix(),
-			status:    status,
 		}
+		c.nodeCaptureStats[node] = stats
+	}
+	if stats.endTime > 0 {
+		// the node already finished, late updates (for example from a capture that ran past its timeout) are ignored
+		c.mu.Unlock()
+		return
+	}
+	changed := stats.status != status
+	stats.status = status
+	if strings.HasPrefix(status, "COMPLETED") || strings.HasPrefix(status, "FAILED") {
+		if stats.endTime == 0 {
+			c.TransfersComplete++
+			stats.endTime = time.Now().Unix()
+		}
+	}
+	if changed {
+		end := stats.endTime
+		if end == 0 {
+			end = time.Now().Unix()
+		}
+		elapsed := end - stats.startTime
+		emit(Event{Event: EventNodeState, Node: node, Status: status, ElapsedSeconds: &elapsed})
 	}
 	c.mu.Unlock()
 }
 
+// UpdatePreflight records the result of a preflight check on a node, checks are shown in the order first seen
+func UpdatePreflight(node, check string, passed bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	found := false
+	for _, name := range c.preflightChecks {
+		if name == check {
+			found = true
+			break
+		}
+	}
+	if !found {
+		c.preflightChecks = append(c.preflightChecks, check)
+	}
+	checks, ok := c.preflight[node]
+	if !ok {
+		checks = make(map[string]bool)
+		c.preflight[node] = checks
+	}
+	checks[check] = passed
+	emit(Event{Event: EventPreflight, Node: node, Check: check, Passed: &passed})
+}
+
+// PreflightMatrix renders a PASS/FAIL table with a row per node and a column per check,
+// a check that did not run on a node is shown as -
+func PreflightMatrix() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return preflightMatrix()
+}
+
+func preflightMatrix() string {
+	if len(c.preflight) == 0 {
+		return ""
+	}
+	var nodes []string
+	for k := range c.preflight {
+		nodes = append(nodes, k)
+	}
+	sort.Strings(nodes)
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "node\t%v\n", strings.Join(c.preflightChecks, "\t"))
+	for _, node := range nodes {
+		var row []string
+		for _, check := range c.preflightChecks {
+			passed, ok := c.preflight[node][check]
+			switch {
+			case !ok:
+				row = append(row, "-")
+			case passed:
+				row = append(row, "PASS")
+			default:
+				row = append(row, "FAIL")
+			}
+		}
+		fmt.Fprintf(w, "%v\t%v\n", node, strings.Join(row, "\t"))
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Sprintf("unable to render preflight matrix: %v", err)
+	}
+	return b.String()
+}
+
 var clearCode = "\033[H\033[2J"
 
+// PrintState redraws the status screen, with --progress plain it is printed once without clearing the
+// screen and with --progress json it is a summary event
 func PrintState() {
 	c.mu.Lock()
-	fmt.Print(clearCode)
+	switch progress {
+	case ProgressJSON:
+		emit(summary())
+		c.mu.Unlock()
+		return
+	case ProgressTUI:
+		fmt.Print(clearCode)
+	}
 	total := c.totalTransfers
 	var keys []string
 	for k := range c.nodeCaptureStats {
@@ -135,6 +250,11 @@ func PrintState() {
 		nodes.WriteString(fmt.Sprintf("files collected       : %v\n", len(c.k8sFilesCollected)))
 		nodes.WriteString("\n")
 	}
+	if matrix := preflightMatrix(); matrix != "" {
+		nodes.WriteString("Preflight:\n----------\n")
+		nodes.WriteString(matrix)
+		nodes.WriteString("\n")
+	}
 	if len(c.nodeCaptureStats) > 0 {
 		nodes.WriteString("Nodes:\n------\n")
 	}
@@ -177,7 +297,7 @@ Result               : %v
 
 %v
 `, time.Now().Format(time.RFC1123), strings.TrimSpace(c.ddcVersion), c.ddcYaml, c.logFile, c.collectionType, strings.Join(c.enabled, ","), strings.Join(c.disabled, ","), patMessage, c.TransfersComplete, total,
-		c.tarball, c.result, nodes.String())
+		c.tarball, resultLine(), nodes.String())
 	c.mu.Unlock()
 
 }
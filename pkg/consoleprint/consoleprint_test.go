@@ -15,8 +15,11 @@
 package consoleprint_test
 
 import (
+	"encoding/json"
+	"errors"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/dremio/dremio-diagnostic-collector/pkg/consoleprint"
 	"github.com/dremio/dremio-diagnostic-collector/pkg/output"
@@ -35,3 +38,137 @@ func TestClearsScreen(t *testing.T) {
 		t.Errorf("output %v did not contain 'CLEAR SCREEN'", out)
 	}
 }
+
+func TestNodeCompletedFromCheckpointIsCounted(t *testing.T) {
+	consoleprint.UpdateRuntime("", "", "", "", nil, nil, false, 0, 1)
+	consoleprint.UpdateNodeState("checkpoint-node", "COMPLETED - FROM CHECKPOINT")
+	out, err := output.CaptureOutput(func() {
+		consoleprint.PrintState()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "Transfers Complete   : 1/1") {
+		t.Errorf("expected the node to be counted as complete in %v", out)
+	}
+}
+
+func TestNodeStateIsFinalOnceFailed(t *testing.T) {
+	consoleprint.UpdateNodeState("timeout-node", "COLLECTING")
+	consoleprint.UpdateNodeState("timeout-node", "FAILED - TIMEOUT")
+	consoleprint.UpdateNodeState("timeout-node", "TARBALL TRANSFER")
+	out, err := output.CaptureOutput(func() {
+		consoleprint.PrintState()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "status FAILED - TIMEOUT") {
+		t.Errorf("expected the failed status to be kept in %v", out)
+	}
+}
+
+func TestPreflightMatrix(t *testing.T) {
+	consoleprint.UpdatePreflight("node-b", "sudo", true)
+	consoleprint.UpdatePreflight("node-b", "jcmd", false)
+	consoleprint.UpdatePreflight("node-a", "jcmd", true)
+	expected := `node    sudo  jcmd
+node-a  -     PASS
+node-b  PASS  FAIL
+`
+	if actual := consoleprint.PreflightMatrix(); actual != expected {
+		t.Errorf("expected\n%v\nbut was\n%v", expected, actual)
+	}
+	out, err := output.CaptureOutput(func() {
+		consoleprint.PrintState()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "Preflight:") || !strings.Contains(out, "node-b  PASS  FAIL") {
+		t.Errorf("expected the preflight matrix in %v", out)
+	}
+}
+
+func setProgress(t *testing.T, mode string) {
+	t.Helper()
+	if err := consoleprint.SetProgress(mode); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := consoleprint.SetProgress(consoleprint.ProgressTUI); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestJSONProgress(t *testing.T) {
+	setProgress(t, consoleprint.ProgressJSON)
+	out, err := output.CaptureOutput(func() {
+		consoleprint.UpdateNodeState("json-node", "COLLECTING")
+		// unchanged so not reported again
+		consoleprint.UpdateNodeState("json-node", "COLLECTING")
+		consoleprint.UpdateK8sFiles("pods.json")
+		consoleprint.TaskStarted("jfr")
+		consoleprint.TaskFinished("jfr", 2*time.Second, errors.New("jcmd not found"))
+		consoleprint.UpdateResult("complete")
+		consoleprint.PrintState()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	var events []consoleprint.Event
+	for _, line := range lines {
+		var e consoleprint.Event
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("line %q is not json: %v", line, err)
+		}
+		events = append(events, e)
+	}
+	var names []string
+	for _, e := range events {
+		names = append(names, e.Event)
+	}
+	expected := []string{"node-state", "k8s-file", "task-start", "task-failed", "result", "summary"}
+	if strings.Join(names, ",") != strings.Join(expected, ",") {
+		t.Fatalf("expected events %v but was %v", expected, names)
+	}
+	if events[0].Node != "json-node" || events[0].Status != "COLLECTING" || events[1].File != "pods.json" {
+		t.Errorf("unexpected events %#v", events[:2])
+	}
+	if events[3].Task != "jfr" || events[3].Error != "jcmd not found" || *events[3].DurationSeconds != 2 {
+		t.Errorf("unexpected task event %#v", events[3])
+	}
+	summary := events[5]
+	if summary.Result != "complete" || summary.TotalTransfers == nil {
+		t.Errorf("unexpected summary %#v", summary)
+	}
+	var found bool
+	for _, n := range summary.Nodes {
+		found = found || (n.Node == "json-node" && n.Status == "COLLECTING")
+	}
+	if !found {
+		t.Errorf("expected json-node in the summary %#v", summary.Nodes)
+	}
+}
+
+func TestPlainProgressDoesNotClearScreen(t *testing.T) {
+	setProgress(t, consoleprint.ProgressPlain)
+	out, err := output.CaptureOutput(func() {
+		consoleprint.TaskFinished("ttop", time.Second, nil)
+		consoleprint.PrintState()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out, "CLEAR SCREEN") || !strings.Contains(out, "task ttop finished in 1.0s") {
+		t.Errorf("unexpected plain output %v", out)
+	}
+}
+
+func TestSetProgressRejectsUnknownModes(t *testing.T) {
+	if err := consoleprint.SetProgress("fancy"); err == nil {
+		t.Error("expected an error for an unknown mode")
+	}
+}
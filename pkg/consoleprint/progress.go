@@ -0,0 +1,219 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package consoleprint
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// progress modes for --progress
+const (
+	// ProgressAuto is tui when stdout is a terminal and plain otherwise
+	ProgressAuto = "auto"
+	// ProgressTUI redraws the status screen
+	ProgressTUI = "tui"
+	// ProgressPlain prints a line per event and the status once at the end
+	ProgressPlain = "plain"
+	// ProgressJSON prints an Event per line
+	ProgressJSON = "json"
+)
+
+// event names
+const (
+	EventNodeState  = "node-state"
+	EventK8sFile    = "k8s-file"
+	EventPreflight  = "preflight"
+	EventTarball    = "tarball"
+	EventUpload     = "upload"
+	EventTaskStart  = "task-start"
+	EventTaskFinish = "task-finish"
+	EventTaskFailed = "task-failed"
+	EventResult     = "result"
+	EventSummary    = "summary"
+)
+
+var progress = ProgressTUI
+
+// emitMu keeps the lines of events written from several goroutines whole
+var emitMu sync.Mutex
+
+// Event is a line of the json progress stream, only the fields of the event are set
+type Event struct {
+	Time              time.Time   `json:"time"`
+	Event             string      `json:"event"`
+	Node              string      `json:"node,omitempty"`
+	Status            string      `json:"status,omitempty"`
+	ElapsedSeconds    *int64      `json:"elapsedSeconds,omitempty"`
+	File              string      `json:"file,omitempty"`
+	Check             string      `json:"check,omitempty"`
+	Passed            *bool       `json:"passed,omitempty"`
+	Task              string      `json:"task,omitempty"`
+	DurationSeconds   *float64    `json:"durationSeconds,omitempty"`
+	Error             string      `json:"error,omitempty"`
+	Tarball           string      `json:"tarball,omitempty"`
+	Upload            string      `json:"upload,omitempty"`
+	Result            string      `json:"result,omitempty"`
+	TransfersComplete *int        `json:"transfersComplete,omitempty"`
+	TotalTransfers    *int        `json:"totalTransfers,omitempty"`
+	Nodes             []NodeState `json:"nodes,omitempty"`
+}
+
+// NodeState is a node in the summary event
+type NodeState struct {
+	Node           string `json:"node"`
+	Status         string `json:"status"`
+	ElapsedSeconds int64  `json:"elapsedSeconds"`
+}
+
+// SetProgress picks how progress is shown, auto resolves to tui or plain depending on whether stdout is a terminal
+func SetProgress(mode string) error {
+	switch mode {
+	case ProgressAuto:
+		if term.IsTerminal(int(os.Stdout.Fd())) {
+			progress = ProgressTUI
+		} else {
+			progress = ProgressPlain
+		}
+	case ProgressTUI, ProgressPlain, ProgressJSON:
+		progress = mode
+	default:
+		return fmt.Errorf("unknown progress mode %q, use %v, %v, %v or %v", mode, ProgressAuto, ProgressTUI, ProgressPlain, ProgressJSON)
+	}
+	return nil
+}
+
+// Progress is the resolved progress mode
+func Progress() string {
+	return progress
+}
+
+// Interactive is true when the status screen is redrawn and prompts can be shown
+func Interactive() bool {
+	return progress == ProgressTUI
+}
+
+// TaskStarted reports a task of the local-collect thread pool starting
+func TaskStarted(task string) {
+	emit(Event{Event: EventTaskStart, Task: task})
+}
+
+// TaskFinished reports a task of the local-collect thread pool ending, the status screen shows a . or an x
+func TaskFinished(task string, duration time.Duration, err error) {
+	if progress == ProgressTUI {
+		if err != nil {
+			fmt.Print("x")
+		} else {
+			fmt.Print(".")
+		}
+		return
+	}
+	seconds := duration.Seconds()
+	e := Event{Event: EventTaskFinish, Task: task, DurationSeconds: &seconds}
+	if err != nil {
+		e.Event = EventTaskFailed
+		e.Error = err.Error()
+	}
+	emit(e)
+}
+
+// emit writes the event for json and plain progress, the status screen shows the state instead
+func emit(e Event) {
+	if progress == ProgressTUI {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	var line string
+	if progress == ProgressJSON {
+		b, err := json.Marshal(e)
+		if err != nil {
+			line = fmt.Sprintf(`{"event":"error","error":%q}`, err.Error())
+		} else {
+			line = string(b)
+		}
+	} else {
+		line = e.text()
+	}
+	emitMu.Lock()
+	defer emitMu.Unlock()
+	fmt.Println(line)
+}
+
+// text is the event as a line of plain progress
+func (e Event) text() string {
+	switch e.Event {
+	case EventNodeState:
+		return fmt.Sprintf("node %v: %v", e.Node, e.Status)
+	case EventK8sFile:
+		return fmt.Sprintf("kubernetes: collected %v", e.File)
+	case EventPreflight:
+		result := "FAIL"
+		if e.Passed != nil && *e.Passed {
+			result = "PASS"
+		}
+		return fmt.Sprintf("preflight %v on %v: %v", e.Check, e.Node, result)
+	case EventTarball:
+		return fmt.Sprintf("tarball: %v", e.Tarball)
+	case EventUpload:
+		return fmt.Sprintf("upload: %v", e.Upload)
+	case EventTaskStart:
+		return fmt.Sprintf("task %v started", e.Task)
+	case EventTaskFinish:
+		return fmt.Sprintf("task %v finished in %.1fs", e.Task, *e.DurationSeconds)
+	case EventTaskFailed:
+		return fmt.Sprintf("task %v failed after %.1fs: %v", e.Task, *e.DurationSeconds, e.Error)
+	case EventResult:
+		return fmt.Sprintf("result: %v", e.Result)
+	default:
+		return e.Event
+	}
+}
+
+// summary is the whole state as an event, called with c.mu held
+func summary() Event {
+	complete, total := c.TransfersComplete, c.totalTransfers
+	e := Event{
+		Event:             EventSummary,
+		Tarball:           c.tarball,
+		Upload:            c.upload,
+		Result:            c.result,
+		TransfersComplete: &complete,
+		TotalTransfers:    &total,
+	}
+	var keys []string
+	for k := range c.nodeCaptureStats {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	now := time.Now().Unix()
+	for _, k := range keys {
+		node := c.nodeCaptureStats[k]
+		end := node.endTime
+		if end == 0 {
+			end = now
+		}
+		e.Nodes = append(e.Nodes, NodeState{Node: k, Status: strings.TrimSpace(node.status), ElapsedSeconds: end - node.startTime})
+	}
+	return e
+}
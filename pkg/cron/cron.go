@@ -0,0 +1,212 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// package cron parses standard five field cron expressions and finds when they next fire
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+type bounds struct {
+	name     string
+	min, max int
+	names    map[string]int
+}
+
+var (
+	minutes = bounds{name: "minute", min: 0, max: 59}
+	hours   = bounds{name: "hour", min: 0, max: 23}
+	days    = bounds{name: "day of month", min: 1, max: 31}
+	months  = bounds{name: "month", min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6, "jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	// 7 is accepted for sunday like most crons do and is folded onto 0 after parsing
+	weekdays = bounds{name: "day of week", min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+// Schedule is a parsed cron expression, each field is a bit set of the values it matches
+type Schedule struct {
+	expr     string
+	minute   uint64
+	hour     uint64
+	dom      uint64
+	month    uint64
+	dow      uint64
+	anyDOM   bool
+	anyDOW   bool
+	location *time.Location
+}
+
+// Parse reads a "minute hour day-of-month month day-of-week" expression. Fields take *, numbers, names
+// for months and weekdays, ranges (1-5), lists (1,15) and steps (*/15, 0-30/10). The @hourly, @daily,
+// @midnight, @weekly, @monthly, @yearly and @annually shortcuts are also accepted. Times are local.
+func Parse(expr string) (Schedule, error) {
+	return ParseInLocation(expr, time.Local)
+}
+
+// ParseInLocation is Parse with the times of the expression read in loc
+func ParseInLocation(expr string, loc *time.Location) (Schedule, error) {
+	s := Schedule{expr: strings.TrimSpace(expr), location: loc}
+	spec := s.expr
+	if strings.HasPrefix(spec, "@") {
+		d, ok := descriptors[strings.ToLower(spec)]
+		if !ok {
+			return s, fmt.Errorf("unknown cron shortcut %q", spec)
+		}
+		spec = d
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return s, fmt.Errorf("cron expression %q must have 5 fields (minute hour day-of-month month day-of-week) but has %v", expr, len(fields))
+	}
+	var err error
+	if s.minute, err = parseField(fields[0], minutes); err != nil {
+		return s, err
+	}
+	if s.hour, err = parseField(fields[1], hours); err != nil {
+		return s, err
+	}
+	if s.dom, err = parseField(fields[2], days); err != nil {
+		return s, err
+	}
+	if s.month, err = parseField(fields[3], months); err != nil {
+		return s, err
+	}
+	if s.dow, err = parseField(fields[4], weekdays); err != nil {
+		return s, err
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow = s.dow&^(1<<7) | 1
+	}
+	s.anyDOM = strings.HasPrefix(fields[2], "*")
+	s.anyDOW = strings.HasPrefix(fields[4], "*")
+	return s, nil
+}
+
+func parseField(field string, b bounds) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepPart)
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step %q in %v field %q", stepPart, b.name, field)
+			}
+		}
+		var start, end int
+		switch {
+		case rangePart == "*":
+			start, end = b.min, b.max
+		case strings.Contains(rangePart, "-"):
+			low, high, _ := strings.Cut(rangePart, "-")
+			var err error
+			if start, err = value(low, b); err != nil {
+				return 0, err
+			}
+			if end, err = value(high, b); err != nil {
+				return 0, err
+			}
+			if start > end {
+				return 0, fmt.Errorf("range %q in %v field %q goes backwards", rangePart, b.name, field)
+			}
+		default:
+			var err error
+			if start, err = value(rangePart, b); err != nil {
+				return 0, err
+			}
+			end = start
+			// 5/15 means from 5 to the end of the range every 15
+			if hasStep {
+				end = b.max
+			}
+		}
+		for v := start; v <= end; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func value(s string, b bounds) (int, error) {
+	if v, ok := b.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q for %v", s, b.name)
+	}
+	if v < b.min || v > b.max {
+		return 0, fmt.Errorf("%v %v is outside of %v-%v", b.name, v, b.min, b.max)
+	}
+	return v, nil
+}
+
+// String returns the expression the schedule was parsed from
+func (s Schedule) String() string {
+	return s.expr
+}
+
+// Next returns the first time after t the schedule fires, or the zero time when it never does
+// within the next five years, for example for the 30th of February
+func (s Schedule) Next(t time.Time) time.Time {
+	loc := s.location
+	if loc == nil {
+		loc = time.Local
+	}
+	t = t.In(loc).Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case s.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !s.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+		case s.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// dayMatches follows cron in matching either day field when both are restricted
+func (s Schedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.anyDOM || s.anyDOW {
+		return dom && dow
+	}
+	return dom || dow
+}
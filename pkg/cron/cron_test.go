@@ -0,0 +1,74 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// package cron_test tests the cron package
+package cron_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dremio/dremio-diagnostic-collector/pkg/cron"
+)
+
+func TestNext(t *testing.T) {
+	// a wednesday
+	from := time.Date(2023, 11, 15, 10, 7, 30, 0, time.UTC)
+	tests := []struct {
+		expr     string
+		expected time.Time
+	}{
+		{"* * * * *", time.Date(2023, 11, 15, 10, 8, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2023, 11, 15, 10, 15, 0, 0, time.UTC)},
+		{"0 */6 * * *", time.Date(2023, 11, 15, 12, 0, 0, 0, time.UTC)},
+		{"30 2 * * *", time.Date(2023, 11, 16, 2, 30, 0, 0, time.UTC)},
+		{"0 9 * * mon-fri", time.Date(2023, 11, 16, 9, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2023, 11, 19, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 jan *", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"5/20 10 * * *", time.Date(2023, 11, 15, 10, 25, 0, 0, time.UTC)},
+		{"0 0 1,20 * *", time.Date(2023, 11, 20, 0, 0, 0, 0, time.UTC)},
+		// both day fields restricted match on either
+		{"0 0 1 * fri", time.Date(2023, 11, 17, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2023, 11, 15, 11, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2023, 11, 19, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		s, err := cron.ParseInLocation(tt.expr, time.UTC)
+		if err != nil {
+			t.Fatalf("unable to parse %q: %v", tt.expr, err)
+		}
+		if actual := s.Next(from); !actual.Equal(tt.expected) {
+			t.Errorf("expected %q to next fire at %v but was %v", tt.expr, tt.expected, actual)
+		}
+	}
+}
+
+func TestNextNever(t *testing.T) {
+	s, err := cron.ParseInLocation("0 0 30 2 *", time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next := s.Next(time.Now()); !next.IsZero() {
+		t.Errorf("expected the 30th of february to never fire but was %v", next)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "* * * foo *", "@often"} {
+		if _, err := cron.Parse(expr); err == nil {
+			t.Errorf("expected %q to be rejected", expr)
+		}
+	}
+}
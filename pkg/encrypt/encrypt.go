@@ -0,0 +1,274 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// package encrypt encrypts archives to age recipients so they can be stored and moved around without
+// exposing the logs, queries and profiles in them
+package encrypt
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/agessh"
+	gossh "golang.org/x/crypto/ssh"
+
+	"github.com/dremio/dremio-diagnostic-collector/pkg/simplelog"
+)
+
+const (
+	// Suffix is added to the name of every encrypted file
+	Suffix = ".age"
+	// IdentityPassphraseEnv is read before prompting for the passphrase of an encrypted ssh identity
+	IdentityPassphraseEnv = "DDC_IDENTITY_PASSPHRASE" // #nosec G101
+)
+
+// IsEncrypted is true for files written by File
+func IsEncrypted(name string) bool {
+	return strings.HasSuffix(name, Suffix)
+}
+
+// LoadRecipients expands every value into recipient lines. A value is an age public key (age1...),
+// an ssh public key (ssh-ed25519 or ssh-rsa) or the path of a file listing them one per line like
+// the recipients files of age -R. Every recipient is parsed so mistakes show up before collecting
+func LoadRecipients(values []string) ([]string, error) {
+	var recipients []string
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		if isRecipient(v) {
+			if _, err := parseRecipient(v); err != nil {
+				return nil, err
+			}
+			recipients = append(recipients, v)
+			continue
+		}
+		lines, err := readRecipientsFile(v)
+		if err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, lines...)
+	}
+	return recipients, nil
+}
+
+func isRecipient(v string) bool {
+	return strings.HasPrefix(v, "age1") || strings.HasPrefix(v, "ssh-")
+}
+
+func readRecipientsFile(file string) ([]string, error) {
+	f, err := os.Open(filepath.Clean(file))
+	if err != nil {
+		return nil, fmt.Errorf("'%v' is not an age or ssh public key and cannot be read as a recipients file: %w", file, err)
+	}
+	defer func() {
+		if err := f.Close(); err != nil {
+			simplelog.Debugf("optional close of %v failed %v", file, err)
+		}
+	}()
+	var recipients []string
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if _, err := parseRecipient(line); err != nil {
+			return nil, fmt.Errorf("line %v of recipients file %v: %w", n, file, err)
+		}
+		recipients = append(recipients, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read recipients file %v: %w", file, err)
+	}
+	if len(recipients) == 0 {
+		return nil, fmt.Errorf("recipients file %v has no recipients", file)
+	}
+	return recipients, nil
+}
+
+func parseRecipient(line string) (age.Recipient, error) {
+	if strings.HasPrefix(line, "ssh-") {
+		r, err := agessh.ParseRecipient(line)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ssh recipient '%v': %w", line, err)
+		}
+		return r, nil
+	}
+	r, err := age.ParseX25519Recipient(line)
+	if err != nil {
+		return nil, fmt.Errorf("invalid age recipient '%v': %w", line, err)
+	}
+	return r, nil
+}
+
+// WriteRecipientsFile writes recipients in the format LoadRecipients reads, it is how they are handed to
+// local-collect on the nodes since ssh public keys do not survive being passed as a remote argument
+func WriteRecipientsFile(file string, recipients []string) error {
+	return os.WriteFile(file, []byte(strings.Join(recipients, "\n")+"\n"), 0600)
+}
+
+// File encrypts file to the recipients, writes it to file + Suffix and removes the unencrypted file
+func File(file string, recipients []string) (string, error) {
+	if len(recipients) == 0 {
+		return "", errors.New("no recipients to encrypt to")
+	}
+	var parsed []age.Recipient
+	for _, line := range recipients {
+		r, err := parseRecipient(line)
+		if err != nil {
+			return "", err
+		}
+		parsed = append(parsed, r)
+	}
+	dest := file + Suffix
+	if err := encryptTo(file, dest, parsed); err != nil {
+		if rmErr := os.Remove(dest); rmErr != nil && !errors.Is(rmErr, os.ErrNotExist) {
+			simplelog.Warningf("unable to remove partially encrypted %v: %v", dest, rmErr)
+		}
+		return "", err
+	}
+	if err := os.Remove(file); err != nil {
+		return "", fmt.Errorf("encrypted %v but unable to remove the unencrypted file: %w", file, err)
+	}
+	return dest, nil
+}
+
+// ReplaceFile encrypts file to the recipient keys or files in encryptTo, see LoadRecipients. Unlike File the
+// unencrypted file is also removed when encryption fails so it is never picked up by mistake
+func ReplaceFile(file string, encryptTo []string) (string, error) {
+	recipients, err := LoadRecipients(encryptTo)
+	if err == nil {
+		var encrypted string
+		if encrypted, err = File(file, recipients); err == nil {
+			simplelog.Infof("encrypted %v to %v recipient(s)", encrypted, len(recipients))
+			return encrypted, nil
+		}
+	}
+	if rmErr := os.Remove(file); rmErr != nil && !errors.Is(rmErr, os.ErrNotExist) {
+		simplelog.Errorf("unable to remove unencrypted file %v due to error %v", file, rmErr)
+	}
+	return "", fmt.Errorf("unable to encrypt %v: %w", file, err)
+}
+
+func encryptTo(file, dest string, recipients []age.Recipient) error {
+	in, err := os.Open(filepath.Clean(file))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := in.Close(); err != nil {
+			simplelog.Debugf("optional close of %v failed %v", file, err)
+		}
+	}()
+	out, err := os.OpenFile(filepath.Clean(dest), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := out.Close(); err != nil {
+			simplelog.Debugf("optional close of %v failed %v", dest, err)
+		}
+	}()
+	w, err := age.Encrypt(out, recipients...)
+	if err != nil {
+		return fmt.Errorf("unable to encrypt %v: %w", file, err)
+	}
+	if _, err := io.Copy(w, in); err != nil {
+		return fmt.Errorf("unable to encrypt %v: %w", file, err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("unable to finish encrypting %v: %w", file, err)
+	}
+	return out.Close()
+}
+
+// LoadIdentities reads an age identity file (AGE-SECRET-KEY-...) or an ssh private key, passphrase is
+// only called for an ssh key that is encrypted
+func LoadIdentities(file string, passphrase func() ([]byte, error)) ([]age.Identity, error) {
+	b, err := os.ReadFile(filepath.Clean(file))
+	if err != nil {
+		return nil, fmt.Errorf("unable to read identity %v: %w", file, err)
+	}
+	if bytes.Contains(b, []byte("AGE-SECRET-KEY-")) {
+		identities, err := age.ParseIdentities(bytes.NewReader(b))
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse age identity %v: %w", file, err)
+		}
+		return identities, nil
+	}
+	identity, err := agessh.ParseIdentity(b)
+	if err == nil {
+		return []age.Identity{identity}, nil
+	}
+	var missing *gossh.PassphraseMissingError
+	if !errors.As(err, &missing) {
+		return nil, fmt.Errorf("%v is not an age identity or a supported ssh private key: %w", file, err)
+	}
+	if missing.PublicKey == nil {
+		return nil, fmt.Errorf("the public key of encrypted ssh key %v is unknown, decrypt it with ssh-keygen -p first", file)
+	}
+	identity, err = agessh.NewEncryptedSSHIdentity(missing.PublicKey, b, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("unable to use encrypted ssh key %v: %w", file, err)
+	}
+	return []age.Identity{identity}, nil
+}
+
+// Decrypt writes the decrypted content of file to dest
+func Decrypt(file, dest string, identities []age.Identity) error {
+	in, err := os.Open(filepath.Clean(file))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := in.Close(); err != nil {
+			simplelog.Debugf("optional close of %v failed %v", file, err)
+		}
+	}()
+	r, err := age.Decrypt(in, identities...)
+	if err != nil {
+		return fmt.Errorf("unable to decrypt %v: %w", file, err)
+	}
+	out, err := os.OpenFile(filepath.Clean(dest), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, r); err != nil {
+		if closeErr := out.Close(); closeErr != nil {
+			simplelog.Debugf("optional close of %v failed %v", dest, closeErr)
+		}
+		if rmErr := os.Remove(dest); rmErr != nil {
+			simplelog.Warningf("unable to remove partially decrypted %v: %v", dest, rmErr)
+		}
+		return fmt.Errorf("unable to decrypt %v: %w", file, err)
+	}
+	return out.Close()
+}
+
+// DecryptedName is the name file had before it was encrypted
+func DecryptedName(file string) string {
+	if IsEncrypted(file) {
+		return strings.TrimSuffix(file, Suffix)
+	}
+	return file + ".decrypted"
+}
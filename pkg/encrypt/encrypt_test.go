@@ -0,0 +1,223 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// package encrypt_test tests the encrypt package
+package encrypt_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	gossh "golang.org/x/crypto/ssh"
+
+	"github.com/dremio/dremio-diagnostic-collector/pkg/encrypt"
+)
+
+func writeFile(t *testing.T, name string, content []byte) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(file, content, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+// sshKey returns an ed25519 public key line and its private key file, encrypted when passphrase is set
+func sshKey(t *testing.T, passphrase string) (string, string) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sshPub, err := gossh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var block *pem.Block
+	if passphrase == "" {
+		block, err = gossh.MarshalPrivateKey(priv, "")
+	} else {
+		block, err = gossh.MarshalPrivateKeyWithPassphrase(priv, "", []byte(passphrase))
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(string(gossh.MarshalAuthorizedKey(sshPub))), writeFile(t, "id_ed25519", pem.EncodeToMemory(block))
+}
+
+func roundTrip(t *testing.T, recipients []string, identities []age.Identity) {
+	t.Helper()
+	file := writeFile(t, "diag.tgz", []byte("customer sql"))
+	encrypted, err := encrypt.File(file, recipients)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if encrypted != file+encrypt.Suffix {
+		t.Errorf("expected %v but was %v", file+encrypt.Suffix, encrypted)
+	}
+	if _, err := os.Stat(file); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected the unencrypted file to be removed but got %v", err)
+	}
+	b, err := os.ReadFile(encrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "customer sql") {
+		t.Error("expected the content to be encrypted")
+	}
+	decrypted := encrypt.DecryptedName(encrypted)
+	if err := encrypt.Decrypt(encrypted, decrypted, identities); err != nil {
+		t.Fatal(err)
+	}
+	b, err = os.ReadFile(decrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "customer sql" {
+		t.Errorf("expected 'customer sql' but was '%v'", string(b))
+	}
+}
+
+func TestAgeRoundTrip(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	identityFile := writeFile(t, "key.txt", []byte("# created: test\n"+identity.String()+"\n"))
+	identities, err := encrypt.LoadIdentities(identityFile, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roundTrip(t, []string{identity.Recipient().String()}, identities)
+}
+
+func TestSSHRoundTrip(t *testing.T) {
+	pub, keyFile := sshKey(t, "")
+	identities, err := encrypt.LoadIdentities(keyFile, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roundTrip(t, []string{pub}, identities)
+}
+
+func TestEncryptedSSHKeyAsksForPassphrase(t *testing.T) {
+	pub, keyFile := sshKey(t, "secret")
+	asked := false
+	identities, err := encrypt.LoadIdentities(keyFile, func() ([]byte, error) {
+		asked = true
+		return []byte("secret"), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	roundTrip(t, []string{pub}, identities)
+	if !asked {
+		t.Error("expected the passphrase to be asked for")
+	}
+}
+
+func TestDecryptWithWrongIdentity(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := writeFile(t, "diag.tgz", []byte("customer sql"))
+	encrypted, err := encrypt.File(file, []string{identity.Recipient().String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dest := encrypt.DecryptedName(encrypted)
+	if err := encrypt.Decrypt(encrypted, dest, []age.Identity{other}); err == nil {
+		t.Fatal("expected decryption with another identity to fail")
+	}
+	if _, err := os.Stat(dest); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected nothing to be written but got %v", err)
+	}
+}
+
+func TestLoadRecipients(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, _ := sshKey(t, "")
+	recipientsFile := writeFile(t, "recipients.txt", []byte("# support team\n"+pub+"\n\n"))
+	recipients, err := encrypt.LoadRecipients([]string{identity.Recipient().String(), recipientsFile, " "})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recipients) != 2 || recipients[0] != identity.Recipient().String() || recipients[1] != pub {
+		t.Errorf("unexpected recipients %v", recipients)
+	}
+
+	// written recipients are read back the same way
+	written := filepath.Join(t.TempDir(), "ddc-recipients.txt")
+	if err := encrypt.WriteRecipientsFile(written, recipients); err != nil {
+		t.Fatal(err)
+	}
+	again, err := encrypt.LoadRecipients([]string{written})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(again, "\n") != strings.Join(recipients, "\n") {
+		t.Errorf("expected %v but was %v", recipients, again)
+	}
+
+	for _, invalid := range [][]string{
+		{"age1notarecipient"},
+		{"ssh-ed25519 AAAAnotakey"},
+		{filepath.Join(t.TempDir(), "missing.txt")},
+		{writeFile(t, "empty.txt", []byte("# nobody\n"))},
+		{writeFile(t, "bad.txt", []byte(pub+"\nnot a key\n"))},
+	} {
+		if _, err := encrypt.LoadRecipients(invalid); err == nil {
+			t.Errorf("expected %v to be rejected", invalid)
+		}
+	}
+}
+
+func TestReplaceFile(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := writeFile(t, "node1.tar.gz", []byte("customer sql"))
+	encrypted, err := encrypt.ReplaceFile(file, []string{identity.Recipient().String()})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if encrypted != file+encrypt.Suffix {
+		t.Errorf("expected %v but was %v", file+encrypt.Suffix, encrypted)
+	}
+
+	// a bad recipient still removes the unencrypted file
+	file = writeFile(t, "node2.tar.gz", []byte("customer sql"))
+	if _, err := encrypt.ReplaceFile(file, []string{filepath.Join(t.TempDir(), "missing-recipients.txt")}); err == nil {
+		t.Error("expected an error for a missing recipients file")
+	}
+	if _, err := os.Stat(file); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected the unencrypted file to be removed but got %v", err)
+	}
+}
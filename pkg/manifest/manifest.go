@@ -0,0 +1,193 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// package manifest lists every file of a diagnostic bundle with its SHA-256 so a bundle that was
+// truncated or corrupted on the way to support can be found before anyone relies on it
+package manifest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dremio/dremio-diagnostic-collector/pkg/simplelog"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/versions"
+)
+
+// FileName is the name of the manifest at the root of the bundle
+const FileName = "manifest.json"
+
+// Entry is a single file of the bundle
+type Entry struct {
+	// Path is slash separated and relative to the root of the bundle
+	Path string `json:"path"`
+	// Node is the host the file was collected from, empty for files about the whole cluster
+	Node string `json:"node,omitempty"`
+	// Collector is the collection the file came from (logs, jfr, system-tables, ...)
+	Collector string    `json:"collector,omitempty"`
+	Size      int64     `json:"size"`
+	ModTime   time.Time `json:"mtime"`
+	SHA256    string    `json:"sha256"`
+}
+
+type Manifest struct {
+	DDCVersion string    `json:"ddcVersion"`
+	CreatedUTC time.Time `json:"createdUTC"`
+	Files      []Entry   `json:"files"`
+}
+
+// Build hashes every file under root. The top level directories of contentDir (relative to root, empty
+// for root itself) are the collectors and nodes are the host names to attribute files to
+func Build(root, contentDir string, nodes []string) (Manifest, error) {
+	m := Manifest{
+		DDCVersion: strings.TrimSpace(versions.GetCLIVersion()),
+		CreatedUTC: time.Now().UTC(),
+		Files:      []Entry{},
+	}
+	err := filepath.Walk(root, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, filePath)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == FileName {
+			return nil
+		}
+		sum, err := hashFile(filePath)
+		if err != nil {
+			return err
+		}
+		node, collector := Classify(rel, filepath.ToSlash(contentDir), nodes)
+		m.Files = append(m.Files, Entry{
+			Path:      rel,
+			Node:      node,
+			Collector: collector,
+			Size:      info.Size(),
+			ModTime:   info.ModTime().UTC().Truncate(time.Second),
+			SHA256:    sum,
+		})
+		return nil
+	})
+	if err != nil {
+		return Manifest{}, fmt.Errorf("unable to build manifest of %v: %w", root, err)
+	}
+	return m, nil
+}
+
+// Write builds the manifest of root and writes it to root/manifest.json
+func Write(root, contentDir string, nodes []string) (Manifest, error) {
+	m, err := Build(root, contentDir, nodes)
+	if err != nil {
+		return m, err
+	}
+	b, err := json.MarshalIndent(m, "", "\t")
+	if err != nil {
+		return m, err
+	}
+	if err := os.WriteFile(filepath.Join(root, FileName), b, 0600); err != nil {
+		return m, fmt.Errorf("unable to write manifest: %w", err)
+	}
+	simplelog.Infof("manifest of %v files written", len(m.Files))
+	return m, nil
+}
+
+// Read parses a manifest written by Write
+func Read(r io.Reader) (Manifest, error) {
+	var m Manifest
+	if err := json.NewDecoder(r).Decode(&m); err != nil {
+		return m, fmt.Errorf("unable to read %v: %w", FileName, err)
+	}
+	return m, nil
+}
+
+func hashFile(filePath string) (string, error) {
+	f, err := os.Open(filepath.Clean(filePath))
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if err := f.Close(); err != nil {
+			simplelog.Debugf("optional close of %v failed %v", filePath, err)
+		}
+	}()
+	sum, _, err := hash(f)
+	return sum, err
+}
+
+func hash(r io.Reader) (string, int64, error) {
+	h := sha256.New()
+	n, err := io.Copy(h, r)
+	if err != nil {
+		return "", n, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
+
+// Classify finds the collector and node of a slash separated path relative to the root of the bundle.
+// Local collect writes <collector>/<node>/..., the jfr recordings as jfr/<node>.jfr, the thread dumps as
+// jfr/thread-dumps/<node>/... and encrypted node tarballs as <node>.tar.gz.age, so the node is either a
+// directory on the path or the start of the file name. The longest matching node wins so node1 does not
+// claim the files of node10
+func Classify(rel, contentDir string, nodes []string) (node, collector string) {
+	if contentDir != "" && contentDir != "." {
+		if !strings.HasPrefix(rel, contentDir+"/") {
+			return "", ""
+		}
+		rel = strings.TrimPrefix(rel, contentDir+"/")
+	}
+	segments := strings.Split(rel, "/")
+	if len(segments) > 1 {
+		collector = segments[0]
+	}
+	if len(segments) > 2 && segments[0] == "jfr" && segments[1] == "thread-dumps" {
+		collector = "thread-dumps"
+	}
+	dirs := segments[:len(segments)-1]
+	base := segments[len(segments)-1]
+	sorted := append([]string{}, nodes...)
+	sort.Slice(sorted, func(i, j int) bool { return len(sorted[i]) > len(sorted[j]) })
+	for _, n := range sorted {
+		if n == "" {
+			continue
+		}
+		for _, d := range dirs {
+			if d == n {
+				return n, collector
+			}
+		}
+		if strings.HasPrefix(base, n) && len(base) > len(n) && strings.ContainsRune(".-_", rune(base[len(n)])) {
+			return n, collector
+		}
+	}
+	return "", collector
+}
+
+// cleanName turns an archive entry name into a manifest path
+func cleanName(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
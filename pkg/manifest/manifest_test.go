@@ -0,0 +1,179 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// package manifest_test tests the manifest package
+package manifest_test
+
+import (
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/dremio/dremio-diagnostic-collector/pkg/archive"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/manifest"
+)
+
+const baseDir = "20221110-141414-DDC"
+
+// writeBundle lays out files the way ddc stages them before archiving and writes the manifest
+func writeBundle(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	// random bytes do not compress so truncating the archive cuts into the files
+	noise := make([]byte, 128*1024)
+	if _, err := rand.New(rand.NewSource(1)).Read(noise); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{
+		"summary.json": []byte(`{"ddcVersion": "0.9.0"}`),
+		filepath.Join(baseDir, "logs", "node1", "server.log"):            noise,
+		filepath.Join(baseDir, "logs", "node10", "server.log"):           []byte("node10 log"),
+		filepath.Join(baseDir, "jfr", "node1.jfr"):                       []byte("recording"),
+		filepath.Join(baseDir, "system-tables", "sys.options.json"):      []byte("[]"),
+		filepath.Join(baseDir, "jfr", "thread-dumps", "node10", "1.txt"): []byte("jstack"),
+	}
+	for name, content := range files {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(root, name)), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(root, name), content, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := manifest.Write(root, baseDir, []string{"node1", "node10"}); err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+func TestBuildClassifiesFiles(t *testing.T) {
+	root := writeBundle(t)
+	m, err := manifest.Build(root, baseDir, []string{"node1", "node10"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	type class struct{ node, collector string }
+	actual := make(map[string]class)
+	for _, e := range m.Files {
+		if len(e.SHA256) != 64 {
+			t.Errorf("expected a sha256 for %v but was '%v'", e.Path, e.SHA256)
+		}
+		actual[e.Path] = class{e.Node, e.Collector}
+	}
+	expected := map[string]class{
+		"summary.json":                              {},
+		baseDir + "/logs/node1/server.log":          {"node1", "logs"},
+		baseDir + "/logs/node10/server.log":         {"node10", "logs"},
+		baseDir + "/jfr/node1.jfr":                  {"node1", "jfr"},
+		baseDir + "/system-tables/sys.options.json": {"", "system-tables"},
+		baseDir + "/jfr/thread-dumps/node10/1.txt":  {"node10", "thread-dumps"},
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected\n%v\nbut was\n%v", expected, actual)
+	}
+}
+
+func TestVerifyArchive(t *testing.T) {
+	root := writeBundle(t)
+	for _, format := range archive.Formats {
+		t.Run(string(format), func(t *testing.T) {
+			dest := filepath.Join(t.TempDir(), "diag."+string(format))
+			if _, err := archive.ArchiveDir(root, dest, archive.Options{Format: format, First: []string{manifest.FileName}}); err != nil {
+				t.Fatal(err)
+			}
+			report, err := manifest.Verify(dest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !report.OK() || report.Verified != 6 || report.Expected != 6 {
+				t.Errorf("expected all 6 files to verify but was %#v", report)
+			}
+		})
+	}
+}
+
+func TestVerifyDirectory(t *testing.T) {
+	root := writeBundle(t)
+	if err := os.Remove(filepath.Join(root, baseDir, "jfr", "node1.jfr")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, baseDir, "logs", "node10", "server.log"), []byte("node10 log!"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, baseDir, "system-tables", "sys.options.json"), []byte("{}"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "notes.txt"), []byte("added later"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	report, err := manifest.Verify(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.OK() {
+		t.Fatal("expected the report to fail")
+	}
+	if !reflect.DeepEqual(report.Missing, []string{baseDir + "/jfr/node1.jfr"}) {
+		t.Errorf("unexpected missing files %v", report.Missing)
+	}
+	expected := []manifest.Problem{
+		{Path: baseDir + "/logs/node10/server.log", Reason: "size is 11 bytes but 10 were collected"},
+		{Path: baseDir + "/system-tables/sys.options.json", Reason: "sha256 does not match"},
+	}
+	if !reflect.DeepEqual(report.Corrupted, expected) {
+		t.Errorf("expected corrupted %v but was %v", expected, report.Corrupted)
+	}
+	if !reflect.DeepEqual(report.Unlisted, []string{"notes.txt"}) {
+		t.Errorf("unexpected unlisted files %v", report.Unlisted)
+	}
+	if report.Verified != 3 {
+		t.Errorf("expected 3 verified files but was %v", report.Verified)
+	}
+}
+
+func TestVerifyTruncatedArchive(t *testing.T) {
+	root := writeBundle(t)
+	dest := filepath.Join(t.TempDir(), "diag.tgz")
+	if _, err := archive.ArchiveDir(root, dest, archive.Options{Format: archive.TarGz, First: []string{manifest.FileName}}); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(dest, info.Size()/2); err != nil {
+		t.Fatal(err)
+	}
+	report, err := manifest.Verify(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.OK() || report.ReadError == "" {
+		t.Errorf("expected the truncation to be reported but was %#v", report)
+	}
+	if len(report.Missing)+len(report.Corrupted) == 0 {
+		t.Errorf("expected missing or corrupted files but was %#v", report)
+	}
+}
+
+func TestVerifyWithoutManifest(t *testing.T) {
+	if _, err := manifest.Verify(t.TempDir()); err == nil {
+		t.Error("expected an error for a bundle without a manifest")
+	}
+	if _, err := manifest.Verify(filepath.Join(t.TempDir(), "diag.tgz.age")); err == nil {
+		t.Error("expected an error for an encrypted bundle")
+	}
+}
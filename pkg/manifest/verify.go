@@ -0,0 +1,134 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manifest
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/dremio/dremio-diagnostic-collector/pkg/archive"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/encrypt"
+)
+
+// Problem is a file that does not match the manifest
+type Problem struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+}
+
+// Report is the result of checking a bundle against its manifest
+type Report struct {
+	Bundle string `json:"bundle"`
+	// Expected is the number of files listed in the manifest
+	Expected int `json:"expected"`
+	// Verified is the number of files that matched their size and checksum
+	Verified  int       `json:"verified"`
+	Missing   []string  `json:"missing,omitempty"`
+	Corrupted []Problem `json:"corrupted,omitempty"`
+	// Unlisted files are in the bundle but not in the manifest, they are reported but do not fail the check
+	Unlisted []string `json:"unlisted,omitempty"`
+	// ReadError is set when the bundle could not be read to the end, usually because it was truncated
+	ReadError string `json:"readError,omitempty"`
+}
+
+// OK is true when every file in the manifest was found intact
+func (r Report) OK() bool {
+	return r.ReadError == "" && len(r.Missing) == 0 && len(r.Corrupted) == 0
+}
+
+type found struct {
+	size int64
+	sum  string
+	err  error
+}
+
+// Verify checks every file of a bundle against its manifest, the bundle is an archive written by ddc
+// (any volume of a split archive) or the directory it was extracted to. The error is only for a bundle
+// that cannot be checked at all, damage that was found is in the report
+func Verify(bundle string) (Report, error) {
+	report := Report{Bundle: bundle}
+	if encrypt.IsEncrypted(bundle) {
+		return report, fmt.Errorf("%v is encrypted, run ddc decrypt on it first", bundle)
+	}
+	if _, err := os.Stat(bundle); err != nil {
+		return report, err
+	}
+	files, manifestBytes, err := readBundle(bundle)
+	if err != nil {
+		report.ReadError = err.Error()
+	}
+	if manifestBytes == nil {
+		if err != nil {
+			return report, fmt.Errorf("%v was not found in %v, the bundle is unreadable: %w", FileName, bundle, err)
+		}
+		return report, fmt.Errorf("%v was not found in %v, only bundles written by ddc 0.9.0 and later have one", FileName, bundle)
+	}
+	m, err := Read(bytes.NewReader(manifestBytes))
+	if err != nil {
+		return report, err
+	}
+	report.Expected = len(m.Files)
+	listed := make(map[string]bool)
+	for _, e := range m.Files {
+		listed[e.Path] = true
+		f, ok := files[e.Path]
+		switch {
+		case !ok:
+			report.Missing = append(report.Missing, e.Path)
+		case f.err != nil:
+			report.Corrupted = append(report.Corrupted, Problem{Path: e.Path, Reason: fmt.Sprintf("unreadable: %v", f.err)})
+		case f.size != e.Size:
+			report.Corrupted = append(report.Corrupted, Problem{Path: e.Path, Reason: fmt.Sprintf("size is %v bytes but %v were collected", f.size, e.Size)})
+		case f.sum != e.SHA256:
+			report.Corrupted = append(report.Corrupted, Problem{Path: e.Path, Reason: "sha256 does not match"})
+		default:
+			report.Verified++
+		}
+	}
+	for name := range files {
+		if !listed[name] {
+			report.Unlisted = append(report.Unlisted, name)
+		}
+	}
+	sort.Strings(report.Unlisted)
+	return report, nil
+}
+
+func readBundle(name string) (map[string]found, []byte, error) {
+	files := make(map[string]found)
+	var manifestBytes []byte
+	err := archive.Walk(name, func(e archive.Entry, r io.Reader) error {
+		if r == nil {
+			return nil
+		}
+		name := cleanName(e.Name)
+		if name == FileName {
+			b, err := io.ReadAll(r)
+			if err != nil {
+				return err
+			}
+			manifestBytes = b
+			return nil
+		}
+		sum, n, err := hash(r)
+		files[name] = found{size: n, sum: sum, err: err}
+		// a read error in the middle of a file means the rest of the archive is gone too
+		return err
+	})
+	return files, manifestBytes, err
+}
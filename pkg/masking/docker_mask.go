@@ -0,0 +1,60 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// masking hides secrets in files and replaces them with redacted text
+package masking
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// RemoveSecretsFromDockerInspect masks the environment variables in docker or podman inspect output
+// that look like secrets, the env is a list of KEY=value strings unlike the k8s name and value pairs
+func RemoveSecretsFromDockerInspect(inspectJSON string) (string, error) {
+	var containers []map[string]interface{}
+	if err := json.Unmarshal([]byte(inspectJSON), &containers); err != nil {
+		return "", err
+	}
+	for _, container := range containers {
+		configRaw, ok := container["Config"]
+		if !ok {
+			continue
+		}
+		config, ok := configRaw.(map[string]interface{})
+		if !ok {
+			return "", fmt.Errorf("Config must be an object but was '%T'", configRaw)
+		}
+		envRaw, ok := config["Env"].([]interface{})
+		if !ok {
+			continue
+		}
+		for i, entry := range envRaw {
+			envVar, ok := entry.(string)
+			if !ok {
+				continue
+			}
+			name, _, found := strings.Cut(envVar, "=")
+			if found && checkK8sStringForSecret(name) {
+				envRaw[i] = name + "=REMOVED_POTENTIAL_SECRET"
+			}
+		}
+	}
+	outBytes, err := json.Marshal(containers)
+	if err != nil {
+		return "", err
+	}
+	return string(outBytes), nil
+}
@@ -0,0 +1,41 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package masking_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dremio/dremio-diagnostic-collector/pkg/masking"
+)
+
+func TestRemoveSecretsFromDockerInspect(t *testing.T) {
+	input := `[{"Name": "/dremio", "Config": {"Env": ["DREMIO_JAVA_SERVER_EXTRA_OPTS=-Xmx4g", "DREMIO_PASSWORD=secret", "PAT_TOKEN=abc"]}}]`
+	actual, err := masking.RemoveSecretsFromDockerInspect(input)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if strings.Contains(actual, "secret") || strings.Contains(actual, "abc") {
+		t.Errorf("expected the secrets to be removed but was %v", actual)
+	}
+	for _, expected := range []string{"DREMIO_JAVA_SERVER_EXTRA_OPTS=-Xmx4g", "DREMIO_PASSWORD=REMOVED_POTENTIAL_SECRET", "PAT_TOKEN=REMOVED_POTENTIAL_SECRET"} {
+		if !strings.Contains(actual, expected) {
+			t.Errorf("expected %v in %v", expected, actual)
+		}
+	}
+	if _, err := masking.RemoveSecretsFromDockerInspect("not json"); err == nil {
+		t.Error("expected an error for invalid json")
+	}
+}
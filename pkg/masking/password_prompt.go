@@ -22,8 +22,13 @@ import (
 )
 
 func PromptForPAT() (string, error) {
+	return PromptForSecret("Enter Dremio personal access token")
+}
+
+// PromptForSecret asks for a value without echoing it back to the terminal
+func PromptForSecret(label string) (string, error) {
 	prompt := promptui.Prompt{
-		Label: "Enter Dremio personal access token",
+		Label: label,
 		Mask:  '*',
 	}
 
@@ -0,0 +1,158 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// package taskresults provides the outcome of every collector local-collect ran, written into the node tarball and aggregated by ddc
+package taskresults
+
+import (
+	"sort"
+	"time"
+)
+
+// FileName is the file in the node tarball holding the NodeResults
+const FileName = "task-results.json"
+
+// task statuses
+const (
+	StatusOK      = "ok"
+	StatusFailed  = "failed"
+	StatusSkipped = "skipped"
+)
+
+// TaskResult is the outcome of a single collector on a node, Bytes is what it wrote before it was compressed into the tarball
+type TaskResult struct {
+	Name            string     `json:"name"`
+	Status          string     `json:"status"`
+	StartTimeUTC    *time.Time `json:"startTimeUTC,omitempty"`
+	DurationSeconds float64    `json:"durationSeconds"`
+	// CaptureStartUTC is when a jvm capture (ttop, jfr, jstack) began sampling, after waiting for the common start of the nodes
+	CaptureStartUTC *time.Time `json:"captureStartUTC,omitempty"`
+	Bytes           int64      `json:"bytes"`
+	Error           string     `json:"error,omitempty"`
+}
+
+// NodeResults are the task results of one node
+type NodeResults struct {
+	NodeName string `json:"nodeName"`
+	// CaptureStartRequestedUTC is the common start of the jvm captures that ddc asked the node for
+	CaptureStartRequestedUTC *time.Time   `json:"captureStartRequestedUTC,omitempty"`
+	Tasks                    []TaskResult `json:"tasks"`
+}
+
+// Failure is a task that failed on a node
+type Failure struct {
+	Node  string `json:"node"`
+	Error string `json:"error"`
+}
+
+// Summary is a task across all the nodes it was scheduled or skipped on
+type Summary struct {
+	Name               string    `json:"name"`
+	OK                 int       `json:"ok"`
+	Failed             int       `json:"failed"`
+	Skipped            int       `json:"skipped"`
+	Bytes              int64     `json:"bytes"`
+	MaxDurationSeconds float64   `json:"maxDurationSeconds"`
+	Failures           []Failure `json:"failures,omitempty"`
+}
+
+// Aggregate sums up the task results of every node into a Summary per task sorted by name
+func Aggregate(nodes []NodeResults) []Summary {
+	byName := make(map[string]*Summary)
+	for _, n := range nodes {
+		for _, t := range n.Tasks {
+			s, ok := byName[t.Name]
+			if !ok {
+				s = &Summary{Name: t.Name}
+				byName[t.Name] = s
+			}
+			switch t.Status {
+			case StatusOK:
+				s.OK++
+			case StatusFailed:
+				s.Failed++
+				s.Failures = append(s.Failures, Failure{Node: n.NodeName, Error: t.Error})
+			case StatusSkipped:
+				s.Skipped++
+			}
+			s.Bytes += t.Bytes
+			if t.DurationSeconds > s.MaxDurationSeconds {
+				s.MaxDurationSeconds = t.DurationSeconds
+			}
+		}
+	}
+	summaries := []Summary{}
+	for _, s := range byName {
+		sort.Slice(s.Failures, func(i, j int) bool { return s.Failures[i].Node < s.Failures[j].Node })
+		summaries = append(summaries, *s)
+	}
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].Name < summaries[j].Name })
+	return summaries
+}
+
+// CaptureStart is when a jvm capture of a node started, OffsetMillis is how late (or early) it was against the requested start
+type CaptureStart struct {
+	Node         string    `json:"node"`
+	Task         string    `json:"task"`
+	StartUTC     time.Time `json:"startUTC"`
+	OffsetMillis int64     `json:"offsetMillis"`
+}
+
+// CaptureSkew is how far apart the jvm captures of the nodes really started, MaxSkewMillis is between the first and last one
+type CaptureSkew struct {
+	RequestedUTC  time.Time      `json:"requestedUTC"`
+	MaxSkewMillis int64          `json:"maxSkewMillis"`
+	Captures      []CaptureStart `json:"captures"`
+}
+
+// Skew compares the jvm capture starts of the nodes that were asked to start at requested, nodes asked for another
+// start (such as ones resumed from an earlier run) are left out. It is nil when no such node ran a jvm capture
+func Skew(requested time.Time, nodes []NodeResults) *CaptureSkew {
+	skew := &CaptureSkew{RequestedUTC: requested.UTC()}
+	var first, last time.Time
+	for _, n := range nodes {
+		if n.CaptureStartRequestedUTC == nil || !n.CaptureStartRequestedUTC.Equal(requested) {
+			continue
+		}
+		for _, t := range n.Tasks {
+			if t.CaptureStartUTC == nil {
+				continue
+			}
+			start := t.CaptureStartUTC.UTC()
+			skew.Captures = append(skew.Captures, CaptureStart{
+				Node:         n.NodeName,
+				Task:         t.Name,
+				StartUTC:     start,
+				OffsetMillis: start.Sub(requested).Milliseconds(),
+			})
+			if first.IsZero() || start.Before(first) {
+				first = start
+			}
+			if last.IsZero() || start.After(last) {
+				last = start
+			}
+		}
+	}
+	if len(skew.Captures) == 0 {
+		return nil
+	}
+	skew.MaxSkewMillis = last.Sub(first).Milliseconds()
+	sort.Slice(skew.Captures, func(i, j int) bool {
+		if skew.Captures[i].Node != skew.Captures[j].Node {
+			return skew.Captures[i].Node < skew.Captures[j].Node
+		}
+		return skew.Captures[i].Task < skew.Captures[j].Task
+	})
+	return skew
+}
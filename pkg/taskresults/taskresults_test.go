@@ -0,0 +1,84 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package taskresults_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dremio/dremio-diagnostic-collector/pkg/taskresults"
+)
+
+func TestAggregate(t *testing.T) {
+	nodes := []taskresults.NodeResults{
+		{NodeName: "executor1", Tasks: []taskresults.TaskResult{
+			{Name: "jfr", Status: taskresults.StatusFailed, DurationSeconds: 1, Error: "jcmd not found"},
+			{Name: "server-logs", Status: taskresults.StatusOK, DurationSeconds: 2, Bytes: 100},
+		}},
+		{NodeName: "coordinator1", Tasks: []taskresults.TaskResult{
+			{Name: "server-logs", Status: taskresults.StatusOK, DurationSeconds: 5, Bytes: 50},
+			{Name: "jfr", Status: taskresults.StatusFailed, DurationSeconds: 3, Error: "timeout"},
+			{Name: "wlm", Status: taskresults.StatusSkipped},
+		}},
+	}
+	expected := []taskresults.Summary{
+		{Name: "jfr", Failed: 2, MaxDurationSeconds: 3, Failures: []taskresults.Failure{
+			{Node: "coordinator1", Error: "timeout"},
+			{Node: "executor1", Error: "jcmd not found"},
+		}},
+		{Name: "server-logs", OK: 2, Bytes: 150, MaxDurationSeconds: 5},
+		{Name: "wlm", Skipped: 1},
+	}
+	if actual := taskresults.Aggregate(nodes); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected\n%#v\nbut was\n%#v", expected, actual)
+	}
+}
+
+func TestSkew(t *testing.T) {
+	requested := time.Date(2024, 1, 2, 3, 4, 0, 0, time.UTC)
+	earlier := requested.Add(-time.Hour)
+	at := func(offset time.Duration) *time.Time {
+		start := requested.Add(offset)
+		return &start
+	}
+	nodes := []taskresults.NodeResults{
+		{NodeName: "executor1", CaptureStartRequestedUTC: &requested, Tasks: []taskresults.TaskResult{
+			{Name: "ttop", Status: taskresults.StatusOK, CaptureStartUTC: at(1500 * time.Millisecond)},
+			{Name: "server-logs", Status: taskresults.StatusOK},
+		}},
+		{NodeName: "coordinator1", CaptureStartRequestedUTC: &requested, Tasks: []taskresults.TaskResult{
+			{Name: "jstack", Status: taskresults.StatusOK, CaptureStartUTC: at(20 * time.Millisecond)},
+		}},
+		// resumed from a run that asked for another start
+		{NodeName: "executor2", CaptureStartRequestedUTC: &earlier, Tasks: []taskresults.TaskResult{
+			{Name: "jstack", Status: taskresults.StatusOK, CaptureStartUTC: &earlier},
+		}},
+	}
+	expected := &taskresults.CaptureSkew{
+		RequestedUTC:  requested,
+		MaxSkewMillis: 1480,
+		Captures: []taskresults.CaptureStart{
+			{Node: "coordinator1", Task: "jstack", StartUTC: *at(20 * time.Millisecond), OffsetMillis: 20},
+			{Node: "executor1", Task: "ttop", StartUTC: *at(1500 * time.Millisecond), OffsetMillis: 1500},
+		},
+	}
+	if actual := taskresults.Skew(requested, nodes); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected\n%#v\nbut was\n%#v", expected, actual)
+	}
+	if actual := taskresults.Skew(requested, nodes[2:]); actual != nil {
+		t.Errorf("expected no skew without a capture of the requested start but was %#v", actual)
+	}
+}
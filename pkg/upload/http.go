@@ -0,0 +1,206 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// package upload sends the finished diagnostic archive to S3 compatible storage, SFTP or an HTTP endpoint
+package upload
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dremio/dremio-diagnostic-collector/pkg/simplelog"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/strutils"
+)
+
+// httpTarget sends the file in chunks. In put mode a file that fits in one chunk is a plain PUT and
+// bigger files send every chunk with a Content-Range header. In multipart mode every chunk is posted
+// to the url as is with the chunk position in form fields. The offset confirmed so far is kept in
+// the state so an interrupted upload continues with the next chunk
+type httpTarget struct {
+	destination string
+	base        *url.URL
+	mode        string
+	headers     http.Header
+	chunkBytes  int64
+	client      *http.Client
+}
+
+func newHTTPTarget(args Args, u *url.URL, chunkBytes int64) *httpTarget {
+	headers := http.Header{}
+	for _, h := range args.Headers {
+		name, value, _ := strings.Cut(h, ":")
+		headers.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+	mode := args.HTTPMode
+	if mode == "" {
+		mode = HTTPModePut
+	}
+	return &httpTarget{
+		destination: args.URL,
+		base:        u,
+		mode:        mode,
+		headers:     headers,
+		chunkBytes:  chunkBytes,
+		client:      &http.Client{Timeout: 10 * time.Minute},
+	}
+}
+
+func (t *httpTarget) Destination() string {
+	return t.destination
+}
+
+func (t *httpTarget) Prefix() string {
+	// multipart posts go to the url as is so only the file name is sent
+	if t.mode == HTTPModeMultipart {
+		return ""
+	}
+	if t.base.Path == "" {
+		return "/"
+	}
+	return t.base.Path
+}
+
+func (t *httpTarget) Upload(ctx context.Context, file, remote string, state *State) (string, error) {
+	f, err := os.Open(filepath.Clean(file))
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if err := f.Close(); err != nil {
+			simplelog.Debugf("optional close of %v failed %v", file, err)
+		}
+	}()
+	u := *t.base
+	if t.mode == HTTPModePut {
+		u.Path = remote
+	}
+	if state.Size > 0 && state.Offset >= state.Size {
+		// every chunk was confirmed before the last run stopped
+		return u.String(), nil
+	}
+	chunks := chunkCount(state.Size, t.chunkBytes)
+	buf := make([]byte, t.chunkBytes)
+	// the loop runs at least once so an empty file is still sent
+	for sent := false; !sent || state.Offset < state.Size; sent = true {
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		offset := state.Offset
+		n, err := f.ReadAt(buf, offset)
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+		chunk := buf[:n]
+		index := offset / t.chunkBytes
+		err = withRetry(ctx, fmt.Sprintf("chunk %v of %v", index+1, chunks), func() error {
+			if t.mode == HTTPModeMultipart {
+				return t.post(ctx, &u, path.Base(remote), chunk, offset, index, chunks, state.Size)
+			}
+			return t.put(ctx, &u, chunk, offset, state.Size, chunks > 1)
+		})
+		if err != nil {
+			return "", err
+		}
+		state.Offset = offset + int64(n)
+		if err := state.Save(); err != nil {
+			return "", err
+		}
+		simplelog.Infof("uploaded chunk %v of %v of %v", index+1, chunks, file)
+	}
+	return u.String(), nil
+}
+
+func (t *httpTarget) put(ctx context.Context, u *url.URL, chunk []byte, offset, size int64, ranged bool) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u.String(), bytes.NewReader(chunk))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	if ranged {
+		req.Header.Set("Content-Range", fmt.Sprintf("bytes %v-%v/%v", offset, offset+int64(len(chunk))-1, size))
+	}
+	return t.send(req)
+}
+
+// post sends the chunk as the file field of a form, the field names are the ones commonly used by
+// chunked upload endpoints
+func (t *httpTarget) post(ctx context.Context, u *url.URL, name string, chunk []byte, offset, index, chunks, size int64) error {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	fields := [][2]string{
+		{"fileName", name},
+		{"chunkIndex", strconv.FormatInt(index, 10)},
+		{"totalChunks", strconv.FormatInt(chunks, 10)},
+		{"chunkOffset", strconv.FormatInt(offset, 10)},
+		{"totalSize", strconv.FormatInt(size, 10)},
+	}
+	for _, field := range fields {
+		if err := w.WriteField(field[0], field[1]); err != nil {
+			return err
+		}
+	}
+	part, err := w.CreateFormFile("file", name)
+	if err != nil {
+		return err
+	}
+	if _, err := part.Write(chunk); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	return t.send(req)
+}
+
+func (t *httpTarget) send(req *http.Request) error {
+	for name, values := range t.headers {
+		for _, v := range values {
+			req.Header.Add(name, v)
+		}
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if err != nil {
+		simplelog.Debugf("unable to read response of %v %v: %v", req.Method, req.URL.Path, err)
+	}
+	// 308 is how resumable upload endpoints confirm a chunk that is not the last one
+	if (resp.StatusCode >= 200 && resp.StatusCode < 300) || resp.StatusCode == http.StatusPermanentRedirect {
+		return nil
+	}
+	err = fmt.Errorf("%v %v returned %v: %v", req.Method, req.URL.Path, resp.Status, strutils.LimitString(string(respBody), 500))
+	if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusRequestTimeout {
+		return err
+	}
+	return permanentErr{err}
+}
@@ -0,0 +1,410 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// package upload sends the finished diagnostic archive to S3 compatible storage, SFTP or an HTTP endpoint
+package upload
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dremio/dremio-diagnostic-collector/pkg/simplelog"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/strutils"
+)
+
+const (
+	// AccessKeyEnv, SecretKeyEnv and SessionTokenEnv are the standard AWS variables for the credentials
+	AccessKeyEnv    = "AWS_ACCESS_KEY_ID"
+	SecretKeyEnv    = "AWS_SECRET_ACCESS_KEY" // #nosec G101
+	SessionTokenEnv = "AWS_SESSION_TOKEN"     // #nosec G101
+	RegionEnv       = "AWS_REGION"
+	defaultS3Region = "us-east-1"
+)
+
+// s3Target uploads with the S3 REST API signed with signature version 4. Files bigger than one chunk
+// use a multipart upload whose id and finished parts are kept in the state so it can be resumed
+type s3Target struct {
+	destination  string
+	bucket       string
+	prefix       string
+	endpoint     *url.URL
+	pathStyle    bool
+	region       string
+	accessKey    string
+	secretKey    string
+	sessionToken string
+	chunkBytes   int64
+	client       *http.Client
+	now          func() time.Time
+}
+
+func newS3Target(args Args, u *url.URL, chunkBytes int64) (*s3Target, error) {
+	accessKey := os.Getenv(AccessKeyEnv)
+	secretKey := os.Getenv(SecretKeyEnv)
+	if accessKey == "" || secretKey == "" {
+		return nil, fmt.Errorf("s3 uploads need %v and %v to be set", AccessKeyEnv, SecretKeyEnv)
+	}
+	region := args.S3Region
+	if region == "" {
+		region = os.Getenv(RegionEnv)
+	}
+	if region == "" {
+		region = defaultS3Region
+	}
+	t := &s3Target{
+		destination:  args.URL,
+		bucket:       u.Host,
+		prefix:       strings.TrimPrefix(u.Path, "/"),
+		region:       region,
+		accessKey:    accessKey,
+		secretKey:    secretKey,
+		sessionToken: os.Getenv(SessionTokenEnv),
+		chunkBytes:   chunkBytes,
+		client:       &http.Client{Timeout: 10 * time.Minute},
+		now:          time.Now,
+	}
+	if args.S3Endpoint != "" {
+		// S3 compatible storage such as MinIO is addressed by path since the bucket is rarely in DNS
+		endpoint, err := url.Parse(args.S3Endpoint)
+		if err != nil {
+			return nil, err
+		}
+		t.endpoint = endpoint
+		t.pathStyle = true
+	} else {
+		t.endpoint = &url.URL{Scheme: "https", Host: fmt.Sprintf("%v.s3.%v.amazonaws.com", t.bucket, region)}
+	}
+	return t, nil
+}
+
+func (t *s3Target) Destination() string {
+	return t.destination
+}
+
+func (t *s3Target) Prefix() string {
+	return t.prefix
+}
+
+func (t *s3Target) objectURL(key string, query url.Values) *url.URL {
+	u := *t.endpoint
+	if t.pathStyle {
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/" + t.bucket + "/" + key
+	} else {
+		u.Path = "/" + key
+	}
+	u.RawQuery = query.Encode()
+	return &u
+}
+
+func (t *s3Target) Upload(ctx context.Context, file, key string, state *State) (string, error) {
+	f, err := os.Open(filepath.Clean(file))
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if err := f.Close(); err != nil {
+			simplelog.Debugf("optional close of %v failed %v", file, err)
+		}
+	}()
+	location := fmt.Sprintf("s3://%v/%v", t.bucket, key)
+	if state.Size <= t.chunkBytes {
+		body := make([]byte, state.Size)
+		if _, err := io.ReadFull(f, body); err != nil {
+			return "", err
+		}
+		err := withRetry(ctx, file, func() error {
+			_, err := t.do(ctx, http.MethodPut, t.objectURL(key, nil), body)
+			return err
+		})
+		return location, err
+	}
+	if state.started() && state.ChunkBytes != t.chunkBytes {
+		simplelog.Infof("the chunk size changed since the upload of %v started, starting over", file)
+		state.reset(t.chunkBytes)
+	}
+	state.ChunkBytes = t.chunkBytes
+	if err := t.uploadParts(ctx, f, key, state); err != nil {
+		var noSuchUpload noSuchUploadErr
+		if !errors.As(err, &noSuchUpload) {
+			return "", err
+		}
+		// the multipart upload was aborted or expired on the server so the parts are gone
+		simplelog.Warningf("multipart upload %v of %v no longer exists, starting over", state.UploadID, file)
+		state.reset(t.chunkBytes)
+		if err := t.uploadParts(ctx, f, key, state); err != nil {
+			return "", err
+		}
+	}
+	return location, nil
+}
+
+func (t *s3Target) uploadParts(ctx context.Context, f *os.File, key string, state *State) error {
+	if state.UploadID == "" {
+		var initiate struct {
+			UploadID string `xml:"UploadId"`
+		}
+		err := withRetry(ctx, "create multipart upload", func() error {
+			body, err := t.do(ctx, http.MethodPost, t.objectURL(key, url.Values{"uploads": {""}}), nil)
+			if err != nil {
+				return err
+			}
+			return xml.Unmarshal(body, &initiate)
+		})
+		if err != nil {
+			return err
+		}
+		if initiate.UploadID == "" {
+			return errors.New("no UploadId in the response to create multipart upload")
+		}
+		state.UploadID = initiate.UploadID
+		if err := state.Save(); err != nil {
+			return err
+		}
+	}
+	parts := int(chunkCount(state.Size, t.chunkBytes))
+	buf := make([]byte, t.chunkBytes)
+	for number := len(state.Parts) + 1; number <= parts; number++ {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		offset := int64(number-1) * t.chunkBytes
+		n, err := f.ReadAt(buf, offset)
+		if err != nil && err != io.EOF {
+			return err
+		}
+		chunk := buf[:n]
+		query := url.Values{"partNumber": {strconv.Itoa(number)}, "uploadId": {state.UploadID}}
+		var etag string
+		err = withRetry(ctx, fmt.Sprintf("part %v of %v", number, parts), func() error {
+			resp, err := t.request(ctx, http.MethodPut, t.objectURL(key, query), chunk)
+			if err != nil {
+				return err
+			}
+			etag = resp.Header.Get("ETag")
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		state.Parts = append(state.Parts, Part{Number: number, ETag: etag})
+		state.Offset = offset + int64(n)
+		if err := state.Save(); err != nil {
+			return err
+		}
+		simplelog.Infof("uploaded part %v of %v of s3://%v/%v", number, parts, t.bucket, key)
+	}
+	return t.complete(ctx, key, state)
+}
+
+func (t *s3Target) complete(ctx context.Context, key string, state *State) error {
+	type completedPart struct {
+		PartNumber int    `xml:"PartNumber"`
+		ETag       string `xml:"ETag"`
+	}
+	complete := struct {
+		XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+		Parts   []completedPart `xml:"Part"`
+	}{}
+	sort.Slice(state.Parts, func(i, j int) bool { return state.Parts[i].Number < state.Parts[j].Number })
+	for _, p := range state.Parts {
+		complete.Parts = append(complete.Parts, completedPart{PartNumber: p.Number, ETag: p.ETag})
+	}
+	body, err := xml.Marshal(complete)
+	if err != nil {
+		return err
+	}
+	return withRetry(ctx, "complete multipart upload", func() error {
+		respBody, err := t.do(ctx, http.MethodPost, t.objectURL(key, url.Values{"uploadId": {state.UploadID}}), body)
+		if err != nil {
+			return err
+		}
+		// S3 can answer 200 and still report an error in the body
+		if bytes.Contains(respBody, []byte("<Error>")) {
+			return fmt.Errorf("unable to complete multipart upload: %v", strutils.LimitString(string(respBody), 500))
+		}
+		return nil
+	})
+}
+
+type noSuchUploadErr struct {
+	err error
+}
+
+func (e noSuchUploadErr) Error() string {
+	return e.err.Error()
+}
+
+func (t *s3Target) do(ctx context.Context, method string, u *url.URL, body []byte) ([]byte, error) {
+	resp, err := t.request(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	return resp.body, nil
+}
+
+type s3Response struct {
+	Header http.Header
+	body   []byte
+}
+
+// request sends a signed request and reads the whole response, errors from S3 are turned into
+// permanent errors when retrying cannot help
+func (t *s3Target) request(ctx context.Context, method string, u *url.URL, body []byte) (*s3Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = int64(len(body))
+	t.sign(req, body)
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return &s3Response{Header: resp.Header, body: respBody}, nil
+	}
+	err = fmt.Errorf("%v %v returned %v: %v", method, u.Path, resp.Status, strutils.LimitString(string(respBody), 500))
+	switch {
+	case bytes.Contains(respBody, []byte("<Code>NoSuchUpload</Code>")):
+		return nil, permanentErr{noSuchUploadErr{err}}
+	case resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusRequestTimeout:
+		return nil, err
+	default:
+		return nil, permanentErr{err}
+	}
+}
+
+// sign adds the signature version 4 Authorization header
+// https://docs.aws.amazon.com/AmazonS3/latest/API/sig-v4-header-based-auth.html
+func (t *s3Target) sign(req *http.Request, body []byte) {
+	now := t.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	payloadHash := sha256.Sum256(body)
+	payload := hex.EncodeToString(payloadHash[:])
+
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payload)
+	if t.sessionToken != "" {
+		req.Header.Set("x-amz-security-token", t.sessionToken)
+	}
+	headers := map[string]string{"host": req.URL.Host}
+	for name := range req.Header {
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, "x-amz-") || lower == "content-type" {
+			headers[lower] = strings.TrimSpace(req.Header.Get(name))
+		}
+	}
+	var names []string
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalPath(req.URL.EscapedPath()),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payload,
+	}, "\n")
+	scope := fmt.Sprintf("%v/%v/s3/aws4_request", day, t.region)
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, hex.EncodeToString(requestHash[:])}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+t.secretKey), day)
+	key = hmacSHA256(key, t.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%v/%v, SignedHeaders=%v, Signature=%v", t.accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// canonicalPath encodes every path segment the way S3 expects, which is stricter than url.PathEscape
+func canonicalPath(escaped string) string {
+	if escaped == "" {
+		return "/"
+	}
+	segments := strings.Split(escaped, "/")
+	for i, s := range segments {
+		unescaped, err := url.PathUnescape(s)
+		if err != nil {
+			unescaped = s
+		}
+		segments[i] = awsEscape(unescaped)
+	}
+	return strings.Join(segments, "/")
+}
+
+func canonicalQuery(query url.Values) string {
+	var keys []string
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var pairs []string
+	for _, k := range keys {
+		values := append([]string{}, query[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			pairs = append(pairs, awsEscape(k)+"="+awsEscape(v))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// awsEscape percent encodes everything but the unreserved characters of RFC 3986
+func awsEscape(s string) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') || c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,175 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// package upload sends the finished diagnostic archive to S3 compatible storage, SFTP or an HTTP endpoint
+package upload
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/pkg/sftp"
+	gossh "golang.org/x/crypto/ssh"
+
+	"github.com/dremio/dremio-diagnostic-collector/pkg/simplelog"
+)
+
+// sftpTarget writes to <remotePath>.part and renames it when every byte is there. The size of the
+// .part file is where an interrupted upload continues from
+type sftpTarget struct {
+	destination string
+	user        string
+	addr        string
+	prefix      string
+	chunkBytes  int64
+	dial        func() (*sftp.Client, io.Closer, error)
+}
+
+func newSFTPTarget(args Args, u *url.URL, chunkBytes int64) (*sftpTarget, error) {
+	if args.SSHConfig == nil {
+		return nil, errors.New("sftp uploads need an ssh configuration")
+	}
+	t := &sftpTarget{
+		destination: args.URL,
+		user:        u.User.Username(),
+		addr:        u.Host,
+		prefix:      u.Path,
+		chunkBytes:  chunkBytes,
+	}
+	if u.Port() == "" {
+		t.addr = net.JoinHostPort(u.Hostname(), "22")
+	}
+	if t.prefix == "" {
+		t.prefix = "/"
+	}
+	t.dial = func() (*sftp.Client, io.Closer, error) {
+		config, err := args.SSHConfig(t.user)
+		if err != nil {
+			return nil, nil, err
+		}
+		conn, err := gossh.Dial("tcp", t.addr, config)
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to connect to %v: %w", t.addr, err)
+		}
+		client, err := sftp.NewClient(conn)
+		if err != nil {
+			if closeErr := conn.Close(); closeErr != nil {
+				simplelog.Debugf("optional close of ssh connection to %v failed %v", t.addr, closeErr)
+			}
+			return nil, nil, fmt.Errorf("unable to start sftp on %v: %w", t.addr, err)
+		}
+		return client, conn, nil
+	}
+	return t, nil
+}
+
+func (t *sftpTarget) Destination() string {
+	return t.destination
+}
+
+func (t *sftpTarget) Prefix() string {
+	return t.prefix
+}
+
+func (t *sftpTarget) Upload(ctx context.Context, file, remote string, state *State) (string, error) {
+	client, conn, err := t.dial()
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if err := client.Close(); err != nil {
+			simplelog.Debugf("optional close of sftp client failed %v", err)
+		}
+		if conn != nil {
+			if err := conn.Close(); err != nil {
+				simplelog.Debugf("optional close of ssh connection failed %v", err)
+			}
+		}
+	}()
+	if err := client.MkdirAll(path.Dir(remote)); err != nil {
+		return "", fmt.Errorf("unable to create %v: %w", path.Dir(remote), err)
+	}
+	local, err := os.Open(filepath.Clean(file))
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if err := local.Close(); err != nil {
+			simplelog.Debugf("optional close of %v failed %v", file, err)
+		}
+	}()
+
+	partial := remote + ".part"
+	var offset int64
+	if info, err := client.Stat(partial); err == nil && info.Size() <= state.Size {
+		offset = info.Size()
+	}
+	flags := os.O_WRONLY | os.O_CREATE
+	if offset == 0 {
+		flags |= os.O_TRUNC
+	} else {
+		simplelog.Infof("%v already has %v of %v bytes, continuing from there", partial, offset, state.Size)
+	}
+	out, err := client.OpenFile(partial, flags)
+	if err != nil {
+		return "", fmt.Errorf("unable to open %v: %w", partial, err)
+	}
+	defer func() {
+		if err := out.Close(); err != nil {
+			simplelog.Debugf("optional close of %v failed %v", partial, err)
+		}
+	}()
+	if _, err := out.Seek(offset, io.SeekStart); err != nil {
+		return "", err
+	}
+	buf := make([]byte, t.chunkBytes)
+	for offset < state.Size {
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		n, err := local.ReadAt(buf, offset)
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+		if _, err := out.Write(buf[:n]); err != nil {
+			return "", fmt.Errorf("unable to write %v at %v: %w", partial, offset, err)
+		}
+		offset += int64(n)
+		state.Offset = offset
+		if err := state.Save(); err != nil {
+			return "", err
+		}
+		simplelog.Debugf("sent %v of %v bytes to %v", offset, state.Size, partial)
+	}
+	if err := out.Close(); err != nil {
+		return "", fmt.Errorf("unable to close %v: %w", partial, err)
+	}
+	// an earlier upload with the same name is replaced
+	if err := client.PosixRename(partial, remote); err != nil {
+		if err := client.Remove(remote); err != nil && !errors.Is(err, os.ErrNotExist) {
+			simplelog.Debugf("unable to remove %v before renaming: %v", remote, err)
+		}
+		if err := client.Rename(partial, remote); err != nil {
+			return "", fmt.Errorf("unable to rename %v to %v: %w", partial, remote, err)
+		}
+	}
+	return (&url.URL{Scheme: "sftp", User: url.User(t.user), Host: t.addr, Path: remote}).String(), nil
+}
@@ -0,0 +1,106 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// package upload sends the finished diagnostic archive to S3 compatible storage, SFTP or an HTTP endpoint
+package upload
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/dremio/dremio-diagnostic-collector/pkg/simplelog"
+)
+
+// StateFile is kept next to the file being uploaded until the upload is done
+func StateFile(file string) string {
+	return file + ".upload.json"
+}
+
+// Part is a finished part of an S3 multipart upload
+type Part struct {
+	Number int    `json:"number"`
+	ETag   string `json:"etag"`
+}
+
+// State is what was sent of a file, it only applies to the same file going to the same destination
+type State struct {
+	Destination string    `json:"destination"`
+	Size        int64     `json:"size"`
+	ModTime     time.Time `json:"modTime"`
+	ChunkBytes  int64     `json:"chunkBytes"`
+	// Offset is how many bytes the destination has confirmed
+	Offset   int64  `json:"offset"`
+	UploadID string `json:"uploadId,omitempty"`
+	Parts    []Part `json:"parts,omitempty"`
+	path     string
+}
+
+// loadState reads the state of an earlier upload of file, a state for another destination or an
+// older version of the file is thrown away
+func loadState(file, destination string, info os.FileInfo) (*State, error) {
+	fresh := &State{Destination: destination, Size: info.Size(), ModTime: info.ModTime().UTC(), path: StateFile(file)}
+	b, err := os.ReadFile(filepath.Clean(fresh.path))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fresh, nil
+		}
+		return nil, fmt.Errorf("unable to read upload state %v: %w", fresh.path, err)
+	}
+	var state State
+	if err := json.Unmarshal(b, &state); err != nil {
+		simplelog.Warningf("ignoring unreadable upload state %v: %v", fresh.path, err)
+		return fresh, nil
+	}
+	if state.Destination != destination || state.Size != info.Size() || !state.ModTime.Equal(fresh.ModTime) {
+		simplelog.Infof("upload state %v is for another file or destination, starting over", fresh.path)
+		return fresh, nil
+	}
+	state.path = fresh.path
+	return &state, nil
+}
+
+func (s *State) started() bool {
+	return s.Offset > 0 || s.UploadID != ""
+}
+
+// reset starts over, for example when the destination no longer knows about the upload
+func (s *State) reset(chunkBytes int64) {
+	s.ChunkBytes = chunkBytes
+	s.Offset = 0
+	s.UploadID = ""
+	s.Parts = nil
+}
+
+// Save writes the state so a later run can resume from it
+func (s *State) Save() error {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(s.path, b, 0600); err != nil {
+		return fmt.Errorf("unable to write upload state %v: %w", s.path, err)
+	}
+	return nil
+}
+
+func (s *State) remove() error {
+	if err := os.Remove(s.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,270 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// package upload sends the finished diagnostic archive to S3 compatible storage, SFTP or an HTTP endpoint
+package upload
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+	gossh "golang.org/x/crypto/ssh"
+
+	"github.com/dremio/dremio-diagnostic-collector/pkg/archive"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/consoleprint"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/simplelog"
+)
+
+const (
+	// DefaultChunkMB is the size of every chunk sent, S3 needs at least 5 MB for all but the last part
+	DefaultChunkMB = 16
+	// HTTPModePut sends each chunk as a PUT with a Content-Range header
+	HTTPModePut = "put"
+	// HTTPModeMultipart posts each chunk as a multipart/form-data file field
+	HTTPModeMultipart = "multipart"
+	// minS3PartBytes is the smallest part S3 accepts in a multipart upload
+	minS3PartBytes = 5 * 1024 * 1024
+	// chunkAttempts is how often a chunk is sent before the upload is stopped and left to be resumed
+	chunkAttempts = 3
+)
+
+// Args configure the upload target, URL is where the archive goes:
+// s3://bucket/prefix/, sftp://user@host:port/dir/ or http(s)://host/path
+type Args struct {
+	URL        string
+	ChunkMB    int64
+	S3Endpoint string
+	S3Region   string
+	HTTPMode   string
+	// Headers are sent with every HTTP request as "Name: value", for example an Authorization header
+	Headers []string
+	// SSHConfig returns the client config used to connect to an sftp server as user
+	SSHConfig func(user string) (*gossh.ClientConfig, error)
+}
+
+// AddFlags registers the upload flags, they are shared by ddc and ddc upload
+func AddFlags(flags *pflag.FlagSet, args *Args) {
+	flags.StringVar(&args.URL, "upload-to", "", "upload the archive when it is written: s3://bucket/prefix/ (credentials come from AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN), sftp://user@host:port/dir/ or http(s)://host/path. A path ending in / gets the archive name appended")
+	flags.Int64Var(&args.ChunkMB, "upload-chunk-mb", DefaultChunkMB, "size in MB of each chunk sent, an interrupted upload resumes from the last chunk that was sent")
+	flags.StringVar(&args.S3Endpoint, "upload-s3-endpoint", "", "endpoint of S3 compatible storage such as MinIO, for example http://localhost:9000, empty uses AWS S3")
+	flags.StringVar(&args.S3Region, "upload-s3-region", "", "region of the S3 bucket, defaults to AWS_REGION and then us-east-1")
+	flags.StringVar(&args.HTTPMode, "upload-http-mode", HTTPModePut, "for http(s) uploads: 'put' sends the chunks as PUT requests with a Content-Range header, 'multipart' posts them as multipart/form-data")
+	flags.StringArrayVar(&args.Headers, "upload-header", nil, "header sent with every http(s) upload request as 'Name: value', can be repeated")
+}
+
+// Target stores files at one destination
+type Target interface {
+	// Destination is the --upload-to value the target was made from
+	Destination() string
+	// Prefix is the path or key in the destination that files are stored under, see remotePath
+	Prefix() string
+	// Upload sends file to remotePath and returns its url, state is saved after every chunk so an
+	// interrupted upload continues where it stopped
+	Upload(ctx context.Context, file, remotePath string, state *State) (string, error)
+}
+
+// Result is recorded in the summary.json next to the archive
+type Result struct {
+	Target          string    `json:"target"`
+	Status          string    `json:"status"`
+	URLs            []string  `json:"urls"`
+	Bytes           int64     `json:"bytes"`
+	Resumed         bool      `json:"resumed,omitempty"`
+	Error           string    `json:"error,omitempty"`
+	StartTimeUTC    time.Time `json:"startTimeUTC"`
+	EndTimeUTC      time.Time `json:"endTimeUTC"`
+	DurationSeconds int64     `json:"durationSeconds"`
+}
+
+const (
+	StatusUploaded = "uploaded"
+	StatusFailed   = "failed"
+)
+
+// Validate checks the args without connecting to anything
+func Validate(args Args) error {
+	u, err := url.Parse(args.URL)
+	if err != nil {
+		return fmt.Errorf("invalid --upload-to '%v': %w", args.URL, err)
+	}
+	if args.ChunkMB <= 0 {
+		return fmt.Errorf("--upload-chunk-mb must be more than 0 but was %v", args.ChunkMB)
+	}
+	switch u.Scheme {
+	case "s3":
+		if u.Host == "" {
+			return fmt.Errorf("invalid --upload-to '%v', the bucket is missing, use s3://bucket/prefix/", args.URL)
+		}
+		if args.ChunkMB*1024*1024 < minS3PartBytes {
+			return fmt.Errorf("--upload-chunk-mb must be at least 5 for s3 uploads but was %v", args.ChunkMB)
+		}
+		if args.S3Endpoint != "" {
+			if _, err := url.Parse(args.S3Endpoint); err != nil {
+				return fmt.Errorf("invalid --upload-s3-endpoint '%v': %w", args.S3Endpoint, err)
+			}
+		}
+	case "sftp":
+		if u.Host == "" || u.User.Username() == "" {
+			return fmt.Errorf("invalid --upload-to '%v', use sftp://user@host:port/dir/", args.URL)
+		}
+	case "http", "https":
+		if u.Host == "" {
+			return fmt.Errorf("invalid --upload-to '%v', the host is missing", args.URL)
+		}
+		if args.HTTPMode != "" && args.HTTPMode != HTTPModePut && args.HTTPMode != HTTPModeMultipart {
+			return fmt.Errorf("--upload-http-mode must be '%v' or '%v' but was '%v'", HTTPModePut, HTTPModeMultipart, args.HTTPMode)
+		}
+		for _, h := range args.Headers {
+			if _, _, ok := strings.Cut(h, ":"); !ok {
+				return fmt.Errorf("invalid --upload-header '%v', use 'Name: value'", h)
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported --upload-to '%v', it must start with s3://, sftp://, http:// or https://", args.URL)
+	}
+	return nil
+}
+
+// NewTarget picks the target from the scheme of args.URL
+func NewTarget(args Args) (Target, error) {
+	if err := Validate(args); err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(args.URL)
+	if err != nil {
+		return nil, err
+	}
+	chunkBytes := args.ChunkMB * 1024 * 1024
+	switch u.Scheme {
+	case "s3":
+		return newS3Target(args, u, chunkBytes)
+	case "sftp":
+		return newSFTPTarget(args, u, chunkBytes)
+	default:
+		return newHTTPTarget(args, u, chunkBytes), nil
+	}
+}
+
+// remotePath is the name the file is stored under, a prefix ending in / or an empty prefix gets the file
+// name appended and the volumes of a split archive keep their number
+func remotePath(prefix, file string) string {
+	if prefix == "" || strings.HasSuffix(prefix, "/") {
+		return prefix + filepath.Base(file)
+	}
+	return prefix + archive.VolumeSuffix(file)
+}
+
+// Files uploads every file, volumes of a split archive in order. Each file keeps a state file next to it
+// until it is uploaded so running again resumes instead of starting over
+func Files(ctx context.Context, target Target, files []string) (result Result, err error) {
+	result = Result{
+		Target:       target.Destination(),
+		Status:       StatusFailed,
+		URLs:         []string{},
+		StartTimeUTC: time.Now().UTC(),
+	}
+	defer func() {
+		result.EndTimeUTC = time.Now().UTC()
+		result.DurationSeconds = int64(result.EndTimeUTC.Sub(result.StartTimeUTC).Seconds())
+	}()
+	for i, file := range files {
+		if ctx.Err() != nil {
+			result.Error = ctx.Err().Error()
+			return result, ctx.Err()
+		}
+		info, err := os.Stat(file)
+		if err != nil {
+			result.Error = err.Error()
+			return result, err
+		}
+		dest := remotePath(target.Prefix(), file)
+		state, err := loadState(file, target.Destination(), info)
+		if err != nil {
+			result.Error = err.Error()
+			return result, err
+		}
+		if state.started() {
+			result.Resumed = true
+			simplelog.Infof("resuming upload of %v to %v", file, target.Destination())
+		}
+		consoleprint.UpdateUpload(fmt.Sprintf("uploading %v (%v/%v) to %v", filepath.Base(file), i+1, len(files), target.Destination()))
+		u, err := target.Upload(ctx, file, dest, state)
+		if err != nil {
+			err = fmt.Errorf("unable to upload %v to %v: %w", file, target.Destination(), err)
+			result.Error = err.Error()
+			return result, err
+		}
+		if err := state.remove(); err != nil {
+			simplelog.Warningf("unable to remove upload state %v: %v", state.path, err)
+		}
+		simplelog.Infof("uploaded %v to %v", file, u)
+		result.URLs = append(result.URLs, u)
+		result.Bytes += info.Size()
+	}
+	result.Status = StatusUploaded
+	consoleprint.UpdateUpload("uploaded to " + strings.Join(result.URLs, ", "))
+	return result, nil
+}
+
+// withRetry runs send until it works, chunkAttempts times at most with a growing pause in between
+func withRetry(ctx context.Context, what string, send func() error) error {
+	var err error
+	for attempt := 1; attempt <= chunkAttempts; attempt++ {
+		if err = send(); err == nil {
+			return nil
+		}
+		var permanent permanentErr
+		if errors.As(err, &permanent) || attempt == chunkAttempts {
+			break
+		}
+		simplelog.Warningf("attempt %v of %v to send %v failed, retrying: %v", attempt, chunkAttempts, what, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(attempt) * retryPause):
+		}
+	}
+	return err
+}
+
+// retryPause is multiplied by the attempt number
+var retryPause = 2 * time.Second
+
+// permanentErr is not retried since sending the same request again will fail the same way
+type permanentErr struct {
+	err error
+}
+
+func (p permanentErr) Error() string {
+	return p.err.Error()
+}
+
+func (p permanentErr) Unwrap() error {
+	return p.err
+}
+
+// chunkCount is the number of chunks of chunkBytes needed for size, an empty file is still one chunk
+func chunkCount(size, chunkBytes int64) int64 {
+	if size == 0 {
+		return 1
+	}
+	return (size + chunkBytes - 1) / chunkBytes
+}
@@ -21,9 +21,16 @@ go build -ldflags "$LDFLAGS" -o .\bin\ddc
 
 # Use Compress-Archive to create zip file and then move it
 Compress-Archive -Path .\bin\ddc -DestinationPath .\bin\ddc.zip
-Move-Item -Force -Path  .\bin\ddc.zip -Destination .\cmd\root\ddcbinary\output\ddc.zip
 Remove-Item -Path .\bin\ddc
 
+# Both embedded builds are made before either zip is moved into output so they do not embed each other
+$env:GOARCH="arm64"
+go build -ldflags "$LDFLAGS" -o .\bin\ddc
+Compress-Archive -Path .\bin\ddc -DestinationPath .\bin\ddc-embedded-arm64.zip
+Remove-Item -Path .\bin\ddc
+Move-Item -Force -Path  .\bin\ddc.zip -Destination .\cmd\root\ddcbinary\output\ddc.zip
+Move-Item -Force -Path  .\bin\ddc-embedded-arm64.zip -Destination .\cmd\root\ddcbinary\output\ddc-linux-arm64.zip
+
 $env:GOOS="windows"
 $env:GOARCH="amd64"
 # Build again and copy default-ddc.yaml
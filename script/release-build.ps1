@@ -25,10 +25,20 @@ go build -ldflags "$LDFLAGS" -o ./bin/ddc
 Copy-Item -Path ./default-ddc.yaml -Destination ./bin/ddc.yaml
 Compress-Archive -Path ./bin/ddc -DestinationPath ./bin/ddc.zip
 Remove-Item ./bin/ddc
+
+Write-Output "Building embedded binary linux-arm64"
+Get-Date -Format "HH:mm:ss"
+# Both embedded builds are made before either zip is moved into output so they do not embed each other
+$env:GOARCH="arm64"
+go build -ldflags "$LDFLAGS" -o ./bin/ddc
+Compress-Archive -Path ./bin/ddc -DestinationPath ./bin/ddc-embedded-arm64.zip
+Remove-Item ./bin/ddc
 Move-Item -Force -Path ./bin/ddc.zip -Destination ./cmd/root/ddcbinary/output/ddc.zip
+Move-Item -Force -Path ./bin/ddc-embedded-arm64.zip -Destination ./cmd/root/ddcbinary/output/ddc-linux-arm64.zip
 
 Write-Output "Building linux-amd64"
 Get-Date -Format "HH:mm:ss"
+$env:GOARCH="amd64"
 go build -ldflags "$LDFLAGS" -o ./bin/ddc
 Compress-Archive -Path ./bin/ddc, ./bin/ddc.yaml -DestinationPath ./bin/ddc-linux-amd64.zip
 